@@ -20,7 +20,9 @@ import (
 	"io/ioutil"
 	"labix.org/v2/mgo/bson"
 	"net/http"
+	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -57,6 +59,9 @@ func CloneRepositoryHandler(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return &errors.Http{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", instance.Name)}
 	}
+	if err = checkDeployMaintenance(&instance, r); err != nil {
+		return err
+	}
 	err = write(&logWriter, []byte("\n ---> Tsuru receiving push\n"))
 	if err != nil {
 		return err
@@ -77,11 +82,7 @@ func CloneRepositoryHandler(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	err = instance.InstallDeps(&logWriter)
-	if err != nil {
-		return err
-	}
-	err = instance.Restart(&logWriter)
+	err = instance.Deploy(&logWriter)
 	if err != nil {
 		return err
 	}
@@ -100,25 +101,28 @@ func AppIsAvaliableHandler(w http.ResponseWriter, r *http.Request) error {
 	if app.State != "started" {
 		return fmt.Errorf("App must be started to receive pushs, but it is %q.", app.State)
 	}
+	if err = checkDeployMaintenance(&app, r); err != nil {
+		return err
+	}
 	w.WriteHeader(http.StatusOK)
 	return nil
 }
 
+// AppDelete starts the removal of the app, returning the id of the operation
+// that tracks the removal.
 func AppDelete(w http.ResponseWriter, r *http.Request, u *auth.User) error {
-	app, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
 	if err != nil {
 		return err
 	}
-	gUrl := repository.GitServerUri()
-	if err := (&gandalf.Client{Endpoint: gUrl}).RemoveRepository(app.Name); err != nil {
-		log.Printf("Got error while removing repository from gandalf: %s", err.Error())
-		return &errors.Http{Code: http.StatusInternalServerError, Message: "Could not remove app's repository at git server. Aborting..."}
+	op, err := a.StartRemove(u.Email)
+	if err == app.ErrRemovalPending {
+		return &errors.Http{Code: http.StatusConflict, Message: err.Error()}
 	}
-	if err := app.Destroy(); err != nil {
+	if err != nil {
 		return err
 	}
-	fmt.Fprint(w, "success")
-	return nil
+	return writeOperation(w, map[string]string{"operation": op.Id})
 }
 
 func getTeamNames(u *auth.User) ([]string, error) {
@@ -129,8 +133,30 @@ func getTeamNames(u *auth.User) ([]string, error) {
 	return auth.GetTeamsNames(teams), nil
 }
 
+// AppList lists the apps the user has access to. The apps may be filtered by
+// the parameters name (a regular expression), framework, state, team and tag,
+// which may be given more than once. The parameters limit and page paginate
+// the result.
 func AppList(w http.ResponseWriter, r *http.Request, u *auth.User) error {
-	apps, err := app.List(u)
+	query := r.URL.Query()
+	filter := app.Filter{
+		Name:      query.Get("name"),
+		Framework: query.Get("framework"),
+		State:     query.Get("state"),
+		Team:      query.Get("team"),
+		Tags:      query["tag"],
+	}
+	var err error
+	if filter.Limit, err = intParam(query, "limit"); err != nil {
+		return err
+	}
+	if filter.Page, err = intParam(query, "page"); err != nil {
+		return err
+	}
+	apps, err := app.List(u, &filter)
+	if e, ok := err.(*app.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
 	if err != nil {
 		return err
 	}
@@ -141,6 +167,40 @@ func AppList(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	return json.NewEncoder(w).Encode(apps)
 }
 
+// intParam returns the value of an integer parameter of the query, or zero if
+// it's missing.
+func intParam(query url.Values, name string) (int, error) {
+	v := query.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, &errors.Http{Code: http.StatusBadRequest, Message: fmt.Sprintf("Invalid %s: %q.", name, v)}
+	}
+	return n, nil
+}
+
+// SetMetadataHandler changes the metadata of the app. The body is a JSON object
+// with the fields to change, the others are kept:
+//
+//	{"description": "The payments API", "contact": "payments@company.com", "tags": ["api"]}
+func SetMetadataHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	m := a.Metadata()
+	if err = json.NewDecoder(r.Body).Decode(&m); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in the body of the request."}
+	}
+	err = a.SetMetadata(m)
+	if e, ok := err.(*app.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
 func AppInfo(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	app, err := getAppOrError(r.URL.Query().Get(":name"), u)
 	if err != nil {
@@ -159,21 +219,26 @@ func createAppHelper(instance *app.App, u *auth.User, units uint) ([]byte, error
 		return nil, &errors.Http{Code: http.StatusForbidden, Message: msg}
 	}
 	instance.SetTeams(teams)
-	err = app.CreateApp(instance, units)
+	instance.Owner = u.Email
+	op, err := app.StartCreateApp(instance, units, u.Email)
 	if err != nil {
 		log.Printf("Got error while creating app: %s", err)
 		if e, ok := err.(*app.ValidationError); ok {
 			return nil, &errors.Http{Code: http.StatusPreconditionFailed, Message: e.Message}
 		}
-		if strings.Contains(err.Error(), "key error") {
+		if e, ok := err.(*app.QuotaExceededError); ok {
+			return nil, &errors.Http{Code: http.StatusForbidden, Message: e.Error()}
+		}
+		if err == app.ErrAppAlreadyExists {
 			msg := fmt.Sprintf(`There is already an app named "%s".`, instance.Name)
 			return nil, &errors.Http{Code: http.StatusConflict, Message: msg}
 		}
 		return nil, err
 	}
 	msg := map[string]string{
-		"status":         "success",
+		"status":         "pending",
 		"repository_url": repository.GetUrl(instance.Name),
+		"operation":      op.Id,
 	}
 	return json.Marshal(msg)
 }
@@ -182,6 +247,7 @@ type jsonApp struct {
 	Name      string
 	Framework string
 	Units     uint
+	Plan      string
 }
 
 func CreateAppHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
@@ -197,6 +263,7 @@ func CreateAppHandler(w http.ResponseWriter, r *http.Request, u *auth.User) erro
 	}
 	app.Name = japp.Name
 	app.Framework = japp.Framework
+	app.Plan.Name = japp.Plan
 	if japp.Units == 0 {
 		japp.Units = 1
 	}
@@ -204,6 +271,7 @@ func CreateAppHandler(w http.ResponseWriter, r *http.Request, u *auth.User) erro
 	if err != nil {
 		return err
 	}
+	w.WriteHeader(http.StatusAccepted)
 	fmt.Fprint(w, string(jsonMsg))
 	return nil
 }
@@ -238,11 +306,21 @@ func AddUnitsHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error
 		return err
 	}
 	appName := r.URL.Query().Get(":name")
-	app, err := getAppOrError(appName, u)
+	a, err := getAppOrError(appName, u)
 	if err != nil {
 		return err
 	}
-	return app.AddUnits(n)
+	op, err := a.StartAddUnits(n, r.URL.Query().Get("process"), u.Email)
+	if err != nil {
+		switch e := err.(type) {
+		case *app.QuotaExceededError:
+			return &errors.Http{Code: http.StatusForbidden, Message: e.Error()}
+		case *app.ValidationError:
+			return &errors.Http{Code: http.StatusBadRequest, Message: e.Error()}
+		}
+		return err
+	}
+	return writeOperation(w, map[string]string{"operation": op.Id})
 }
 
 func RemoveUnitsHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
@@ -417,21 +495,55 @@ func SetEnv(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
 	}
 	appName := r.URL.Query().Get(":name")
-	app, err := getAppOrError(appName, u)
+	a, err := getAppOrError(appName, u)
 	if err != nil {
 		return err
 	}
-	regex, err := regexp.Compile(`(\w+=[^=]+)(\s|$)`)
-	if err != nil {
+	if err = checkMaintenance(&a, r); err != nil {
 		return err
 	}
-	variables := regex.FindAllStringSubmatch(string(body), -1)
-	envs := make([]bind.EnvVar, len(variables))
-	for i, v := range variables {
-		parts := strings.Split(v[1], "=")
-		envs[i] = bind.EnvVar{Name: parts[0], Value: parts[1], Public: true}
+	var envs []bind.EnvVar
+	if r.Header.Get("Content-Type") == "application/json" {
+		envs, err = parseJSONEnvs(body)
+		if err != nil {
+			return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+		}
+	} else {
+		regex, err := regexp.Compile(`(\w+=[^=]+)(\s|$)`)
+		if err != nil {
+			return err
+		}
+		variables := regex.FindAllStringSubmatch(string(body), -1)
+		envs = make([]bind.EnvVar, len(variables))
+		for i, v := range variables {
+			parts := strings.Split(v[1], "=")
+			envs[i] = bind.EnvVar{Name: parts[0], Value: parts[1], Public: true}
+		}
 	}
-	return app.SetEnvsToApp(envs, true, false)
+	err = a.SetEnvsToApp(envs, true, false, u.Email)
+	if e, ok := err.(*app.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+// parseJSONEnvs parses a JSON object mapping names to values, which allows
+// values with spaces and equal signs, like the ones imported from .env files.
+func parseJSONEnvs(body []byte) ([]bind.EnvVar, error) {
+	var values map[string]string
+	if err := json.Unmarshal(body, &values); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	envs := make([]bind.EnvVar, len(names))
+	for i, name := range names {
+		envs[i] = bind.EnvVar{Name: name, Value: values[name], Public: true}
+	}
+	return envs, nil
 }
 
 func UnsetEnv(w http.ResponseWriter, r *http.Request, u *auth.User) error {
@@ -451,7 +563,60 @@ func UnsetEnv(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	if err != nil {
 		return err
 	}
-	return app.UnsetEnvsFromApp(strings.Fields(string(body)), true, false)
+	if err = checkMaintenance(&app, r); err != nil {
+		return err
+	}
+	return app.UnsetEnvsFromApp(strings.Fields(string(body)), true, false, u.Email)
+}
+
+// ReencryptEnvsHandler encrypts the private environment variables of all apps
+// with the current key, after a key rotation. The response contains the number
+// of apps that had variables re-encrypted.
+func ReencryptEnvsHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	n, err := app.ReencryptEnvs()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]int{"apps": n})
+}
+
+// EnvHistory returns the env revisions of an app, the most recent first.
+func EnvHistory(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	revisions, err := a.EnvHistory()
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(revisions)
+}
+
+// EnvRollback brings the public env vars of an app back to the given revision.
+func EnvRollback(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	revision, err := strconv.Atoi(r.URL.Query().Get(":revision"))
+	if err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid revision."}
+	}
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	if err = checkMaintenance(&a, r); err != nil {
+		return err
+	}
+	err = a.RollbackEnvs(revision, u.Email)
+	if err == app.ErrEnvRevisionNotFound {
+		return &errors.Http{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
 }
 
 func AppLog(w http.ResponseWriter, r *http.Request, u *auth.User) error {
@@ -104,6 +104,7 @@ pos-restart:
 	s.provisioner.PrepareOutput(nil)            // clone
 	s.provisioner.PrepareOutput(nil)            // install
 	s.provisioner.PrepareOutput([]byte(output)) // loadHooks
+	s.provisioner.PrepareOutput(nil)            // loadProcfile
 	s.provisioner.PrepareOutput(nil)            // pre-restart
 	s.provisioner.PrepareOutput(nil)            // restart
 	s.provisioner.PrepareOutput(nil)            // pos-restart
@@ -112,6 +113,7 @@ pos-restart:
 		Framework: "django",
 		Teams:     []string{s.team.Name},
 		State:     string(provision.StatusStarted),
+		Units:     []app.Unit{{Name: "someapp/0", State: string(provision.StatusStarted)}},
 	}
 	err := db.Session.Apps().Insert(a)
 	c.Assert(err, IsNil)
@@ -145,6 +147,7 @@ pos-restart:
 	s.provisioner.PrepareOutput(nil)            // clone
 	s.provisioner.PrepareOutput(nil)            // install
 	s.provisioner.PrepareOutput([]byte(output)) // loadHooks
+	s.provisioner.PrepareOutput(nil)            // loadProcfile
 	s.provisioner.PrepareOutput(nil)            // pre-restart
 	s.provisioner.PrepareOutput(nil)            // restart
 	s.provisioner.PrepareOutput(nil)            // pos-restart
@@ -153,6 +156,7 @@ pos-restart:
 		Framework: "django",
 		Teams:     []string{s.team.Name},
 		State:     string(provision.StatusStarted),
+		Units:     []app.Unit{{Name: "someapp/0", State: string(provision.StatusStarted)}},
 	}
 	err := db.Session.Apps().Insert(a)
 	c.Assert(err, IsNil)
@@ -188,6 +192,7 @@ pos-restart:
 	s.provisioner.PrepareOutput(nil)            // clone
 	s.provisioner.PrepareOutput(nil)            // install
 	s.provisioner.PrepareOutput([]byte(output)) // loadHooks
+	s.provisioner.PrepareOutput(nil)            // loadProcfile
 	s.provisioner.PrepareOutput(nil)            // pre-restart
 	s.provisioner.PrepareOutput(nil)            // restart
 	s.provisioner.PrepareOutput(nil)            // pos-restart
@@ -196,6 +201,7 @@ pos-restart:
 		Framework: "django",
 		Teams:     []string{s.team.Name},
 		State:     string(provision.StatusStarted),
+		Units:     []app.Unit{{Name: "someapp/0", State: string(provision.StatusStarted)}},
 	}
 	err := db.Session.Apps().Insert(a)
 	c.Assert(err, IsNil)
@@ -321,7 +327,10 @@ func (s *S) TestDelete(c *C) {
 	recorder := httptest.NewRecorder()
 	err = AppDelete(recorder, request, s.user)
 	c.Assert(err, IsNil)
-	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Code, Equals, http.StatusAccepted)
+	op := waitOperation(c, recorder.Body)
+	c.Assert(op.Status, Equals, app.OperationSucceeded)
+	c.Assert(op.Kind, Equals, "remove-app")
 	c.Assert(h.url[1], Equals, "/repository/myapptodelete") // increment the index because of CreateApp action
 	c.Assert(h.method[1], Equals, "DELETE")
 	c.Assert(string(h.body[1]), Equals, "null")
@@ -377,8 +386,12 @@ func (s *S) TestDeleteShouldHandleWithGandalfError(c *C) {
 	ts := s.t.StartGandalfTestServer(&h)
 	defer ts.Close()
 	err = AppDelete(recorder, request, s.user)
-	c.Assert(err, NotNil)
-	c.Assert(err.Error(), Equals, "Could not remove app's repository at git server. Aborting...")
+	c.Assert(err, IsNil)
+	op := waitOperation(c, recorder.Body)
+	c.Assert(op.Status, Equals, app.OperationFailed)
+	c.Assert(op.Error, Equals, "Could not remove app's repository at git server. Aborting...")
+	err = myApp.Get()
+	c.Assert(err, IsNil)
 }
 
 func (s *S) TestDeleteReturnsErrorIfAppDestroyFails(c *C) {
@@ -400,7 +413,9 @@ func (s *S) TestDeleteReturnsErrorIfAppDestroyFails(c *C) {
 	c.Assert(err, IsNil)
 	recorder := httptest.NewRecorder()
 	err = AppDelete(recorder, request, s.user)
-	c.Assert(err, NotNil)
+	c.Assert(err, IsNil)
+	op := waitOperation(c, recorder.Body)
+	c.Assert(op.Status, Equals, app.OperationFailed)
 }
 
 func (s *S) TestAppInfo(c *C) {
@@ -466,8 +481,10 @@ func (s *S) TestCreateAppHelperShouldNotCreateAnAppWhenAnErrorHappensOnCreateRep
 	ts := s.t.StartGandalfTestServer(&h)
 	defer ts.Close()
 	a := app.App{Name: "someapp"}
-	_, err := createAppHelper(&a, s.user, 1)
-	c.Assert(err, NotNil)
+	result, err := createAppHelper(&a, s.user, 1)
+	c.Assert(err, IsNil)
+	op := waitOperation(c, bytes.NewReader(result))
+	c.Assert(op.Status, Equals, app.OperationFailed)
 	length, err := db.Session.Apps().Find(bson.M{"name": a.Name}).Count()
 	c.Assert(err, IsNil)
 	c.Assert(length, Equals, 0)
@@ -478,9 +495,11 @@ func (s *S) TestCreateAppHelperCreatesRepositoryInGandalf(c *C) {
 	ts := s.t.StartGandalfTestServer(&h)
 	defer ts.Close()
 	a := app.App{Name: "someapp"}
-	_, err := createAppHelper(&a, s.user, 1)
+	result, err := createAppHelper(&a, s.user, 1)
 	c.Assert(err, IsNil)
 	defer a.Destroy()
+	op := waitOperation(c, bytes.NewReader(result))
+	c.Assert(op.Status, Equals, app.OperationSucceeded)
 	c.Assert(h.url[0], Equals, "/repository")
 	c.Assert(h.method[0], Equals, "POST")
 	expected := fmt.Sprintf(`{"name":"someapp","users":["%s"],"ispublic":false}`, s.user.Email)
@@ -511,13 +530,15 @@ func (s *S) TestCreateAppHandler(c *C) {
 	c.Assert(err, IsNil)
 	repoUrl := repository.GetUrl(a.Name)
 	var obtained map[string]string
-	expected := map[string]string{
-		"status":         "success",
-		"repository_url": repoUrl,
-	}
 	err = json.Unmarshal(body, &obtained)
-	c.Assert(obtained, DeepEquals, expected)
-	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(err, IsNil)
+	c.Assert(obtained["status"], Equals, "pending")
+	c.Assert(obtained["repository_url"], Equals, repoUrl)
+	c.Assert(recorder.Code, Equals, http.StatusAccepted)
+	op := waitOperation(c, bytes.NewReader(body))
+	c.Assert(op.Status, Equals, app.OperationSucceeded)
+	c.Assert(op.Kind, Equals, "create-app")
+	c.Assert(op.User, Equals, s.user.Email)
 	var gotApp app.App
 	err = db.Session.Apps().Find(bson.M{"name": "someapp"}).One(&gotApp)
 	c.Assert(err, IsNil)
@@ -558,6 +579,23 @@ func (s *S) TestCreateAppReturns403IfTheUserIsNotMemberOfAnyTeam(c *C) {
 	c.Assert(e, ErrorMatches, "^In order to create an app, you should be member of at least one team$")
 }
 
+func (s *S) TestCreateAppReturns403IfTheQuotaIsExceeded(c *C) {
+	err := db.Session.Quotas().Insert(app.Quota{Owner: s.user.Email, MaxApps: 0, MaxUnits: app.Unlimited})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId(s.user.Email)
+	b := strings.NewReader(`{"name":"someapp","framework":"django"}`)
+	request, err := http.NewRequest("POST", "/apps", b)
+	c.Assert(err, IsNil)
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	err = CreateAppHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusForbidden)
+	c.Assert(e.Message, Equals, `Quota exceeded for user "whydidifall@thewho.com": using 0 of 0 apps, requested 1 more.`)
+}
+
 func (s *S) TestCreateAppReturnsConflictWithProperMessageWhenTheAppAlreadyExist(c *C) {
 	a := app.App{
 		Name:  "plainsofdawn",
@@ -606,6 +644,9 @@ func (s *S) TestAddUnits(c *C) {
 	recorder := httptest.NewRecorder()
 	err = AddUnitsHandler(recorder, request, s.user)
 	c.Assert(err, IsNil)
+	c.Assert(recorder.Code, Equals, http.StatusAccepted)
+	op := waitOperation(c, recorder.Body)
+	c.Assert(op.Status, Equals, app.OperationSucceeded)
 	err = a.Get()
 	c.Assert(err, IsNil)
 	c.Assert(a.Units, HasLen, 3)
@@ -644,6 +685,53 @@ func (s *S) TestAddUnitsReturns403IfTheUserDoesNotHaveAccessToTheApp(c *C) {
 	c.Assert(e.Message, Equals, "User does not have access to this app")
 }
 
+func (s *S) TestAddUnitsReturns403IfTheQuotaIsExceeded(c *C) {
+	err := db.Session.Quotas().Insert(app.Quota{Owner: s.team.Name, MaxApps: 1, MaxUnits: 2, Apps: 1, Units: 2})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId(s.team.Name)
+	a := app.App{
+		Name:        "armorandsword",
+		Framework:   "python",
+		Teams:       []string{s.team.Name},
+		QuotaOwners: []string{s.team.Name},
+	}
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader("1")
+	request, err := http.NewRequest("PUT", "/apps/armorandsword/units?:name=armorandsword", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddUnitsHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusForbidden)
+	c.Assert(e.Message, Equals, `Quota exceeded for team "tsuruteam": using 2 of 2 units, requested 1 more.`)
+}
+
+func (s *S) TestAddUnitsReturns400IfTheProcessIsNotDeclared(c *C) {
+	a := app.App{
+		Name:      "armorandsword",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Processes: []app.Process{{Name: "web", Command: "gunicorn app:app"}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader("1")
+	request, err := http.NewRequest("PUT", "/apps/armorandsword/units?:name=armorandsword&process=worker", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddUnitsHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+	c.Assert(e.Message, Equals, `App "armorandsword" does not declare the process "worker" in its Procfile.`)
+}
+
 func (s *S) TestAddUnitsReturns400IfNumberOfUnitsIsOmited(c *C) {
 	bodies := []io.Reader{nil, strings.NewReader("")}
 	for _, body := range bodies {
@@ -690,7 +778,7 @@ func (s *S) TestRemoveUnits(c *C) {
 	err = s.provisioner.Provision(&a)
 	c.Assert(err, IsNil)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 3)
+	s.provisioner.AddUnits(&a, 3, "web")
 	body := strings.NewReader("2")
 	request, err := http.NewRequest("DELETE", "/apps/velha/units?:name=velha", body)
 	c.Assert(err, IsNil)
@@ -1463,6 +1551,30 @@ func (s *S) TestSetEnvHandlerShouldSupportLowerCasedVariableName(c *C) {
 	c.Assert(app.Env["http_proxy"], DeepEquals, expected)
 }
 
+func (s *S) TestSetEnvHandlerReturnsBadRequestForInvalidVariableName(c *C) {
+	a := app.App{
+		Name:  "fragments",
+		Teams: []string{s.team.Name},
+		Units: []app.Unit{{Machine: 1}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/env?:name=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader("1PROXY=http://my_proxy.com:3128"))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = SetEnv(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+	c.Assert(e.Message, Matches, `^Invalid environment variable name "1PROXY".*`)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Env, HasLen, 0)
+}
+
 func (s *S) TestSetEnvHandlerShouldNotChangeValueOfPrivateVariables(c *C) {
 	original := map[string]bind.EnvVar{
 		"DATABASE_HOST": {
@@ -2077,9 +2189,10 @@ func (s *S) TestUnbindHandler(c *C) {
 	c.Assert(err, IsNil)
 	defer db.Session.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
 	a := app.App{
-		Name:  "painkiller",
-		Teams: []string{s.team.Name},
-		Units: []app.Unit{{Machine: 1}},
+		Name:      "painkiller",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Machine: 1}},
 	}
 	err = app.CreateApp(&a, 1)
 	c.Assert(err, IsNil)
@@ -2289,3 +2402,142 @@ func (s *S) TestAddLogHandler(c *C) {
 		c.Check(length, Equals, 1)
 	}
 }
+
+func (s *S) TestReencryptEnvsHandler(c *C) {
+	request, err := http.NewRequest("POST", "/env/reencrypt", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = ReencryptEnvsHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Body.String(), Equals, `{"apps":0}`+"\n")
+}
+
+func (s *S) TestSetEnvHandlerAcceptsJSON(c *C) {
+	a := app.App{
+		Name:  "fragments",
+		Teams: []string{s.team.Name},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer db.Session.EnvRevisions().RemoveAll(bson.M{"app": a.Name})
+	url := fmt.Sprintf("/apps/%s/env?:name=%s", a.Name, a.Name)
+	body := strings.NewReader(`{"GREETING":"hello world","DATABASE_URL":"mysql://u:p@host/db?a=b"}`)
+	request, err := http.NewRequest("POST", url, body)
+	c.Assert(err, IsNil)
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	err = SetEnv(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Env["GREETING"], DeepEquals, bind.EnvVar{Name: "GREETING", Value: "hello world", Public: true})
+	c.Assert(a.Env["DATABASE_URL"].Value, Equals, "mysql://u:p@host/db?a=b")
+	revisions, err := a.EnvHistory()
+	c.Assert(err, IsNil)
+	c.Assert(revisions, HasLen, 1)
+	c.Assert(revisions[0].User, Equals, s.user.Email)
+}
+
+func (s *S) TestSetEnvHandlerReturnsBadRequestForInvalidJSON(c *C) {
+	a := app.App{Name: "fragments", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/env?:name=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, strings.NewReader(`{"GREETING":`))
+	c.Assert(err, IsNil)
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	err = SetEnv(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestEnvHistory(c *C) {
+	a := app.App{Name: "fragments", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer db.Session.EnvRevisions().RemoveAll(bson.M{"app": a.Name})
+	envs := []bind.EnvVar{
+		{Name: "DEBUG", Value: "true", Public: true},
+		{Name: "DATABASE_PASSWORD", Value: "secret", Public: false},
+	}
+	err = a.SetEnvsToApp(envs, false, false, s.user.Email)
+	c.Assert(err, IsNil)
+	request, err := http.NewRequest("GET", "/apps/fragments/env/history?:name=fragments", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = EnvHistory(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), Equals, "application/json")
+	c.Assert(strings.Contains(recorder.Body.String(), "secret"), Equals, false)
+	var revisions []app.EnvRevision
+	err = json.NewDecoder(recorder.Body).Decode(&revisions)
+	c.Assert(err, IsNil)
+	c.Assert(revisions, HasLen, 1)
+	c.Assert(revisions[0].Revision, Equals, 1)
+	c.Assert(revisions[0].Changes, HasLen, 2)
+}
+
+func (s *S) TestEnvHistoryReturnsNoContentWithoutRevisions(c *C) {
+	a := app.App{Name: "fragments", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/fragments/env/history?:name=fragments", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = EnvHistory(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Code, Equals, http.StatusNoContent)
+}
+
+func (s *S) TestEnvRollback(c *C) {
+	a := app.App{Name: "fragments", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer db.Session.EnvRevisions().RemoveAll(bson.M{"app": a.Name})
+	err = a.SetEnvsToApp([]bind.EnvVar{{Name: "DEBUG", Value: "true", Public: true}}, true, false, s.user.Email)
+	c.Assert(err, IsNil)
+	err = a.SetEnvsToApp([]bind.EnvVar{{Name: "DEBUG", Value: "false", Public: true}}, true, false, s.user.Email)
+	c.Assert(err, IsNil)
+	request, err := http.NewRequest("POST", "/apps/fragments/env/rollback/1?:name=fragments&:revision=1", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = EnvRollback(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Env["DEBUG"].Value, Equals, "true")
+}
+
+func (s *S) TestEnvRollbackToAnUnknownRevision(c *C) {
+	a := app.App{Name: "fragments", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/fragments/env/rollback/9?:name=fragments&:revision=9", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = EnvRollback(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusNotFound)
+}
+
+func (s *S) TestEnvRollbackWithInvalidRevision(c *C) {
+	request, err := http.NewRequest("POST", "/apps/fragments/env/rollback/x?:name=fragments&:revision=x", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = EnvRollback(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+}
@@ -0,0 +1,56 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/router"
+	"net/http"
+)
+
+// cnameError converts errors from the router to HTTP errors.
+func cnameError(err error) error {
+	if e, ok := err.(*app.ValidationError); ok {
+		return &errors.Http{Code: http.StatusPreconditionFailed, Message: e.Message}
+	}
+	switch err {
+	case router.ErrCNameExists:
+		return &errors.Http{Code: http.StatusConflict, Message: "This cname is already used by another app."}
+	case router.ErrCNameNotFound:
+		return &errors.Http{Code: http.StatusNotFound, Message: "The app does not have this cname."}
+	}
+	return err
+}
+
+// AddCNameHandler adds a custom domain to the app. The body of the request is
+// a JSON object with the domain:
+//
+//	{"cname": "www.mycompany.com"}
+func AddCNameHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	var params map[string]string
+	if err = json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in the body of the request."}
+	}
+	if params["cname"] == "" {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide the cname."}
+	}
+	return cnameError(a.AddCName(params["cname"]))
+}
+
+// RemoveCNameHandler removes a custom domain from the app.
+func RemoveCNameHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	return cnameError(a.RemoveCName(r.URL.Query().Get(":cname")))
+}
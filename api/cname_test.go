@@ -0,0 +1,131 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestAddCNameHandler(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader(`{"cname":"leper.mycompany.com"}`)
+	request, err := http.NewRequest("POST", "/apps/leper/cname?:name=leper", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddCNameHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(s.router.HasCName("leper.mycompany.com", "leper"), Equals, true)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.CName, DeepEquals, []string{"leper.mycompany.com"})
+}
+
+func (s *S) TestAddCNameHandlerWithInvalidCName(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader(`{"cname":"leper"}`)
+	request, err := http.NewRequest("POST", "/apps/leper/cname?:name=leper", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddCNameHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusPreconditionFailed)
+}
+
+func (s *S) TestAddCNameHandlerWithCNameUsedByAnotherApp(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	s.router.AddBackend("other")
+	s.router.SetCName("leper.mycompany.com", "other")
+	body := strings.NewReader(`{"cname":"leper.mycompany.com"}`)
+	request, err := http.NewRequest("POST", "/apps/leper/cname?:name=leper", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddCNameHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusConflict)
+}
+
+func (s *S) TestAddCNameHandlerWithoutCName(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/leper/cname?:name=leper", strings.NewReader(`{}`))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddCNameHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestAddCNameHandlerWithoutAccessToTheApp(c *C) {
+	a := app.App{Name: "leper", Teams: []string{"someoneelse"}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader(`{"cname":"leper.mycompany.com"}`)
+	request, err := http.NewRequest("POST", "/apps/leper/cname?:name=leper", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddCNameHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusForbidden)
+}
+
+func (s *S) TestRemoveCNameHandler(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = a.AddCName("leper.mycompany.com")
+	c.Assert(err, IsNil)
+	url := "/apps/leper/cname/leper.mycompany.com?:name=leper&:cname=leper.mycompany.com"
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemoveCNameHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(s.router.HasCName("leper.mycompany.com", "leper"), Equals, false)
+}
+
+func (s *S) TestRemoveUnknownCNameHandler(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	s.router.AddBackend("leper")
+	url := "/apps/leper/cname/leper.mycompany.com?:name=leper&:cname=leper.mycompany.com"
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemoveCNameHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusNotFound)
+}
@@ -0,0 +1,72 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+)
+
+// AddCronJobHandler schedules a new cron job in the app. The body of the
+// request is a JSON object with the schedule and the command of the job:
+//
+//	{"schedule": "*/10 * * * *", "command": "python manage.py clearsessions"}
+func AddCronJobHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	var params map[string]string
+	if err = json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in the body of the request."}
+	}
+	if params["schedule"] == "" || params["command"] == "" {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide the schedule and the command of the job."}
+	}
+	job, err := a.AddCronJob(params["schedule"], params["command"], u.Email)
+	if err != nil {
+		if e, ok := err.(*app.ValidationError); ok {
+			return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+		}
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(job)
+}
+
+// CronJobsHandler lists the cron jobs of the app, with the history of their
+// runs.
+func CronJobsHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	jobs, err := a.CronJobs()
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(jobs)
+}
+
+// RemoveCronJobHandler removes a cron job from the app.
+func RemoveCronJobHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	err = a.RemoveCronJob(r.URL.Query().Get(":id"))
+	if err == app.ErrCronJobNotFound {
+		return &errors.Http{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
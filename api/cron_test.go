@@ -0,0 +1,144 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestAddCronJobHandler(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer db.Session.CronJobs().RemoveAll(bson.M{"app": a.Name})
+	body := strings.NewReader(`{"schedule":"*/10 * * * *","command":"python manage.py clearsessions"}`)
+	request, err := http.NewRequest("POST", "/apps/leper/cron?:name=leper", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddCronJobHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var job app.CronJob
+	err = json.NewDecoder(recorder.Body).Decode(&job)
+	c.Assert(err, IsNil)
+	c.Assert(job.Schedule, Equals, "*/10 * * * *")
+	c.Assert(job.Command, Equals, "python manage.py clearsessions")
+	c.Assert(job.User, Equals, s.user.Email)
+	jobs, err := a.CronJobs()
+	c.Assert(err, IsNil)
+	c.Assert(jobs, HasLen, 1)
+	c.Assert(jobs[0].Id, Equals, job.Id)
+}
+
+func (s *S) TestAddCronJobHandlerWithInvalidSchedule(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader(`{"schedule":"every minute","command":"ls"}`)
+	request, err := http.NewRequest("POST", "/apps/leper/cron?:name=leper", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddCronJobHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+	c.Assert(e.Message, Matches, `^Invalid schedule "every minute": .*`)
+}
+
+func (s *S) TestAddCronJobHandlerWithoutCommand(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader(`{"schedule":"@daily"}`)
+	request, err := http.NewRequest("POST", "/apps/leper/cron?:name=leper", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddCronJobHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+	c.Assert(e.Message, Equals, "You must provide the schedule and the command of the job.")
+}
+
+func (s *S) TestCronJobsHandler(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer db.Session.CronJobs().RemoveAll(bson.M{"app": a.Name})
+	_, err = a.AddCronJob("@hourly", "ls", s.user.Email)
+	c.Assert(err, IsNil)
+	request, err := http.NewRequest("GET", "/apps/leper/cron?:name=leper", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CronJobsHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), Equals, "application/json")
+	var jobs []app.CronJob
+	err = json.NewDecoder(recorder.Body).Decode(&jobs)
+	c.Assert(err, IsNil)
+	c.Assert(jobs, HasLen, 1)
+	c.Assert(jobs[0].Command, Equals, "ls")
+}
+
+func (s *S) TestCronJobsHandlerWithoutJobs(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/leper/cron?:name=leper", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CronJobsHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Code, Equals, http.StatusNoContent)
+}
+
+func (s *S) TestRemoveCronJobHandler(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer db.Session.CronJobs().RemoveAll(bson.M{"app": a.Name})
+	job, err := a.AddCronJob("@hourly", "ls", s.user.Email)
+	c.Assert(err, IsNil)
+	url := "/apps/leper/cron/" + job.Id.Hex() + "?:name=leper&:id=" + job.Id.Hex()
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemoveCronJobHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	jobs, err := a.CronJobs()
+	c.Assert(err, IsNil)
+	c.Assert(jobs, HasLen, 0)
+}
+
+func (s *S) TestRemoveCronJobHandlerNotFound(c *C) {
+	a := app.App{Name: "leper", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("DELETE", "/apps/leper/cron/abc?:name=leper&:id=abc", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemoveCronJobHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusNotFound)
+	c.Assert(e.Message, Equals, "Cron job not found.")
+}
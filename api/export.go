@@ -0,0 +1,146 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/api/service"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/goyaml"
+	"net/http"
+)
+
+// exportManifest returns the manifest that describes the current state of the
+// app. Private env vars are not exported, because they're set by service
+// instances.
+func exportManifest(a *app.App) (*Manifest, error) {
+	m := Manifest{
+		Name:      a.Name,
+		Framework: a.Framework,
+		Units:     uint(len(a.Units)),
+		Plan:      a.Plan.Name,
+		Teams:     a.Teams,
+		Env:       make(map[string]string),
+	}
+	for name, env := range a.Env {
+		if env.Public {
+			m.Env[name] = env.Value
+		}
+	}
+	var instances []service.ServiceInstance
+	err := db.Session.ServiceInstances().Find(bson.M{"apps": a.Name}).Sort("name").All(&instances)
+	if err != nil {
+		return nil, err
+	}
+	for _, si := range instances {
+		m.Services = append(m.Services, manifestService{Name: si.Name, Service: si.ServiceName, Plan: si.PlanName})
+	}
+	// Hooks are only informative, so an app.conf that can't be read doesn't
+	// prevent the export.
+	if hooks, err := a.Hooks(); err == nil && len(hooks) > 0 {
+		m.Hooks = hooks
+	}
+	return &m, nil
+}
+
+// ExportApp returns the YAML manifest of the app, which can be given to
+// ApplyManifest to create a copy of the app, in the same tsuru server or in
+// another one.
+func ExportApp(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	m, err := exportManifest(&a)
+	if err != nil {
+		return err
+	}
+	out, err := goyaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-yaml")
+	_, err = w.Write(out)
+	return err
+}
+
+// CloneApp creates a new app with the same configuration of an existing one.
+// The body of the request is a JSON object with the name of the new app and,
+// optionally, the team that will own it:
+//
+//	{"name": "myapp-staging", "team": "qa"}
+//
+// Service instances are not shared: the new app gets a fresh instance of each
+// service bound to the original app, named after the new app and the service
+// (like "myapp-staging-mysql"). The response contains the changes made, in the
+// same format of ApplyManifest.
+func CloneApp(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	src, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	var params map[string]string
+	if err = json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in the body of the request."}
+	}
+	name := params["name"]
+	if name == "" {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "The name of the new app is required."}
+	}
+	dst := app.App{Name: name}
+	if dst.Get() == nil {
+		return &errors.Http{Code: http.StatusConflict, Message: fmt.Sprintf("There is already an app named %s.", name)}
+	}
+	m, err := exportManifest(&src)
+	if err != nil {
+		return err
+	}
+	m.Name = name
+	if m.Units == 0 {
+		m.Units = 1
+	}
+	if team := params["team"]; team != "" {
+		teams, err := u.Teams()
+		if err != nil {
+			return err
+		}
+		var member bool
+		for _, t := range teams {
+			member = member || t.Name == team
+		}
+		if !member {
+			return &errors.Http{Code: http.StatusForbidden, Message: fmt.Sprintf("You are not a member of the team %s.", team)}
+		}
+		m.Teams = []string{team}
+	}
+	used := make(map[string]int)
+	for i, s := range m.Services {
+		m.Services[i].Name = name + "-" + s.Service
+		if used[s.Service] > 0 {
+			m.Services[i].Name += fmt.Sprintf("-%d", used[s.Service])
+		}
+		used[s.Service]++
+		n, err := db.Session.ServiceInstances().Find(bson.M{"name": m.Services[i].Name}).Count()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			msg := fmt.Sprintf("There is already a service instance named %s.", m.Services[i].Name)
+			return &errors.Http{Code: http.StatusConflict, Message: msg}
+		}
+	}
+	plan := manifestPlan{manifest: m, user: u}
+	if err = plan.build(); err != nil {
+		return err
+	}
+	plan.apply()
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(plan.changes)
+}
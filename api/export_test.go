@@ -0,0 +1,169 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/api/service"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestExportManifest(c *C) {
+	a := app.App{
+		Name:      "original",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "original/0"}, {Name: "original/1"}},
+		Plan:      app.Plan{Name: "small"},
+		Env: map[string]bind.EnvVar{
+			"DEBUG":        {Name: "DEBUG", Value: "false", Public: true},
+			"DATABASE_URL": {Name: "DATABASE_URL", Value: "mysql://", Public: false},
+		},
+	}
+	instance := service.ServiceInstance{Name: "original-db", ServiceName: "mysql", Apps: []string{a.Name}}
+	err := db.Session.ServiceInstances().Insert(instance)
+	c.Assert(err, IsNil)
+	defer db.Session.ServiceInstances().Remove(bson.M{"name": instance.Name})
+	m, err := exportManifest(&a)
+	c.Assert(err, IsNil)
+	c.Assert(m.Name, Equals, "original")
+	c.Assert(m.Framework, Equals, "python")
+	c.Assert(m.Units, Equals, uint(2))
+	c.Assert(m.Plan, Equals, "small")
+	c.Assert(m.Teams, DeepEquals, []string{s.team.Name})
+	c.Assert(m.Env, DeepEquals, map[string]string{"DEBUG": "false"})
+	c.Assert(m.Services, DeepEquals, []manifestService{{Name: "original-db", Service: "mysql"}})
+}
+
+func (s *S) TestExportAppReturnsNotFoundForUnknownApp(c *C) {
+	request, err := http.NewRequest("GET", "/apps/unknown/export?:name=unknown", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = ExportApp(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusNotFound)
+}
+
+func (s *S) TestExportAppWithoutAccess(c *C) {
+	a := app.App{Name: "original", Framework: "python", Teams: []string{"someoneelse"}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/original/export?:name=original", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = ExportApp(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusForbidden)
+}
+
+func (s *S) TestCloneApp(c *C) {
+	a := app.App{
+		Name:      "original",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "original/0", Machine: 1}},
+		Env: map[string]bind.EnvVar{
+			"DEBUG": {Name: "DEBUG", Value: "false", Public: true},
+		},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	h := testHandler{}
+	ts := s.t.StartGandalfTestServer(&h)
+	defer ts.Close()
+	clone := app.App{Name: "copy"}
+	defer func() {
+		err := clone.Get()
+		c.Assert(err, IsNil)
+		err = clone.Destroy()
+		c.Assert(err, IsNil)
+		err = s.provisioner.Destroy(&clone)
+		c.Assert(err, IsNil)
+	}()
+	body := strings.NewReader(`{"name":"copy"}`)
+	request, err := http.NewRequest("POST", "/apps/original/clone?:name=original", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CloneApp(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var changes []change
+	err = json.NewDecoder(recorder.Body).Decode(&changes)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 2)
+	c.Assert(changes[0].Action, Equals, "create-app")
+	c.Assert(changes[0].Status, Equals, changeDone)
+	c.Assert(changes[1].Action, Equals, "env-set")
+	c.Assert(changes[1].Status, Equals, changeDone)
+	err = clone.Get()
+	c.Assert(err, IsNil)
+	c.Assert(clone.Framework, Equals, "python")
+	c.Assert(clone.Teams, DeepEquals, []string{s.team.Name})
+	c.Assert(clone.Env["DEBUG"].Value, Equals, "false")
+}
+
+func (s *S) TestCloneAppToAnExistingApp(c *C) {
+	a := app.App{Name: "original", Framework: "python", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	b := app.App{Name: "copy", Framework: "python", Teams: []string{s.team.Name}}
+	err = db.Session.Apps().Insert(b)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": b.Name})
+	body := strings.NewReader(`{"name":"copy"}`)
+	request, err := http.NewRequest("POST", "/apps/original/clone?:name=original", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CloneApp(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusConflict)
+}
+
+func (s *S) TestCloneAppToTeamThatTheUserIsNotMember(c *C) {
+	a := app.App{Name: "original", Framework: "python", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader(`{"name":"copy","team":"qa"}`)
+	request, err := http.NewRequest("POST", "/apps/original/clone?:name=original", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CloneApp(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusForbidden)
+}
+
+func (s *S) TestCloneAppRequiresTheNameOfTheNewApp(c *C) {
+	a := app.App{Name: "original", Framework: "python", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/original/clone?:name=original", strings.NewReader(`{}`))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CloneApp(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+}
@@ -0,0 +1,71 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision/ssh"
+	"io/ioutil"
+	"net/http"
+)
+
+// HostList lists the hosts in the pool of the SSH provisioner. Only admin
+// users can list hosts.
+func HostList(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	hosts, err := ssh.ListHosts()
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return json.NewEncoder(w).Encode(hosts)
+}
+
+// AddHostHandler adds a host to the pool of the SSH provisioner. The body of
+// the request contains the address and the capacity of the host:
+//
+//	{"address":"10.10.10.1","capacity":4}
+//
+// Only admin users can add hosts.
+func AddHostHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	var params struct {
+		Address  string
+		Capacity int
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, &params); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid host definition."}
+	}
+	host, err := ssh.AddHost(params.Address, params.Capacity)
+	if err == ssh.ErrHostAlreadyExists {
+		return &errors.Http{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if err != nil {
+		return &errors.Http{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	}
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(host)
+}
+
+// RemoveHostHandler removes a host from the pool of the SSH provisioner. Hosts
+// that still run units can't be removed. Only admin users can remove hosts.
+func RemoveHostHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	err := ssh.RemoveHost(r.URL.Query().Get(":address"))
+	switch err {
+	case ssh.ErrHostNotFound:
+		return &errors.Http{Code: http.StatusNotFound, Message: err.Error()}
+	case ssh.ErrHostNotEmpty:
+		return &errors.Http{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	}
+	return err
+}
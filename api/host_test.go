@@ -0,0 +1,116 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision/ssh"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestHostList(c *C) {
+	_, err := ssh.AddHost("10.10.10.1", 4)
+	c.Assert(err, IsNil)
+	defer db.Session.Hosts().RemoveId("10.10.10.1")
+	request, err := http.NewRequest("GET", "/hosts", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = HostList(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var hosts []ssh.Host
+	err = json.NewDecoder(recorder.Body).Decode(&hosts)
+	c.Assert(err, IsNil)
+	c.Assert(hosts, HasLen, 1)
+	c.Assert(hosts[0].Address, Equals, "10.10.10.1")
+	c.Assert(hosts[0].Capacity, Equals, 4)
+}
+
+func (s *S) TestHostListWithoutHosts(c *C) {
+	request, err := http.NewRequest("GET", "/hosts", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = HostList(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Code, Equals, http.StatusNoContent)
+}
+
+func (s *S) TestAddHostHandler(c *C) {
+	body := strings.NewReader(`{"address":"10.10.10.1","capacity":4}`)
+	request, err := http.NewRequest("POST", "/hosts", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddHostHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	defer db.Session.Hosts().RemoveId("10.10.10.1")
+	c.Assert(recorder.Code, Equals, http.StatusCreated)
+	hosts, err := ssh.ListHosts()
+	c.Assert(err, IsNil)
+	c.Assert(hosts, HasLen, 1)
+	c.Assert(hosts[0].Capacity, Equals, 4)
+}
+
+func (s *S) TestAddHostHandlerInvalidJSON(c *C) {
+	request, err := http.NewRequest("POST", "/hosts", strings.NewReader("{{"))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddHostHandler(recorder, request, s.user)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestAddHostHandlerInvalidCapacity(c *C) {
+	body := strings.NewReader(`{"address":"10.10.10.1","capacity":0}`)
+	request, err := http.NewRequest("POST", "/hosts", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddHostHandler(recorder, request, s.user)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusPreconditionFailed)
+	c.Assert(e.Message, Equals, "The capacity of the host must be at least 1.")
+}
+
+func (s *S) TestAddHostHandlerDuplicated(c *C) {
+	_, err := ssh.AddHost("10.10.10.1", 4)
+	c.Assert(err, IsNil)
+	defer db.Session.Hosts().RemoveId("10.10.10.1")
+	body := strings.NewReader(`{"address":"10.10.10.1","capacity":2}`)
+	request, err := http.NewRequest("POST", "/hosts", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddHostHandler(recorder, request, s.user)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusConflict)
+}
+
+func (s *S) TestRemoveHostHandler(c *C) {
+	_, err := ssh.AddHost("10.10.10.1", 4)
+	c.Assert(err, IsNil)
+	request, err := http.NewRequest("DELETE", "/hosts/10.10.10.1?:address=10.10.10.1", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemoveHostHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	hosts, err := ssh.ListHosts()
+	c.Assert(err, IsNil)
+	c.Assert(hosts, HasLen, 0)
+}
+
+func (s *S) TestRemoveHostHandlerNotFound(c *C) {
+	request, err := http.NewRequest("DELETE", "/hosts/10.10.10.1?:address=10.10.10.1", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemoveHostHandler(recorder, request, s.user)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusNotFound)
+}
@@ -0,0 +1,54 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+)
+
+// checkMaintenance fails with a conflict when the app is in maintenance mode,
+// unless the request is forced with the "force" parameter.
+func checkMaintenance(a *app.App, r *http.Request) error {
+	force := r.URL.Query().Get("force") == "true"
+	if err := a.CheckMaintenance(force); err != nil {
+		msg := err.Error() + " Turn it off with app-maintenance or use --force."
+		return &errors.Http{Code: http.StatusConflict, Message: msg}
+	}
+	return nil
+}
+
+// checkDeployMaintenance refuses deploys to apps in maintenance mode, unless
+// the request is forced with the "force" parameter. Unlike checkMaintenance,
+// the message doesn't suggest --force, as git push doesn't take it.
+func checkDeployMaintenance(a *app.App, r *http.Request) error {
+	force := r.URL.Query().Get("force") == "true"
+	if err := a.CheckMaintenance(force); err != nil {
+		msg := err.Error() + " Turn it off with app-maintenance to deploy."
+		return &errors.Http{Code: http.StatusConflict, Message: msg}
+	}
+	return nil
+}
+
+// MaintenanceHandler turns the maintenance mode of the app on or off,
+// according to the :mode parameter.
+func MaintenanceHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	var on bool
+	switch r.URL.Query().Get(":mode") {
+	case "on":
+		on = true
+	case "off":
+		on = false
+	default:
+		return &errors.Http{Code: http.StatusBadRequest, Message: `Invalid maintenance mode, use "on" or "off".`}
+	}
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	return a.SetMaintenance(on)
+}
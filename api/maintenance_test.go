@@ -0,0 +1,142 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestMaintenanceHandler(c *C) {
+	a := app.App{Name: "tilt", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/tilt/maintenance/on?:name=tilt&:mode=on", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = MaintenanceHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Maintenance, Equals, true)
+	request, err = http.NewRequest("POST", "/apps/tilt/maintenance/off?:name=tilt&:mode=off", nil)
+	c.Assert(err, IsNil)
+	err = MaintenanceHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Maintenance, Equals, false)
+}
+
+func (s *S) TestMaintenanceHandlerWithInvalidMode(c *C) {
+	request, err := http.NewRequest("POST", "/apps/tilt/maintenance/maybe?:name=tilt&:mode=maybe", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = MaintenanceHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestSetEnvHandlerBlockedByMaintenance(c *C) {
+	a := app.App{Name: "tilt", Teams: []string{s.team.Name}, Maintenance: true}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/tilt/env?:name=tilt", strings.NewReader("DATABASE_HOST=localhost"))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = SetEnv(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusConflict)
+	c.Assert(e.Message, Equals, "The app is in maintenance mode. Turn it off with app-maintenance or use --force.")
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Env, HasLen, 0)
+}
+
+func (s *S) TestSetEnvHandlerForcedInMaintenance(c *C) {
+	a := app.App{Name: "tilt", Teams: []string{s.team.Name}, Maintenance: true}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/tilt/env?:name=tilt&force=true", strings.NewReader("DATABASE_HOST=localhost"))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = SetEnv(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Env["DATABASE_HOST"].Value, Equals, "localhost")
+}
+
+func (s *S) TestUnsetEnvHandlerBlockedByMaintenance(c *C) {
+	a := app.App{Name: "tilt", Teams: []string{s.team.Name}, Maintenance: true}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("DELETE", "/apps/tilt/env?:name=tilt", strings.NewReader("DATABASE_HOST"))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = UnsetEnv(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusConflict)
+}
+
+func (s *S) TestAppIsAvaliableHandlerBlockedByMaintenance(c *C) {
+	a := app.App{
+		Name:        "tilt",
+		Units:       []app.Unit{{Name: "tilt/0", State: string(provision.StatusStarted)}},
+		State:       string(provision.StatusStarted),
+		Maintenance: true,
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/avaliable?:name=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AppIsAvaliableHandler(recorder, request)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusConflict)
+	c.Assert(e.Message, Equals, "The app is in maintenance mode. Turn it off with app-maintenance to deploy.")
+	request, err = http.NewRequest("GET", url+"&force=true", nil)
+	c.Assert(err, IsNil)
+	err = AppIsAvaliableHandler(recorder, request)
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestCloneRepositoryHandlerBlockedByMaintenance(c *C) {
+	a := app.App{Name: "tilt", Maintenance: true}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/tilt/repository/clone?:name=tilt", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CloneRepositoryHandler(recorder, request)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusConflict)
+	c.Assert(s.provisioner.GetCmds("", &a), HasLen, 0)
+}
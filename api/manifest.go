@@ -0,0 +1,409 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/api/service"
+	"github.com/globocom/tsuru/api/service/consumption"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/goyaml"
+	"net/http"
+	"sort"
+)
+
+// manifestService is a service instance declared in the manifest. The
+// instance is created if it doesn't exist, with the given plan, and bound to
+// the app.
+type manifestService struct {
+	Name    string
+	Service string
+	Plan    string `yaml:",omitempty"`
+}
+
+// Manifest describes the desired state of an app. Fields that are not
+// present in the manifest are left untouched. Hooks are declared in the
+// app.conf file of the repository, so they're exported for reference but not
+// applied. Example:
+//
+//	name: myapp
+//	framework: python
+//	units: 3
+//	plan: small
+//	teams: [developers, ops]
+//	env:
+//	  DEBUG: "false"
+//	services:
+//	  - name: myapp-db
+//	    service: mysql
+//	    plan: small
+type Manifest struct {
+	Name      string
+	Framework string
+	Units     uint                `yaml:",omitempty"`
+	Plan      string              `yaml:",omitempty"`
+	Teams     []string            `yaml:",omitempty"`
+	Env       map[string]string   `yaml:",omitempty"`
+	Services  []manifestService   `yaml:",omitempty"`
+	Hooks     map[string][]string `yaml:",omitempty"`
+}
+
+// Change statuses, as reported by ApplyManifest.
+const (
+	changePlanned = "planned"
+	changeDone    = "done"
+	changeFailed  = "failed"
+	changeSkipped = "skipped"
+)
+
+// change is one of the steps needed to bring the app to the state described
+// in the manifest.
+type change struct {
+	Action      string
+	Description string
+	Status      string
+	Error       string `json:",omitempty"`
+	run         func() error
+}
+
+func (c *change) String() string {
+	return c.Description
+}
+
+// manifestPlan computes the changes needed to apply the manifest, in
+// dependency order: the app must exist before its teams, units and env vars
+// change, and service instances must exist before being bound.
+type manifestPlan struct {
+	manifest *Manifest
+	user     *auth.User
+	changes  []*change
+}
+
+// skipError is returned by changes that can't run yet. Unlike failures, it
+// doesn't stop the remaining changes, and the change is planned again in the
+// next apply.
+type skipError struct {
+	reason string
+}
+
+func (err *skipError) Error() string {
+	return err.reason
+}
+
+func (p *manifestPlan) add(action, description string, run func() error) {
+	c := change{Action: action, Description: description, Status: changePlanned, run: run}
+	p.changes = append(p.changes, &c)
+}
+
+// load returns the current state of the app, which is changed by previous
+// steps of the plan.
+func (p *manifestPlan) load() (*app.App, error) {
+	a, err := getAppOrError(p.manifest.Name, p.user)
+	return &a, err
+}
+
+func (p *manifestPlan) build() error {
+	m := p.manifest
+	if m.Name == "" {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "The manifest must contain the name of the app."}
+	}
+	current := app.App{Name: m.Name}
+	exists := current.Get() == nil
+	if exists {
+		var err error
+		if current, err = getAppOrError(m.Name, p.user); err != nil {
+			return err
+		}
+		if m.Framework != "" && m.Framework != current.Framework {
+			msg := fmt.Sprintf("Cannot change the framework of the app from %q to %q.", current.Framework, m.Framework)
+			return &errors.Http{Code: http.StatusPreconditionFailed, Message: msg}
+		}
+		p.planPlan(&current)
+		p.planTeams(current.Teams)
+		p.planUnits(&current)
+	} else {
+		if err := p.planCreation(); err != nil {
+			return err
+		}
+		teams, err := p.user.Teams()
+		if err != nil {
+			return err
+		}
+		p.planTeams(auth.GetTeamsNames(teams))
+	}
+	p.planEnv(&current)
+	return p.planServices()
+}
+
+func (p *manifestPlan) planCreation() error {
+	m := p.manifest
+	if m.Framework == "" {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "The manifest must contain the framework of the app."}
+	}
+	units := m.Units
+	if units == 0 {
+		units = 1
+	}
+	description := fmt.Sprintf("create app %q with framework %q and %d unit(s)", m.Name, m.Framework, units)
+	p.add("create-app", description, func() error {
+		teams, err := p.user.Teams()
+		if err != nil {
+			return err
+		}
+		a := app.App{Name: m.Name, Framework: m.Framework, Plan: app.Plan{Name: m.Plan}, Owner: p.user.Email}
+		a.SetTeams(teams)
+		return app.CreateApp(&a, units)
+	})
+	return nil
+}
+
+func (p *manifestPlan) planPlan(current *app.App) {
+	plan := p.manifest.Plan
+	if plan == "" || plan == current.Plan.Name {
+		return
+	}
+	p.add("change-plan", fmt.Sprintf("change plan to %q", plan), func() error {
+		a, err := p.load()
+		if err != nil {
+			return err
+		}
+		return a.ChangePlan(plan)
+	})
+}
+
+func (p *manifestPlan) planTeams(current []string) {
+	if len(p.manifest.Teams) == 0 {
+		return
+	}
+	name := p.manifest.Name
+	has := make(map[string]bool)
+	for _, t := range current {
+		has[t] = true
+	}
+	wanted := make(map[string]bool)
+	for _, t := range p.manifest.Teams {
+		wanted[t] = true
+		if !has[t] {
+			team := t
+			p.add("grant", fmt.Sprintf("grant access to team %q", team), func() error {
+				return grantAccessToTeam(name, team, p.user)
+			})
+		}
+	}
+	for _, t := range current {
+		if !wanted[t] {
+			team := t
+			p.add("revoke", fmt.Sprintf("revoke access from team %q", team), func() error {
+				return revokeAccessFromTeam(name, team, p.user)
+			})
+		}
+	}
+}
+
+func (p *manifestPlan) planUnits(current *app.App) {
+	wanted := p.manifest.Units
+	have := uint(len(current.Units))
+	if wanted == 0 || wanted == have {
+		return
+	}
+	if wanted > have {
+		n := wanted - have
+		p.add("add-units", fmt.Sprintf("add %d unit(s)", n), func() error {
+			a, err := p.load()
+			if err != nil {
+				return err
+			}
+			return a.AddUnits(n, "")
+		})
+	} else {
+		n := have - wanted
+		p.add("remove-units", fmt.Sprintf("remove %d unit(s)", n), func() error {
+			a, err := p.load()
+			if err != nil {
+				return err
+			}
+			return a.RemoveUnits(n)
+		})
+	}
+}
+
+// planEnv sets the public variables declared in the manifest and unsets the
+// public variables that are not declared. Private variables, like the ones
+// set by service instances, are never changed.
+func (p *manifestPlan) planEnv(current *app.App) {
+	if p.manifest.Env == nil {
+		return
+	}
+	var set []bind.EnvVar
+	var names []string
+	for name := range p.manifest.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := p.manifest.Env[name]
+		if env, ok := current.Env[name]; !ok || env.Value != value {
+			set = append(set, bind.EnvVar{Name: name, Value: value, Public: true})
+		}
+	}
+	var unset []string
+	for name, env := range current.Env {
+		if _, ok := p.manifest.Env[name]; !ok && env.Public {
+			unset = append(unset, name)
+		}
+	}
+	sort.Strings(unset)
+	if len(set) > 0 {
+		setNames := make([]string, len(set))
+		for i, env := range set {
+			setNames[i] = env.Name
+		}
+		p.add("env-set", fmt.Sprintf("set env vars %v", setNames), func() error {
+			a, err := p.load()
+			if err != nil {
+				return err
+			}
+			return a.SetEnvsToApp(set, true, false, p.user.Email)
+		})
+	}
+	if len(unset) > 0 {
+		p.add("env-unset", fmt.Sprintf("unset env vars %v", unset), func() error {
+			a, err := p.load()
+			if err != nil {
+				return err
+			}
+			return a.UnsetEnvsFromApp(unset, true, false, p.user.Email)
+		})
+	}
+}
+
+// planServices creates the service instances declared in the manifest and
+// binds them to the app, unbinding the instances that are not declared.
+func (p *manifestPlan) planServices() error {
+	if p.manifest.Services == nil {
+		return nil
+	}
+	name := p.manifest.Name
+	var bound []service.ServiceInstance
+	err := db.Session.ServiceInstances().Find(bson.M{"apps": name}).All(&bound)
+	if err != nil {
+		return err
+	}
+	wanted := make(map[string]bool)
+	for _, s := range p.manifest.Services {
+		wanted[s.Name] = true
+	}
+	for _, si := range bound {
+		if !wanted[si.Name] {
+			instance := si.Name
+			p.add("unbind", fmt.Sprintf("unbind service instance %q", instance), func() error {
+				return p.bind(instance, false)
+			})
+		}
+	}
+	for _, s := range p.manifest.Services {
+		var si service.ServiceInstance
+		err := db.Session.ServiceInstances().Find(bson.M{"name": s.Name}).One(&si)
+		if err != nil {
+			if s.Service == "" {
+				msg := fmt.Sprintf("The service of the instance %q is required, because the instance does not exist.", s.Name)
+				return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+			}
+			svc, instance, plan := s.Service, s.Name, s.Plan
+			p.add("create-service-instance", fmt.Sprintf("create service instance %q of service %q", instance, svc), func() error {
+				_, err := consumption.CreateInstance(svc, instance, plan, p.user)
+				return err
+			})
+		} else if si.FindApp(name) > -1 {
+			continue
+		}
+		instance := s.Name
+		p.add("bind", fmt.Sprintf("bind service instance %q", instance), func() error {
+			return p.bind(instance, true)
+		})
+	}
+	return nil
+}
+
+func (p *manifestPlan) bind(instanceName string, shouldBind bool) error {
+	instance, a, err := serviceInstanceAndAppOrError(instanceName, p.manifest.Name, p.user)
+	if err != nil {
+		return err
+	}
+	if shouldBind {
+		if instance.State == service.StateCreating {
+			msg := fmt.Sprintf("The service instance %q is still being created, apply the manifest again to bind it when it's ready.", instanceName)
+			return &skipError{reason: msg}
+		}
+		return instance.Bind(&a)
+	}
+	return instance.Unbind(&a)
+}
+
+// apply runs the changes in order, stopping in the first failure. The
+// remaining changes are skipped, and will be planned again in the next
+// apply. Changes that can't run yet are skipped alone, see skipError.
+func (p *manifestPlan) apply() {
+	for i, c := range p.changes {
+		err := c.run()
+		if e, ok := err.(*skipError); ok {
+			c.Status = changeSkipped
+			c.Error = e.reason
+			continue
+		}
+		if err != nil {
+			c.Status = changeFailed
+			if e, ok := err.(*errors.Http); ok {
+				c.Error = e.Message
+			} else {
+				c.Error = err.Error()
+			}
+			for _, skipped := range p.changes[i+1:] {
+				skipped.Status = changeSkipped
+			}
+			return
+		}
+		c.Status = changeDone
+	}
+}
+
+// ApplyManifest brings an app to the state described by the YAML manifest in
+// the body of the request, creating the app if needed. Only the changes
+// needed are executed.
+//
+// If the "dry" parameter is "true", the changes are computed but not
+// executed. In both cases, the response contains the list of changes and
+// their status.
+func ApplyManifest(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	var m Manifest
+	if err = goyaml.Unmarshal(body, &m); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid manifest: " + err.Error()}
+	}
+	plan := manifestPlan{manifest: &m, user: u}
+	if err = plan.build(); err != nil {
+		return err
+	}
+	if r.URL.Query().Get("dry") != "true" {
+		plan.apply()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	changes := plan.changes
+	if changes == nil {
+		changes = []*change{}
+	}
+	return json.NewEncoder(w).Encode(changes)
+}
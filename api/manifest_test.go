@@ -0,0 +1,187 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/api/service"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) applyManifest(c *C, manifest string, dry bool) ([]change, error) {
+	url := "/apply"
+	if dry {
+		url += "?dry=true"
+	}
+	request, err := http.NewRequest("POST", url, strings.NewReader(manifest))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = ApplyManifest(recorder, request, s.user)
+	if err != nil {
+		return nil, err
+	}
+	var changes []change
+	err = json.NewDecoder(recorder.Body).Decode(&changes)
+	c.Assert(err, IsNil)
+	return changes, nil
+}
+
+func (s *S) TestApplyManifestDryRunForNewApp(c *C) {
+	manifest := `name: manifesto
+framework: python
+units: 2
+env:
+  DEBUG: "false"
+`
+	changes, err := s.applyManifest(c, manifest, true)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 2)
+	c.Assert(changes[0].Action, Equals, "create-app")
+	c.Assert(changes[0].Description, Equals, `create app "manifesto" with framework "python" and 2 unit(s)`)
+	c.Assert(changes[0].Status, Equals, changePlanned)
+	c.Assert(changes[1].Action, Equals, "env-set")
+	c.Assert(changes[1].Status, Equals, changePlanned)
+	n, err := db.Session.Apps().Find(bson.M{"name": "manifesto"}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
+func (s *S) TestApplyManifestDryRunForExistingApp(c *C) {
+	a := app.App{
+		Name:      "manifesto",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "manifesto/0", Machine: 1}},
+		Env: map[string]bind.EnvVar{
+			"DEBUG":        {Name: "DEBUG", Value: "true", Public: true},
+			"OLD":          {Name: "OLD", Value: "old", Public: true},
+			"DATABASE_URL": {Name: "DATABASE_URL", Value: "mysql://", Public: false},
+		},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	manifest := `name: manifesto
+units: 3
+env:
+  DEBUG: "false"
+`
+	changes, err := s.applyManifest(c, manifest, true)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 3)
+	c.Assert(changes[0].Action, Equals, "add-units")
+	c.Assert(changes[0].Description, Equals, "add 2 unit(s)")
+	c.Assert(changes[1].Action, Equals, "env-set")
+	c.Assert(changes[1].Description, Equals, "set env vars [DEBUG]")
+	c.Assert(changes[2].Action, Equals, "env-unset")
+	c.Assert(changes[2].Description, Equals, "unset env vars [OLD]")
+}
+
+func (s *S) TestApplyManifestWithoutChanges(c *C) {
+	a := app.App{
+		Name:      "manifesto",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "manifesto/0", Machine: 1}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	changes, err := s.applyManifest(c, "name: manifesto\nframework: python\nunits: 1\n", false)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 0)
+}
+
+func (s *S) TestApplyManifestSetsEnvVars(c *C) {
+	a := app.App{
+		Name:      "manifesto",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "manifesto/0", Machine: 1}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	changes, err := s.applyManifest(c, "name: manifesto\nenv:\n  DEBUG: \"false\"\n", false)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+	c.Assert(changes[0].Status, Equals, changeDone)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	expected := bind.EnvVar{Name: "DEBUG", Value: "false", Public: true}
+	c.Assert(a.Env["DEBUG"], DeepEquals, expected)
+}
+
+func (s *S) TestApplyManifestSkipsTheBindOfInstancesBeingCreated(c *C) {
+	a := app.App{
+		Name:      "manifesto",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "manifesto/0", Machine: 1}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	instance := service.ServiceInstance{Name: "slowdb", ServiceName: "mysql", Teams: []string{s.team.Name}, State: service.StateCreating}
+	err = instance.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.ServiceInstances().Remove(bson.M{"name": instance.Name})
+	manifest := "name: manifesto\nenv:\n  DEBUG: \"false\"\nservices:\n  - name: slowdb\n"
+	changes, err := s.applyManifest(c, manifest, false)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 2)
+	for _, ch := range changes {
+		if ch.Action == "bind" {
+			c.Assert(ch.Status, Equals, changeSkipped)
+			c.Assert(ch.Error, Equals, `The service instance "slowdb" is still being created, apply the manifest again to bind it when it's ready.`)
+		} else {
+			c.Assert(ch.Status, Equals, changeDone)
+		}
+	}
+	err = db.Session.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, IsNil)
+	c.Assert(instance.Apps, HasLen, 0)
+}
+
+func (s *S) TestApplyManifestCannotChangeTheFramework(c *C) {
+	a := app.App{
+		Name:      "manifesto",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	_, err = s.applyManifest(c, "name: manifesto\nframework: ruby\n", true)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusPreconditionFailed)
+}
+
+func (s *S) TestApplyManifestRequiresTheNameOfTheApp(c *C) {
+	_, err := s.applyManifest(c, "framework: python\n", true)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestApplyManifestRequiresTheFrameworkForNewApps(c *C) {
+	_, err := s.applyManifest(c, "name: manifesto\n", true)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+	c.Assert(e.Message, Equals, "The manifest must contain the framework of the app.")
+}
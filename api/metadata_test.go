@@ -0,0 +1,96 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestSetMetadataHandler(c *C) {
+	a := app.App{Name: "lilith", Teams: []string{s.team.Name}, Contact: "old@company.com"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader(`{"description":"The payments API","tags":["payments","api"]}`)
+	request, err := http.NewRequest("PUT", "/apps/lilith/metadata?:name=lilith", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = SetMetadataHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Description, Equals, "The payments API")
+	c.Assert(a.Contact, Equals, "old@company.com")
+	c.Assert(a.Tags, DeepEquals, []string{"api", "payments"})
+}
+
+func (s *S) TestSetMetadataHandlerWithInvalidTag(c *C) {
+	a := app.App{Name: "lilith", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	body := strings.NewReader(`{"tags":["not a tag"]}`)
+	request, err := http.NewRequest("PUT", "/apps/lilith/metadata?:name=lilith", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = SetMetadataHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestAppListWithFilters(c *C) {
+	apps := []app.App{
+		{Name: "payments-api", Framework: "python", Teams: []string{s.team.Name}, Tags: []string{"payments"}},
+		{Name: "payments-web", Framework: "ruby", Teams: []string{s.team.Name}, Tags: []string{"payments"}},
+		{Name: "search", Framework: "python", Teams: []string{s.team.Name}},
+	}
+	for _, a := range apps {
+		err := db.Session.Apps().Insert(a)
+		c.Assert(err, IsNil)
+		defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	}
+	request, err := http.NewRequest("GET", "/apps?tag=payments&framework=python", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AppList(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var result []app.App
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, IsNil)
+	c.Assert(result, HasLen, 1)
+	c.Assert(result[0].Name, Equals, "payments-api")
+	request, err = http.NewRequest("GET", "/apps?name=^payments&limit=1&page=2", nil)
+	c.Assert(err, IsNil)
+	recorder = httptest.NewRecorder()
+	err = AppList(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	result = nil
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, IsNil)
+	c.Assert(result, HasLen, 1)
+	c.Assert(result[0].Name, Equals, "payments-web")
+}
+
+func (s *S) TestAppListWithInvalidLimit(c *C) {
+	request, err := http.NewRequest("GET", "/apps?limit=many", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AppList(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+	c.Assert(e.Message, Equals, `Invalid limit: "many".`)
+}
@@ -0,0 +1,33 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+)
+
+// writeOperation writes the response of handlers that start operations in
+// background.
+func writeOperation(w http.ResponseWriter, msg map[string]string) error {
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(msg)
+}
+
+// OperationInfo returns the progress of an operation. Only the user that
+// started the operation and admin users are able to see it.
+func OperationInfo(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	op, err := app.GetOperation(r.URL.Query().Get(":id"))
+	if err != nil {
+		return &errors.Http{Code: http.StatusNotFound, Message: "Operation not found."}
+	}
+	if op.User != u.Email && !u.IsAdmin() {
+		return &errors.Http{Code: http.StatusForbidden, Message: "User does not have access to this operation."}
+	}
+	return json.NewEncoder(w).Encode(op)
+}
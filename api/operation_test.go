@@ -0,0 +1,88 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"io"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// waitOperation reads the id of the operation from the given response body
+// and waits for the operation to finish.
+func waitOperation(c *C, body io.Reader) *app.Operation {
+	var msg map[string]string
+	err := json.NewDecoder(body).Decode(&msg)
+	c.Assert(err, IsNil)
+	for i := 0; i < 100; i++ {
+		op, err := app.GetOperation(msg["operation"])
+		c.Assert(err, IsNil)
+		if op.Done() {
+			return op
+		}
+		time.Sleep(1e8)
+	}
+	c.Fatalf("Operation %s did not finish.", msg["operation"])
+	return nil
+}
+
+func (s *S) TestOperationInfo(c *C) {
+	op := app.Operation{
+		Id:     "abc123",
+		Kind:   "add-units",
+		App:    "armorandsword",
+		User:   s.user.Email,
+		Status: app.OperationRunning,
+		Steps:  []app.OperationStep{{Name: "add units", Status: app.StepRunning}},
+	}
+	err := db.Session.Operations().Insert(op)
+	c.Assert(err, IsNil)
+	defer db.Session.Operations().Remove(bson.M{"_id": op.Id})
+	request, err := http.NewRequest("GET", "/operations/abc123?:id=abc123", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = OperationInfo(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var got app.Operation
+	err = json.NewDecoder(recorder.Body).Decode(&got)
+	c.Assert(err, IsNil)
+	c.Assert(got.Id, Equals, "abc123")
+	c.Assert(got.Status, Equals, app.OperationRunning)
+	c.Assert(got.Steps, DeepEquals, op.Steps)
+}
+
+func (s *S) TestOperationInfoNotFound(c *C) {
+	request, err := http.NewRequest("GET", "/operations/unknown?:id=unknown", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = OperationInfo(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusNotFound)
+}
+
+func (s *S) TestOperationInfoFromAnotherUser(c *C) {
+	op := app.Operation{Id: "abc123", User: "someone@tsuru.io"}
+	err := db.Session.Operations().Insert(op)
+	c.Assert(err, IsNil)
+	defer db.Session.Operations().Remove(bson.M{"_id": op.Id})
+	request, err := http.NewRequest("GET", "/operations/abc123?:id=abc123", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = OperationInfo(recorder, request, &auth.User{Email: "nobody@tsuru.io"})
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusForbidden)
+}
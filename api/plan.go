@@ -0,0 +1,141 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"strings"
+)
+
+func getPlanOrError(name string) (app.Plan, error) {
+	plan := app.Plan{Name: name}
+	if err := plan.Get(); err != nil {
+		return plan, &errors.Http{Code: http.StatusNotFound, Message: fmt.Sprintf("Plan %s not found.", name)}
+	}
+	return plan, nil
+}
+
+// PlanList lists all plans that the user is allowed to use.
+func PlanList(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	plans, err := app.ListPlans(u)
+	if err != nil {
+		return err
+	}
+	if len(plans) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return json.NewEncoder(w).Encode(plans)
+}
+
+// CreatePlanHandler creates a new plan. Only admin users can create plans.
+func CreatePlanHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	var plan app.Plan
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, &plan); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid plan definition."}
+	}
+	plan.Teams = nil
+	if err = plan.Create(); err != nil {
+		if e, ok := err.(*app.ValidationError); ok {
+			return &errors.Http{Code: http.StatusPreconditionFailed, Message: e.Message}
+		}
+		if strings.Contains(err.Error(), "key error") {
+			msg := fmt.Sprintf(`There is already a plan named "%s".`, plan.Name)
+			return &errors.Http{Code: http.StatusConflict, Message: msg}
+		}
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// RemovePlanHandler removes a plan. Only admin users can remove plans.
+func RemovePlanHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	plan, err := getPlanOrError(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	return plan.Delete()
+}
+
+func planAndTeamOrError(r *http.Request) (app.Plan, *auth.Team, error) {
+	plan, err := getPlanOrError(r.URL.Query().Get(":plan"))
+	if err != nil {
+		return plan, nil, err
+	}
+	t := new(auth.Team)
+	err = db.Session.Teams().Find(bson.M{"_id": r.URL.Query().Get(":team")}).One(t)
+	if err != nil {
+		return plan, nil, &errors.Http{Code: http.StatusNotFound, Message: "Team not found"}
+	}
+	return plan, t, nil
+}
+
+// GrantPlanToTeamHandler restricts a plan to a team (and other teams that
+// already have access to the plan).
+func GrantPlanToTeamHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	plan, team, err := planAndTeamOrError(r)
+	if err != nil {
+		return err
+	}
+	if err = plan.GrantAccess(team); err != nil {
+		return &errors.Http{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return nil
+}
+
+// RevokePlanFromTeamHandler removes the access of a team to a plan. Plans
+// without teams are available to everybody.
+func RevokePlanFromTeamHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	plan, team, err := planAndTeamOrError(r)
+	if err != nil {
+		return err
+	}
+	if err = plan.RevokeAccess(team); err != nil {
+		return &errors.Http{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return nil
+}
+
+// ChangePlanHandler changes the plan of an app. The name of the new plan is
+// the body of the request.
+func ChangePlanHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	msg := "You must provide the name of the plan."
+	if r.Body == nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	planName := strings.TrimSpace(string(body))
+	if planName == "" {
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+	}
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	if err = a.ChangePlan(planName); err != nil {
+		if e, ok := err.(*app.ValidationError); ok {
+			return &errors.Http{Code: http.StatusPreconditionFailed, Message: e.Message}
+		}
+		return err
+	}
+	return nil
+}
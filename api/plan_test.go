@@ -0,0 +1,263 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestPlanList(c *C) {
+	plans := []app.Plan{
+		{Name: "small", Memory: 512},
+		{Name: "huge", Memory: 8192, Teams: []string{"otherteam"}},
+	}
+	for _, p := range plans {
+		err := p.Create()
+		c.Assert(err, IsNil)
+		defer p.Delete()
+	}
+	request, err := http.NewRequest("GET", "/plans", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = PlanList(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var got []app.Plan
+	err = json.NewDecoder(recorder.Body).Decode(&got)
+	c.Assert(err, IsNil)
+	c.Assert(got, HasLen, 1)
+	c.Assert(got[0].Name, Equals, "small")
+	c.Assert(got[0].Memory, Equals, int64(512))
+}
+
+func (s *S) TestPlanListReturnsNoContentWithoutPlans(c *C) {
+	request, err := http.NewRequest("GET", "/plans", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = PlanList(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Code, Equals, http.StatusNoContent)
+}
+
+func (s *S) TestCreatePlanHandler(c *C) {
+	body := strings.NewReader(`{"Name":"small","Memory":512,"CpuShare":100,"Disk":2048,"Default":true}`)
+	request, err := http.NewRequest("POST", "/plans", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePlanHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	defer db.Session.Plans().RemoveId("small")
+	c.Assert(recorder.Code, Equals, http.StatusCreated)
+	plan := app.Plan{Name: "small"}
+	err = plan.Get()
+	c.Assert(err, IsNil)
+	c.Assert(plan.Memory, Equals, int64(512))
+	c.Assert(plan.CpuShare, Equals, 100)
+	c.Assert(plan.Disk, Equals, int64(2048))
+	c.Assert(plan.Default, Equals, true)
+}
+
+func (s *S) TestCreatePlanHandlerInvalidJSON(c *C) {
+	request, err := http.NewRequest("POST", "/plans", strings.NewReader("{{{"))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePlanHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestCreatePlanHandlerInvalidName(c *C) {
+	request, err := http.NewRequest("POST", "/plans", strings.NewReader(`{"Name":"my plan"}`))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePlanHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusPreconditionFailed)
+}
+
+func (s *S) TestCreatePlanHandlerDuplicatePlan(c *C) {
+	plan := app.Plan{Name: "small"}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	request, err := http.NewRequest("POST", "/plans", strings.NewReader(`{"Name":"small"}`))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePlanHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusConflict)
+	c.Assert(e.Message, Equals, `There is already a plan named "small".`)
+}
+
+func (s *S) TestRemovePlanHandler(c *C) {
+	plan := app.Plan{Name: "small"}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	request, err := http.NewRequest("DELETE", "/plans/small?:name=small", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemovePlanHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	count, err := db.Session.Plans().FindId("small").Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 0)
+}
+
+func (s *S) TestRemovePlanHandlerPlanNotFound(c *C) {
+	request, err := http.NewRequest("DELETE", "/plans/unknown?:name=unknown", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemovePlanHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusNotFound)
+}
+
+func (s *S) TestGrantAndRevokePlanToTeamHandlers(c *C) {
+	plan := app.Plan{Name: "huge"}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	url := "/plans/huge/" + s.team.Name + "?:plan=huge&:team=" + s.team.Name
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = GrantPlanToTeamHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	err = plan.Get()
+	c.Assert(err, IsNil)
+	c.Assert(plan.Teams, DeepEquals, []string{s.team.Name})
+	request, err = http.NewRequest("DELETE", url, nil)
+	c.Assert(err, IsNil)
+	recorder = httptest.NewRecorder()
+	err = RevokePlanFromTeamHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	err = plan.Get()
+	c.Assert(err, IsNil)
+	c.Assert(plan.Teams, HasLen, 0)
+}
+
+func (s *S) TestGrantPlanToTeamHandlerTeamNotFound(c *C) {
+	plan := app.Plan{Name: "huge"}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	request, err := http.NewRequest("PUT", "/plans/huge/unknown?:plan=huge&:team=unknown", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = GrantPlanToTeamHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusNotFound)
+	c.Assert(e.Message, Equals, "Team not found")
+}
+
+func (s *S) TestChangePlanHandler(c *C) {
+	plan := app.Plan{Name: "medium", Memory: 1024}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	a := app.App{Name: "growing", Framework: "python", Teams: []string{s.team.Name}}
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("PUT", "/apps/growing/plan?:name=growing", strings.NewReader("medium"))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = ChangePlanHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Plan.Name, Equals, "medium")
+	c.Assert(a.Plan.Memory, Equals, int64(1024))
+}
+
+func (s *S) TestChangePlanHandlerWithoutPlan(c *C) {
+	request, err := http.NewRequest("PUT", "/apps/growing/plan?:name=growing", strings.NewReader(""))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = ChangePlanHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestChangePlanHandlerRestrictedPlan(c *C) {
+	plan := app.Plan{Name: "huge", Teams: []string{"otherteam"}}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	a := app.App{Name: "growing", Framework: "python", Teams: []string{s.team.Name}}
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("PUT", "/apps/growing/plan?:name=growing", strings.NewReader("huge"))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = ChangePlanHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusPreconditionFailed)
+}
+
+func (s *S) TestChangePlanHandlerUserWithoutAccessToTheApp(c *C) {
+	a := app.App{Name: "growing", Framework: "python", Teams: []string{"otherteam"}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("PUT", "/apps/growing/plan?:name=growing", strings.NewReader("medium"))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	u := &auth.User{Email: "nobody@tsuru.io"}
+	err = ChangePlanHandler(recorder, request, u)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAppInfoShowsThePlan(c *C) {
+	a := app.App{
+		Name:      "sized",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Plan:      app.Plan{Name: "small", Memory: 512},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/sized?:name=sized", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = AppInfo(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(recorder.Body)
+	c.Assert(err, IsNil)
+	var got map[string]interface{}
+	err = json.Unmarshal(body, &got)
+	c.Assert(err, IsNil)
+	plan := got["Plan"].(map[string]interface{})
+	c.Assert(plan["Name"], Equals, "small")
+	c.Assert(plan["Memory"], Equals, float64(512))
+}
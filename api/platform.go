@@ -0,0 +1,114 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+func getPlatformOrError(name string) (app.Platform, error) {
+	p := app.Platform{Name: name}
+	if err := p.Get(); err != nil {
+		return p, &errors.Http{Code: http.StatusNotFound, Message: fmt.Sprintf("Platform %s not found.", name)}
+	}
+	return p, nil
+}
+
+// PlatformList lists the platforms available for new apps. Admin users also
+// see deprecated platforms.
+func PlatformList(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	platforms, err := app.ListPlatforms(u)
+	if err != nil {
+		return err
+	}
+	if len(platforms) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return json.NewEncoder(w).Encode(platforms)
+}
+
+// CreatePlatformHandler adds a platform to the catalog. Only admin users can
+// create platforms.
+func CreatePlatformHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	var p app.Platform
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, &p); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid platform definition."}
+	}
+	if err = p.Create(); err != nil {
+		if e, ok := err.(*app.ValidationError); ok {
+			return &errors.Http{Code: http.StatusPreconditionFailed, Message: e.Message}
+		}
+		if strings.Contains(err.Error(), "key error") {
+			msg := fmt.Sprintf(`There is already a platform named "%s".`, p.Name)
+			return &errors.Http{Code: http.StatusConflict, Message: msg}
+		}
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// RemovePlatformHandler removes a platform that is not used by any app. Only
+// admin users can remove platforms.
+func RemovePlatformHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	p, err := getPlatformOrError(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	if err = p.Delete(); err == app.ErrPlatformInUse {
+		return &errors.Http{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	}
+	return err
+}
+
+// DeprecatePlatformHandler disables a platform for new apps.
+func DeprecatePlatformHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	p, err := getPlatformOrError(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	return p.Deprecate()
+}
+
+// EnablePlatformHandler makes a deprecated platform available for new apps
+// again.
+func EnablePlatformHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	p, err := getPlatformOrError(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	return p.Enable()
+}
+
+// PlatformApps returns the names of the apps that use a platform, so admins
+// can track the migration of apps away from deprecated platforms.
+func PlatformApps(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	p, err := getPlatformOrError(r.URL.Query().Get(":name"))
+	if err != nil {
+		return err
+	}
+	apps, err := p.Apps()
+	if err != nil {
+		return err
+	}
+	if len(apps) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return json.NewEncoder(w).Encode(apps)
+}
@@ -0,0 +1,169 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestPlatformList(c *C) {
+	p := app.Platform{Name: "java"}
+	err := p.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().RemoveId(p.Name)
+	err = p.Deprecate()
+	c.Assert(err, IsNil)
+	request, err := http.NewRequest("GET", "/platforms", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = PlatformList(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var got []app.Platform
+	err = json.NewDecoder(recorder.Body).Decode(&got)
+	c.Assert(err, IsNil)
+	names := make([]string, len(got))
+	for i, platform := range got {
+		names[i] = platform.Name
+	}
+	c.Assert(names, DeepEquals, []string{"django", "golang", "gotthard", "python", "ruby", "vougan"})
+}
+
+func (s *S) TestCreatePlatformHandler(c *C) {
+	body := strings.NewReader(`{"Name":"java","Description":"Java with Tomcat","Template":"cs:precise/tomcat"}`)
+	request, err := http.NewRequest("POST", "/platforms", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePlatformHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().RemoveId("java")
+	c.Assert(recorder.Code, Equals, http.StatusCreated)
+	p := app.Platform{Name: "java"}
+	err = p.Get()
+	c.Assert(err, IsNil)
+	c.Assert(p.Template, Equals, "cs:precise/tomcat")
+	c.Assert(p.Enabled, Equals, true)
+}
+
+func (s *S) TestCreatePlatformHandlerWithExistingPlatform(c *C) {
+	body := strings.NewReader(`{"Name":"python"}`)
+	request, err := http.NewRequest("POST", "/platforms", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePlatformHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusConflict)
+	c.Assert(e.Message, Equals, `There is already a platform named "python".`)
+}
+
+func (s *S) TestCreatePlatformHandlerWithInvalidName(c *C) {
+	body := strings.NewReader(`{"Name":"Java 7"}`)
+	request, err := http.NewRequest("POST", "/platforms", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePlatformHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusPreconditionFailed)
+}
+
+func (s *S) TestRemovePlatformHandler(c *C) {
+	p := app.Platform{Name: "java"}
+	err := p.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().RemoveId(p.Name)
+	request, err := http.NewRequest("DELETE", "/platforms/java?:name=java", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemovePlatformHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	n, err := db.Session.Platforms().FindId("java").Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
+func (s *S) TestRemovePlatformHandlerWithPlatformInUse(c *C) {
+	a := app.App{Name: "snake", Framework: "python"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("DELETE", "/platforms/python?:name=python", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemovePlatformHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusPreconditionFailed)
+}
+
+func (s *S) TestRemovePlatformHandlerWithUnknownPlatform(c *C) {
+	request, err := http.NewRequest("DELETE", "/platforms/cobol?:name=cobol", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemovePlatformHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusNotFound)
+}
+
+func (s *S) TestDeprecateAndEnablePlatformHandlers(c *C) {
+	p := app.Platform{Name: "java"}
+	err := p.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().RemoveId(p.Name)
+	request, err := http.NewRequest("PUT", "/platforms/java/deprecate?:name=java", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = DeprecatePlatformHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	err = p.Get()
+	c.Assert(err, IsNil)
+	c.Assert(p.Enabled, Equals, false)
+	request, err = http.NewRequest("PUT", "/platforms/java/enable?:name=java", nil)
+	c.Assert(err, IsNil)
+	recorder = httptest.NewRecorder()
+	err = EnablePlatformHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	err = p.Get()
+	c.Assert(err, IsNil)
+	c.Assert(p.Enabled, Equals, true)
+}
+
+func (s *S) TestPlatformApps(c *C) {
+	a := app.App{Name: "snake", Framework: "python"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/platforms/python/apps?:name=python", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = PlatformApps(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var apps []string
+	err = json.NewDecoder(recorder.Body).Decode(&apps)
+	c.Assert(err, IsNil)
+	c.Assert(apps, DeepEquals, []string{"snake"})
+}
+
+func (s *S) TestPlatformAppsWithoutApps(c *C) {
+	request, err := http.NewRequest("GET", "/platforms/golang/apps?:name=golang", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = PlatformApps(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Code, Equals, http.StatusNoContent)
+}
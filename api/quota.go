@@ -0,0 +1,75 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"strings"
+)
+
+// quotaOwnerOrError returns the owner of the quota in the request, which is a
+// user email or a team name, checking that it exists.
+func quotaOwnerOrError(r *http.Request) (string, error) {
+	owner := r.URL.Query().Get(":owner")
+	var n int
+	var err error
+	if strings.Contains(owner, "@") {
+		n, err = db.Session.Users().Find(bson.M{"email": owner}).Count()
+	} else {
+		n, err = db.Session.Teams().Find(bson.M{"_id": owner}).Count()
+	}
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", &errors.Http{Code: http.StatusNotFound, Message: fmt.Sprintf("Team or user %s not found.", owner)}
+	}
+	return owner, nil
+}
+
+// QuotaHandler returns the quota of a team or user, with its current usage.
+func QuotaHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	owner, err := quotaOwnerOrError(r)
+	if err != nil {
+		return err
+	}
+	q, err := app.GetQuota(owner)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(q)
+}
+
+// ChangeQuotaHandler changes the limits of the quota of a team or user. The
+// body of the request contains the new limits, -1 meaning unlimited:
+//
+//	{"MaxApps": 5, "MaxUnits": 20}
+func ChangeQuotaHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	owner, err := quotaOwnerOrError(r)
+	if err != nil {
+		return err
+	}
+	var limits struct {
+		MaxApps  int
+		MaxUnits int
+	}
+	if err = json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid quota limits."}
+	}
+	if err = app.SetQuota(owner, limits.MaxApps, limits.MaxUnits); err != nil {
+		if e, ok := err.(*app.ValidationError); ok {
+			return &errors.Http{Code: http.StatusPreconditionFailed, Message: e.Message}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+func (s *S) TestQuotaHandler(c *C) {
+	err := db.Session.Quotas().Insert(app.Quota{Owner: s.team.Name, MaxApps: 5, MaxUnits: 10, Apps: 2, Units: 3})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId(s.team.Name)
+	request, err := http.NewRequest("GET", "/quota/tsuruteam?:owner=tsuruteam", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = QuotaHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var q app.Quota
+	err = json.NewDecoder(recorder.Body).Decode(&q)
+	c.Assert(err, IsNil)
+	c.Assert(q, DeepEquals, app.Quota{Owner: s.team.Name, MaxApps: 5, MaxUnits: 10, Apps: 2, Units: 3})
+}
+
+func (s *S) TestQuotaHandlerWithoutQuota(c *C) {
+	request, err := http.NewRequest("GET", "/quota/whydidifall@thewho.com?:owner=whydidifall@thewho.com", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = QuotaHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var q app.Quota
+	err = json.NewDecoder(recorder.Body).Decode(&q)
+	c.Assert(err, IsNil)
+	c.Assert(q.MaxApps, Equals, app.Unlimited)
+	c.Assert(q.MaxUnits, Equals, app.Unlimited)
+}
+
+func (s *S) TestQuotaHandlerWithUnknownOwner(c *C) {
+	request, err := http.NewRequest("GET", "/quota/unknown?:owner=unknown", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = QuotaHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusNotFound)
+	c.Assert(e.Message, Equals, "Team or user unknown not found.")
+}
+
+func (s *S) TestChangeQuotaHandler(c *C) {
+	body := strings.NewReader(`{"MaxApps":3,"MaxUnits":-1}`)
+	request, err := http.NewRequest("PUT", "/quota/tsuruteam?:owner=tsuruteam", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = ChangeQuotaHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId(s.team.Name)
+	q, err := app.GetQuota(s.team.Name)
+	c.Assert(err, IsNil)
+	c.Assert(q.MaxApps, Equals, 3)
+	c.Assert(q.MaxUnits, Equals, app.Unlimited)
+}
+
+func (s *S) TestChangeQuotaHandlerWithInvalidLimits(c *C) {
+	body := strings.NewReader(`{"MaxApps":-5,"MaxUnits":1}`)
+	request, err := http.NewRequest("PUT", "/quota/tsuruteam?:owner=tsuruteam", body)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = ChangeQuotaHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusPreconditionFailed)
+}
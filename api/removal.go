@@ -0,0 +1,38 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/app"
+	"net/http"
+)
+
+// CleanupHandler retries the removals of apps that failed or were
+// interrupted, or only the removals of the app in the "app" parameter. It
+// returns the removals with their new status. Only admin users can clean up
+// removals.
+func CleanupHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	removals, err := app.StuckRemovals(r.URL.Query().Get("app"))
+	if err != nil {
+		return err
+	}
+	if len(removals) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	result := make([]app.Removal, len(removals))
+	for i, removal := range removals {
+		retried, err := app.RetryRemoval(removal.Id)
+		if retried == nil {
+			removal.Error = err.Error()
+			retried = &removal
+		}
+		result[i] = *retried
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,69 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/pipeline"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func (s *S) TestCleanupHandler(c *C) {
+	a := app.App{Name: "halfremoved", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	doc := bson.M{
+		"_id":    "stuck-removal",
+		"kind":   "destroy-app",
+		"target": a.Name,
+		"status": pipeline.Failed,
+		"error":  "database is down",
+		"steps": []pipeline.Step{
+			{Name: "unbind service instances", Status: pipeline.StepDone},
+			{Name: "destroy S3 credentials and bucket", Status: pipeline.StepDone},
+			{Name: "destroy units", Status: pipeline.StepDone},
+			{Name: "remove the app from the router", Status: pipeline.StepDone},
+			{Name: "remove the app from the database", Status: pipeline.StepFailed, Error: "database is down"},
+			{Name: "release quota", Status: pipeline.StepPending},
+		},
+		"context":   bson.M{"appname": a.Name},
+		"heartbeat": time.Now(),
+		"started":   time.Now(),
+	}
+	err = db.Session.Pipelines().Insert(doc)
+	c.Assert(err, IsNil)
+	defer db.Session.Pipelines().RemoveId("stuck-removal")
+	request, err := http.NewRequest("POST", "/removals/cleanup?app=halfremoved", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CleanupHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var removals []app.Removal
+	err = json.NewDecoder(recorder.Body).Decode(&removals)
+	c.Assert(err, IsNil)
+	c.Assert(removals, HasLen, 1)
+	c.Assert(removals[0].App, Equals, "halfremoved")
+	c.Assert(removals[0].Status, Equals, pipeline.Succeeded)
+	c.Assert(removals[0].Steps[4].Status, Equals, pipeline.StepDone)
+	count, err := db.Session.Apps().Find(bson.M{"name": a.Name}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 0)
+}
+
+func (s *S) TestCleanupHandlerWithoutStuckRemovals(c *C) {
+	request, err := http.NewRequest("POST", "/removals/cleanup", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CleanupHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Code, Equals, http.StatusNoContent)
+}
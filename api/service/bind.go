@@ -0,0 +1,85 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/pipeline"
+	"labix.org/v2/mgo/bson"
+)
+
+// bindContext is the context of the pipeline that binds an app to a service
+// instance.
+type bindContext struct {
+	Instance ServiceInstance
+	App      string
+
+	// Hostname is the address of the first unit of the app, used by
+	// services of the first version of the API.
+	Hostname string
+
+	// app is not stored, the backward of the actions use only the name
+	// and the hostname of the app.
+	app bind.App
+
+	// env holds the environment variables returned by the service API.
+	// They're credentials, so they're not stored with the context: a
+	// pipeline interrupted before setting them is rolled back instead of
+	// resumed.
+	env map[string]string
+}
+
+func init() {
+	pipeline.Register("bind-app", func() *pipeline.Pipeline {
+		return newBindPipeline(new(bindContext))
+	})
+}
+
+func newBindPipeline(ctx *bindContext) *pipeline.Pipeline {
+	return pipeline.New("bind-app", ctx,
+		&pipeline.Action{
+			Name: "bind the app in the service",
+			Forward: func() error {
+				cli := ctx.Instance.Service().ProductionEndpoint()
+				env, err := cli.Bind(&ctx.Instance, ctx.app)
+				ctx.env = env
+				return err
+			},
+			Backward: func() {
+				cli := ctx.Instance.Service().ProductionEndpoint()
+				if err := cli.unbind(&ctx.Instance, ctx.App, ctx.Hostname); err != nil {
+					log.Printf("Failed to unbind the app %s from the instance %s: %s", ctx.App, ctx.Instance.Name, err)
+				}
+			},
+		},
+		&pipeline.Action{
+			Name: "add the app to the instance",
+			Forward: func() error {
+				return ctx.Instance.update()
+			},
+			Backward: func() {
+				pull := bson.M{"$pull": bson.M{"apps": ctx.App}}
+				db.Session.ServiceInstances().Update(bson.M{"name": ctx.Instance.Name}, pull)
+			},
+		},
+		&pipeline.Action{
+			Name: "set the environment variables",
+			Forward: func() error {
+				var envVars []bind.EnvVar
+				for k, v := range ctx.env {
+					envVars = append(envVars, bind.EnvVar{
+						Name:         k,
+						Value:        v,
+						Public:       false,
+						InstanceName: ctx.Instance.Name,
+					})
+				}
+				return ctx.app.SetEnvs(envVars, false)
+			},
+		},
+	)
+}
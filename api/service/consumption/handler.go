@@ -32,39 +32,65 @@ func CreateInstanceHandler(w http.ResponseWriter, r *http.Request, u *auth.User)
 		log.Print(err.Error())
 		return &errors.Http{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
+	si, err := CreateInstance(sJson["service_name"], sJson["name"], sJson["plan"], u)
+	if err != nil {
+		return err
+	}
+	if si.State == service.StateCreating {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+// CreateInstance creates a new instance of the service, calling the service
+// API. The instance is available to all teams of the user that have access to
+// the service.
+//
+// The plan is optional, and must be one of the plans of the service that
+// these teams are allowed to use.
+//
+// Services may provision the instance asynchronously, in which case the
+// returned instance is still being created, see service.PollInstances.
+func CreateInstance(serviceName, instanceName, planName string, u *auth.User) (*service.ServiceInstance, error) {
 	var s service.Service
-	err = validateInstanceForCreation(&s, sJson, u)
+	sJson := map[string]string{"service_name": serviceName, "name": instanceName}
+	err := validateInstanceForCreation(&s, sJson, u)
 	if err != nil {
 		log.Print("Got error while validation:")
 		log.Print(err.Error())
-		return err
+		return nil, err
 	}
 	var teamNames []string
 	teams, err := u.Teams()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for _, t := range teams {
 		if s.HasTeam(&t) || !s.IsRestricted {
 			teamNames = append(teamNames, t.Name)
 		}
 	}
+	if planName != "" {
+		if _, err = s.FindPlan(planName, teamNames); err != nil {
+			return nil, err
+		}
+	}
 	si := service.ServiceInstance{
-		Name:        sJson["name"],
-		ServiceName: sJson["service_name"],
+		Name:        instanceName,
+		ServiceName: serviceName,
 		Teams:       teamNames,
+		PlanName:    planName,
 	}
 	if err = s.ProductionEndpoint().Create(&si); err != nil {
 		log.Print("Error while calling create action from service api.")
 		log.Print(err.Error())
-		return err
+		return nil, err
 	}
-	err = si.Create()
-	if err != nil {
-		return err
+	if err = si.Create(); err != nil {
+		return nil, err
 	}
-	fmt.Fprint(w, "success")
-	return nil
+	return &si, nil
 }
 
 func validateInstanceForCreation(s *service.Service, sJson map[string]string, u *auth.User) error {
@@ -97,6 +123,14 @@ func RemoveServiceInstanceHandler(w http.ResponseWriter, r *http.Request, u *aut
 		//TODO(flaviamissi): return err
 		return &errors.Http{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
+	if si.State == service.StateRemoving {
+		if err = si.SetState(service.StateRemoving, ""); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("service instance is being removed"))
+		return nil
+	}
 	err = db.Session.ServiceInstances().Remove(bson.M{"name": name})
 	if err != nil {
 		return err
@@ -131,6 +165,10 @@ func ServiceInstanceStatusHandler(w http.ResponseWriter, r *http.Request, u *aut
 		msg := fmt.Sprintf("Service instance does not exists, error: %s", err.Error())
 		return &errors.Http{Code: http.StatusInternalServerError, Message: msg}
 	}
+	if !si.IsReady() {
+		fmt.Fprintf(w, `Service instance "%s" is %s`, siName, si.StateMessage())
+		return nil
+	}
 	s := si.Service()
 	var b string
 	if b, err = s.ProductionEndpoint().Status(&si); err != nil {
@@ -169,6 +207,28 @@ func ServiceInfoHandler(w http.ResponseWriter, r *http.Request, u *auth.User) er
 	return nil
 }
 
+// ServicePlansHandler lists the plans of the service that the user is
+// allowed to use.
+func ServicePlansHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	s, err := getServiceOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	teams, err := u.Teams()
+	if err != nil {
+		return err
+	}
+	plans, err := s.PlansFor(auth.GetTeamsNames(teams))
+	if err != nil {
+		return err
+	}
+	if len(plans) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return json.NewEncoder(w).Encode(plans)
+}
+
 func Doc(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	sName := r.URL.Query().Get(":name")
 	s, err := getServiceOrError(sName, u)
@@ -115,6 +115,73 @@ func (s *S) TestCreateInstanceHandlerReturnErrorIfTheServiceAPICallFailAndDoesNo
 	c.Assert(err, NotNil)
 }
 
+func (s *S) TestCreateInstanceHandlerSendsAndSavesThePlan(c *C) {
+	var plan string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plan = r.FormValue("plan")
+	}))
+	defer ts.Close()
+	srvc := service.Service{
+		Name:     "mysql",
+		Endpoint: map[string]string{"production": ts.URL},
+		Plans:    []service.Plan{{Name: "small"}, {Name: "big", Teams: []string{s.team.Name}}},
+	}
+	err := srvc.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Services().Remove(bson.M{"_id": "mysql"})
+	b := bytes.NewBufferString(`{"name": "brainSQL", "service_name": "mysql", "plan": "big"}`)
+	request, err := http.NewRequest("POST", "/services/instances", b)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateInstanceHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	defer db.Session.ServiceInstances().Remove(bson.M{"name": "brainSQL"})
+	c.Assert(plan, Equals, "big")
+	var si service.ServiceInstance
+	err = db.Session.ServiceInstances().Find(bson.M{"name": "brainSQL"}).One(&si)
+	c.Assert(err, IsNil)
+	c.Assert(si.PlanName, Equals, "big")
+}
+
+func (s *S) TestCreateInstanceHandlerReturns403WhenTheTeamsCannotUseThePlan(c *C) {
+	srvc := service.Service{Name: "mysql", Plans: []service.Plan{{Name: "big", Teams: []string{"admin"}}}}
+	err := srvc.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Services().Remove(bson.M{"_id": "mysql"})
+	b := bytes.NewBufferString(`{"name": "brainSQL", "service_name": "mysql", "plan": "big"}`)
+	request, err := http.NewRequest("POST", "/services/instances", b)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateInstanceHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusForbidden)
+	n, err := db.Session.ServiceInstances().Find(bson.M{"name": "brainSQL"}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
+func (s *S) TestCreateInstanceHandlerSavesInstancesThatAreStillBeingCreated(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Services().Remove(bson.M{"_id": "mysql"})
+	recorder, request := makeRequestToCreateInstanceHandler(c)
+	err = CreateInstanceHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	defer db.Session.ServiceInstances().Remove(bson.M{"name": "brainSQL"})
+	c.Assert(recorder.Code, Equals, http.StatusAccepted)
+	var si service.ServiceInstance
+	err = db.Session.ServiceInstances().Find(bson.M{"name": "brainSQL"}).One(&si)
+	c.Assert(err, IsNil)
+	c.Assert(si.State, Equals, service.StateCreating)
+}
+
 func makeRequestToRemoveInstanceHandler(name string, c *C) (*httptest.ResponseRecorder, *http.Request) {
 	url := fmt.Sprintf("/services/c/instances/%s?:name=%s", name, name)
 	request, err := http.NewRequest("DELETE", url, nil)
@@ -220,6 +287,51 @@ func (s *S) TestremoveServiceShouldNotRemoveTheServiceIfTheServiceAPICallFail(c
 	c.Assert(e.Message, Equals, "Failed to destroy the instance deepercut-instance: it's a test!")
 }
 
+func (s *S) TestRemoveServiceInstanceHandlerKeepsInstancesThatAreStillBeingRemoved(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	se := service.Service{Name: "deepercut", Endpoint: map[string]string{"production": ts.URL}}
+	err := se.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Services().Remove(bson.M{"_id": se.Name})
+	si := service.ServiceInstance{Name: "deepercut-instance", ServiceName: "deepercut", Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.ServiceInstances().Remove(bson.M{"name": si.Name})
+	recorder, request := makeRequestToRemoveInstanceHandler("deepercut-instance", c)
+	err = RemoveServiceInstanceHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Code, Equals, http.StatusAccepted)
+	c.Assert(recorder.Body.String(), Equals, "service instance is being removed")
+	err = db.Session.ServiceInstances().Find(bson.M{"name": si.Name}).One(&si)
+	c.Assert(err, IsNil)
+	c.Assert(si.State, Equals, service.StateRemoving)
+}
+
+func (s *S) TestRemoveServiceInstanceHandlerRemovesInstancesThatWereBeingRemoved(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	se := service.Service{Name: "deepercut", Endpoint: map[string]string{"production": ts.URL}}
+	err := se.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Services().Remove(bson.M{"_id": se.Name})
+	si := service.ServiceInstance{Name: "deepercut-instance", ServiceName: "deepercut", Teams: []string{s.team.Name}, State: service.StateRemoving}
+	err = si.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.ServiceInstances().Remove(bson.M{"name": si.Name})
+	recorder, request := makeRequestToRemoveInstanceHandler("deepercut-instance", c)
+	err = RemoveServiceInstanceHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	n, err := db.Session.ServiceInstances().Find(bson.M{"name": si.Name}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
 func (s *S) TestServicesInstancesHandler(c *C) {
 	srv := service.Service{Name: "redis", Teams: []string{s.team.Name}}
 	err := srv.Create()
@@ -357,6 +469,21 @@ func (s *S) TestServiceInstanceStatusHandler(c *C) {
 	c.Assert(string(b), Equals, "Service instance \"my_nosql\" is up")
 }
 
+func (s *S) TestServiceInstanceStatusHandlerReportsTheStateOfInstancesThatAreNotReady(c *C) {
+	srv := service.Service{Name: "mongodb"}
+	err := srv.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Services().Remove(bson.M{"_id": "mongodb"})
+	si := service.ServiceInstance{Name: "my_nosql", ServiceName: srv.Name, State: service.StateFailed, Error: "Disk full."}
+	err = si.Create()
+	c.Assert(err, IsNil)
+	defer si.Delete()
+	recorder, request := makeRequestToStatusHandler("my_nosql", c)
+	err = ServiceInstanceStatusHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Body.String(), Equals, `Service instance "my_nosql" is in error: Disk full.`)
+}
+
 func (s *S) TestServiceInstanceStatusHandlerShouldReturnErrorWHenNameIsNotProvided(c *C) {
 	recorder, request := makeRequestToStatusHandler("", c)
 	err := ServiceInstanceStatusHandler(recorder, request, s.user)
@@ -479,6 +606,40 @@ func (s *S) makeRequestToGetDocHandler(name string, c *C) (*httptest.ResponseRec
 	return recorder, request
 }
 
+func (s *S) TestServicePlansHandler(c *C) {
+	srvc := service.Service{Name: "mysql", Plans: []service.Plan{
+		{Name: "small", Description: "1GB"},
+		{Name: "big", Description: "10GB", Teams: []string{"admin"}},
+	}}
+	err := srvc.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Services().Remove(bson.M{"_id": "mysql"})
+	request, err := http.NewRequest("GET", "/services/mysql/plans?:name=mysql", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = ServicePlansHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var plans []service.Plan
+	err = json.NewDecoder(recorder.Body).Decode(&plans)
+	c.Assert(err, IsNil)
+	c.Assert(plans, DeepEquals, []service.Plan{{Name: "small", Description: "1GB"}})
+}
+
+func (s *S) TestServicePlansHandlerWithoutPlans(c *C) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Services().Remove(bson.M{"_id": "mysql"})
+	request, err := http.NewRequest("GET", "/services/mysql/plans?:name=mysql", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = ServicePlansHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.Code, Equals, http.StatusNoContent)
+}
+
 func (s *S) TestDocHandler(c *C) {
 	doc := `Doc for coolnosql
 Collnosql is a really really cool nosql`
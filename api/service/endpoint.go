@@ -18,6 +18,10 @@ import (
 
 type Client struct {
 	endpoint string
+
+	// version is the version of the service API contract, see
+	// Service.ApiVersion.
+	version int
 }
 
 func (c *Client) buildErrorMessage(err error, resp *http.Response) (msg string) {
@@ -62,6 +66,10 @@ func (c *Client) jsonFromResponse(resp *http.Response) (env map[string]string, e
 	return
 }
 
+// Create calls the creation of the service instance. Services that provision
+// instances asynchronously answer with 202 Accepted, and the State of the
+// instance is set to StateCreating, until the service reports it's ready, see
+// PollInstances. Otherwise the instance is ready.
 func (c *Client) Create(instance *ServiceInstance) error {
 	var err error
 	log.Print("Attempting to call creation of service instance " + instance.Name + " at " + instance.ServiceName + " api")
@@ -69,7 +77,14 @@ func (c *Client) Create(instance *ServiceInstance) error {
 	params := map[string][]string{
 		"name": {instance.Name},
 	}
+	if instance.PlanName != "" {
+		params["plan"] = []string{instance.PlanName}
+	}
 	if resp, err = c.issueRequest("/resources", "POST", params); err == nil && resp.StatusCode < 300 {
+		instance.State = StateReady
+		if resp.StatusCode == http.StatusAccepted {
+			instance.State = StateCreating
+		}
 		return nil
 	} else {
 		msg := "Failed to create the instance " + instance.Name + ": " + c.buildErrorMessage(err, resp)
@@ -79,6 +94,10 @@ func (c *Client) Create(instance *ServiceInstance) error {
 	return err
 }
 
+// Destroy calls the removal of the service instance. Services that remove
+// instances asynchronously answer with 202 Accepted, and the State of the
+// instance is set to StateRemoving, until the service reports it's gone, see
+// PollInstances. Otherwise the instance is gone, and its State is reset.
 func (c *Client) Destroy(instance *ServiceInstance) (err error) {
 	log.Print("Attempting to call destroy of service instance " + instance.Name + " at " + instance.ServiceName + " api")
 	var resp *http.Response
@@ -86,19 +105,35 @@ func (c *Client) Destroy(instance *ServiceInstance) (err error) {
 		msg := "Failed to destroy the instance " + instance.Name + ": " + c.buildErrorMessage(err, resp)
 		log.Print(msg)
 		err = &errors.Http{Code: http.StatusInternalServerError, Message: msg}
+	} else if err == nil {
+		instance.State = ""
+		if resp.StatusCode == http.StatusAccepted {
+			instance.State = StateRemoving
+		}
 	}
 	return err
 }
 
+// Bind calls the bind of the service instance and the app. Services of the
+// version 2 of the API receive the name of the app and the addresses of all
+// its units, the others receive the address of the first unit.
 func (c *Client) Bind(instance *ServiceInstance, app bind.App) (envVars map[string]string, err error) {
 	log.Print("Attempting to call bind of service instance " + instance.Name + " and app " + app.GetName() + " at " + instance.ServiceName + " api")
 	var resp *http.Response
-	params := map[string][]string{
-		"hostname": {app.GetUnits()[0].GetIp()},
+	var params map[string][]string
+	if c.version >= 2 {
+		params = map[string][]string{
+			"app-name":  {app.GetName()},
+			"unit-host": unitHosts(app.GetUnits()),
+		}
+	} else {
+		params = map[string][]string{
+			"hostname": {app.GetUnits()[0].GetIp()},
+		}
 	}
 	if resp, err = c.issueRequest("/resources/"+instance.Name, "POST", params); err == nil && resp.StatusCode < 300 {
 		return c.jsonFromResponse(resp)
-	} else if resp.StatusCode == http.StatusPreconditionFailed {
+	} else if err == nil && resp.StatusCode == http.StatusPreconditionFailed {
 		err = &errors.Http{Code: resp.StatusCode, Message: "You cannot bind any app to this service instance because it is not ready yet."}
 	} else {
 		msg := "Failed to bind instance " + instance.Name + " to the app " + app.GetName() + ": " + c.buildErrorMessage(err, resp)
@@ -108,18 +143,135 @@ func (c *Client) Bind(instance *ServiceInstance, app bind.App) (envVars map[stri
 	return
 }
 
-func (c *Client) Unbind(instance *ServiceInstance, app bind.App) (err error) {
-	log.Print("Attempting to call unbind of service instance " + instance.Name + " and app " + app.GetName() + " at " + instance.ServiceName + " api")
+// unitHosts returns the addresses of the units. Units that don't have an
+// address yet are skipped, they're bound with BindUnit when they get one.
+func unitHosts(units []bind.Unit) []string {
+	var hosts []string
+	for _, u := range units {
+		if ip := u.GetIp(); ip != "" {
+			hosts = append(hosts, ip)
+		}
+	}
+	return hosts
+}
+
+// Unbind calls the unbind of the service instance and the app. Services of
+// the first version of the API aren't called for apps without units, as they
+// know apps only by the address of their first unit.
+func (c *Client) Unbind(instance *ServiceInstance, app bind.App) error {
+	var host string
+	if c.version < 2 {
+		units := app.GetUnits()
+		if len(units) == 0 {
+			return nil
+		}
+		host = units[0].GetIp()
+	}
+	return c.unbind(instance, app.GetName(), host)
+}
+
+// unbind calls the unbind of the service instance and the app. Services of
+// the first version of the API receive the given host of the app instead of
+// its name.
+func (c *Client) unbind(instance *ServiceInstance, appName, host string) (err error) {
+	log.Print("Attempting to call unbind of service instance " + instance.Name + " and app " + appName + " at " + instance.ServiceName + " api")
 	var resp *http.Response
-	url := "/resources/" + instance.Name + "/hostname/" + app.GetUnits()[0].GetIp()
+	url := "/resources/" + instance.Name + "/hostname/" + host
+	if c.version >= 2 {
+		url = "/resources/" + instance.Name + "/apps/" + appName
+	}
 	if resp, err = c.issueRequest(url, "DELETE", nil); err == nil && resp.StatusCode > 299 {
-		msg := "Failed to unbind instance " + instance.Name + " from the app " + app.GetName() + ": " + c.buildErrorMessage(err, resp)
+		msg := "Failed to unbind instance " + instance.Name + " from the app " + appName + ": " + c.buildErrorMessage(err, resp)
+		log.Print(msg)
+		err = &errors.Http{Code: http.StatusInternalServerError, Message: msg}
+	}
+	return
+}
+
+// BindUnit tells the service instance that a unit was added to an app bound
+// to it. Only services of the version 2 of the API are called, and only for
+// units that have an address: units created without one are bound by the
+// collector when they get it.
+func (c *Client) BindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) (err error) {
+	if c.version < 2 || unit.GetIp() == "" {
+		return nil
+	}
+	log.Print("Attempting to call bind of service instance " + instance.Name + " and a unit of the app " + app.GetName() + " at " + instance.ServiceName + " api")
+	var resp *http.Response
+	params := map[string][]string{
+		"app-name":  {app.GetName()},
+		"unit-host": {unit.GetIp()},
+	}
+	if resp, err = c.issueRequest("/resources/"+instance.Name+"/units", "POST", params); err != nil || resp.StatusCode > 299 {
+		msg := "Failed to bind the unit " + unit.GetIp() + " of the app " + app.GetName() + " to the instance " + instance.Name + ": " + c.buildErrorMessage(err, resp)
 		log.Print(msg)
 		err = &errors.Http{Code: http.StatusInternalServerError, Message: msg}
 	}
 	return
 }
 
+// UnbindUnit tells the service instance that a unit was removed from an app
+// bound to it. Only services of the version 2 of the API are called, and only
+// for units that have an address, as the others were never bound.
+func (c *Client) UnbindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) (err error) {
+	if c.version < 2 || unit.GetIp() == "" {
+		return nil
+	}
+	log.Print("Attempting to call unbind of service instance " + instance.Name + " and a unit of the app " + app.GetName() + " at " + instance.ServiceName + " api")
+	var resp *http.Response
+	params := map[string][]string{
+		"app-name":  {app.GetName()},
+		"unit-host": {unit.GetIp()},
+	}
+	if resp, err = c.issueRequest("/resources/"+instance.Name+"/units", "DELETE", params); err != nil || resp.StatusCode > 299 {
+		msg := "Failed to unbind the unit " + unit.GetIp() + " of the app " + app.GetName() + " from the instance " + instance.Name + ": " + c.buildErrorMessage(err, resp)
+		log.Print(msg)
+		err = &errors.Http{Code: http.StatusInternalServerError, Message: msg}
+	}
+	return
+}
+
+// Plans returns the plans provided by the service API, from GET
+// /resources/plans. Services that don't provide plans may answer with 404 or
+// 204.
+func (c *Client) Plans() ([]Plan, error) {
+	log.Print("Attempting to call plans of service api at " + c.endpoint)
+	resp, err := c.issueRequest("/resources/plans", "GET", nil)
+	if err == nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNoContent) {
+		resp.Body.Close()
+		return nil, nil
+	}
+	if err != nil || resp.StatusCode > 299 {
+		msg := "Failed to get the plans of the service: " + c.buildErrorMessage(err, resp)
+		log.Print(msg)
+		return nil, &errors.Http{Code: http.StatusInternalServerError, Message: msg}
+	}
+	defer resp.Body.Close()
+	var plans []Plan
+	if err = json.NewDecoder(resp.Body).Decode(&plans); err != nil {
+		return nil, err
+	}
+	for i := range plans {
+		plans[i].Teams = nil
+	}
+	return plans, nil
+}
+
+// status returns the status code and the body of the response of the status
+// of the service instance.
+func (c *Client) status(instance *ServiceInstance) (int, string, error) {
+	resp, err := c.issueRequest("/resources/"+instance.Name+"/status", "GET", nil)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, strings.TrimSpace(string(b)), nil
+}
+
 // Connects into service's api
 // The api should be prepared to receive the request,
 // like below:
@@ -96,6 +96,43 @@ func (s *S) TestCreateShouldSendTheNameOfTheResourceToTheEndpoint(c *C) {
 	c.Assert(map[string][]string(v), DeepEquals, map[string][]string{"name": {"my-redis"}})
 }
 
+func (s *S) TestCreateSendsThePlanOfTheInstance(c *C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis", PlanName: "small"}
+	client := &Client{endpoint: ts.URL}
+	err := client.Create(&instance)
+	c.Assert(err, IsNil)
+	h.Lock()
+	defer h.Unlock()
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, IsNil)
+	c.Assert(map[string][]string(v), DeepEquals, map[string][]string{"name": {"my-redis"}, "plan": {"small"}})
+}
+
+func (s *S) TestCreateSetsTheStateOfTheInstance(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	err := (&Client{endpoint: ts.URL}).Create(&instance)
+	c.Assert(err, IsNil)
+	c.Assert(instance.State, Equals, StateReady)
+}
+
+func (s *S) TestCreateAcceptedByTheServiceIsStillBeingCreated(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	err := (&Client{endpoint: ts.URL}).Create(&instance)
+	c.Assert(err, IsNil)
+	c.Assert(instance.State, Equals, StateCreating)
+}
+
 func (s *S) TestCreateShouldReturnErrorIfTheRequestFail(c *C) {
 	ts := httptest.NewServer(http.HandlerFunc(failHandler))
 	defer ts.Close()
@@ -120,6 +157,28 @@ func (s *S) TestDestroyShouldSendADELETERequestToTheResourceURL(c *C) {
 	c.Assert(h.method, Equals, "DELETE")
 }
 
+func (s *S) TestDestroyAcceptedByTheServiceIsStillBeingRemoved(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "his-redis", ServiceName: "redis", State: StateReady}
+	err := (&Client{endpoint: ts.URL}).Destroy(&instance)
+	c.Assert(err, IsNil)
+	c.Assert(instance.State, Equals, StateRemoving)
+}
+
+func (s *S) TestDestroyResetsTheStateOfInstancesRemovedByTheService(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "his-redis", ServiceName: "redis", State: StateRemoving}
+	err := (&Client{endpoint: ts.URL}).Destroy(&instance)
+	c.Assert(err, IsNil)
+	c.Assert(instance.State, Equals, "")
+}
+
 func (s *S) TestDestroyShouldReturnErrorIfTheRequestFails(c *C) {
 	ts := httptest.NewServer(http.HandlerFunc(failHandler))
 	defer ts.Close()
@@ -236,6 +295,150 @@ func (s *S) TestUnbindReturnsErrorIfTheRequestFails(c *C) {
 	c.Assert(err, ErrorMatches, "^Failed to unbind instance heaven-can-wait from the app arch-enemy: Server failed to do its job.$")
 }
 
+func (s *S) TestBindV2SendsTheAppNameAndAllUnits(c *C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := FakeApp{name: "her-app", ip: "10.0.10.1"}
+	client := &Client{endpoint: ts.URL, version: 2}
+	_, err := client.Bind(&instance, &a)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, IsNil)
+	c.Assert(h.url, Equals, "/resources/her-redis")
+	c.Assert(h.method, Equals, "POST")
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, IsNil)
+	expected := map[string][]string{"app-name": {"her-app"}, "unit-host": {"10.0.10.1"}}
+	c.Assert(map[string][]string(v), DeepEquals, expected)
+}
+
+func (s *S) TestUnbindV2SendsADELETERequestToTheAppURL(c *C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "heaven-can-wait", ServiceName: "heaven"}
+	a := FakeApp{name: "arch-enemy", ip: "2.2.2.2"}
+	client := &Client{endpoint: ts.URL, version: 2}
+	err := client.Unbind(&instance, &a)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, IsNil)
+	c.Assert(h.url, Equals, "/resources/heaven-can-wait/apps/arch-enemy")
+	c.Assert(h.method, Equals, "DELETE")
+}
+
+func (s *S) TestBindUnit(c *C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := FakeApp{name: "her-app", ip: "10.0.10.1"}
+	client := &Client{endpoint: ts.URL, version: 2}
+	err := client.BindUnit(&instance, &a, &FakeUnit{ip: "10.0.10.2"})
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, IsNil)
+	c.Assert(h.url, Equals, "/resources/her-redis/units")
+	c.Assert(h.method, Equals, "POST")
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, IsNil)
+	expected := map[string][]string{"app-name": {"her-app"}, "unit-host": {"10.0.10.2"}}
+	c.Assert(map[string][]string(v), DeepEquals, expected)
+}
+
+func (s *S) TestBindUnitReturnsErrorIfTheRequestFails(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := FakeApp{name: "her-app", ip: "10.0.10.1"}
+	client := &Client{endpoint: ts.URL, version: 2}
+	err := client.BindUnit(&instance, &a, &FakeUnit{ip: "10.0.10.2"})
+	c.Assert(err, ErrorMatches, "^Failed to bind the unit 10.0.10.2 of the app her-app to the instance her-redis: Server failed to do its job.$")
+}
+
+func (s *S) TestBindUnitSkipsUnitsWithoutAddress(c *C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := FakeApp{name: "her-app", ip: "10.0.10.1"}
+	client := &Client{endpoint: ts.URL, version: 2}
+	err := client.BindUnit(&instance, &a, &FakeUnit{})
+	c.Assert(err, IsNil)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(h.url, Equals, "")
+}
+
+func (s *S) TestUnitHostsSkipsUnitsWithoutAddress(c *C) {
+	hosts := unitHosts([]bind.Unit{&FakeUnit{ip: "10.0.10.1"}, &FakeUnit{}, &FakeUnit{ip: "10.0.10.3"}})
+	c.Assert(hosts, DeepEquals, []string{"10.0.10.1", "10.0.10.3"})
+}
+
+func (s *S) TestUnbindUnit(c *C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := FakeApp{name: "her-app", ip: "10.0.10.1"}
+	client := &Client{endpoint: ts.URL, version: 2}
+	err := client.UnbindUnit(&instance, &a, &FakeUnit{ip: "10.0.10.2"})
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, IsNil)
+	c.Assert(h.url, Equals, "/resources/her-redis/units?app-name=her-app&unit-host=10.0.10.2")
+	c.Assert(h.method, Equals, "DELETE")
+}
+
+func (s *S) TestUnitCallsAreSkippedInTheFirstVersionOfTheApi(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := FakeApp{name: "her-app", ip: "10.0.10.1"}
+	client := &Client{endpoint: ts.URL}
+	err := client.BindUnit(&instance, &a, &FakeUnit{ip: "10.0.10.2"})
+	c.Assert(err, IsNil)
+	err = client.UnbindUnit(&instance, &a, &FakeUnit{ip: "10.0.10.2"})
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestPlans(c *C) {
+	var method, path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		w.Write([]byte(`[{"name":"small","description":"1GB"},{"name":"big","description":"10GB","teams":["admin"]}]`))
+	}))
+	defer ts.Close()
+	client := &Client{endpoint: ts.URL}
+	plans, err := client.Plans()
+	c.Assert(err, IsNil)
+	c.Assert(method, Equals, "GET")
+	c.Assert(path, Equals, "/resources/plans")
+	c.Assert(plans, DeepEquals, []Plan{{Name: "small", Description: "1GB"}, {Name: "big", Description: "10GB"}})
+}
+
+func (s *S) TestPlansOfServicesWithoutPlans(c *C) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	plans, err := (&Client{endpoint: ts.URL}).Plans()
+	c.Assert(err, IsNil)
+	c.Assert(plans, HasLen, 0)
+	ts = httptest.NewServer(http.HandlerFunc(noContentHandler))
+	defer ts.Close()
+	plans, err = (&Client{endpoint: ts.URL}).Plans()
+	c.Assert(err, IsNil)
+	c.Assert(plans, HasLen, 0)
+}
+
+func (s *S) TestPlansReturnsErrorIfTheRequestFails(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer ts.Close()
+	_, err := (&Client{endpoint: ts.URL}).Plans()
+	c.Assert(err, ErrorMatches, "^Failed to get the plans of the service: Server failed to do its job.$")
+}
+
 func (s *S) TestBuildErrorMessageWithNilResponse(c *C) {
 	cli := Client{}
 	err := stderrors.New("epic fail")
@@ -0,0 +1,86 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+)
+
+// Plan is a flavor of the instances of a service, chosen when the instance
+// is created, e.g. the size of a database. Plans are either declared in the
+// manifest of the service, or provided by the service API.
+type Plan struct {
+	Name        string
+	Description string
+
+	// Teams restricts the plan to the given teams. Plans without teams
+	// are available to all teams that have access to the service. Only
+	// plans declared in the manifest can be restricted.
+	Teams []string `json:",omitempty"`
+}
+
+// AllowedFor indicates whether any of the given teams is allowed to use the
+// plan.
+func (p *Plan) AllowedFor(teams []string) bool {
+	if len(p.Teams) == 0 {
+		return true
+	}
+	for _, team := range teams {
+		for _, t := range p.Teams {
+			if t == team {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetPlans returns the plans of the service: the plans declared in its
+// manifest or, if there are none, the plans provided by the service API.
+func (s *Service) GetPlans() ([]Plan, error) {
+	if len(s.Plans) > 0 {
+		return s.Plans, nil
+	}
+	return s.ProductionEndpoint().Plans()
+}
+
+// PlansFor returns the plans of the service that any of the given teams is
+// allowed to use.
+func (s *Service) PlansFor(teams []string) ([]Plan, error) {
+	plans, err := s.GetPlans()
+	if err != nil {
+		return nil, err
+	}
+	var allowed []Plan
+	for _, p := range plans {
+		if p.AllowedFor(teams) {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed, nil
+}
+
+// FindPlan returns the plan of the service with the given name, if any of
+// the given teams is allowed to use it.
+func (s *Service) FindPlan(name string, teams []string) (*Plan, error) {
+	plans, err := s.GetPlans()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range plans {
+		if p.Name != name {
+			continue
+		}
+		if !p.AllowedFor(teams) {
+			msg := fmt.Sprintf("You don't have access to the plan %q of the service %q.", name, s.Name)
+			return nil, &errors.Http{Code: http.StatusForbidden, Message: msg}
+		}
+		return &p, nil
+	}
+	msg := fmt.Sprintf("The service %q doesn't have the plan %q.", s.Name, name)
+	return nil, &errors.Http{Code: http.StatusNotFound, Message: msg}
+}
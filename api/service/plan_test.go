@@ -0,0 +1,68 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"github.com/globocom/tsuru/errors"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+)
+
+func (s *S) TestPlanAllowedFor(c *C) {
+	p := Plan{Name: "small"}
+	c.Assert(p.AllowedFor(nil), Equals, true)
+	p.Teams = []string{"admin", "ops"}
+	c.Assert(p.AllowedFor([]string{"developers", "ops"}), Equals, true)
+	c.Assert(p.AllowedFor([]string{"developers"}), Equals, false)
+	c.Assert(p.AllowedFor(nil), Equals, false)
+}
+
+func (s *S) TestGetPlansReturnsTheDeclaredPlans(c *C) {
+	srvc := Service{Name: "mysql", Plans: []Plan{{Name: "small"}}}
+	plans, err := srvc.GetPlans()
+	c.Assert(err, IsNil)
+	c.Assert(plans, DeepEquals, srvc.Plans)
+}
+
+func (s *S) TestGetPlansFetchesThePlansFromTheServiceApi(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name":"small","description":"1GB"}]`))
+	}))
+	defer ts.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	plans, err := srvc.GetPlans()
+	c.Assert(err, IsNil)
+	c.Assert(plans, DeepEquals, []Plan{{Name: "small", Description: "1GB"}})
+}
+
+func (s *S) TestPlansFor(c *C) {
+	srvc := Service{Name: "mysql", Plans: []Plan{
+		{Name: "small"},
+		{Name: "big", Teams: []string{"admin"}},
+	}}
+	plans, err := srvc.PlansFor([]string{"developers"})
+	c.Assert(err, IsNil)
+	c.Assert(plans, DeepEquals, []Plan{{Name: "small"}})
+	plans, err = srvc.PlansFor([]string{"developers", "admin"})
+	c.Assert(err, IsNil)
+	c.Assert(plans, DeepEquals, srvc.Plans)
+}
+
+func (s *S) TestFindPlan(c *C) {
+	srvc := Service{Name: "mysql", Plans: []Plan{
+		{Name: "small"},
+		{Name: "big", Teams: []string{"admin"}},
+	}}
+	plan, err := srvc.FindPlan("big", []string{"admin"})
+	c.Assert(err, IsNil)
+	c.Assert(plan.Name, Equals, "big")
+	_, err = srvc.FindPlan("big", []string{"developers"})
+	c.Assert(err, ErrorMatches, `^You don't have access to the plan "big" of the service "mysql".$`)
+	c.Assert(err.(*errors.Http).Code, Equals, http.StatusForbidden)
+	_, err = srvc.FindPlan("huge", []string{"admin"})
+	c.Assert(err, ErrorMatches, `^The service "mysql" doesn't have the plan "huge".$`)
+	c.Assert(err.(*errors.Http).Code, Equals, http.StatusNotFound)
+}
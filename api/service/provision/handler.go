@@ -18,8 +18,33 @@ import (
 )
 
 type serviceYaml struct {
-	Id       string
-	Endpoint map[string]string
+	Id         string
+	Endpoint   map[string]string
+	ApiVersion int `yaml:"api-version"`
+	Plans      []service.Plan
+}
+
+func (sy *serviceYaml) validateApiVersion() error {
+	if sy.ApiVersion < 0 || sy.ApiVersion > service.MaxApiVersion {
+		msg := fmt.Sprintf("Unsupported API version: %d. The latest version is %d.", sy.ApiVersion, service.MaxApiVersion)
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+	}
+	return nil
+}
+
+func (sy *serviceYaml) validatePlans() error {
+	names := make(map[string]bool, len(sy.Plans))
+	for _, p := range sy.Plans {
+		if p.Name == "" {
+			return &errors.Http{Code: http.StatusBadRequest, Message: "The name of the plans is required."}
+		}
+		if names[p.Name] {
+			msg := fmt.Sprintf("The plan %q is declared more than once.", p.Name)
+			return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+		}
+		names[p.Name] = true
+	}
+	return nil
 }
 
 func ServicesHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
@@ -49,6 +74,12 @@ func CreateHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	if _, ok := sy.Endpoint["production"]; !ok {
 		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide a production endpoint in the manifest file."}
 	}
+	if err = sy.validateApiVersion(); err != nil {
+		return err
+	}
+	if err = sy.validatePlans(); err != nil {
+		return err
+	}
 	var teams []auth.Team
 	db.Session.Teams().Find(bson.M{"users": u.Email}).All(&teams)
 	if len(teams) == 0 {
@@ -67,6 +98,8 @@ func CreateHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 		Name:       sy.Id,
 		Endpoint:   sy.Endpoint,
 		OwnerTeams: auth.GetTeamsNames(teams),
+		ApiVersion: sy.ApiVersion,
+		Plans:      sy.Plans,
 	}
 	err = s.Create()
 	if err != nil {
@@ -84,11 +117,19 @@ func UpdateHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
 	}
 	var yaml serviceYaml
 	goyaml.Unmarshal(body, &yaml)
+	if err = yaml.validateApiVersion(); err != nil {
+		return err
+	}
+	if err = yaml.validatePlans(); err != nil {
+		return err
+	}
 	s, err := getServiceOrError(yaml.Id, u)
 	if err != nil {
 		return err
 	}
 	s.Endpoint = yaml.Endpoint
+	s.ApiVersion = yaml.ApiVersion
+	s.Plans = yaml.Plans
 	if err = s.Update(); err != nil {
 		return err
 	}
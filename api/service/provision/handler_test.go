@@ -157,6 +157,85 @@ func (s *S) TestCreateHandlerReturnsBadRequestIfTheServiceDoesNotHaveAProduction
 	c.Assert(e.Message, Equals, "You must provide a production endpoint in the manifest file.")
 }
 
+func (s *S) TestCreateHandlerSavesTheApiVersion(c *C) {
+	manifest := `id: some_service
+api-version: 2
+endpoint:
+    production: someservice.com
+`
+	request, err := http.NewRequest("POST", "/services", bytes.NewBufferString(manifest))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var rService service.Service
+	err = db.Session.Services().Find(bson.M{"_id": "some_service"}).One(&rService)
+	c.Assert(err, IsNil)
+	c.Assert(rService.ApiVersion, Equals, 2)
+}
+
+func (s *S) TestCreateHandlerRejectsUnsupportedApiVersions(c *C) {
+	manifest := `id: some_service
+api-version: 3
+endpoint:
+    production: someservice.com
+`
+	request, err := http.NewRequest("POST", "/services", bytes.NewBufferString(manifest))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+	c.Assert(e.Message, Equals, "Unsupported API version: 3. The latest version is 2.")
+}
+
+func (s *S) TestCreateHandlerSavesThePlans(c *C) {
+	manifest := `id: some_service
+endpoint:
+    production: someservice.com
+plans:
+  - name: small
+    description: 1GB of storage
+  - name: big
+    description: 10GB of storage
+    teams: [admin]
+`
+	request, err := http.NewRequest("POST", "/services", bytes.NewBufferString(manifest))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateHandler(recorder, request, s.user)
+	c.Assert(err, IsNil)
+	var rService service.Service
+	err = db.Session.Services().Find(bson.M{"_id": "some_service"}).One(&rService)
+	c.Assert(err, IsNil)
+	expected := []service.Plan{
+		{Name: "small", Description: "1GB of storage"},
+		{Name: "big", Description: "10GB of storage", Teams: []string{"admin"}},
+	}
+	c.Assert(rService.Plans, DeepEquals, expected)
+}
+
+func (s *S) TestCreateHandlerRejectsDuplicatedPlans(c *C) {
+	manifest := `id: some_service
+endpoint:
+    production: someservice.com
+plans:
+  - name: small
+  - name: small
+`
+	request, err := http.NewRequest("POST", "/services", bytes.NewBufferString(manifest))
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusBadRequest)
+	c.Assert(e.Message, Equals, `The plan "small" is declared more than once.`)
+}
+
 func (s *S) TestUpdateHandlerShouldUpdateTheServiceWithDataFromManifest(c *C) {
 	service := service.Service{Name: "mysqlapi", Endpoint: map[string]string{"production": "sqlapi.com"}, OwnerTeams: []string{s.team.Name}}
 	err := service.Create()
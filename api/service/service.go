@@ -20,8 +20,22 @@ type Service struct {
 	Status       string
 	Doc          string
 	IsRestricted bool `bson:"is_restricted"`
+
+	// ApiVersion is the version of the service API contract implemented
+	// by the service. In the first version, the default, apps are bound
+	// through the address of their first unit. In the version 2, the
+	// service receives the addresses of all units of the app, and is told
+	// when units are added or removed, see Client.BindUnit.
+	ApiVersion int `bson:"api_version"`
+
+	// Plans are the plans declared in the manifest of the service, see
+	// GetPlans.
+	Plans []Plan
 }
 
+// MaxApiVersion is the latest version of the service API contract.
+const MaxApiVersion = 2
+
 type ServiceModel struct {
 	Service   string
 	Instances []string
@@ -51,7 +65,7 @@ func (s *Service) getClient(endpoint string) (cli *Client, err error) {
 		if !strings.HasPrefix(e, "http://") {
 			e = "http://" + e
 		}
-		cli = &Client{endpoint: e}
+		cli = &Client{endpoint: e, version: s.ApiVersion}
 	} else {
 		err = errors.New("Unknown endpoint: " + endpoint)
 	}
@@ -6,19 +6,52 @@ package service
 
 import (
 	stderrors "errors"
+	"fmt"
 	"github.com/globocom/tsuru/api/auth"
 	"github.com/globocom/tsuru/app/bind"
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/log"
 	"labix.org/v2/mgo/bson"
 	"net/http"
 )
 
+// States of the service instances.
+const (
+	// StateCreating is the state of instances being provisioned by the
+	// service, see Client.Create.
+	StateCreating = "creating"
+
+	// StateReady is the state of instances that can be bound to apps.
+	// Instances created before states were tracked have an empty state,
+	// and are ready too.
+	StateReady = "ready"
+
+	// StateFailed is the state of instances whose creation or removal
+	// failed in the service. The error of the service is kept in the
+	// instance.
+	StateFailed = "failed"
+
+	// StateRemoving is the state of instances being removed by the
+	// service, see Client.Destroy.
+	StateRemoving = "removing"
+)
+
 type ServiceInstance struct {
 	Name        string
 	ServiceName string `bson:"service_name"`
 	Apps        []string
 	Teams       []string
+
+	// PlanName is the name of the plan chosen when the instance was
+	// created. It's empty for services without plans.
+	PlanName string `bson:"plan_name"`
+
+	// State is the state of the instance in its lifecycle, see the State*
+	// constants, and Error is the error reported by the service when the
+	// instance failed.
+	State string
+	Error string `bson:",omitempty"`
 }
 
 func (si *ServiceInstance) Create() error {
@@ -70,37 +103,139 @@ func (si *ServiceInstance) update() error {
 	return db.Session.ServiceInstances().Update(bson.M{"name": si.Name}, si)
 }
 
-func (si *ServiceInstance) Bind(app bind.App) error {
-	err := si.AddApp(app.GetName())
-	if err != nil {
-		return &errors.Http{Code: http.StatusConflict, Message: "This app is already binded to this service instance."}
+// IsReady indicates whether the instance can be bound to apps.
+func (si *ServiceInstance) IsReady() bool {
+	return si.State == "" || si.State == StateReady
+}
+
+// checkReady returns an error describing the state of the instance if it's
+// not ready.
+func (si *ServiceInstance) checkReady() error {
+	var msg string
+	switch {
+	case si.IsReady():
+		return nil
+	case si.State == StateCreating:
+		msg = fmt.Sprintf("The service instance %q is still being created. Try again when it's ready.", si.Name)
+	case si.State == StateRemoving:
+		msg = fmt.Sprintf("The service instance %q is being removed.", si.Name)
+	default:
+		msg = fmt.Sprintf("The service instance %q failed: %s", si.Name, si.Error)
 	}
-	var envVars []bind.EnvVar
-	var setEnv = func(env map[string]string) {
-		for k, v := range env {
-			envVars = append(envVars, bind.EnvVar{
-				Name:         k,
-				Value:        v,
-				Public:       false,
-				InstanceName: si.Name,
-			})
-		}
+	return &errors.Http{Code: http.StatusPreconditionFailed, Message: msg}
+}
+
+// SetState changes the state of the instance, saving it in the database. The
+// message is the error of the service, for failed instances.
+func (si *ServiceInstance) SetState(state, message string) error {
+	si.State, si.Error = state, message
+	change := bson.M{"$set": bson.M{"state": state, "error": message}}
+	return db.Session.ServiceInstances().Update(bson.M{"name": si.Name}, change)
+}
+
+// StateMessage describes the state of the instance, as stored in the
+// database.
+func (si *ServiceInstance) StateMessage() string {
+	switch si.State {
+	case StateCreating:
+		return "being created"
+	case StateRemoving:
+		return "being removed"
+	case StateFailed:
+		return "in error: " + si.Error
 	}
+	return "ready"
+}
+
+// poll checks the state of the instance in the service, when it's being
+// created or removed. Instances that the service finished removing are
+// deleted.
+func (si *ServiceInstance) poll() error {
 	cli := si.Service().ProductionEndpoint()
-	if len(app.GetUnits()) == 0 {
-		return &errors.Http{Code: http.StatusPreconditionFailed, Message: "This app does not have an IP yet."}
+	if cli == nil {
+		return fmt.Errorf("The service %q doesn't have a production endpoint.", si.ServiceName)
 	}
-	env, err := cli.Bind(si, app)
+	code, msg, err := cli.status(si)
 	if err != nil {
 		return err
 	}
-	setEnv(env)
-	err = si.update()
+	switch {
+	case code == http.StatusAccepted:
+		return nil
+	case si.State == StateCreating && code == http.StatusNoContent:
+		return si.SetState(StateReady, "")
+	case si.State == StateRemoving && code == http.StatusNotFound:
+		return si.Delete()
+	case si.State == StateRemoving && code == http.StatusNoContent:
+		return nil
+	}
+	if msg == "" {
+		msg = fmt.Sprintf("The service answered with the status %d.", code)
+	}
+	return si.SetState(StateFailed, msg)
+}
+
+// PollInstances checks, in their services, the state of all instances that
+// are being created or removed, and updates them. It returns the number of
+// instances that couldn't be checked, and the last error.
+func PollInstances() (int, error) {
+	var instances []ServiceInstance
+	q := bson.M{"state": bson.M{"$in": []string{StateCreating, StateRemoving}}}
+	err := db.Session.ServiceInstances().Find(q).All(&instances)
 	if err != nil {
-		cli.Unbind(si, app)
+		return 0, err
+	}
+	var failures int
+	for i := range instances {
+		if e := instances[i].poll(); e != nil {
+			log.Printf("Failed to check the state of the service instance %q: %s.", instances[i].Name, e)
+			failures++
+			err = e
+		}
+	}
+	return failures, err
+}
+
+// Bind binds the app to the service instance, calling the bind of the
+// service API with the units of the app and setting the environment
+// variables returned by the API in the app. If any of these steps fails, the
+// previous ones are rolled back.
+//
+// Only ready instances can be bound. Services of the first version of the API
+// are bound through the first unit of the app, so apps without units can't be
+// bound to them.
+func (si *ServiceInstance) Bind(app bind.App) error {
+	if err := si.checkReady(); err != nil {
 		return err
 	}
-	return app.SetEnvs(envVars, false)
+	err := si.AddApp(app.GetName())
+	if err != nil {
+		return &errors.Http{Code: http.StatusConflict, Message: "This app is already binded to this service instance."}
+	}
+	ctx := bindContext{
+		Instance: *si,
+		App:      app.GetName(),
+		app:      app,
+	}
+	units := app.GetUnits()
+	if len(units) > 0 {
+		ctx.Hostname = units[0].GetIp()
+	} else if si.Service().ApiVersion < 2 {
+		return &errors.Http{Code: http.StatusPreconditionFailed, Message: "This app does not have an IP yet."}
+	}
+	return newBindPipeline(&ctx).Execute()
+}
+
+// BindUnit tells the service of the instance that a unit was added to an app
+// bound to the instance.
+func (si *ServiceInstance) BindUnit(app bind.App, unit bind.Unit) error {
+	return si.Service().ProductionEndpoint().BindUnit(si, app, unit)
+}
+
+// UnbindUnit tells the service of the instance that a unit was removed from
+// an app bound to the instance.
+func (si *ServiceInstance) UnbindUnit(app bind.App, unit bind.Unit) error {
+	return si.Service().ProductionEndpoint().UnbindUnit(si, app, unit)
 }
 
 func (si *ServiceInstance) Unbind(app bind.App) error {
@@ -8,8 +8,11 @@ import (
 	"github.com/globocom/tsuru/api/auth"
 	"github.com/globocom/tsuru/app/bind"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
 	"labix.org/v2/mgo/bson"
 	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
 )
 
 func (s *S) createServiceInstance() {
@@ -262,3 +265,123 @@ func (s *S) TestGetServiceInstancesByServicesAndTeamsForUsersThatAreNotMembersOf
 	c.Assert(err, IsNil)
 	c.Assert(instances, IsNil)
 }
+
+func (s *S) TestBindRefusesInstancesThatAreNotReady(c *C) {
+	app := &FakeApp{name: "painkiller", ip: "10.10.10.10"}
+	instance := ServiceInstance{Name: "slowsql", State: StateCreating}
+	err := instance.Bind(app)
+	c.Assert(err, ErrorMatches, `^The service instance "slowsql" is still being created. Try again when it's ready.$`)
+	c.Assert(err.(*errors.Http).Code, Equals, http.StatusPreconditionFailed)
+	instance.State, instance.Error = StateFailed, "Disk full."
+	err = instance.Bind(app)
+	c.Assert(err, ErrorMatches, `^The service instance "slowsql" failed: Disk full.$`)
+	instance.State = StateRemoving
+	err = instance.Bind(app)
+	c.Assert(err, ErrorMatches, `^The service instance "slowsql" is being removed.$`)
+	c.Assert(instance.Apps, HasLen, 0)
+}
+
+func (s *S) TestIsReady(c *C) {
+	c.Assert((&ServiceInstance{}).IsReady(), Equals, true)
+	c.Assert((&ServiceInstance{State: StateReady}).IsReady(), Equals, true)
+	c.Assert((&ServiceInstance{State: StateCreating}).IsReady(), Equals, false)
+	c.Assert((&ServiceInstance{State: StateFailed}).IsReady(), Equals, false)
+	c.Assert((&ServiceInstance{State: StateRemoving}).IsReady(), Equals, false)
+}
+
+// pollingInstance creates a service whose status endpoint answers with the
+// given status and body, and an instance of it in the given state.
+func (s *S) pollingInstance(c *C, state string, status int, body string) (ServiceInstance, func()) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	srvc := Service{Name: "slowsql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, IsNil)
+	instance := ServiceInstance{Name: "slowsql-1", ServiceName: srvc.Name, State: state}
+	err = instance.Create()
+	c.Assert(err, IsNil)
+	return instance, func() {
+		ts.Close()
+		db.Session.Services().Remove(bson.M{"_id": srvc.Name})
+		db.Session.ServiceInstances().Remove(bson.M{"name": instance.Name})
+	}
+}
+
+func (s *S) getInstance(c *C, name string) ServiceInstance {
+	var si ServiceInstance
+	err := db.Session.ServiceInstances().Find(bson.M{"name": name}).One(&si)
+	c.Assert(err, IsNil)
+	return si
+}
+
+func (s *S) TestPollInstancesMarksReadyInstances(c *C) {
+	instance, cleanup := s.pollingInstance(c, StateCreating, http.StatusNoContent, "")
+	defer cleanup()
+	n, err := PollInstances()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+	c.Assert(s.getInstance(c, instance.Name).State, Equals, StateReady)
+}
+
+func (s *S) TestPollInstancesKeepsPendingInstances(c *C) {
+	instance, cleanup := s.pollingInstance(c, StateCreating, http.StatusAccepted, "")
+	defer cleanup()
+	_, err := PollInstances()
+	c.Assert(err, IsNil)
+	c.Assert(s.getInstance(c, instance.Name).State, Equals, StateCreating)
+}
+
+func (s *S) TestPollInstancesKeepsTheErrorOfTheService(c *C) {
+	instance, cleanup := s.pollingInstance(c, StateCreating, http.StatusInternalServerError, "Disk full.\n")
+	defer cleanup()
+	_, err := PollInstances()
+	c.Assert(err, IsNil)
+	si := s.getInstance(c, instance.Name)
+	c.Assert(si.State, Equals, StateFailed)
+	c.Assert(si.Error, Equals, "Disk full.")
+	c.Assert(si.StateMessage(), Equals, "in error: Disk full.")
+}
+
+func (s *S) TestPollInstancesDeletesRemovedInstances(c *C) {
+	instance, cleanup := s.pollingInstance(c, StateRemoving, http.StatusNotFound, "")
+	defer cleanup()
+	_, err := PollInstances()
+	c.Assert(err, IsNil)
+	n, err := db.Session.ServiceInstances().Find(bson.M{"name": instance.Name}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
+func (s *S) TestPollInstancesIgnoresReadyInstances(c *C) {
+	instance, cleanup := s.pollingInstance(c, StateReady, http.StatusInternalServerError, "down")
+	defer cleanup()
+	_, err := PollInstances()
+	c.Assert(err, IsNil)
+	c.Assert(s.getInstance(c, instance.Name).State, Equals, StateReady)
+}
+
+func (s *S) TestBindDoesNotStoreTheEnvironmentVariablesOfTheService(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"DATABASE_PASSWORD":"s3cr3t"}`))
+	}))
+	defer ts.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Services().Remove(bson.M{"_id": srvc.Name})
+	instance := ServiceInstance{Name: "secretsql", ServiceName: srvc.Name}
+	err = instance.Create()
+	c.Assert(err, IsNil)
+	defer instance.Delete()
+	err = instance.Bind(&FakeApp{name: "painkiller", ip: "10.10.10.10"})
+	c.Assert(err, IsNil)
+	var stored bson.M
+	err = db.Session.Pipelines().Find(bson.M{"kind": "bind-app"}).Sort("-started").One(&stored)
+	c.Assert(err, IsNil)
+	defer db.Session.Pipelines().RemoveId(stored["_id"])
+	c.Assert(stored["context"], Not(IsNil))
+	_, ok := stored["context"].(bson.M)["env"]
+	c.Assert(ok, Equals, false)
+}
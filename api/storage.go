@@ -0,0 +1,34 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+)
+
+// RotateStorageKeysHandler starts replacing the credentials of the bucket of
+// the app, responding with the operation that tracks the rotation. Apps in
+// maintenance mode can't rotate their keys, because their units don't receive
+// new variables.
+func RotateStorageKeysHandler(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+	a, err := getAppOrError(r.URL.Query().Get(":name"), u)
+	if err != nil {
+		return err
+	}
+	op, err := a.StartRotateStorageKeys(u.Email)
+	if err == app.ErrAppInMaintenance {
+		return &errors.Http{Code: http.StatusConflict, Message: err.Error() + " Turn it off with app-maintenance."}
+	}
+	if e, ok := err.(*app.ValidationError); ok {
+		return &errors.Http{Code: http.StatusPreconditionFailed, Message: e.Message}
+	}
+	if err != nil {
+		return err
+	}
+	return writeOperation(w, map[string]string{"operation": op.Id})
+}
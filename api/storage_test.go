@@ -0,0 +1,46 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+)
+
+func (s *S) TestRotateStorageKeysHandlerWithoutBucket(c *C) {
+	a := app.App{Name: "nobucket", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/nobucket/storage/rotate-keys?:name=nobucket", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RotateStorageKeysHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusPreconditionFailed)
+	c.Assert(e.Message, Equals, `The app "nobucket" doesn't have a bucket.`)
+}
+
+func (s *S) TestRotateStorageKeysHandlerInMaintenance(c *C) {
+	a := app.App{Name: "tilt", Teams: []string{s.team.Name}, Maintenance: true}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("POST", "/apps/tilt/storage/rotate-keys?:name=tilt", nil)
+	c.Assert(err, IsNil)
+	recorder := httptest.NewRecorder()
+	err = RotateStorageKeysHandler(recorder, request, s.user)
+	c.Assert(err, NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Code, Equals, http.StatusConflict)
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/db"
 	fsTesting "github.com/globocom/tsuru/fs/testing"
+	"github.com/globocom/tsuru/provision/provisiontest"
+	"github.com/globocom/tsuru/router/routertest"
 	tsuruTesting "github.com/globocom/tsuru/testing"
 	"io"
 	. "launchpad.net/gocheck"
@@ -26,7 +28,8 @@ type S struct {
 	user        *auth.User
 	rfs         *fsTesting.RecordingFs
 	t           *tsuruTesting.T
-	provisioner *tsuruTesting.FakeProvisioner
+	provisioner *provisiontest.FakeProvisioner
+	router      *routertest.FakeRouter
 }
 
 var _ = Suite(&S{})
@@ -80,8 +83,18 @@ func (s *S) SetUpSuite(c *C) {
 	s.createUserAndTeam(c)
 	s.t.StartAmzS3AndIAM(c)
 	s.t.SetGitConfs(c)
-	s.provisioner = tsuruTesting.NewFakeProvisioner()
+	s.provisioner = provisiontest.NewFakeProvisioner()
 	app.Provisioner = s.provisioner
+	s.router = routertest.NewFakeRouter()
+	app.Router = s.router
+	s.createPlatforms(c)
+}
+
+func (s *S) createPlatforms(c *C) {
+	for _, name := range []string{"django", "golang", "gotthard", "python", "ruby", "vougan"} {
+		err := db.Session.Platforms().Insert(app.Platform{Name: name, Enabled: true})
+		c.Assert(err, IsNil)
+	}
 }
 
 func (s *S) TearDownSuite(c *C) {
@@ -95,6 +108,7 @@ func (s *S) TearDownSuite(c *C) {
 func (s *S) TearDownTest(c *C) {
 	s.t.RollbackGitConfs(c)
 	s.provisioner.Reset()
+	s.router.Reset()
 }
 
 func (s *S) getTestData(p ...string) io.ReadCloser {
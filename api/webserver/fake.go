@@ -0,0 +1,15 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build fake
+
+package main
+
+// The fake provisioner and router, with the chaos scenario of the "fake"
+// section of tsuru.conf, are only available in binaries built with the fake
+// tag: go build -tags fake.
+import (
+	_ "github.com/globocom/tsuru/provision/provisiontest"
+	_ "github.com/globocom/tsuru/router/routertest"
+)
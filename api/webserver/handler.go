@@ -42,6 +42,17 @@ func (fn Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type AdminRequiredHandler func(http.ResponseWriter, *http.Request, *auth.User) error
+
+func (fn AdminRequiredHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	AuthorizationRequiredHandler(func(w http.ResponseWriter, r *http.Request, u *auth.User) error {
+		if !u.IsAdmin() {
+			return &errors.Http{Code: http.StatusForbidden, Message: "You must be an admin to perform this action."}
+		}
+		return fn(w, r, u)
+	}).ServeHTTP(w, r)
+}
+
 type AuthorizationRequiredHandler func(http.ResponseWriter, *http.Request, *auth.User) error
 
 func (fn AuthorizationRequiredHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -7,6 +7,7 @@ package main
 import (
 	stderrors "errors"
 	"fmt"
+	"github.com/globocom/config"
 	"github.com/globocom/tsuru/api/auth"
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/errors"
@@ -224,3 +225,38 @@ func (s *S) TestSetVersionHeaders(c *C) {
 	c.Assert(recorder.Header().Get("Supported-Tsuru"), Equals, tsuruMin)
 	c.Assert(recorder.Header().Get("Supported-Crane"), Equals, craneMin)
 }
+
+func (s *S) TestAdminRequiredHandlerShouldReturnForbiddenIfTheUserIsNotAnAdmin(c *C) {
+	config.Set("admin-team", "admin")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/plans", nil)
+	c.Assert(err, IsNil)
+	request.Header.Set("Authorization", s.t.Token)
+	AdminRequiredHandler(authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), Equals, "You must be an admin to perform this action.\n")
+}
+
+func (s *S) TestAdminRequiredHandlerShouldReturnTheHandlerResultIfTheUserIsAnAdmin(c *C) {
+	config.Set("admin-team", "admin")
+	team := auth.Team{Name: "admin", Users: []string{s.u.Email}}
+	err := db.Session.Teams().Insert(team)
+	c.Assert(err, IsNil)
+	defer db.Session.Teams().RemoveId(team.Name)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/plans", nil)
+	c.Assert(err, IsNil)
+	request.Header.Set("Authorization", s.t.Token)
+	AdminRequiredHandler(authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Equals, "success")
+}
+
+func (s *S) TestAdminRequiredHandlerShouldReturnUnauthorizedIfTheTokenIsInvalid(c *C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/plans", nil)
+	c.Assert(err, IsNil)
+	request.Header.Set("Authorization", "what the token?!")
+	AdminRequiredHandler(authorizedSimpleHandler).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusUnauthorized)
+}
@@ -18,6 +18,9 @@ import (
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
 	_ "github.com/globocom/tsuru/provision/juju"
+	_ "github.com/globocom/tsuru/provision/ssh"
+	"github.com/globocom/tsuru/router"
+	_ "github.com/globocom/tsuru/router/nginx"
 	stdlog "log"
 	"log/syslog"
 	"net/http"
@@ -57,6 +60,9 @@ func main() {
 	defer db.Session.Close()
 	fmt.Printf("Connected to MongoDB server at %s.\n", connString)
 	fmt.Printf("Using the database %q.\n\n", dbName)
+	if err = app.SeedPlatforms(); err != nil {
+		fatal(err)
+	}
 
 	m := pat.New()
 
@@ -72,6 +78,7 @@ func main() {
 	m.Put("/services", AuthorizationRequiredHandler(service_provision.UpdateHandler))
 	m.Del("/services/:name", AuthorizationRequiredHandler(service_provision.DeleteHandler))
 	m.Get("/services/:name", AuthorizationRequiredHandler(consumption.ServiceInfoHandler))
+	m.Get("/services/:name/plans", AuthorizationRequiredHandler(consumption.ServicePlansHandler))
 	m.Get("/services/c/:name/doc", AuthorizationRequiredHandler(consumption.Doc))
 	m.Get("/services/:name/doc", AuthorizationRequiredHandler(service_provision.GetDocHandler))
 	m.Put("/services/:name/doc", AuthorizationRequiredHandler(service_provision.AddDocHandler))
@@ -87,14 +94,53 @@ func main() {
 	m.Get("/apps/:name/env", AuthorizationRequiredHandler(api.GetEnv))
 	m.Post("/apps/:name/env", AuthorizationRequiredHandler(api.SetEnv))
 	m.Del("/apps/:name/env", AuthorizationRequiredHandler(api.UnsetEnv))
+	m.Get("/apps/:name/env/history", AuthorizationRequiredHandler(api.EnvHistory))
+	m.Post("/apps/:name/env/rollback/:revision", AuthorizationRequiredHandler(api.EnvRollback))
+	m.Post("/apps/:name/maintenance/:mode", AuthorizationRequiredHandler(api.MaintenanceHandler))
+	m.Post("/apps/:name/storage/rotate-keys", AuthorizationRequiredHandler(api.RotateStorageKeysHandler))
+	m.Put("/apps/:name/metadata", AuthorizationRequiredHandler(api.SetMetadataHandler))
+	m.Post("/env/reencrypt", AdminRequiredHandler(api.ReencryptEnvsHandler))
 	m.Get("/apps", AuthorizationRequiredHandler(api.AppList))
 	m.Post("/apps", AuthorizationRequiredHandler(api.CreateAppHandler))
 	m.Put("/apps/:name/units", AuthorizationRequiredHandler(api.AddUnitsHandler))
 	m.Del("/apps/:name/units", AuthorizationRequiredHandler(api.RemoveUnitsHandler))
+	m.Put("/apps/:name/plan", AuthorizationRequiredHandler(api.ChangePlanHandler))
 	m.Put("/apps/:app/:team", AuthorizationRequiredHandler(api.GrantAccessToTeamHandler))
 	m.Del("/apps/:app/:team", AuthorizationRequiredHandler(api.RevokeAccessFromTeamHandler))
 	m.Get("/apps/:name/log", AuthorizationRequiredHandler(api.AppLog))
+	m.Post("/apply", AuthorizationRequiredHandler(api.ApplyManifest))
+	m.Get("/apps/:name/export", AuthorizationRequiredHandler(api.ExportApp))
+	m.Post("/apps/:name/clone", AuthorizationRequiredHandler(api.CloneApp))
+	m.Post("/apps/:name/cname", AuthorizationRequiredHandler(api.AddCNameHandler))
+	m.Del("/apps/:name/cname/:cname", AuthorizationRequiredHandler(api.RemoveCNameHandler))
 	m.Post("/apps/:name/log", Handler(api.AddLogHandler))
+	m.Get("/apps/:name/cron", AuthorizationRequiredHandler(api.CronJobsHandler))
+	m.Post("/apps/:name/cron", AuthorizationRequiredHandler(api.AddCronJobHandler))
+	m.Del("/apps/:name/cron/:id", AuthorizationRequiredHandler(api.RemoveCronJobHandler))
+
+	m.Get("/plans", AuthorizationRequiredHandler(api.PlanList))
+	m.Post("/plans", AdminRequiredHandler(api.CreatePlanHandler))
+	m.Del("/plans/:name", AdminRequiredHandler(api.RemovePlanHandler))
+	m.Put("/plans/:plan/:team", AdminRequiredHandler(api.GrantPlanToTeamHandler))
+	m.Del("/plans/:plan/:team", AdminRequiredHandler(api.RevokePlanFromTeamHandler))
+
+	m.Get("/platforms", AuthorizationRequiredHandler(api.PlatformList))
+	m.Post("/platforms", AdminRequiredHandler(api.CreatePlatformHandler))
+	m.Del("/platforms/:name", AdminRequiredHandler(api.RemovePlatformHandler))
+	m.Put("/platforms/:name/deprecate", AdminRequiredHandler(api.DeprecatePlatformHandler))
+	m.Put("/platforms/:name/enable", AdminRequiredHandler(api.EnablePlatformHandler))
+	m.Get("/platforms/:name/apps", AdminRequiredHandler(api.PlatformApps))
+
+	m.Get("/quota/:owner", AdminRequiredHandler(api.QuotaHandler))
+	m.Put("/quota/:owner", AdminRequiredHandler(api.ChangeQuotaHandler))
+
+	m.Get("/hosts", AdminRequiredHandler(api.HostList))
+	m.Post("/hosts", AdminRequiredHandler(api.AddHostHandler))
+	m.Del("/hosts/:address", AdminRequiredHandler(api.RemoveHostHandler))
+
+	m.Get("/operations/:id", AuthorizationRequiredHandler(api.OperationInfo))
+
+	m.Post("/removals/cleanup", AdminRequiredHandler(api.CleanupHandler))
 
 	m.Post("/users", Handler(auth.CreateUser))
 	m.Post("/users/:email/tokens", Handler(auth.Login))
@@ -121,6 +167,22 @@ func main() {
 		}
 		fmt.Printf("Using %q provisioner.\n\n", provisioner)
 
+		if name, err := config.GetString("router"); err == nil {
+			app.Router, err = router.Get(name)
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Printf("Using %q router.\n\n", name)
+		}
+
+		if name, err := config.GetString("storage"); err == nil {
+			app.Storage, err = app.GetStorage(name)
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Printf("Using %q object storage.\n\n", name)
+		}
+
 		listen, err := config.GetString("listen")
 		if err != nil {
 			fatal(err)
@@ -4,38 +4,183 @@
 
 package app
 
-// action represents an action, with the given methods to forward and backward
-// for the action.
-type action interface {
-	forward(app *App, args ...interface{}) error
-	backward(app *App, args ...interface{})
-
-	// rollbackItself indicates whether backward should be called when forward
-	// fail. If false, only previously executed actions will be rolled back on
-	// forward failures.
-	rollbackItself() bool
-}
-
-// execute runs an list of actions. If an errors ocourrs execute stops the
-// execution for the actions and call the rollback for previous actions.
-func execute(a *App, actions []action, args ...interface{}) error {
-	for index, action := range actions {
-		err := action.forward(a, args...)
-		if err != nil {
-			if !action.rollbackItself() {
-				index--
+import (
+	"github.com/globocom/tsuru/pipeline"
+	"io"
+	"io/ioutil"
+	"labix.org/v2/mgo"
+)
+
+// pipelineContext is the context shared by the actions of the app pipelines.
+// It's stored in the database with the progress of the pipeline, so
+// interrupted pipelines can be rolled back after a crash.
+type pipelineContext struct {
+	// App is the app the pipeline acts on. Only its name is stored, the
+	// app is loaded from the database when the pipeline is rebuilt, see
+	// Load.
+	App     *App `bson:"-"`
+	AppName string
+
+	// QuotaOwners are the owners of the app whose quotas are reserved or
+	// released by the pipeline, and Reservations are the units of the app
+	// reserved in their quotas. They're stored because the app may not be
+	// in the database when the pipeline is rebuilt.
+	QuotaOwners  []string
+	Reservations []Reservation
+
+	// Units is the number of units to create or add, and Process is their
+	// process type.
+	Units   uint
+	Process string
+
+	// UnitNames are the names of the units added by the pipeline.
+	UnitNames []string
+
+	// BoundUnits are the units bound to service instances by the
+	// pipeline, so only these are unbound when it's rolled back.
+	BoundUnits []boundUnit
+
+	// w receives the output of deploys. It's not stored, so actions must
+	// handle a nil writer.
+	w io.Writer
+}
+
+// boundUnit is a unit bound to a service instance.
+type boundUnit struct {
+	Instance string
+	Unit     string
+}
+
+// addedUnits returns the units of the app named in UnitNames.
+func (ctx *pipelineContext) addedUnits() []Unit {
+	var units []Unit
+	for _, u := range ctx.App.Units {
+		for _, name := range ctx.UnitNames {
+			if u.Name == name {
+				units = append(units, u)
+				break
 			}
-			rollBack(a, actions[:index+1], args...)
-			return err
 		}
 	}
+	return units
+}
+
+// Load loads the app of a context restored from the database. Apps that are
+// not in the database, because the pipeline was interrupted before saving
+// them or after removing them, are replaced with an app that has only the
+// stored name, quota owners and reservations.
+func (ctx *pipelineContext) Load() error {
+	app := App{Name: ctx.AppName}
+	if err := app.Get(); err == mgo.ErrNotFound {
+		app.QuotaOwners = ctx.QuotaOwners
+		app.Reservations = ctx.Reservations
+	} else if err != nil {
+		return err
+	}
+	ctx.App = &app
 	return nil
 }
 
-// rollBack runs the rollback for the given actions.
-func rollBack(a *App, actions []action, args ...interface{}) {
-	for i := len(actions) - 1; i >= 0; i-- {
-		action := actions[i]
-		action.backward(a, args...)
+func (ctx *pipelineContext) writer() io.Writer {
+	if ctx.w == nil {
+		return ioutil.Discard
+	}
+	return ctx.w
+}
+
+// appAction is an action of the app pipelines, with the methods to forward
+// and backward the action.
+type appAction struct {
+	name     string
+	forward  func(ctx *pipelineContext) error
+	backward func(ctx *pipelineContext)
+
+	// rollbackItself indicates whether backward should be called when
+	// forward fail. If false, only previously executed actions will be
+	// rolled back on forward failures.
+	rollbackItself bool
+}
+
+// pipelines are the actions of each kind of pipeline run by the app package.
+var pipelines = map[string][]*appAction{
+	"create-app": {
+		&reserveQuota,
+		&insertApp,
+		&createBucketIam,
+		&createRepository,
+		&provisionApp,
+		&addBackend,
+	},
+	"destroy-app": destroyAppActions,
+	"remove-app":  append([]*appAction{&removeRepository}, destroyAppActions...),
+	"add-units": {
+		&reserveUnits,
+		&provisionUnits,
+		&saveUnits,
+		&bindUnits,
+		&startUnits,
+	},
+	"deploy": {
+		&installDeps,
+		&loadDeployConfig,
+		&runBuildHook,
+		&runPreDeployHook,
+		&restartApp,
+		&runPostDeployHook,
+	},
+	"rotate-storage-keys": {
+		&exportStorageKey,
+		&waitStorageKey,
+		&deleteStorageKey,
+	},
+}
+
+// destroyAppActions can't be rolled back: a failed removal stops at the
+// failing action, and can be resumed with RetryRemoval.
+var destroyAppActions = []*appAction{
+	&unbindInstances,
+	&destroyBucketIam,
+	&destroyUnits,
+	&removeBackend,
+	&removeApp,
+	&releaseQuota,
+}
+
+func init() {
+	for kind := range pipelines {
+		kind := kind
+		pipeline.Register(kind, func() *pipeline.Pipeline {
+			return newPipeline(kind, new(pipelineContext))
+		})
+	}
+}
+
+// newPipeline returns the pipeline of the given kind, with its actions bound
+// to the context.
+func newPipeline(kind string, ctx *pipelineContext) *pipeline.Pipeline {
+	actions := pipelines[kind]
+	p := pipeline.New(kind, ctx)
+	if ctx.App != nil {
+		ctx.AppName = ctx.App.Name
+		if ctx.QuotaOwners == nil {
+			ctx.QuotaOwners = ctx.App.QuotaOwners
+		}
+		if ctx.Reservations == nil {
+			ctx.Reservations = ctx.App.Reservations
+		}
+		p.Target = ctx.App.Name
+	}
+	p.Actions = make([]*pipeline.Action, len(actions))
+	for i, a := range actions {
+		act := a
+		p.Actions[i] = &pipeline.Action{
+			Name:           act.name,
+			Forward:        func() error { return act.forward(ctx) },
+			RollbackItself: act.rollbackItself,
+		}
+		if act.backward != nil {
+			p.Actions[i].Backward = func() { act.backward(ctx) }
+		}
 	}
+	return p
 }
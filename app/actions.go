@@ -5,138 +5,463 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"github.com/globocom/config"
 	"github.com/globocom/go-gandalfclient"
 	"github.com/globocom/tsuru/app/bind"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/queue"
 	"github.com/globocom/tsuru/repository"
+	"github.com/globocom/tsuru/router"
 	"labix.org/v2/mgo/bson"
 	"strconv"
 )
 
-// insertApp is an implementation for the action interface.
-type insertApp struct{}
+// reserveQuota reserves one app and the units of the app in the quotas of
+// the user that creates the app and of its teams. Its backward releases the
+// reserved app and units.
+var reserveQuota = appAction{
+	name: "reserve quota",
+	forward: func(ctx *pipelineContext) error {
+		app, units := ctx.App, int(ctx.Units)
+		app.QuotaOwners = app.quotaOwners()
+		ctx.QuotaOwners = app.QuotaOwners
+		for i, owner := range app.QuotaOwners {
+			err := reserve(owner, "apps", 1)
+			if err == nil {
+				if err = reserve(owner, "units", units); err != nil {
+					release(owner, "apps", 1)
+				}
+			}
+			if err != nil {
+				for _, reserved := range app.QuotaOwners[:i] {
+					release(reserved, "apps", 1)
+					release(reserved, "units", units)
+				}
+				return err
+			}
+		}
+		for _, owner := range app.QuotaOwners {
+			app.setReserved(owner, units)
+		}
+		return nil
+	},
+	backward: func(ctx *pipelineContext) {
+		for _, owner := range ctx.QuotaOwners {
+			release(owner, "apps", 1)
+			release(owner, "units", int(ctx.Units))
+		}
+	},
+}
 
-// insertApp forward stores the app with "pending" as your state.
-func (a *insertApp) forward(app *App, args ...interface{}) error {
-	app.State = "pending"
-	return db.Session.Apps().Insert(app)
+// insertApp stores the app with "pending" as your state. Its backward
+// removes the app from the database.
+var insertApp = appAction{
+	name: "save the app in the database",
+	forward: func(ctx *pipelineContext) error {
+		ctx.App.State = "pending"
+		return db.Session.Apps().Insert(ctx.App)
+	},
+	backward: func(ctx *pipelineContext) {
+		db.Session.Apps().Remove(bson.M{"name": ctx.App.Name})
+	},
 }
 
-// insertApp backward removes the app from the database.
-func (a *insertApp) backward(app *App, args ...interface{}) {
-	db.Session.Apps().Remove(bson.M{"name": app.Name})
+// createBucketIam creates the bucket of the app in the object storage, and
+// exports the related info as environs in the app machine. Its backward
+// destroys the app bucket.
+//
+// When there's no object storage, only the APPNAME and TSURU_HOST environs
+// are exported.
+var createBucketIam = appAction{
+	name: "create S3 credentials and bucket",
+	forward: func(ctx *pipelineContext) error {
+		app := ctx.App
+		host, _ := config.GetString("host")
+		envVars := []bind.EnvVar{
+			{Name: "APPNAME", Value: app.Name},
+			{Name: "TSURU_HOST", Value: host},
+		}
+		if Storage != nil {
+			bucket, err := Storage.CreateBucket(app)
+			if err != nil {
+				return err
+			}
+			variables := map[string]string{
+				"ENDPOINT":           bucket.Endpoint,
+				"LOCATIONCONSTRAINT": strconv.FormatBool(bucket.LocationConstraint),
+				"ACCESS_KEY_ID":      bucket.AccessKey,
+				"SECRET_KEY":         bucket.SecretKey,
+				"BUCKET":             bucket.Name,
+			}
+			for name, value := range variables {
+				envVars = append(envVars, bind.EnvVar{
+					Name:         fmt.Sprintf("TSURU_S3_%s", name),
+					Value:        value,
+					InstanceName: s3InstanceName,
+				})
+			}
+		}
+		return app.SetEnvsToApp(envVars, false, true, "")
+	},
+	backward: func(ctx *pipelineContext) {
+		if Storage != nil {
+			Storage.DestroyBucket(ctx.App)
+		}
+	},
+	rollbackItself: true,
 }
 
-func (a *insertApp) rollbackItself() bool {
-	return false
+// provisionApp provisions the app, with the number of units in the context.
+var provisionApp = appAction{
+	name: "provision units",
+	forward: func(ctx *pipelineContext) error {
+		err := Provisioner.Provision(ctx.App)
+		if err != nil {
+			return err
+		}
+		if ctx.Units > 1 {
+			_, err = Provisioner.AddUnits(ctx.App, ctx.Units-1, provision.DefaultProcess)
+			return err
+		}
+		return nil
+	},
 }
 
-// createBucketIam is an implementation for the action interface.
-type createBucketIam struct{}
+// addBackend registers the app in the router, if tsuru is configured with
+// one. Routes to the units are added by the collector, as they start.
+var addBackend = appAction{
+	name: "register the app in the router",
+	forward: func(ctx *pipelineContext) error {
+		if Router == nil {
+			return nil
+		}
+		return Router.AddBackend(ctx.App.Name)
+	},
+}
 
-// createBucketIam forward creates a bucket and exports
-// the related info as environs in the app machine.
-func (a *createBucketIam) forward(app *App, args ...interface{}) error {
-	env, err := createBucket(app)
-	if err != nil {
-		return err
-	}
-	host, _ := config.GetString("host")
-	envVars := []bind.EnvVar{
-		{Name: "APPNAME", Value: app.Name},
-		{Name: "TSURU_HOST", Value: host},
-	}
-	variables := map[string]string{
-		"ENDPOINT":           env.endpoint,
-		"LOCATIONCONSTRAINT": strconv.FormatBool(env.locationConstraint),
-		"ACCESS_KEY_ID":      env.AccessKey,
-		"SECRET_KEY":         env.SecretKey,
-		"BUCKET":             env.bucket,
-	}
-	for name, value := range variables {
-		envVars = append(envVars, bind.EnvVar{
-			Name:         fmt.Sprintf("TSURU_S3_%s", name),
-			Value:        value,
-			InstanceName: s3InstanceName,
-		})
-	}
-	app.SetEnvsToApp(envVars, false, true)
-	return nil
-}
-
-// createBucketIam backward destroys the app bucket.
-func (a *createBucketIam) backward(app *App, args ...interface{}) {
-	destroyBucket(app)
-}
-
-func (a *createBucketIam) rollbackItself() bool {
-	return true
-}
-
-// provisionApp is an implementation for the action interface.
-type provisionApp struct{}
-
-// provision forward provisions the app.
-func (a *provisionApp) forward(app *App, args ...interface{}) error {
-	var units uint
-	if len(args) > 0 {
-		switch args[0].(type) {
-		case int:
-			units = uint(args[0].(int))
-		case int64:
-			units = uint(args[0].(int64))
-		case uint:
-			units = args[0].(uint)
-		case uint64:
-			units = uint(args[0].(uint64))
-		default:
-			units = 1
-		}
-	}
-	err := Provisioner.Provision(app)
-	if err != nil {
-		return err
-	}
-	if units > 1 {
-		_, err = Provisioner.AddUnits(app, units-1)
+// createRepository creates a git repository using the gandalf client. Its
+// backward removes the repository.
+var createRepository = appAction{
+	name: "create the git repository",
+	forward: func(ctx *pipelineContext) error {
+		gUrl := repository.GitServerUri()
+		var users []string
+		for _, t := range ctx.App.GetTeams() {
+			users = append(users, t.Users...)
+		}
+		c := gandalf.Client{Endpoint: gUrl}
+		_, err := c.NewRepository(ctx.App.Name, users, false)
 		return err
-	}
-	return nil
+	},
+	backward: func(ctx *pipelineContext) {
+		gUrl := repository.GitServerUri()
+		c := gandalf.Client{Endpoint: gUrl}
+		c.RemoveRepository(ctx.App.Name)
+	},
+}
+
+// reserveUnits reserves the units in the context in the quotas of the app.
+// Its backward releases them.
+var reserveUnits = appAction{
+	name: "reserve quota",
+	forward: func(ctx *pipelineContext) error {
+		return ctx.App.reserveUnits(int(ctx.Units))
+	},
+	backward: func(ctx *pipelineContext) {
+		ctx.App.releaseUnits(int(ctx.Units))
+	},
+}
+
+// provisionUnits adds the units in the context to the app within the
+// provisioner, with the process type in the context. Its backward removes
+// the added units.
+var provisionUnits = appAction{
+	name: "provision units",
+	forward: func(ctx *pipelineContext) error {
+		app := ctx.App
+		units, err := Provisioner.AddUnits(app, ctx.Units, ctx.Process)
+		if err != nil {
+			return err
+		}
+		for _, unit := range units {
+			app.Units = append(app.Units, Unit{
+				Name:    unit.Name,
+				Type:    unit.Type,
+				Ip:      unit.Ip,
+				Machine: unit.Machine,
+				State:   provision.StatusPending.String(),
+				Process: ctx.Process,
+			})
+			ctx.UnitNames = append(ctx.UnitNames, unit.Name)
+		}
+		return nil
+	},
+	backward: func(ctx *pipelineContext) {
+		for _, name := range ctx.UnitNames {
+			if err := Provisioner.RemoveUnit(ctx.App, name); err != nil {
+				log.Printf("Failed to remove the unit %s: %s", name, err)
+			}
+		}
+	},
+}
+
+// saveUnits stores the units added to the app in the database. Its backward
+// removes them.
+var saveUnits = appAction{
+	name: "save the units in the database",
+	forward: func(ctx *pipelineContext) error {
+		return db.Session.Apps().Update(bson.M{"name": ctx.App.Name}, ctx.App)
+	},
+	backward: func(ctx *pipelineContext) {
+		pull := bson.M{"$pull": bson.M{"units": bson.M{"name": bson.M{"$in": ctx.UnitNames}}}}
+		db.Session.Apps().Update(bson.M{"name": ctx.App.Name}, pull)
+	},
+}
+
+// bindUnits tells the service instances bound to the app about the units
+// added to it. Units created without an address are skipped, the collector
+// binds them when they get one. Its backward unbinds the units that were
+// bound, recorded in BoundUnits.
+var bindUnits = appAction{
+	name: "bind the units to service instances",
+	forward: func(ctx *pipelineContext) error {
+		instances, err := ctx.App.serviceInstances()
+		if err != nil {
+			return err
+		}
+		units := ctx.addedUnits()
+		for _, instance := range instances {
+			for i := range units {
+				if err := instance.BindUnit(ctx.App, &units[i]); err != nil {
+					return err
+				}
+				ctx.BoundUnits = append(ctx.BoundUnits, boundUnit{Instance: instance.Name, Unit: units[i].Name})
+			}
+		}
+		return nil
+	},
+	backward: func(ctx *pipelineContext) {
+		app := ctx.App
+		instances, err := app.serviceInstances()
+		if err != nil {
+			log.Printf("Failed to unbind the units of the app %s: %s", app.Name, err)
+			return
+		}
+		units := ctx.addedUnits()
+		for _, bound := range ctx.BoundUnits {
+			for _, instance := range instances {
+				if instance.Name != bound.Instance {
+					continue
+				}
+				for i := range units {
+					if units[i].Name != bound.Unit {
+						continue
+					}
+					if err := instance.UnbindUnit(app, &units[i]); err != nil {
+						log.Printf("Failed to unbind the unit %s from the instance %s: %s", bound.Unit, instance.Name, err)
+					}
+				}
+			}
+		}
+		ctx.BoundUnits = nil
+	},
+	rollbackItself: true,
+}
+
+// startUnits asks the collector to write the apprc file and start the units
+// added to the app.
+var startUnits = appAction{
+	name: "start units",
+	forward: func(ctx *pipelineContext) error {
+		messages := make([]queue.Message, 0, len(ctx.UnitNames)*2)
+		for _, name := range ctx.UnitNames {
+			messages = append(messages,
+				queue.Message{Action: RegenerateApprc, Args: []string{ctx.App.Name, name}},
+				queue.Message{Action: StartApp, Args: []string{ctx.App.Name, name}},
+			)
+		}
+		return ctx.App.enqueue(messages...)
+	},
 }
 
-// provision backward does nothing.
-func (a *provisionApp) backward(app *App, args ...interface{}) {}
+// removeRepository removes the git repository using the gandalf client. The
+// repository can't be restored.
+var removeRepository = appAction{
+	name: "remove the git repository",
+	forward: func(ctx *pipelineContext) error {
+		gUrl := repository.GitServerUri()
+		if err := (&gandalf.Client{Endpoint: gUrl}).RemoveRepository(ctx.App.Name); err != nil {
+			log.Printf("Got error while removing repository from gandalf: %s", err.Error())
+			return errors.New("Could not remove app's repository at git server. Aborting...")
+		}
+		return nil
+	},
+}
+
+// destroyBucketIam destroys the bucket of the app and its credentials. Apps
+// without a bucket are skipped.
+var destroyBucketIam = appAction{
+	name: "destroy S3 credentials and bucket",
+	forward: func(ctx *pipelineContext) error {
+		if Storage == nil {
+			return nil
+		}
+		if b, err := appBucket(ctx.App); err != nil || b == nil {
+			return err
+		}
+		return Storage.DestroyBucket(ctx.App)
+	},
+}
+
+// unbindInstances unbinds the app from the service instances it's bound to.
+// Instances are unbound one by one, so the ones unbound before a failure are
+// not unbound again when the removal is resumed.
+var unbindInstances = appAction{
+	name: "unbind service instances",
+	forward: func(ctx *pipelineContext) error {
+		return ctx.App.unbind()
+	},
+}
+
+// destroyUnits destroys the app within the provisioner.
+var destroyUnits = appAction{
+	name: "destroy units",
+	forward: func(ctx *pipelineContext) error {
+		app := ctx.App
+		if len(app.Units) > 0 {
+			err := Provisioner.Destroy(app)
+			if err != nil {
+				return errors.New("Failed to destroy the app: " + err.Error())
+			}
+		}
+		return nil
+	},
+}
+
+// removeBackend removes the app, its routes and CNames from the router. Apps
+// that were never registered in the router are ignored.
+var removeBackend = appAction{
+	name: "remove the app from the router",
+	forward: func(ctx *pipelineContext) error {
+		if Router == nil {
+			return nil
+		}
+		if err := Router.RemoveBackend(ctx.App.Name); err != nil && err != router.ErrBackendNotFound {
+			return err
+		}
+		return nil
+	},
+}
+
+// removeApp removes the app, its env history and its cron jobs from the
+// database.
+var removeApp = appAction{
+	name: "remove the app from the database",
+	forward: func(ctx *pipelineContext) error {
+		name := ctx.App.Name
+		if err := db.Session.Apps().Remove(bson.M{"name": name}); err != nil {
+			return err
+		}
+		db.Session.EnvRevisions().RemoveAll(bson.M{"app": name})
+		db.Session.CronJobs().RemoveAll(bson.M{"app": name})
+		return nil
+	},
+}
+
+// releaseQuota releases the app and the units reserved for it in the quotas
+// of its owners.
+var releaseQuota = appAction{
+	name: "release quota",
+	forward: func(ctx *pipelineContext) error {
+		for _, owner := range ctx.QuotaOwners {
+			release(owner, "apps", 1)
+			release(owner, "units", ctx.App.reserved(owner))
+		}
+		return nil
+	},
+}
+
+// installDeps runs the dependencies hook in the units of the app.
+var installDeps = appAction{
+	name: "install dependencies",
+	forward: func(ctx *pipelineContext) error {
+		return ctx.App.InstallDeps(ctx.writer())
+	},
+}
+
+// loadDeployConfig loads the hooks and the Procfile of the app.
+var loadDeployConfig = appAction{
+	name: "load app.conf and Procfile",
+	forward: func(ctx *pipelineContext) error {
+		if err := ctx.App.loadHooks(); err != nil {
+			return err
+		}
+		return ctx.App.loadProcfile()
+	},
+}
+
+// runBuildHook runs the build hooks of the app.
+var runBuildHook = appAction{
+	name: "run build hooks",
+	forward: func(ctx *pipelineContext) error {
+		return ctx.App.runHook(ctx.writer(), ctx.App.hooks.Build, "build")
+	},
+}
 
-func (a *provisionApp) rollbackItself() bool {
-	return false
+// runPreDeployHook runs the pre-deploy hooks of the app.
+var runPreDeployHook = appAction{
+	name: "run pre-deploy hooks",
+	forward: func(ctx *pipelineContext) error {
+		return ctx.App.runHook(ctx.writer(), ctx.App.hooks.PreDeploy, "pre-deploy")
+	},
 }
 
-// createRepository is an implementation for the action interface.
-type createRepository struct{}
+// restartApp restarts the app, running the restart hooks.
+var restartApp = appAction{
+	name: "restart the app",
+	forward: func(ctx *pipelineContext) error {
+		return ctx.App.Restart(ctx.writer())
+	},
+}
+
+// runPostDeployHook runs the post-deploy hooks of the app.
+var runPostDeployHook = appAction{
+	name: "run post-deploy hooks",
+	forward: func(ctx *pipelineContext) error {
+		return ctx.App.runHook(ctx.writer(), ctx.App.hooks.PostDeploy, "post-deploy")
+	},
+}
 
-// createRepository forward creates a git repository using the
-// gandalf client.
-func (a *createRepository) forward(app *App, args ...interface{}) error {
-	gUrl := repository.GitServerUri()
-	var users []string
-	for _, t := range app.GetTeams() {
-		users = append(users, t.Users...)
-	}
-	c := gandalf.Client{Endpoint: gUrl}
-	_, err := c.NewRepository(app.Name, users, false)
-	return err
+// exportStorageKey creates new credentials for the bucket of the app and
+// exports them to the app, recording the replaced key to be deleted later.
+var exportStorageKey = appAction{
+	name: "create and export the new storage key",
+	forward: func(ctx *pipelineContext) error {
+		return ctx.App.exportStorageKey()
+	},
 }
 
-// createRepository backward remove the git repository
-// using the gandalf client.
-func (a *createRepository) backward(app *App, args ...interface{}) {
-	gUrl := repository.GitServerUri()
-	c := gandalf.Client{Endpoint: gUrl}
-	c.RemoveRepository(app.Name)
+// waitStorageKey waits until the new storage credentials are written to all
+// units of the app.
+var waitStorageKey = appAction{
+	name: "write the new storage key to the units",
+	forward: func(ctx *pipelineContext) error {
+		app := ctx.App
+		if len(app.Units) == 0 || app.OldStorageKey == "" {
+			return nil
+		}
+		return app.waitApprc(app.OldStorageKeyVersion, apprcTimeout)
+	},
 }
 
-func (a *createRepository) rollbackItself() bool {
-	return false
+// deleteStorageKey deletes the storage key replaced by exportStorageKey.
+var deleteStorageKey = appAction{
+	name: "delete the old storage key",
+	forward: func(ctx *pipelineContext) error {
+		return deleteOldStorageKey(ctx.App.Name)
+	},
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/api/auth"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
 	"github.com/globocom/tsuru/queue"
 	"github.com/globocom/tsuru/testing"
 	"io/ioutil"
@@ -20,14 +21,14 @@ import (
 )
 
 func (s *S) TestInsertAppForward(c *C) {
-	action := new(insertApp)
+	action := insertApp
 	a := App{
 		Name:      "appname",
 		Framework: "django",
 		Units:     []Unit{{Machine: 3}},
 	}
-	err := action.forward(&a)
-	defer action.backward(&a)
+	err := action.forward(&pipelineContext{App: &a})
+	defer action.backward(&pipelineContext{App: &a})
 	c.Assert(err, IsNil)
 	c.Assert(a.State, Equals, "pending")
 	var retrievedApp App
@@ -39,23 +40,23 @@ func (s *S) TestInsertAppForward(c *C) {
 }
 
 func (s *S) TestInsertAppBackward(c *C) {
-	action := new(insertApp)
+	action := insertApp
 	a := App{
 		Name:      "appname",
 		Framework: "django",
 		Units:     []Unit{{Machine: 3}},
 	}
-	err := action.forward(&a)
+	err := action.forward(&pipelineContext{App: &a})
 	c.Assert(err, IsNil)
-	action.backward(&a)
+	action.backward(&pipelineContext{App: &a})
 	qt, err := db.Session.Apps().Find(bson.M{"name": a.Name}).Count()
 	c.Assert(err, IsNil)
 	c.Assert(qt, Equals, 0)
 }
 
 func (s *S) TestInsertAppRollbackItself(c *C) {
-	action := new(insertApp)
-	c.Assert(action.rollbackItself(), Equals, false)
+	action := insertApp
+	c.Assert(action.rollbackItself, Equals, false)
 }
 
 func (s *S) TestCreateBucketForward(c *C) {
@@ -76,14 +77,14 @@ func (s *S) TestCreateBucketForward(c *C) {
 		defer config.Set("queue-server", old)
 	}
 	config.Set("queue-server", server.Addr())
-	insert := new(insertApp)
-	err = insert.forward(&a)
+	insert := insertApp
+	err = insert.forward(&pipelineContext{App: &a})
 	c.Assert(err, IsNil)
-	defer insert.backward(&a)
-	bucket := new(createBucketIam)
-	err = bucket.forward(&a)
+	defer insert.backward(&pipelineContext{App: &a})
+	bucket := createBucketIam
+	err = bucket.forward(&pipelineContext{App: &a})
 	c.Assert(err, IsNil)
-	defer bucket.backward(&a)
+	defer bucket.backward(&pipelineContext{App: &a})
 	err = a.Get()
 	c.Assert(err, IsNil)
 	env := a.InstanceEnv(s3InstanceName)
@@ -127,15 +128,22 @@ func (s *S) TestCreateBucketForward(c *C) {
 func (s *S) TestCreateBucketBackward(c *C) {
 	source := patchRandomReader()
 	defer unpatchRandomReader()
+	server := testing.FakeQueueServer{}
+	server.Start("127.0.0.1:0")
+	defer server.Stop()
+	config.Set("queue-server", server.Addr())
 	a := App{
 		Name:      "theirapp",
 		Framework: "ruby",
 		Units:     []Unit{{Machine: 1}},
 	}
-	action := new(createBucketIam)
-	err := action.forward(&a)
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	action := createBucketIam
+	err = action.forward(&pipelineContext{App: &a})
 	c.Assert(err, IsNil)
-	action.backward(&a)
+	action.backward(&pipelineContext{App: &a})
 	iam := getIAMEndpoint()
 	_, err = iam.GetUser("theirapp")
 	c.Assert(err, NotNil)
@@ -146,13 +154,25 @@ func (s *S) TestCreateBucketBackward(c *C) {
 	c.Assert(err, NotNil)
 }
 
+func (s *S) TestCreateBucketForwardFailsWhenTheEnvsAreNotSaved(c *C) {
+	patchRandomReader()
+	defer unpatchRandomReader()
+	a := App{Name: "unsaved", Framework: "ruby"}
+	action := createBucketIam
+	err := action.forward(&pipelineContext{App: &a})
+	c.Assert(err, NotNil)
+	action.backward(&pipelineContext{App: &a})
+	_, err = getIAMEndpoint().GetUser("unsaved")
+	c.Assert(err, NotNil)
+}
+
 func (s *S) TestCreateBucketRollbackItself(c *C) {
-	action := new(createBucketIam)
-	c.Assert(action.rollbackItself(), Equals, true)
+	action := createBucketIam
+	c.Assert(action.rollbackItself, Equals, true)
 }
 
 func (s *S) TestDeployForward(c *C) {
-	action := new(provisionApp)
+	action := provisionApp
 	a := App{
 		Name:      "appname",
 		Framework: "django",
@@ -161,7 +181,7 @@ func (s *S) TestDeployForward(c *C) {
 	err := db.Session.Apps().Insert(a)
 	c.Assert(err, IsNil)
 	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
-	err = action.forward(&a, 4)
+	err = action.forward(&pipelineContext{App: &a, Units: 4})
 	defer s.provisioner.Destroy(&a)
 	c.Assert(err, IsNil)
 	index := s.provisioner.FindApp(&a)
@@ -171,8 +191,8 @@ func (s *S) TestDeployForward(c *C) {
 }
 
 func (s *S) TestDeployRollbackItself(c *C) {
-	action := new(provisionApp)
-	c.Assert(action.rollbackItself(), Equals, false)
+	action := provisionApp
+	c.Assert(action.rollbackItself, Equals, false)
 }
 
 type testHandler struct {
@@ -201,10 +221,10 @@ func (s *S) TestCreateRepositoryForward(c *C) {
 	err := db.Session.Teams().Find(bson.M{"users": s.user.Email}).All(&teams)
 	c.Assert(err, IsNil)
 	a.SetTeams(teams)
-	action := new(createRepository)
-	err = action.forward(&a)
+	action := createRepository
+	err = action.forward(&pipelineContext{App: &a})
 	c.Assert(err, IsNil)
-	defer action.backward(&a)
+	defer action.backward(&pipelineContext{App: &a})
 	c.Assert(h.url[0], Equals, "/repository")
 	c.Assert(h.method[0], Equals, "POST")
 	expected := fmt.Sprintf(`{"name":"someapp","users":["%s"],"ispublic":false}`, s.user.Email)
@@ -216,9 +236,94 @@ func (s *S) TestCreateRepositoryBackward(c *C) {
 	ts := s.t.StartGandalfTestServer(&h)
 	defer ts.Close()
 	a := App{Name: "someapp"}
-	action := new(createRepository)
-	action.backward(&a)
+	action := createRepository
+	action.backward(&pipelineContext{App: &a})
 	c.Assert(h.url[0], Equals, "/repository/someapp")
 	c.Assert(h.method[0], Equals, "DELETE")
 	c.Assert(string(h.body[0]), Equals, "null")
 }
+
+func (s *S) TestAddBackendForward(c *C) {
+	a := App{Name: "someapp"}
+	action := addBackend
+	err := action.forward(&pipelineContext{App: &a})
+	c.Assert(err, IsNil)
+	c.Assert(s.router.HasBackend("someapp"), Equals, true)
+}
+
+func (s *S) TestAddBackendForwardWithoutRouter(c *C) {
+	Router = nil
+	defer func() { Router = s.router }()
+	a := App{Name: "someapp"}
+	action := addBackend
+	err := action.forward(&pipelineContext{App: &a})
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestRemoveBackendForward(c *C) {
+	s.router.AddBackend("someapp")
+	a := App{Name: "someapp"}
+	action := removeBackend
+	err := action.forward(&pipelineContext{App: &a})
+	c.Assert(err, IsNil)
+	c.Assert(s.router.HasBackend("someapp"), Equals, false)
+}
+
+func (s *S) TestRemoveBackendForwardIgnoresUnknownBackends(c *C) {
+	a := App{Name: "someapp"}
+	action := removeBackend
+	err := action.forward(&pipelineContext{App: &a})
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestProvisionUnitsForwardAndBackward(c *C) {
+	a := App{Name: "warpaint", Framework: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	ctx := pipelineContext{App: &a, Units: 2, Process: "worker"}
+	err := provisionUnits.forward(&ctx)
+	c.Assert(err, IsNil)
+	c.Assert(a.Units, HasLen, 2)
+	c.Assert(a.Units[0].Process, Equals, "worker")
+	c.Assert(a.Units[0].State, Equals, provision.StatusPending.String())
+	c.Assert(ctx.UnitNames, DeepEquals, []string{a.Units[0].Name, a.Units[1].Name})
+	c.Assert(s.provisioner.GetUnits(&a), HasLen, 3)
+	provisionUnits.backward(&ctx)
+	c.Assert(s.provisioner.GetUnits(&a), HasLen, 1)
+}
+
+func (s *S) TestSaveUnitsBackward(c *C) {
+	a := App{Name: "warpaint", Units: []Unit{{Name: "warpaint/0"}}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	a.Units = append(a.Units, Unit{Name: "warpaint/1"}, Unit{Name: "warpaint/2"})
+	ctx := pipelineContext{App: &a, UnitNames: []string{"warpaint/1", "warpaint/2"}}
+	err = saveUnits.forward(&ctx)
+	c.Assert(err, IsNil)
+	saveUnits.backward(&ctx)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Units, HasLen, 1)
+	c.Assert(a.Units[0].Name, Equals, "warpaint/0")
+}
+
+func (s *S) TestAddUnitsRollsBackWhenTheUnitsCantBeStarted(c *C) {
+	old, err := config.Get("queue-server")
+	if err == nil {
+		defer config.Set("queue-server", old)
+	}
+	config.Unset("queue-server")
+	a := App{Name: "warpaint", Framework: "python"}
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = a.AddUnits(2, "")
+	c.Assert(err, NotNil)
+	c.Assert(s.provisioner.GetUnits(&a), HasLen, 1)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Units, HasLen, 0)
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/globocom/tsuru/provision"
 	"github.com/globocom/tsuru/queue"
 	"github.com/globocom/tsuru/repository"
+	"github.com/globocom/tsuru/router"
 	"io"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/goyaml"
@@ -36,6 +37,10 @@ const (
 
 var Provisioner provision.Provisioner
 
+// Router is the router that forwards requests to the units of the apps. It's
+// nil when tsuru is not configured with a router.
+var Router router.Router
+
 func write(w io.Writer, content []byte) error {
 	n, err := w.Write(content)
 	if err != nil {
@@ -50,13 +55,44 @@ func write(w io.Writer, content []byte) error {
 type App struct {
 	Env       map[string]bind.EnvVar
 	Framework string
+	Template  string
 	Logs      []Applog
 	Name      string
 	State     string
 	Ip        string
 	Units     []Unit
 	Teams     []string
-	hooks     *conf
+	Plan      Plan
+	CName     []string
+	Owner     string
+	// Description, Contact and Tags are the metadata of the app, see
+	// SetMetadata.
+	Description string
+	Contact     string
+	Tags        []string
+	// QuotaOwners are the teams and users whose quotas are used by the
+	// app, see Quota.
+	QuotaOwners []string
+	// Reservations are the units of the app reserved in the quota of
+	// each of its QuotaOwners.
+	Reservations []Reservation
+	// Processes are the process types declared in the Procfile of the
+	// app, loaded in the last deploy.
+	Processes []Process
+	// Maintenance indicates whether the app is in maintenance mode, see
+	// SetMaintenance.
+	Maintenance bool
+	// EnvVersion is incremented on every change of the environment
+	// variables of the app, and ApprcVersion is the version last written
+	// to all of its units, see WriteApprc.
+	EnvVersion   int
+	ApprcVersion int
+	// OldStorageKey is the storage access key replaced by the last
+	// rotation, deleted once OldStorageKeyVersion of the variables is
+	// written to all units of the app, see RotateStorageKeys.
+	OldStorageKey        string
+	OldStorageKeyVersion int
+	hooks                *conf
 }
 
 func (a *App) MarshalJSON() ([]byte, error) {
@@ -68,6 +104,18 @@ func (a *App) MarshalJSON() ([]byte, error) {
 	result["Units"] = a.Units
 	result["Repository"] = repository.GetUrl(a.Name)
 	result["Ip"] = a.Ip
+	result["CName"] = a.CName
+	result["Processes"] = a.Processes
+	result["Maintenance"] = a.Maintenance
+	result["Description"] = a.Description
+	result["Contact"] = a.Contact
+	result["Tags"] = a.Tags
+	result["Plan"] = map[string]interface{}{
+		"Name":     a.Plan.Name,
+		"Memory":   a.Plan.Memory,
+		"CpuShare": a.Plan.CpuShare,
+		"Disk":     a.Plan.Disk,
+	}
 	return json.Marshal(&result)
 }
 
@@ -77,9 +125,46 @@ type Applog struct {
 	Source  string
 }
 
+// conf is the app.conf file of the app, that declares its hooks. Hooks run
+// in the following order during a deploy:
+//
+//	build, pre-deploy, pre-restart, pos-restart, post-deploy
+//
+// pre-restart and pos-restart hooks also run when the app is restarted.
 type conf struct {
-	PreRestart []string `yaml:"pre-restart"`
-	PosRestart []string `yaml:"pos-restart"`
+	Build      []hook `yaml:"build"`
+	PreDeploy  []hook `yaml:"pre-deploy"`
+	PreRestart []hook `yaml:"pre-restart"`
+	PosRestart []hook `yaml:"pos-restart"`
+	PostDeploy []hook `yaml:"post-deploy"`
+}
+
+// phases returns the hooks of the app.conf, keyed by kind.
+func (c *conf) phases() map[string][]hook {
+	return map[string][]hook{
+		"build":       c.Build,
+		"pre-deploy":  c.PreDeploy,
+		"pre-restart": c.PreRestart,
+		"pos-restart": c.PosRestart,
+		"post-deploy": c.PostDeploy,
+	}
+}
+
+func (c *conf) validate() error {
+	for kind, hooks := range c.phases() {
+		for _, h := range hooks {
+			if h.Command == "" {
+				return fmt.Errorf("Invalid %s hook: the command is missing.", kind)
+			}
+			if h.RunOn != "" && h.RunOn != runOnAll && h.RunOn != runOnce {
+				return fmt.Errorf("Invalid %s hook %q: run-on must be %q or %q.", kind, h.Command, runOnce, runOnAll)
+			}
+			if h.Timeout < 0 {
+				return fmt.Errorf("Invalid %s hook %q: the timeout must be positive.", kind, h.Command)
+			}
+		}
+	}
+	return nil
 }
 
 func (a *App) Get() error {
@@ -88,13 +173,24 @@ func (a *App) Get() error {
 
 // CreateApp creates a new app.
 //
-// Creating a new app is a process composed of four steps:
+// Creating a new app is a process composed of six steps:
 //
-//       1. Save the app in the database
-//       2. Create S3 credentials and bucket for the app
-//       3. Create the git repository using gandalf
-//       4. Provision units within the provisioner
+//       1. Reserve the app and its units in the quotas of its owners
+//       2. Save the app in the database, with its plan
+//       3. Create the bucket of the app in the object storage
+//       4. Create the git repository using gandalf
+//       5. Provision units within the provisioner
+//       6. Register the app in the router
 func CreateApp(a *App, units uint) error {
+	if err := a.validateCreation(units); err != nil {
+		return err
+	}
+	return newPipeline("create-app", &pipelineContext{App: a, Units: units}).Execute()
+}
+
+// validateCreation checks whether the app can be created with the given
+// number of units, loading its plan.
+func (a *App) validateCreation(units uint) error {
 	if units == 0 {
 		return &ValidationError{Message: "Cannot create app with 0 units."}
 	}
@@ -104,18 +200,21 @@ func CreateApp(a *App, units uint) error {
 			"starting with a letter."
 		return &ValidationError{Message: msg}
 	}
-	actions := []action{
-		new(insertApp),
-		new(createBucketIam),
-		new(createRepository),
-		new(provisionApp),
+	if err := a.loadPlatform(); err != nil {
+		return err
 	}
-	return execute(a, actions, units)
+	return a.loadPlan()
 }
 
-func (a *App) unbind() error {
+// serviceInstances returns the service instances the app is bound to.
+func (a *App) serviceInstances() ([]service.ServiceInstance, error) {
 	var instances []service.ServiceInstance
 	err := db.Session.ServiceInstances().Find(bson.M{"apps": bson.M{"$in": []string{a.Name}}}).All(&instances)
+	return instances, err
+}
+
+func (a *App) unbind() error {
+	instances, err := a.serviceInstances()
 	if err != nil {
 		return err
 	}
@@ -140,28 +239,19 @@ func (a *App) unbind() error {
 
 // Destroy destroys an app.
 //
-// Destroy an app is a process composed of x steps:
+// Destroy an app is a process composed of six steps:
+//
+//       1. Unbind the app from its service instances
+//       2. Destroy the bucket of the app and its credentials
+//       3. Destroy the app units using the provisioner
+//       4. Remove the app from the router
+//       5. Remove the app from the database
+//       6. Release the app and its units in the quotas of its owners
 //
-//       1. Destroy the bucket and S3 credentials
-//       2. Destroy the app unit using juju
-//       3. Execute the unbind for the app
-//       4. Remove the app from the database
+// The steps can't be rolled back. If one of them fails, the removal stops
+// and can be finished later, see StuckRemovals.
 func (a *App) Destroy() error {
-	err := destroyBucket(a)
-	if err != nil {
-		return err
-	}
-	if len(a.Units) > 0 {
-		err = Provisioner.Destroy(a)
-		if err != nil {
-			return errors.New("Failed to destroy the app: " + err.Error())
-		}
-		err = a.unbind()
-		if err != nil {
-			return err
-		}
-	}
-	return db.Session.Apps().Remove(bson.M{"name": a.Name})
+	return newPipeline("destroy-app", &pipelineContext{App: a}).Execute()
 }
 
 // AddUnit adds a new unit to the app (or update an existing unit). It just updates
@@ -171,6 +261,10 @@ func (a *App) Destroy() error {
 func (a *App) AddUnit(u *Unit) {
 	for i, unt := range a.Units {
 		if unt.Name == u.Name {
+			// Provisioners may not report the process of units.
+			if u.Process == "" {
+				u.Process = unt.Process
+			}
 			a.Units[i] = *u
 			return
 		}
@@ -178,41 +272,24 @@ func (a *App) AddUnit(u *Unit) {
 	a.Units = append(a.Units, *u)
 }
 
-// AddUnits creates n new units within the provisioner, saves new units in the
-// database and enqueues the apprc serialization.
-func (a *App) AddUnits(n uint) error {
+// AddUnits creates n new units of the given process type within the
+// provisioner, saves new units in the database, binds them to the service
+// instances of the app and enqueues the apprc serialization. An empty process
+// means the DefaultProcess. The units are reserved in the quotas of the app
+// owners before being created. If any of these steps fails, the previous ones
+// are rolled back.
+func (a *App) AddUnits(n uint, process string) error {
 	if n == 0 {
 		return errors.New("Cannot add zero units.")
 	}
-	units, err := Provisioner.AddUnits(a, n)
-	if err != nil {
-		return err
+	if process == "" {
+		process = provision.DefaultProcess
 	}
-	qArgs := make([]string, len(units)+1)
-	qArgs[0] = a.Name
-	length := len(a.Units)
-	appUnits := make([]Unit, len(units))
-	a.Units = append(a.Units, appUnits...)
-	messages := make([]queue.Message, len(units)*2)
-	mCount := 0
-	for i, unit := range units {
-		a.Units[i+length] = Unit{
-			Name:    unit.Name,
-			Type:    unit.Type,
-			Ip:      unit.Ip,
-			Machine: unit.Machine,
-			State:   provision.StatusPending.String(),
-		}
-		qArgs[i+1] = unit.Name
-		messages[mCount] = queue.Message{Action: RegenerateApprc, Args: []string{a.Name, unit.Name}}
-		messages[mCount+1] = queue.Message{Action: StartApp, Args: []string{a.Name, unit.Name}}
-		mCount += 2
-	}
-	err = db.Session.Apps().Update(bson.M{"name": a.Name}, a)
-	if err != nil {
+	if err := a.validateProcess(process); err != nil {
 		return err
 	}
-	return a.enqueue(messages...)
+	ctx := pipelineContext{App: a, Units: n, Process: process}
+	return newPipeline("add-units", &ctx).Execute()
 }
 
 func (a *App) removeUnits(indices []int) {
@@ -236,6 +313,8 @@ func (a *App) removeUnits(indices []int) {
 	}
 }
 
+// RemoveUnits removes n units from the app, and tells the service instances
+// of the app that they were removed.
 func (a *App) RemoveUnits(n uint) error {
 	if n == 0 {
 		return errors.New("Cannot remove zero units.")
@@ -248,8 +327,53 @@ func (a *App) RemoveUnits(n uint) error {
 	if err != nil {
 		return err
 	}
+	removed := make([]Unit, len(indices))
+	for i, index := range indices {
+		removed[i] = a.Units[index]
+	}
+	a.releaseUnits(len(indices))
 	a.removeUnits(indices)
-	return db.Session.Apps().Update(bson.M{"name": a.Name}, a)
+	if err = db.Session.Apps().Update(bson.M{"name": a.Name}, a); err != nil {
+		return err
+	}
+	a.unbindUnits(removed)
+	return nil
+}
+
+// unbindUnits tells the service instances bound to the app that the given
+// units were removed. The units are already gone, so failures are only
+// logged.
+func (a *App) unbindUnits(units []Unit) {
+	instances, err := a.serviceInstances()
+	if err != nil {
+		log.Printf("Failed to unbind the removed units of the app %s: %s", a.Name, err)
+		return
+	}
+	for _, instance := range instances {
+		for i := range units {
+			if err := instance.UnbindUnit(a, &units[i]); err != nil {
+				log.Printf("Failed to unbind the unit %s from the instance %s: %s", units[i].Name, instance.Name, err)
+			}
+		}
+	}
+}
+
+// BindUnits tells the service instances bound to the app about the given
+// units. The collector calls it when units get their address, as some
+// provisioners create units without one. Failures are only logged.
+func (a *App) BindUnits(units []Unit) {
+	instances, err := a.serviceInstances()
+	if err != nil {
+		log.Printf("Failed to bind the units of the app %s: %s", a.Name, err)
+		return
+	}
+	for _, instance := range instances {
+		for i := range units {
+			if err := instance.BindUnit(a, &units[i]); err != nil {
+				log.Printf("Failed to bind the unit %s to the instance %s: %s", units[i].Name, instance.Name, err)
+			}
+		}
+	}
 }
 
 func (a *App) Find(team *auth.Team) (int, bool) {
@@ -297,12 +421,25 @@ func (a *App) SetTeams(teams []auth.Team) {
 	sort.Strings(a.Teams)
 }
 
-func (a *App) setEnv(env bind.EnvVar) {
+// setEnv adds the variable to the app, encrypting the value of private
+// variables (see encryptValue). They're decrypted only where the plain value
+// is needed: in the apprc of the units, in the bucket of the app and when
+// comparing revisions of the variables.
+func (a *App) setEnv(env bind.EnvVar) error {
 	if a.Env == nil {
 		a.Env = make(map[string]bind.EnvVar)
 	}
+	value := env.Value
+	if !env.Public {
+		var err error
+		if env.Value, err = encryptValue(env.Value); err != nil {
+			return err
+		}
+		value = "***"
+	}
 	a.Env[env.Name] = env
-	a.Log(fmt.Sprintf("setting env %s with value %s", env.Name, env.Value), "tsuru")
+	a.Log(fmt.Sprintf("setting env %s with value %s", env.Name, value), "tsuru")
+	return nil
 }
 
 func (a *App) getEnv(name string) (bind.EnvVar, error) {
@@ -347,7 +484,7 @@ func deployHookAbsPath(p string) (string, error) {
 	return strings.Join(cmdArgs, " "), nil
 }
 
-// Loads restart hooks from app.conf.
+// Loads hooks from app.conf.
 func (a *App) loadHooks() error {
 	if a.hooks != nil {
 		return nil
@@ -370,11 +507,15 @@ func (a *App) loadHooks() error {
 		a.Log(fmt.Sprintf("Got error while parsing yaml: %s", err), "tsuru")
 		return err
 	}
+	if err = a.hooks.validate(); err != nil {
+		a.Log(fmt.Sprintf("Got error while loading app.conf: %s", err), "tsuru")
+		return err
+	}
 	return nil
 }
 
-func (a *App) runHook(w io.Writer, cmds []string, kind string) error {
-	if len(cmds) == 0 {
+func (a *App) runHook(w io.Writer, hooks []hook, kind string) error {
+	if len(hooks) == 0 {
 		a.Log(fmt.Sprintf("Skipping %s hooks...", kind), "tsuru")
 		return nil
 	}
@@ -383,18 +524,20 @@ func (a *App) runHook(w io.Writer, cmds []string, kind string) error {
 	if err != nil {
 		return err
 	}
-	for _, cmd := range cmds {
-		p, err := deployHookAbsPath(cmd)
+	for _, h := range hooks {
+		p, err := deployHookAbsPath(h.Command)
 		if err != nil {
 			a.Log(fmt.Sprintf("Error obtaining absolute path to hook: %s.", err), "tsuru")
 			continue
 		}
-		err = a.Run(p, w)
+		err = a.runHookCommand(w, h, p)
 		if err != nil {
+			err = fmt.Errorf("The %s hook %q failed: %s", kind, h.Command, err)
+			write(w, []byte("\n ---> "+err.Error()+"\n"))
 			return err
 		}
 	}
-	return err
+	return nil
 }
 
 // preRestart is responsible for running user's pre-restart script.
@@ -418,21 +561,53 @@ func (a *App) posRestart(w io.Writer) error {
 	return a.runHook(w, a.hooks.PosRestart, "pos-restart")
 }
 
+// Hooks returns the commands of the hooks declared in the app.conf file of
+// the app, keyed by kind ("build", "pre-deploy", "pre-restart", "pos-restart"
+// and "post-deploy"). Kinds without commands are omitted.
+func (a *App) Hooks() (map[string][]string, error) {
+	if err := a.loadHooks(); err != nil {
+		return nil, err
+	}
+	hooks := make(map[string][]string)
+	for kind, phase := range a.hooks.phases() {
+		for _, h := range phase {
+			hooks[kind] = append(hooks[kind], h.Command)
+		}
+	}
+	return hooks, nil
+}
+
 // Run executes the command in app units, sourcing apprc before running the
 // command.
 func (a *App) Run(cmd string, w io.Writer) error {
+	return a.runIn(a, cmd, w)
+}
+
+// runIn executes the command in the units of target, which is either the app
+// or a view of some of its units, sourcing apprc before running the command.
+func (a *App) runIn(target provision.App, cmd string, w io.Writer) error {
 	a.Log(fmt.Sprintf("running '%s'", cmd), "tsuru")
 	source := "[ -f /home/application/apprc ] && source /home/application/apprc"
 	cd := "[ -d /home/application/current ] && cd /home/application/current"
 	cmd = fmt.Sprintf("%s; %s; %s", source, cd, cmd)
-	return a.run(cmd, w)
+	if err := a.checkStarted(); err != nil {
+		return err
+	}
+	return Provisioner.ExecuteCommand(w, w, target, cmd)
 }
 
 func (a *App) run(cmd string, w io.Writer) error {
+	if err := a.checkStarted(); err != nil {
+		return err
+	}
+	return Provisioner.ExecuteCommand(w, w, a, cmd)
+}
+
+func (a *App) checkStarted() error {
 	if a.State != string(provision.StatusStarted) {
 		return fmt.Errorf("App must be started to run commands, but it is %q.", a.State)
 	}
-	return Provisioner.ExecuteCommand(w, w, a, cmd)
+	return nil
 }
 
 // Command is declared just to satisfy repository.Unit interface.
@@ -452,7 +627,7 @@ func (a *App) Restart(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	err = a.run("/var/lib/tsuru/hooks/restart", w)
+	err = a.restart(w)
 	if err != nil {
 		return err
 	}
@@ -465,6 +640,13 @@ func (a *App) InstallDeps(w io.Writer) error {
 	return a.run("/var/lib/tsuru/hooks/dependencies", w)
 }
 
+// Deploy installs the dependencies of the code cloned in the units of the app
+// and restarts it, running the hooks of the app.conf file. A failing hook
+// aborts the deploy.
+func (a *App) Deploy(w io.Writer) error {
+	return newPipeline("deploy", &pipelineContext{App: a, w: w}).Execute()
+}
+
 func (a *App) Unit() *Unit {
 	if len(a.Units) > 0 {
 		unit := a.Units[0]
@@ -487,10 +669,20 @@ func (a *App) GetName() string {
 	return a.Name
 }
 
+// GetFramework returns the template of the platform of the app, which the
+// provisioner uses to create units. Apps whose platform doesn't define a
+// template use the name of the platform.
 func (a *App) GetFramework() string {
+	if a.Template != "" {
+		return a.Template
+	}
 	return a.Framework
 }
 
+func (a *App) GetPlan() provision.Plan {
+	return a.Plan.provisionPlan()
+}
+
 func (a *App) ProvisionUnits() []provision.AppUnit {
 	units := make([]provision.AppUnit, len(a.Units))
 	for i, u := range a.Units {
@@ -501,38 +693,12 @@ func (a *App) ProvisionUnits() []provision.AppUnit {
 	return units
 }
 
-// SerializeEnvVars serializes the environment variables of the app. The
-// environment variables will be written the the file /home/application/apprc
-// in all units of the app.
-//
-// The wait parameter indicates whether it should wait or not for the write to
-// complete.
-func (a *App) SerializeEnvVars() error {
-	var buf bytes.Buffer
-	cmd := "cat > /home/application/apprc <<END\n"
-	cmd += fmt.Sprintf("# generated by tsuru at %s\n", time.Now().Format(time.RFC822Z))
-	for k, v := range a.Env {
-		cmd += fmt.Sprintf(`export %s="%s"`+"\n", k, v.Value)
-	}
-	cmd += "END\n"
-	err := a.run(cmd, &buf)
-	if err != nil {
-		output := buf.Bytes()
-		if output == nil {
-			err = fmt.Errorf("Failed to write env vars: %s.", err)
-		} else {
-			err = fmt.Errorf("Failed to write env vars (%s): %s.", err, output)
-		}
-	}
-	return err
-}
-
 func (a *App) SetEnvs(envs []bind.EnvVar, publicOnly bool) error {
 	e := make([]bind.EnvVar, len(envs))
 	for i, env := range envs {
 		e[i] = bind.EnvVar(env)
 	}
-	return a.SetEnvsToApp(e, publicOnly, false)
+	return a.SetEnvsToApp(e, publicOnly, false, "")
 }
 
 func (a *App) enqueue(msgs ...queue.Message) error {
@@ -561,33 +727,24 @@ func (a *App) enqueue(msgs ...queue.Message) error {
 //
 // If useQueue is true, it will use a queue to write the environment variables
 // in the units of the app.
-func (app *App) SetEnvsToApp(envs []bind.EnvVar, publicOnly, useQueue bool) error {
-	if len(envs) > 0 {
-		for _, env := range envs {
-			set := true
-			if publicOnly {
-				e, err := app.getEnv(env.Name)
-				if err == nil && !e.Public {
-					set = false
-				}
-			}
-			if set {
-				app.setEnv(env)
-			}
-		}
-		if err := db.Session.Apps().Update(bson.M{"name": app.Name}, app); err != nil {
+//
+// If any of the names is not a valid shell variable name, no variable is set
+// and a ValidationError is returned. The change is recorded in the env history
+// of the app, on behalf of the given user.
+func (app *App) SetEnvsToApp(envs []bind.EnvVar, publicOnly, useQueue bool, user string) error {
+	for _, env := range envs {
+		if err := validateEnvName(env.Name); err != nil {
 			return err
 		}
-		if useQueue {
-			return app.enqueue(queue.Message{Action: RegenerateApprc, Args: []string{app.Name}})
-		}
-		app.SerializeEnvVars()
+	}
+	if len(envs) > 0 {
+		return app.changeEnvs(envs, nil, publicOnly, useQueue, EnvRevision{User: user})
 	}
 	return nil
 }
 
 func (a *App) UnsetEnvs(envs []string, publicOnly bool) error {
-	return a.UnsetEnvsFromApp(envs, publicOnly, false)
+	return a.UnsetEnvsFromApp(envs, publicOnly, false, "")
 }
 
 // UnsetEnvsFromApp removes environment variables from an app, serializing the
@@ -599,24 +756,52 @@ func (a *App) UnsetEnvs(envs []string, publicOnly bool) error {
 // overridden (if set to false, setEnvsToApp may override a private variable).
 //
 // If useQueue is true, it will use a queue to write the environment variables
-// in the units of the app.
-func (app *App) UnsetEnvsFromApp(variableNames []string, publicOnly, useQueue bool) error {
+// in the units of the app. The change is recorded in the env history of the
+// app, on behalf of the given user.
+func (app *App) UnsetEnvsFromApp(variableNames []string, publicOnly, useQueue bool, user string) error {
 	if len(variableNames) > 0 {
-		for _, name := range variableNames {
-			var unset bool
-			e, err := app.getEnv(name)
-			if !publicOnly || (err == nil && e.Public) {
-				unset = true
-			}
-			if unset {
-				delete(app.Env, name)
+		return app.changeEnvs(nil, variableNames, publicOnly, useQueue, EnvRevision{User: user})
+	}
+	return nil
+}
+
+// changeEnvs sets and unsets environment variables of the app in a single
+// update, recording the variables that actually changed as a new revision in
+// the env history of the app. The User and Rollback fields of rev must be
+// filled by the caller.
+func (app *App) changeEnvs(set []bind.EnvVar, unset []string, publicOnly, useQueue bool, rev EnvRevision) error {
+	before := make(map[string]bind.EnvVar, len(app.Env))
+	for name, env := range app.Env {
+		before[name] = env
+	}
+	for _, env := range set {
+		if publicOnly {
+			e, err := app.getEnv(env.Name)
+			if err == nil && !e.Public {
+				continue
 			}
 		}
-		if err := db.Session.Apps().Update(bson.M{"name": app.Name}, app); err != nil {
+		if err := app.setEnv(env); err != nil {
 			return err
 		}
-		app.SerializeEnvVars()
 	}
+	for _, name := range unset {
+		e, err := app.getEnv(name)
+		if !publicOnly || (err == nil && e.Public) {
+			delete(app.Env, name)
+		}
+	}
+	app.EnvVersion++
+	if err := db.Session.Apps().Update(bson.M{"name": app.Name}, app); err != nil {
+		return err
+	}
+	if err := app.recordEnvRevision(before, rev); err != nil {
+		return err
+	}
+	if useQueue {
+		return app.enqueue(queue.Message{Action: RegenerateApprc, Args: []string{app.Name}})
+	}
+	app.SerializeEnvVars()
 	return nil
 }
 
@@ -644,20 +829,78 @@ func (err *ValidationError) Error() string {
 	return err.Message
 }
 
-func List(u *auth.User) ([]App, error) {
-	var apps []App
-	if u.IsAdmin() {
-		if err := db.Session.Apps().Find(nil).All(&apps); err != nil {
-			return []App{}, err
+// Filter selects the apps returned by List. Empty fields match all apps.
+type Filter struct {
+	// Name is a regular expression matched against the name of the apps.
+	Name      string
+	Framework string
+	State     string
+	Team      string
+	// Tags are the tags the apps must have, all of them.
+	Tags []string
+	// Limit is the maximum number of apps in a page, zero meaning no
+	// limit. Page starts at 1.
+	Limit int
+	Page  int
+}
+
+func (f *Filter) query() (bson.M, error) {
+	query := bson.M{}
+	if f == nil {
+		return query, nil
+	}
+	if f.Name != "" {
+		if _, err := regexp.Compile(f.Name); err != nil {
+			return nil, &ValidationError{Message: fmt.Sprintf("Invalid name pattern %q: %s.", f.Name, err)}
 		}
-		return apps, nil
+		query["name"] = bson.M{"$regex": f.Name}
+	}
+	if f.Framework != "" {
+		query["framework"] = f.Framework
+	}
+	if f.State != "" {
+		query["state"] = f.State
+	}
+	if f.Team != "" {
+		query["teams"] = f.Team
+	}
+	if len(f.Tags) > 0 {
+		query["tags"] = bson.M{"$all": f.Tags}
 	}
-	ts, err := u.Teams()
+	if f.Limit < 0 || f.Page < 0 {
+		return nil, &ValidationError{Message: "The page and the limit must be positive."}
+	}
+	return query, nil
+}
+
+// List returns the apps the user has access to that match the filter, sorted
+// by name. A nil filter matches all apps.
+func List(u *auth.User, f *Filter) ([]App, error) {
+	var apps []App
+	query, err := f.query()
 	if err != nil {
 		return []App{}, err
 	}
-	teams := auth.GetTeamsNames(ts)
-	if err := db.Session.Apps().Find(bson.M{"teams": bson.M{"$in": teams}}).All(&apps); err != nil {
+	if !u.IsAdmin() {
+		ts, err := u.Teams()
+		if err != nil {
+			return []App{}, err
+		}
+		teams := auth.GetTeamsNames(ts)
+		if f != nil && f.Team != "" {
+			query["teams"] = bson.M{"$in": teams, "$all": []string{f.Team}}
+		} else {
+			query["teams"] = bson.M{"$in": teams}
+		}
+	}
+	q := db.Session.Apps().Find(query).Sort("name")
+	if f != nil && f.Limit > 0 {
+		if f.Page > 1 {
+			q = q.Skip((f.Page - 1) * f.Limit)
+		}
+		q = q.Limit(f.Limit)
+	}
+	if err := q.All(&apps); err != nil {
 		return []App{}, err
 	}
 	return apps, nil
@@ -74,7 +74,7 @@ func (s *S) TestDestroyWithoutUnits(c *C) {
 	h := testHandler{}
 	ts := s.t.StartGandalfTestServer(&h)
 	defer ts.Close()
-	app := App{Name: "x4"}
+	app := App{Name: "x4", Framework: "ruby"}
 	err := CreateApp(&app, 1)
 	c.Assert(err, IsNil)
 	err = app.Destroy()
@@ -171,7 +171,7 @@ func (s *S) TestCantCreateTwoAppsWithTheSameName(c *C) {
 	err := db.Session.Apps().Insert(bson.M{"name": "appName"})
 	c.Assert(err, IsNil)
 	defer db.Session.Apps().Remove(bson.M{"name": "appName"})
-	a := App{Name: "appName"}
+	a := App{Name: "appName", Framework: "ruby"}
 	err = CreateApp(&a, 1)
 	defer a.Destroy() // clean mess if test fail
 	c.Assert(err, NotNil)
@@ -269,11 +269,11 @@ func (s *S) TestAddUnits(c *C) {
 	defer db.Session.Apps().Remove(bson.M{"name": app.Name})
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	err = app.AddUnits(5)
+	err = app.AddUnits(5, "")
 	c.Assert(err, IsNil)
 	units := s.provisioner.GetUnits(&app)
 	c.Assert(units, HasLen, 6)
-	err = app.AddUnits(2)
+	err = app.AddUnits(2, "")
 	c.Assert(err, IsNil)
 	units = s.provisioner.GetUnits(&app)
 	c.Assert(units, HasLen, 8)
@@ -301,14 +301,14 @@ func (s *S) TestAddUnits(c *C) {
 
 func (s *S) TestAddZeroUnits(c *C) {
 	app := App{Name: "warpaint", Framework: "ruby"}
-	err := app.AddUnits(0)
+	err := app.AddUnits(0, "")
 	c.Assert(err, NotNil)
 	c.Assert(err.Error(), Equals, "Cannot add zero units.")
 }
 
 func (s *S) TestAddUnitsFailureInProvisioner(c *C) {
 	app := App{Name: "scars", Framework: "golang"}
-	err := app.AddUnits(2)
+	err := app.AddUnits(2, "")
 	c.Assert(err, NotNil)
 	c.Assert(err.Error(), Equals, "App is not provisioned.")
 }
@@ -329,7 +329,7 @@ func (s *S) TestRemoveUnits(c *C) {
 	defer db.Session.Apps().Remove(bson.M{"name": app.Name})
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	s.provisioner.AddUnits(&app, 4)
+	s.provisioner.AddUnits(&app, 4, "web")
 	err = app.RemoveUnits(2)
 	c.Assert(err, IsNil)
 	units := s.provisioner.GetUnits(&app)
@@ -368,7 +368,7 @@ func (s *S) TestRemoveUnitsInvalidValues(c *C) {
 	defer db.Session.Apps().Remove(bson.M{"name": app.Name})
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	s.provisioner.AddUnits(&app, 4)
+	s.provisioner.AddUnits(&app, 4, "web")
 	for _, test := range tests {
 		err := app.RemoveUnits(test.n)
 		c.Check(err, NotNil)
@@ -516,7 +516,7 @@ func (s *S) TestSetEnvRespectsThePublicOnlyFlagKeepPrivateVariablesWhenItsTrue(c
 			Public: true,
 		},
 	}
-	err = a.SetEnvsToApp(envs, true, false)
+	err = a.SetEnvsToApp(envs, true, false, "")
 	c.Assert(err, IsNil)
 	newApp := App{Name: a.Name}
 	err = newApp.Get()
@@ -565,7 +565,7 @@ func (s *S) TestSetEnvRespectsThePublicOnlyFlagOverwrittenAllVariablesWhenItsFal
 			Public: true,
 		},
 	}
-	err = a.SetEnvsToApp(envs, false, false)
+	err = a.SetEnvsToApp(envs, false, false, "")
 	c.Assert(err, IsNil)
 	newApp := App{Name: a.Name}
 	err = newApp.Get()
@@ -607,7 +607,7 @@ func (s *S) TestUnsetEnvRespectsThePublicOnlyFlagKeepPrivateVariablesWhenItsTrue
 	err := db.Session.Apps().Insert(a)
 	c.Assert(err, IsNil)
 	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
-	err = a.UnsetEnvsFromApp([]string{"DATABASE_HOST", "DATABASE_PASSWORD"}, true, false)
+	err = a.UnsetEnvsFromApp([]string{"DATABASE_HOST", "DATABASE_PASSWORD"}, true, false, "")
 	c.Assert(err, IsNil)
 	newApp := App{Name: a.Name}
 	err = newApp.Get()
@@ -644,7 +644,7 @@ func (s *S) TestUnsetEnvRespectsThePublicOnlyFlagUnsettingAllVariablesWhenItsFal
 	err := db.Session.Apps().Insert(a)
 	c.Assert(err, IsNil)
 	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
-	err = a.UnsetEnvsFromApp([]string{"DATABASE_HOST", "DATABASE_PASSWORD"}, false, false)
+	err = a.UnsetEnvsFromApp([]string{"DATABASE_HOST", "DATABASE_PASSWORD"}, false, false, "")
 	c.Assert(err, IsNil)
 	newApp := App{Name: a.Name}
 	err = newApp.Get()
@@ -768,8 +768,8 @@ pos-restart:
 	}
 	err := a.loadHooks()
 	c.Assert(err, IsNil)
-	c.Assert(a.hooks.PreRestart, DeepEquals, []string{"testdata/pre.sh"})
-	c.Assert(a.hooks.PosRestart, DeepEquals, []string{"testdata/pos.sh"})
+	c.Assert(a.hooks.PreRestart, DeepEquals, []hook{{Command: "testdata/pre.sh"}})
+	c.Assert(a.hooks.PosRestart, DeepEquals, []hook{{Command: "testdata/pos.sh"}})
 }
 
 func (s *S) TestLoadHooksWithListOfCommands(c *C) {
@@ -788,8 +788,23 @@ pos-restart:
 	}
 	err := a.loadHooks()
 	c.Assert(err, IsNil)
-	c.Assert(a.hooks.PreRestart, DeepEquals, []string{"testdata/pre.sh", "ls -lh", "sudo rm -rf /"})
-	c.Assert(a.hooks.PosRestart, DeepEquals, []string{"testdata/pos.sh"})
+	c.Assert(a.hooks.PreRestart, DeepEquals, []hook{{Command: "testdata/pre.sh"}, {Command: "ls -lh"}, {Command: "sudo rm -rf /"}})
+	c.Assert(a.hooks.PosRestart, DeepEquals, []hook{{Command: "testdata/pos.sh"}})
+}
+
+func (s *S) TestHooks(c *C) {
+	output := `pre-restart:
+  - testdata/pre.sh
+`
+	s.provisioner.PrepareOutput([]byte(output))
+	a := App{
+		Name:      "something",
+		Framework: "django",
+		State:     string(provision.StatusStarted),
+	}
+	hooks, err := a.Hooks()
+	c.Assert(err, IsNil)
+	c.Assert(hooks, DeepEquals, map[string][]string{"pre-restart": {"testdata/pre.sh"}})
 }
 
 func (s *S) TestLoadHooksWithError(c *C) {
@@ -807,8 +822,8 @@ func (s *S) TestPreRestart(c *C) {
 		Framework: "django",
 		State:     string(provision.StatusStarted),
 		hooks: &conf{
-			PreRestart: []string{"pre.sh"},
-			PosRestart: []string{"pos.sh"},
+			PreRestart: []hook{{Command: "pre.sh"}},
+			PosRestart: []hook{{Command: "pos.sh"}},
 		},
 	}
 	w := new(bytes.Buffer)
@@ -819,7 +834,7 @@ func (s *S) TestPreRestart(c *C) {
 	c.Assert(st, Matches, `.*### ---> Running pre-restart###.*pre-restarted$`)
 	cmds := s.provisioner.GetCmds("", &a)
 	c.Assert(cmds, HasLen, 1)
-	c.Assert(cmds[0].Cmd, Matches, `^\[ -f /home/application/apprc \] && source /home/application/apprc; \[ -d /home/application/current \] && cd /home/application/current;.*pre.sh$`)
+	c.Assert(cmds[0].Cmd, Matches, `^\[ -f /home/application/apprc \] && source /home/application/apprc; \[ -d /home/application/current \] && cd /home/application/current; timeout 600 sh -c 'pre.sh'$`)
 }
 
 func (s *S) TestPreRestartWhenAppConfDoesNotExist(c *C) {
@@ -839,7 +854,7 @@ func (s *S) TestSkipsPreRestartWhenPreRestartSectionDoesNotExists(c *C) {
 		Name:      "something",
 		Framework: "django",
 		Units:     []Unit{{State: string(provision.StatusStarted), Machine: 1}},
-		hooks:     &conf{PosRestart: []string{"somescript.sh"}},
+		hooks:     &conf{PosRestart: []hook{{Command: "somescript.sh"}}},
 	}
 	w := new(bytes.Buffer)
 	l := stdlog.New(w, "", stdlog.LstdFlags)
@@ -856,7 +871,7 @@ func (s *S) TestPosRestart(c *C) {
 		Name:      "something",
 		Framework: "django",
 		State:     string(provision.StatusStarted),
-		hooks:     &conf{PosRestart: []string{"pos.sh"}},
+		hooks:     &conf{PosRestart: []hook{{Command: "pos.sh"}}},
 	}
 	w := new(bytes.Buffer)
 	err := a.posRestart(w)
@@ -881,7 +896,7 @@ func (s *S) TestSkipsPosRestartWhenPosRestartSectionDoesNotExists(c *C) {
 		Name:      "something",
 		Framework: "django",
 		Units:     []Unit{{State: string(provision.StatusStarted), Machine: 1}},
-		hooks:     &conf{PreRestart: []string{"somescript.sh"}},
+		hooks:     &conf{PreRestart: []hook{{Command: "somescript.sh"}}},
 	}
 	w := new(bytes.Buffer)
 	l := stdlog.New(w, "", stdlog.LstdFlags)
@@ -937,7 +952,7 @@ func (s *S) TestRestartRunsPreRestartHook(c *C) {
 		Framework: "django",
 		Teams:     []string{s.team.Name},
 		State:     string(provision.StatusStarted),
-		hooks:     &conf{PreRestart: []string{"pre.sh"}},
+		hooks:     &conf{PreRestart: []hook{{Command: "pre.sh"}}},
 	}
 	var buf bytes.Buffer
 	err := a.Restart(&buf)
@@ -955,7 +970,7 @@ func (s *S) TestRestartRunsPosRestartHook(c *C) {
 		Framework: "django",
 		Teams:     []string{s.team.Name},
 		State:     string(provision.StatusStarted),
-		hooks:     &conf{PosRestart: []string{"pos.sh"}},
+		hooks:     &conf{PosRestart: []hook{{Command: "pos.sh"}}},
 	}
 	var buf bytes.Buffer
 	err := a.Restart(&buf)
@@ -1042,6 +1057,8 @@ func (s *S) TestAppMarshalJson(c *C) {
 		Framework: "Framework",
 		Teams:     []string{"team1"},
 		Ip:        "10.10.10.1",
+		CName:     []string{"name.mycompany.com"},
+		Plan:      Plan{Name: "small", Memory: 512, CpuShare: 100, Disk: 2048},
 	}
 	expected := make(map[string]interface{})
 	expected["Name"] = "Name"
@@ -1051,6 +1068,18 @@ func (s *S) TestAppMarshalJson(c *C) {
 	expected["Teams"] = []interface{}{"team1"}
 	expected["Units"] = nil
 	expected["Ip"] = "10.10.10.1"
+	expected["CName"] = []interface{}{"name.mycompany.com"}
+	expected["Processes"] = nil
+	expected["Maintenance"] = false
+	expected["Description"] = ""
+	expected["Contact"] = ""
+	expected["Tags"] = nil
+	expected["Plan"] = map[string]interface{}{
+		"Name":     "small",
+		"Memory":   float64(512),
+		"CpuShare": float64(100),
+		"Disk":     float64(2048),
+	}
 	data, err := app.MarshalJSON()
 	c.Assert(err, IsNil)
 	result := make(map[string]interface{})
@@ -1105,6 +1134,7 @@ func (s *S) TestSerializeEnvVars(c *C) {
 		Name:  "time",
 		Teams: []string{s.team.Name},
 		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "time/0"}},
 		Env: map[string]bind.EnvVar{
 			"http_proxy": {
 				Name:   "http_proxy",
@@ -1117,8 +1147,9 @@ func (s *S) TestSerializeEnvVars(c *C) {
 	c.Assert(err, IsNil)
 	cmds := s.provisioner.GetCmds("", &app)
 	c.Assert(cmds, HasLen, 1)
-	cmdRegexp := `^cat > /home/application/apprc <<END # generated by tsuru .*`
-	cmdRegexp += ` export http_proxy="http://theirproxy.com:3128/" END $`
+	cmdRegexp := `^printf '%s' '# generated by tsuru .*`
+	cmdRegexp += ` export http_proxy='\\''http://theirproxy.com:3128/'\\'' ' > /home/application/.apprc.([0-9a-f]+)`
+	cmdRegexp += ` && mv -f /home/application/.apprc.([0-9a-f]+) /home/application/apprc$`
 	cmd := strings.Replace(cmds[0].Cmd, "\n", " ", -1)
 	c.Assert(cmd, Matches, cmdRegexp)
 }
@@ -1145,6 +1176,7 @@ func (s *S) TestSerializeEnvVarsErrorWithOutput(c *C) {
 	app := App{
 		Name:  "intheend",
 		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "intheend/0"}},
 		Env: map[string]bind.EnvVar{
 			"https_proxy": {
 				Name:   "https_proxy",
@@ -1155,7 +1187,7 @@ func (s *S) TestSerializeEnvVarsErrorWithOutput(c *C) {
 	}
 	err := app.SerializeEnvVars()
 	c.Assert(err, NotNil)
-	expected := "Failed to write env vars (exit status 1): This program has performed an illegal operation."
+	expected := `Failed to write env vars in unit "intheend/0" (exit status 1): This program has performed an illegal operation.`
 	c.Assert(err.Error(), Equals, expected)
 }
 
@@ -1176,13 +1208,13 @@ func (s *S) TestListReturnsAppsForAGivenUser(c *C) {
 		db.Session.Apps().Remove(bson.M{"name": a.Name})
 		db.Session.Apps().Remove(bson.M{"name": a2.Name})
 	}()
-	apps, err := List(s.user)
+	apps, err := List(s.user, nil)
 	c.Assert(err, IsNil)
 	c.Assert(len(apps), Equals, 2)
 }
 
 func (s *S) TestListReturnsEmptyAppArrayWhenUserHasNoAccessToAnyApp(c *C) {
-	apps, err := List(s.user)
+	apps, err := List(s.user, nil)
 	c.Assert(err, IsNil)
 	c.Assert(apps, DeepEquals, []App(nil))
 }
@@ -1194,7 +1226,7 @@ func (s *S) TestListReturnsAllAppsWhenUserIsInAdminTeam(c *C) {
 	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
 	s.createAdminUserAndTeam(c)
 	defer s.removeAdminUserAndTeam(c)
-	apps, err := List(s.admin)
+	apps, err := List(s.admin, nil)
 	c.Assert(len(apps), Greater, 0)
 	c.Assert(apps[0].Name, Equals, "testApp")
 	c.Assert(apps[0].Teams, DeepEquals, []string{"notAdmin", "noSuperUser"})
@@ -0,0 +1,198 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const apprcPath = "/home/application/apprc"
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateEnvName returns a ValidationError if the name can't be used as the
+// name of an environment variable in a shell.
+func validateEnvName(name string) error {
+	if !envNameRegexp.MatchString(name) {
+		msg := fmt.Sprintf("Invalid environment variable name %q: names must start with a letter or an underscore, followed by letters, digits or underscores.", name)
+		return &ValidationError{Message: msg}
+	}
+	return nil
+}
+
+// shellQuote quotes s for the shell, using single quotes. Nothing is
+// interpreted by the shell inside single quotes, so the only character that
+// needs escaping is the single quote itself.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// ApprcResult is the result of writing the apprc file in a unit of the app.
+// Error is nil if the file was written.
+type ApprcResult struct {
+	Unit  string
+	Error error
+}
+
+// unitApp restricts commands executed by the provisioner to some units of
+// the app.
+type unitApp struct {
+	*App
+	units []provision.AppUnit
+}
+
+func (a *unitApp) ProvisionUnits() []provision.AppUnit {
+	return a.units
+}
+
+// apprc returns the content of the apprc file, exporting all environment
+// variables of the app, in alphabetical order. Variables with invalid names,
+// set before names were validated, are skipped.
+func (a *App) apprc() (string, error) {
+	names := make([]string, 0, len(a.Env))
+	for name := range a.Env {
+		if err := validateEnvName(name); err != nil {
+			log.Printf("Skipping env var of the app %s: %s", a.Name, err)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# generated by tsuru at %s\n", time.Now().Format(time.RFC822Z))
+	for _, name := range names {
+		value := a.Env[name].Value
+		// Public values are never encrypted, even if they look like it.
+		if !a.Env[name].Public {
+			var err error
+			if value, err = decryptValue(value); err != nil {
+				return "", err
+			}
+		}
+		fmt.Fprintf(&buf, "export %s=%s\n", name, shellQuote(value))
+	}
+	return buf.String(), nil
+}
+
+// apprcCommand returns the command that writes the apprc file. The content is
+// written to a temporary file, which is then renamed, so the apprc file is
+// replaced atomically and never seen half written.
+func apprcCommand(content string) (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	tmp := fmt.Sprintf("/home/application/.apprc.%s", hex.EncodeToString(suffix))
+	return fmt.Sprintf("printf '%%s' %s > %s && mv -f %s %s", shellQuote(content), tmp, tmp, apprcPath), nil
+}
+
+// WriteApprc writes the environment variables of the app to the file
+// /home/application/apprc in the given units, or in all units of the app when
+// no unit is given. It returns the result of each unit. Private variables are
+// written decrypted.
+//
+// When the file is written in all units, the version of the variables is
+// saved as the ApprcVersion of the app.
+func (a *App) WriteApprc(units ...string) ([]ApprcResult, error) {
+	if err := a.checkStarted(); err != nil {
+		return nil, fmt.Errorf("Failed to write env vars: %s", err)
+	}
+	content, err := a.apprc()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write env vars: %s", err)
+	}
+	byName := make(map[string]provision.AppUnit)
+	all := a.ProvisionUnits()
+	for _, u := range all {
+		byName[u.GetName()] = u
+	}
+	whole := len(units) == 0
+	if whole {
+		for _, u := range all {
+			units = append(units, u.GetName())
+		}
+	}
+	results := make([]ApprcResult, len(units))
+	for i, name := range units {
+		results[i].Unit = name
+		u, ok := byName[name]
+		if !ok {
+			results[i].Error = fmt.Errorf("App %q does not have a unit named %q.", a.Name, name)
+			continue
+		}
+		cmd, err := apprcCommand(content)
+		if err != nil {
+			results[i].Error = err
+			whole = false
+			continue
+		}
+		var buf bytes.Buffer
+		err = Provisioner.ExecuteCommand(&buf, &buf, &unitApp{App: a, units: []provision.AppUnit{u}}, cmd)
+		if err != nil {
+			if output := buf.Bytes(); len(output) > 0 {
+				err = fmt.Errorf("Failed to write env vars in unit %q (%s): %s.", name, err, output)
+			} else {
+				err = fmt.Errorf("Failed to write env vars in unit %q: %s.", name, err)
+			}
+			results[i].Error = err
+			whole = false
+		}
+	}
+	if whole {
+		a.saveApprcVersion()
+	}
+	return results, nil
+}
+
+// saveApprcVersion saves the current version of the variables of the app as
+// its ApprcVersion, unless a newer version was already saved, and deletes the
+// storage key replaced by RotateStorageKeys once its replacement is written.
+func (a *App) saveApprcVersion() {
+	query := bson.M{"name": a.Name, "apprcversion": bson.M{"$lt": a.EnvVersion}}
+	err := db.Session.Apps().Update(query, bson.M{"$set": bson.M{"apprcversion": a.EnvVersion}})
+	if err != nil && err != mgo.ErrNotFound {
+		log.Printf("Failed to save the apprc version of the app %s: %s", a.Name, err)
+		return
+	}
+	if err == nil {
+		a.ApprcVersion = a.EnvVersion
+		if err = deleteOldStorageKey(a.Name); err != nil {
+			log.Printf("Failed to delete the old storage key of the app %s: %s", a.Name, err)
+		}
+	}
+}
+
+// SerializeEnvVars writes the environment variables of the app to the apprc
+// file in all units of the app, returning an error describing the units where
+// the file could not be written.
+func (a *App) SerializeEnvVars() error {
+	results, err := a.WriteApprc()
+	if err != nil {
+		return err
+	}
+	var msgs []string
+	for _, r := range results {
+		if r.Error != nil {
+			msgs = append(msgs, r.Error.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return nil
+}
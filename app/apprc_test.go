@@ -0,0 +1,199 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// adversarialValues are values that would break a naively generated apprc.
+var adversarialValues = map[string]string{
+	"SINGLE_QUOTE": "it's",
+	"DOUBLE_QUOTE": `say "hello"`,
+	"DOLLAR":       "$HOME ${PATH}",
+	"BACKTICK":     "`touch /tmp/pwned`",
+	"SUBSHELL":     "$(touch /tmp/pwned)",
+	"NEWLINE":      "first line\nsecond line",
+	"HEREDOC":      "value\nEND\necho pwned",
+	"BACKSLASH":    `C:\path\n`,
+	"SEMICOLON":    "a; rm -rf /",
+	"EMPTY":        "",
+}
+
+func (s *S) TestValidateEnvName(c *C) {
+	valid := []string{"DATABASE_HOST", "http_proxy", "_PRIVATE", "EC2_HOST", "a"}
+	for _, name := range valid {
+		c.Check(validateEnvName(name), IsNil)
+	}
+	invalid := []string{"", "1PROXY", "MY-VAR", "MY VAR", "A=B", "$(ls)", "A'B", "A\nB"}
+	for _, name := range invalid {
+		err := validateEnvName(name)
+		c.Check(err, NotNil)
+		_, ok := err.(*ValidationError)
+		c.Check(ok, Equals, true)
+	}
+}
+
+func (s *S) TestShellQuote(c *C) {
+	c.Assert(shellQuote("simple"), Equals, "'simple'")
+	c.Assert(shellQuote("it's"), Equals, `'it'\''s'`)
+	c.Assert(shellQuote(""), Equals, "''")
+}
+
+func (s *S) TestApprcIsSafeForTheShell(c *C) {
+	a := App{Name: "adversarial", Env: make(map[string]bind.EnvVar)}
+	for name, value := range adversarialValues {
+		a.Env[name] = bind.EnvVar{Name: name, Value: value, Public: true}
+	}
+	content, err := a.apprc()
+	c.Assert(err, IsNil)
+	dir := c.MkDir()
+	file := path.Join(dir, "apprc")
+	err = ioutil.WriteFile(file, []byte(content), 0600)
+	c.Assert(err, IsNil)
+	for name, expected := range adversarialValues {
+		out, err := exec.Command("sh", "-c", `. "$0" && printf '%s' "$`+name+`"`, file).CombinedOutput()
+		c.Assert(err, IsNil)
+		c.Check(string(out), Equals, expected)
+	}
+}
+
+func (s *S) TestApprcSkipsInvalidNames(c *C) {
+	a := App{
+		Name: "invalid",
+		Env: map[string]bind.EnvVar{
+			"VALID":         {Name: "VALID", Value: "yes"},
+			"IN-VALID":      {Name: "IN-VALID", Value: "no"},
+			"X=1; echo foo": {Name: "X=1; echo foo", Value: "no"},
+		},
+	}
+	content, err := a.apprc()
+	c.Assert(err, IsNil)
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	c.Assert(lines, HasLen, 2)
+	c.Assert(lines[1], Equals, "export VALID='yes'")
+}
+
+func (s *S) TestApprcDoesNotDecryptPublicValues(c *C) {
+	a := App{
+		Name: "lookalike",
+		Env: map[string]bind.EnvVar{
+			"PREFIXED": {Name: "PREFIXED", Value: "encrypted:not a key", Public: true},
+		},
+	}
+	content, err := a.apprc()
+	c.Assert(err, IsNil)
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	c.Assert(lines, HasLen, 2)
+	c.Assert(lines[1], Equals, "export PREFIXED='encrypted:not a key'")
+}
+
+func (s *S) TestApprcCommandWritesTheFileAtomically(c *C) {
+	a := App{Name: "adversarial", Env: make(map[string]bind.EnvVar)}
+	for name, value := range adversarialValues {
+		a.Env[name] = bind.EnvVar{Name: name, Value: value, Public: true}
+	}
+	content, err := a.apprc()
+	c.Assert(err, IsNil)
+	cmd, err := apprcCommand(content)
+	c.Assert(err, IsNil)
+	dir := c.MkDir()
+	cmd = strings.Replace(cmd, "/home/application", dir, -1)
+	out, err := exec.Command("sh", "-c", cmd).CombinedOutput()
+	c.Assert(string(out), Equals, "")
+	c.Assert(err, IsNil)
+	written, err := ioutil.ReadFile(path.Join(dir, "apprc"))
+	c.Assert(err, IsNil)
+	c.Assert(string(written), Equals, content)
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+}
+
+func (s *S) TestWriteApprcRunsTheCommandInEachUnit(c *C) {
+	a := App{
+		Name:  "time",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "time/0"}, {Name: "time/1"}},
+		Env:   map[string]bind.EnvVar{"DEBUG": {Name: "DEBUG", Value: "true", Public: true}},
+	}
+	s.provisioner.PrepareOutput(nil)
+	s.provisioner.PrepareOutput(nil)
+	results, err := a.WriteApprc()
+	c.Assert(err, IsNil)
+	c.Assert(results, DeepEquals, []ApprcResult{{Unit: "time/0"}, {Unit: "time/1"}})
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 2)
+	for i, cmd := range cmds {
+		units := cmd.App.ProvisionUnits()
+		c.Assert(units, HasLen, 1)
+		c.Assert(units[0].GetName(), Equals, a.Units[i].Name)
+	}
+}
+
+func (s *S) TestWriteApprcSavesTheApprcVersion(c *C) {
+	a := App{
+		Name:       "time",
+		State:      string(provision.StatusStarted),
+		Units:      []Unit{{Name: "time/0"}},
+		EnvVersion: 3,
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	_, err = a.WriteApprc("time/0")
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.ApprcVersion, Equals, 0)
+	_, err = a.WriteApprc()
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.ApprcVersion, Equals, 3)
+}
+
+func (s *S) TestWriteApprcInSpecificUnits(c *C) {
+	a := App{
+		Name:  "time",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "time/0"}, {Name: "time/1"}},
+	}
+	s.provisioner.PrepareOutput(nil)
+	results, err := a.WriteApprc("time/1", "time/7")
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 2)
+	c.Assert(results[0], DeepEquals, ApprcResult{Unit: "time/1"})
+	c.Assert(results[1].Unit, Equals, "time/7")
+	c.Assert(results[1].Error, ErrorMatches, `^App "time" does not have a unit named "time/7".$`)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 1)
+	c.Assert(cmds[0].App.ProvisionUnits()[0].GetName(), Equals, "time/1")
+}
+
+func (s *S) TestWriteApprcReportsFailuresPerUnit(c *C) {
+	s.provisioner.PrepareOutput([]byte("disk full"))
+	s.provisioner.PrepareFailure("ExecuteCommand", errors.New("exit status 1"))
+	s.provisioner.PrepareOutput(nil)
+	a := App{
+		Name:  "time",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "time/0"}, {Name: "time/1"}},
+	}
+	results, err := a.WriteApprc()
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 2)
+	c.Assert(results[0].Error, ErrorMatches, `^Failed to write env vars in unit "time/0" \(exit status 1\): disk full.$`)
+	c.Assert(results[1].Error, IsNil)
+}
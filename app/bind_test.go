@@ -5,13 +5,16 @@
 package app
 
 import (
+	"github.com/globocom/config"
 	"github.com/globocom/tsuru/api/service"
 	"github.com/globocom/tsuru/app/bind"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/testing"
 	"labix.org/v2/mgo/bson"
 	. "launchpad.net/gocheck"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 )
 
 func (s *S) TestAppIsABinderApp(c *C) {
@@ -36,7 +39,7 @@ func (s *S) TestDestroyShouldUnbindAppFromInstance(c *C) {
 	defer db.Session.ServiceInstances().Remove(bson.M{"_id": instance.Name})
 	a := App{
 		Name:      "whichapp",
-		Framework: "",
+		Framework: "django",
 		Teams:     []string{},
 		Units: []Unit{
 			{Ip: "10.10.10.10", Machine: 1},
@@ -50,3 +53,114 @@ func (s *S) TestDestroyShouldUnbindAppFromInstance(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(n, Equals, 0)
 }
+
+type unitsHandler struct {
+	sync.Mutex
+	requests []string
+}
+
+func (h *unitsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Lock()
+	defer h.Unlock()
+	r.ParseForm()
+	h.requests = append(h.requests, r.Method+" "+r.URL.Path+" "+r.Form.Get("unit-host"))
+}
+
+// bindV2 binds the app to an instance of a service of the version 2 of the
+// API, served by h.
+func (s *S) bindV2(c *C, a *App, h http.Handler) (*httptest.Server, func()) {
+	ts := httptest.NewServer(h)
+	srvc := service.Service{Name: "firewall", Endpoint: map[string]string{"production": ts.URL}, ApiVersion: 2}
+	err := srvc.Create()
+	c.Assert(err, IsNil)
+	instance := service.ServiceInstance{Name: "wall", Apps: []string{a.Name}, ServiceName: srvc.Name}
+	err = instance.Create()
+	c.Assert(err, IsNil)
+	return ts, func() {
+		ts.Close()
+		db.Session.Services().Remove(bson.M{"_id": srvc.Name})
+		db.Session.ServiceInstances().Remove(bson.M{"name": instance.Name})
+	}
+}
+
+func (s *S) TestAddUnitsBindsTheNewUnitsToTheServiceInstances(c *C) {
+	server := testing.FakeQueueServer{}
+	server.Start("127.0.0.1:0")
+	defer server.Stop()
+	config.Set("queue-server", server.Addr())
+	a := App{Name: "walled", Framework: "python", Units: []Unit{{Name: "walled/0", Ip: "10.10.10.0"}}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	var h unitsHandler
+	_, cleanup := s.bindV2(c, &a, &h)
+	defer cleanup()
+	err = a.AddUnits(2, "")
+	c.Assert(err, IsNil)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(h.requests, DeepEquals, []string{
+		"POST /resources/wall/units 10.10.10.1",
+		"POST /resources/wall/units 10.10.10.2",
+	})
+}
+
+// failingUnitsHandler records the requests like unitsHandler, failing the
+// bind of the unit with the given address.
+type failingUnitsHandler struct {
+	unitsHandler
+	host string
+}
+
+func (h *failingUnitsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.unitsHandler.ServeHTTP(w, r)
+	if r.Method == "POST" && r.Form.Get("unit-host") == h.host {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (s *S) TestAddUnitsUnbindsOnlyTheBoundUnitsWhenBindingFails(c *C) {
+	server := testing.FakeQueueServer{}
+	server.Start("127.0.0.1:0")
+	defer server.Stop()
+	config.Set("queue-server", server.Addr())
+	a := App{Name: "walled", Framework: "python", Units: []Unit{{Name: "walled/0", Ip: "10.10.10.0"}}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	h := failingUnitsHandler{host: "10.10.10.2"}
+	_, cleanup := s.bindV2(c, &a, &h)
+	defer cleanup()
+	err = a.AddUnits(2, "")
+	c.Assert(err, NotNil)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(h.requests, DeepEquals, []string{
+		"POST /resources/wall/units 10.10.10.1",
+		"POST /resources/wall/units 10.10.10.2",
+		"DELETE /resources/wall/units 10.10.10.1",
+	})
+}
+
+func (s *S) TestRemoveUnitsUnbindsTheRemovedUnitsFromTheServiceInstances(c *C) {
+	a := App{Name: "walled", Framework: "python"}
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.AddUnits(&a, 1, "")
+	a.Units = []Unit{{Name: "walled/0", Ip: "10.10.10.0"}, {Name: "walled/1", Ip: "10.10.10.1"}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	var h unitsHandler
+	_, cleanup := s.bindV2(c, &a, &h)
+	defer cleanup()
+	err = a.RemoveUnits(1)
+	c.Assert(err, IsNil)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(h.requests, DeepEquals, []string{"DELETE /resources/wall/units 10.10.10.0"})
+}
@@ -0,0 +1,199 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronHistorySize is how many runs are kept in the history of a cron job.
+const cronHistorySize = 10
+
+// ErrCronJobNotFound is returned when removing a cron job that the app
+// doesn't have.
+var ErrCronJobNotFound = errors.New("Cron job not found.")
+
+var exitStatusRegexp = regexp.MustCompile(`exit status (\d+)`)
+
+// CronRun is a run of a cron job. ExitStatus is -1 when the command could
+// not run, or when the provisioner did not report the exit status of the
+// command.
+type CronRun struct {
+	Date       time.Time
+	Duration   time.Duration
+	ExitStatus int
+	Error      string `bson:",omitempty"`
+}
+
+// CronJob is a command that runs periodically in one unit of an app, in the
+// minutes described by its schedule, in the timezone of the tsuru server.
+// The output of the command goes to the logs of the app, with the source
+// "cron".
+type CronJob struct {
+	Id       bson.ObjectId `bson:"_id"`
+	App      string
+	Schedule string
+	Command  string
+	User     string
+
+	// Next is the next time the job runs.
+	Next time.Time
+
+	// History holds the last runs of the job, the most recent last.
+	History []CronRun
+}
+
+// LastRun returns the most recent run of the job, or nil if the job never
+// ran.
+func (j *CronJob) LastRun() *CronRun {
+	if len(j.History) == 0 {
+		return nil
+	}
+	return &j.History[len(j.History)-1]
+}
+
+// AddCronJob schedules a new cron job in the app.
+func (a *App) AddCronJob(schedule, command, user string) (*CronJob, error) {
+	s, err := parseSchedule(schedule)
+	if err != nil {
+		return nil, &ValidationError{Message: err.Error()}
+	}
+	if strings.TrimSpace(command) == "" {
+		return nil, &ValidationError{Message: "The command of the cron job is missing."}
+	}
+	next := s.next(time.Now())
+	if next.IsZero() {
+		msg := fmt.Sprintf("Invalid schedule %q: the job would never run.", schedule)
+		return nil, &ValidationError{Message: msg}
+	}
+	job := CronJob{
+		Id:       bson.NewObjectId(),
+		App:      a.Name,
+		Schedule: schedule,
+		Command:  command,
+		User:     user,
+		Next:     next,
+	}
+	if err = db.Session.CronJobs().Insert(job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CronJobs returns the cron jobs of the app.
+func (a *App) CronJobs() ([]CronJob, error) {
+	var jobs []CronJob
+	err := db.Session.CronJobs().Find(bson.M{"app": a.Name}).Sort("_id").All(&jobs)
+	return jobs, err
+}
+
+// RemoveCronJob removes the cron job with the given id from the app.
+func (a *App) RemoveCronJob(id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return ErrCronJobNotFound
+	}
+	err := db.Session.CronJobs().Remove(bson.M{"_id": bson.ObjectIdHex(id), "app": a.Name})
+	if err == mgo.ErrNotFound {
+		return ErrCronJobNotFound
+	}
+	return err
+}
+
+// ClaimDueCronJobs returns the cron jobs that should have run until now,
+// moving them to their next run. A job is claimed by only one caller, so jobs
+// don't run twice when more than one collector is running.
+func ClaimDueCronJobs(now time.Time) ([]CronJob, error) {
+	var jobs []CronJob
+	err := db.Session.CronJobs().Find(bson.M{"next": bson.M{"$lte": now}}).All(&jobs)
+	if err != nil {
+		return nil, err
+	}
+	var claimed []CronJob
+	for _, job := range jobs {
+		s, err := parseSchedule(job.Schedule)
+		if err != nil {
+			log.Printf("Skipping cron job %s of the app %s: %s", job.Id.Hex(), job.App, err)
+			continue
+		}
+		next := s.next(now)
+		err = db.Session.CronJobs().Update(bson.M{"_id": job.Id, "next": job.Next}, bson.M{"$set": bson.M{"next": next}})
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		job.Next = next
+		claimed = append(claimed, job)
+	}
+	return claimed, nil
+}
+
+// Run runs the command of the job in one unit of the app, preferring started
+// units, and records the run in the history of the job. The output of the
+// command is written to the logs of the app.
+func (j *CronJob) Run() error {
+	run := CronRun{Date: time.Now(), ExitStatus: -1}
+	err := j.run()
+	run.Duration = time.Since(run.Date)
+	if err != nil {
+		run.Error = err.Error()
+		if m := exitStatusRegexp.FindStringSubmatch(err.Error()); m != nil {
+			run.ExitStatus, _ = strconv.Atoi(m[1])
+		}
+	} else {
+		run.ExitStatus = 0
+	}
+	if recErr := j.record(run); recErr != nil {
+		log.Printf("Failed to record the run of the cron job %s: %s", j.Id.Hex(), recErr)
+	}
+	return err
+}
+
+func (j *CronJob) run() error {
+	a := App{Name: j.App}
+	if err := a.Get(); err != nil {
+		return fmt.Errorf("App %q not found.", j.App)
+	}
+	u, err := a.hookUnit()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = a.runIn(&unitApp{App: &a, units: []provision.AppUnit{u}}, j.Command, &buf)
+	if err != nil {
+		fmt.Fprintf(&buf, "\nCron job %q failed: %s", j.Command, err)
+	}
+	if buf.Len() > 0 {
+		a.Log(buf.String(), "cron")
+	}
+	return err
+}
+
+// record adds the run to the history of the job, keeping only the most recent
+// runs.
+func (j *CronJob) record(run CronRun) error {
+	var job CronJob
+	if err := db.Session.CronJobs().FindId(j.Id).One(&job); err != nil {
+		return err
+	}
+	job.History = append(job.History, run)
+	if len(job.History) > cronHistorySize {
+		job.History = job.History[len(job.History)-cronHistorySize:]
+	}
+	j.History = job.History
+	return db.Session.CronJobs().UpdateId(j.Id, bson.M{"$set": bson.M{"history": job.History}})
+}
@@ -0,0 +1,167 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestAddCronJob(c *C) {
+	a := App{Name: "cronned"}
+	job, err := a.AddCronJob("*/5 * * * *", "python manage.py clearsessions", "ringo@beatles.com")
+	c.Assert(err, IsNil)
+	defer db.Session.CronJobs().RemoveId(job.Id)
+	c.Assert(job.App, Equals, "cronned")
+	c.Assert(job.User, Equals, "ringo@beatles.com")
+	c.Assert(job.Next.After(time.Now()), Equals, true)
+	c.Assert(job.Next.Minute()%5, Equals, 0)
+	jobs, err := a.CronJobs()
+	c.Assert(err, IsNil)
+	c.Assert(jobs, HasLen, 1)
+	c.Assert(jobs[0].Command, Equals, "python manage.py clearsessions")
+	c.Assert(jobs[0].LastRun(), IsNil)
+}
+
+func (s *S) TestAddCronJobValidation(c *C) {
+	a := App{Name: "cronned"}
+	_, err := a.AddCronJob("* * *", "ls", "")
+	c.Assert(err, FitsTypeOf, &ValidationError{})
+	_, err = a.AddCronJob("@daily", " ", "")
+	c.Assert(err, FitsTypeOf, &ValidationError{})
+	c.Assert(err, ErrorMatches, "^The command of the cron job is missing.$")
+	_, err = a.AddCronJob("0 0 31 2 *", "ls", "")
+	c.Assert(err, FitsTypeOf, &ValidationError{})
+	c.Assert(err, ErrorMatches, `^Invalid schedule "0 0 31 2 \*": the job would never run.$`)
+	jobs, err := a.CronJobs()
+	c.Assert(err, IsNil)
+	c.Assert(jobs, HasLen, 0)
+}
+
+func (s *S) TestRemoveCronJob(c *C) {
+	a := App{Name: "cronned"}
+	job, err := a.AddCronJob("@daily", "ls", "")
+	c.Assert(err, IsNil)
+	other := App{Name: "other"}
+	err = other.RemoveCronJob(job.Id.Hex())
+	c.Assert(err, Equals, ErrCronJobNotFound)
+	err = a.RemoveCronJob(job.Id.Hex())
+	c.Assert(err, IsNil)
+	err = a.RemoveCronJob(job.Id.Hex())
+	c.Assert(err, Equals, ErrCronJobNotFound)
+	err = a.RemoveCronJob("not-an-id")
+	c.Assert(err, Equals, ErrCronJobNotFound)
+}
+
+func (s *S) TestClaimDueCronJobs(c *C) {
+	now := time.Now()
+	due := CronJob{Id: bson.NewObjectId(), App: "cronned", Schedule: "* * * * *", Command: "ls", Next: now.Add(-time.Minute)}
+	later := CronJob{Id: bson.NewObjectId(), App: "cronned", Schedule: "* * * * *", Command: "ps", Next: now.Add(time.Hour)}
+	err := db.Session.CronJobs().Insert(due, later)
+	c.Assert(err, IsNil)
+	defer db.Session.CronJobs().RemoveAll(bson.M{"app": "cronned"})
+	jobs, err := ClaimDueCronJobs(now)
+	c.Assert(err, IsNil)
+	c.Assert(jobs, HasLen, 1)
+	c.Assert(jobs[0].Id, Equals, due.Id)
+	c.Assert(jobs[0].Next.After(now), Equals, true)
+	jobs, err = ClaimDueCronJobs(now)
+	c.Assert(err, IsNil)
+	c.Assert(jobs, HasLen, 0)
+}
+
+func (s *S) TestCronJobRun(c *C) {
+	s.provisioner.PrepareOutput([]byte("2 sessions removed"))
+	a := App{
+		Name:  "cronned",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "cronned/0"}, {Name: "cronned/1", State: string(provision.StatusStarted)}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	job, err := a.AddCronJob("@daily", "python manage.py clearsessions", "")
+	c.Assert(err, IsNil)
+	defer db.Session.CronJobs().RemoveId(job.Id)
+	err = job.Run()
+	c.Assert(err, IsNil)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 1)
+	c.Assert(cmds[0].Cmd, Matches, ".*python manage.py clearsessions$")
+	units := cmds[0].App.ProvisionUnits()
+	c.Assert(units, HasLen, 1)
+	c.Assert(units[0].GetName(), Equals, "cronned/1")
+	err = a.Get()
+	c.Assert(err, IsNil)
+	var logged bool
+	for _, l := range a.Logs {
+		if l.Source == "cron" && l.Message == "2 sessions removed" {
+			logged = true
+		}
+	}
+	c.Assert(logged, Equals, true)
+	jobs, err := a.CronJobs()
+	c.Assert(err, IsNil)
+	run := jobs[0].LastRun()
+	c.Assert(run, NotNil)
+	c.Assert(run.ExitStatus, Equals, 0)
+	c.Assert(run.Error, Equals, "")
+}
+
+func (s *S) TestCronJobRunRecordsTheExitStatus(c *C) {
+	p := &execFuncProvisioner{FakeProvisioner: s.provisioner, exec: func(cmd string) error {
+		return errors.New("exit status 3")
+	}}
+	Provisioner = p
+	defer func() { Provisioner = s.provisioner }()
+	a := App{
+		Name:  "cronned",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "cronned/0"}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	job, err := a.AddCronJob("@daily", "false", "")
+	c.Assert(err, IsNil)
+	defer db.Session.CronJobs().RemoveId(job.Id)
+	for i := 0; i < cronHistorySize+2; i++ {
+		err = job.Run()
+		c.Assert(err, ErrorMatches, "^exit status 3$")
+	}
+	jobs, err := a.CronJobs()
+	c.Assert(err, IsNil)
+	c.Assert(jobs[0].History, HasLen, cronHistorySize)
+	run := jobs[0].LastRun()
+	c.Assert(run.ExitStatus, Equals, 3)
+	c.Assert(run.Error, Equals, "exit status 3")
+}
+
+func (s *S) TestCronJobRunWithoutTheApp(c *C) {
+	job := CronJob{Id: bson.NewObjectId(), App: "ghost", Schedule: "@daily", Command: "ls"}
+	err := db.Session.CronJobs().Insert(job)
+	c.Assert(err, IsNil)
+	defer db.Session.CronJobs().RemoveId(job.Id)
+	err = job.Run()
+	c.Assert(err, ErrorMatches, `^App "ghost" not found.$`)
+	c.Assert(job.LastRun().ExitStatus, Equals, -1)
+}
+
+func (s *S) TestRemoveAppRemovesItsCronJobs(c *C) {
+	a := App{Name: "cronned"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	_, err = a.AddCronJob("@daily", "ls", "")
+	c.Assert(err, IsNil)
+	err = removeApp.forward(&pipelineContext{App: &a})
+	c.Assert(err, IsNil)
+	n, err := db.Session.CronJobs().Find(bson.M{"app": a.Name}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
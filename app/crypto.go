@@ -0,0 +1,207 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"io"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"strings"
+)
+
+// encryptedPrefix identifies encrypted values of private environment
+// variables. Encrypted values have the format:
+//
+//	encrypted:<key id>:<base64 encoded nonce and ciphertext>
+//
+// The key id identifies which of the configured keys encrypted the value, so
+// values encrypted with old keys can still be decrypted after a rotation.
+const encryptedPrefix = "encrypted:"
+
+// encryptionKey is a key used to encrypt private environment variables.
+type encryptionKey struct {
+	id  string
+	key []byte
+}
+
+func newEncryptionKey(secret string) encryptionKey {
+	id := sha256.Sum256([]byte("tsuru-key-id:" + secret))
+	key := sha256.Sum256([]byte(secret))
+	return encryptionKey{id: hex.EncodeToString(id[:4]), key: key[:]}
+}
+
+// encryptionKeys returns the keys configured in tsuru.conf. The first key is
+// the current key, used to encrypt new values. Old keys are used only to
+// decrypt values, until ReencryptEnvs is called. The configuration looks like
+// this:
+//
+//	env-encryption:
+//	  key: current-secret
+//	  old-keys:
+//	    - previous-secret
+//
+// When no key is configured, private variables are stored unencrypted.
+func encryptionKeys() ([]encryptionKey, error) {
+	current, err := config.GetString("env-encryption:key")
+	if err != nil || current == "" {
+		return nil, nil
+	}
+	keys := []encryptionKey{newEncryptionKey(current)}
+	old, err := config.Get("env-encryption:old-keys")
+	if err != nil {
+		return keys, nil
+	}
+	switch old := old.(type) {
+	case []interface{}:
+		for _, k := range old {
+			secret, ok := k.(string)
+			if !ok {
+				return nil, errors.New("env-encryption:old-keys must be a list of strings.")
+			}
+			keys = append(keys, newEncryptionKey(secret))
+		}
+	case []string:
+		for _, secret := range old {
+			keys = append(keys, newEncryptionKey(secret))
+		}
+	default:
+		return nil, errors.New("env-encryption:old-keys must be a list of strings.")
+	}
+	return keys, nil
+}
+
+// encryptValue encrypts the value with the current key, returning it
+// unchanged if there is no key configured.
+func encryptValue(value string) (string, error) {
+	keys, err := encryptionKeys()
+	if err != nil || len(keys) == 0 {
+		return value, err
+	}
+	gcm, err := newGCM(keys[0].key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + keys[0].id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptValue decrypts a value encrypted by encryptValue. Values that are not
+// encrypted are returned unchanged.
+func decryptValue(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	parts := strings.SplitN(value[len(encryptedPrefix):], ":", 2)
+	if len(parts) != 2 {
+		return "", errors.New("Malformed encrypted value.")
+	}
+	keys, err := encryptionKeys()
+	if err != nil {
+		return "", err
+	}
+	for _, k := range keys {
+		if k.id != parts[0] {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return "", errors.New("Malformed encrypted value.")
+		}
+		gcm, err := newGCM(k.key)
+		if err != nil {
+			return "", err
+		}
+		if len(sealed) < gcm.NonceSize() {
+			return "", errors.New("Malformed encrypted value.")
+		}
+		nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+		plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return "", fmt.Errorf("Failed to decrypt value: %s.", err)
+		}
+		return string(plain), nil
+	}
+	return "", fmt.Errorf("Unknown encryption key %q, check env-encryption:old-keys.", parts[0])
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedWithCurrentKey indicates whether the value is encrypted with the
+// current key, or is stored unencrypted because there's no key.
+func encryptedWithCurrentKey(value string, keys []encryptionKey) bool {
+	if len(keys) == 0 {
+		return true
+	}
+	return strings.HasPrefix(value, encryptedPrefix+keys[0].id+":")
+}
+
+// ReencryptEnvs encrypts the private environment variables of all apps with
+// the current key. It should be called after rotating the key, before the old
+// key is removed from the configuration. It returns the number of apps that
+// had variables re-encrypted.
+//
+// Each variable is updated only if it still has the value that was
+// re-encrypted, so variables changed in the meantime are kept.
+func ReencryptEnvs() (int, error) {
+	keys, err := encryptionKeys()
+	if err != nil {
+		return 0, err
+	}
+	var apps []App
+	err = db.Session.Apps().Find(nil).Select(bson.M{"name": 1, "env": 1}).All(&apps)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for _, a := range apps {
+		var changed bool
+		for name, env := range a.Env {
+			if env.Public || encryptedWithCurrentKey(env.Value, keys) {
+				continue
+			}
+			plain, err := decryptValue(env.Value)
+			if err != nil {
+				return count, fmt.Errorf("Failed to re-encrypt %s of the app %s: %s", name, a.Name, err)
+			}
+			value, err := encryptValue(plain)
+			if err != nil {
+				return count, err
+			}
+			field := "env." + name + ".value"
+			err = db.Session.Apps().Update(bson.M{"name": a.Name, field: env.Value}, bson.M{"$set": bson.M{field: value}})
+			if err == mgo.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return count, err
+			}
+			changed = true
+		}
+		if changed {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"strings"
+)
+
+func (s *S) TestEncryptValueWithoutKey(c *C) {
+	value, err := encryptValue("secret")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "secret")
+}
+
+func (s *S) TestEncryptAndDecryptValue(c *C) {
+	config.Set("env-encryption:key", "current")
+	defer config.Unset("env-encryption")
+	value, err := encryptValue("secret")
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasPrefix(value, encryptedPrefix+newEncryptionKey("current").id+":"), Equals, true)
+	c.Assert(strings.Contains(value, "secret"), Equals, false)
+	plain, err := decryptValue(value)
+	c.Assert(err, IsNil)
+	c.Assert(plain, Equals, "secret")
+}
+
+func (s *S) TestDecryptValueNotEncrypted(c *C) {
+	config.Set("env-encryption:key", "current")
+	defer config.Unset("env-encryption")
+	plain, err := decryptValue("secret")
+	c.Assert(err, IsNil)
+	c.Assert(plain, Equals, "secret")
+}
+
+func (s *S) TestDecryptValueWithOldKey(c *C) {
+	config.Set("env-encryption:key", "old")
+	defer config.Unset("env-encryption")
+	value, err := encryptValue("secret")
+	c.Assert(err, IsNil)
+	config.Set("env-encryption:key", "current")
+	config.Set("env-encryption:old-keys", []interface{}{"old"})
+	plain, err := decryptValue(value)
+	c.Assert(err, IsNil)
+	c.Assert(plain, Equals, "secret")
+}
+
+func (s *S) TestDecryptValueWithUnknownKey(c *C) {
+	config.Set("env-encryption:key", "old")
+	defer config.Unset("env-encryption")
+	value, err := encryptValue("secret")
+	c.Assert(err, IsNil)
+	config.Set("env-encryption:key", "current")
+	_, err = decryptValue(value)
+	c.Assert(err, NotNil)
+	c.Assert(err, ErrorMatches, `^Unknown encryption key ".*", check env-encryption:old-keys.$`)
+}
+
+func (s *S) TestSetEnvEncryptsPrivateVariables(c *C) {
+	config.Set("env-encryption:key", "current")
+	defer config.Unset("env-encryption")
+	a := App{Name: "crypto"}
+	err := a.setEnv(bind.EnvVar{Name: "DATABASE_PASSWORD", Value: "secret"})
+	c.Assert(err, IsNil)
+	err = a.setEnv(bind.EnvVar{Name: "DEBUG", Value: "true", Public: true})
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasPrefix(a.Env["DATABASE_PASSWORD"].Value, encryptedPrefix), Equals, true)
+	c.Assert(a.Env["DEBUG"].Value, Equals, "true")
+	for _, log := range a.Logs {
+		c.Assert(strings.Contains(log.Message, "secret"), Equals, false)
+	}
+}
+
+func (s *S) TestSerializeEnvVarsDecryptsPrivateVariables(c *C) {
+	config.Set("env-encryption:key", "current")
+	defer config.Unset("env-encryption")
+	s.provisioner.PrepareOutput([]byte("exported"))
+	a := App{Name: "crypto", State: string(provision.StatusStarted), Units: []Unit{{Name: "crypto/0"}}}
+	err := a.setEnv(bind.EnvVar{Name: "DATABASE_PASSWORD", Value: "secret"})
+	c.Assert(err, IsNil)
+	err = a.SerializeEnvVars()
+	c.Assert(err, IsNil)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 1)
+	c.Assert(strings.Contains(cmds[0].Cmd, `export DATABASE_PASSWORD='\''secret'\''`), Equals, true)
+}
+
+func (s *S) TestReencryptEnvs(c *C) {
+	config.Set("env-encryption:key", "old")
+	defer config.Unset("env-encryption")
+	a := App{Name: "crypto"}
+	err := a.setEnv(bind.EnvVar{Name: "DATABASE_PASSWORD", Value: "secret"})
+	c.Assert(err, IsNil)
+	err = a.setEnv(bind.EnvVar{Name: "DEBUG", Value: "true", Public: true})
+	c.Assert(err, IsNil)
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	config.Set("env-encryption:key", "current")
+	config.Set("env-encryption:old-keys", []interface{}{"old"})
+	n, err := ReencryptEnvs()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	keys, err := encryptionKeys()
+	c.Assert(err, IsNil)
+	c.Assert(encryptedWithCurrentKey(a.Env["DATABASE_PASSWORD"].Value, keys), Equals, true)
+	c.Assert(a.Env["DEBUG"].Value, Equals, "true")
+	config.Unset("env-encryption:old-keys")
+	plain, err := decryptValue(a.Env["DATABASE_PASSWORD"].Value)
+	c.Assert(err, IsNil)
+	c.Assert(plain, Equals, "secret")
+	n, err = ReencryptEnvs()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
@@ -0,0 +1,171 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrEnvRevisionNotFound is returned when rolling back to a revision that
+// doesn't exist in the env history of the app.
+var ErrEnvRevisionNotFound = errors.New("Env revision not found.")
+
+// EnvChange describes the change of one environment variable in an
+// EnvRevision. Values of private variables are never recorded.
+type EnvChange struct {
+	Name   string
+	Value  string `bson:",omitempty"`
+	Public bool
+	Unset  bool `bson:",omitempty"`
+}
+
+// EnvRevision is a version of the environment variables of an app. A new
+// revision is recorded every time the variables of the app change.
+//
+// Env holds the public variables of the app after the change, so the app can
+// be rolled back to the revision. Private variables are managed by service
+// bindings, and are not part of the history.
+type EnvRevision struct {
+	App      string
+	Revision int
+	User     string
+	Date     time.Time
+	Rollback int `bson:",omitempty"`
+	Changes  []EnvChange
+	Env      map[string]string
+}
+
+// diffEnvs returns the changes between two versions of the environment
+// variables of an app, sorted by name.
+func diffEnvs(before, after map[string]bind.EnvVar) ([]EnvChange, error) {
+	var changes []EnvChange
+	for name, env := range after {
+		if old, ok := before[name]; ok {
+			same, err := sameEnv(old, env)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				continue
+			}
+		}
+		change := EnvChange{Name: name, Public: env.Public}
+		if env.Public {
+			change.Value = env.Value
+		}
+		changes = append(changes, change)
+	}
+	for name, env := range before {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, EnvChange{Name: name, Public: env.Public, Unset: true})
+		}
+	}
+	sort.Sort(envChangeList(changes))
+	return changes, nil
+}
+
+// sameEnv indicates whether two versions of a variable are equal. Private
+// values are encrypted with a random nonce, so they're compared decrypted.
+func sameEnv(old, env bind.EnvVar) (bool, error) {
+	if old.Public != env.Public {
+		return false, nil
+	}
+	if env.Public || old.Value == env.Value {
+		return old.Value == env.Value, nil
+	}
+	oldValue, err := decryptValue(old.Value)
+	if err != nil {
+		return false, err
+	}
+	value, err := decryptValue(env.Value)
+	if err != nil {
+		return false, err
+	}
+	return oldValue == value, nil
+}
+
+type envChangeList []EnvChange
+
+func (l envChangeList) Len() int           { return len(l) }
+func (l envChangeList) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l envChangeList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// recordEnvRevision stores the changes from before to the current variables of
+// the app as a new revision. Nothing is recorded if the variables didn't
+// change.
+func (a *App) recordEnvRevision(before map[string]bind.EnvVar, rev EnvRevision) error {
+	changes, err := diffEnvs(before, a.Env)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	rev.Changes = changes
+	rev.App = a.Name
+	rev.Date = time.Now()
+	rev.Env = make(map[string]string)
+	for name, env := range a.Env {
+		if env.Public && validateEnvName(name) == nil {
+			rev.Env[name] = env.Value
+		}
+	}
+	for {
+		var last EnvRevision
+		err = db.Session.EnvRevisions().Find(bson.M{"app": a.Name}).Sort("-revision").One(&last)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		rev.Revision = last.Revision + 1
+		err = db.Session.EnvRevisions().Insert(rev)
+		// Another change got the same revision number, try the next one.
+		if err != nil && strings.Contains(err.Error(), "duplicate key error") {
+			continue
+		}
+		return err
+	}
+}
+
+// EnvHistory returns the env revisions of the app, the most recent first.
+func (a *App) EnvHistory() ([]EnvRevision, error) {
+	var revisions []EnvRevision
+	err := db.Session.EnvRevisions().Find(bson.M{"app": a.Name}).Sort("-revision").All(&revisions)
+	return revisions, err
+}
+
+// RollbackEnvs brings the public variables of the app back to the given
+// revision: variables are set to the values they had in the revision, and
+// variables created after it are unset. Private variables are not changed.
+// The rollback itself is recorded as a new revision.
+func (a *App) RollbackEnvs(revision int, user string) error {
+	var rev EnvRevision
+	err := db.Session.EnvRevisions().Find(bson.M{"app": a.Name, "revision": revision}).One(&rev)
+	if err == mgo.ErrNotFound {
+		return ErrEnvRevisionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	var set []bind.EnvVar
+	var unset []string
+	for name, value := range rev.Env {
+		if env, ok := a.Env[name]; !ok || env.Public && env.Value != value {
+			set = append(set, bind.EnvVar{Name: name, Value: value, Public: true})
+		}
+	}
+	for name, env := range a.Env {
+		if _, ok := rev.Env[name]; !ok && env.Public {
+			unset = append(unset, name)
+		}
+	}
+	if len(set) == 0 && len(unset) == 0 {
+		return nil
+	}
+	return a.changeEnvs(set, unset, true, false, EnvRevision{User: user, Rollback: revision})
+}
@@ -0,0 +1,151 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+)
+
+func (s *S) TestDiffEnvs(c *C) {
+	before := map[string]bind.EnvVar{
+		"DEBUG":         {Name: "DEBUG", Value: "false", Public: true},
+		"WORKERS":       {Name: "WORKERS", Value: "4", Public: true},
+		"DATABASE_USER": {Name: "DATABASE_USER", Value: "root", Public: false},
+	}
+	after := map[string]bind.EnvVar{
+		"DEBUG":             {Name: "DEBUG", Value: "true", Public: true},
+		"WORKERS":           {Name: "WORKERS", Value: "4", Public: true},
+		"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: "secret", Public: false},
+	}
+	expected := []EnvChange{
+		{Name: "DATABASE_PASSWORD", Public: false},
+		{Name: "DATABASE_USER", Public: false, Unset: true},
+		{Name: "DEBUG", Value: "true", Public: true},
+	}
+	changes, err := diffEnvs(before, after)
+	c.Assert(err, IsNil)
+	c.Assert(changes, DeepEquals, expected)
+}
+
+func (s *S) TestDiffEnvsComparesPrivateValuesDecrypted(c *C) {
+	config.Set("env-encryption:key", "current")
+	defer config.Unset("env-encryption")
+	var values [3]string
+	for i, plain := range []string{"secret", "secret", "other"} {
+		var err error
+		values[i], err = encryptValue(plain)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(values[0], Not(Equals), values[1])
+	before := map[string]bind.EnvVar{
+		"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: values[0], Public: false},
+		"DATABASE_USER":     {Name: "DATABASE_USER", Value: values[0], Public: false},
+	}
+	after := map[string]bind.EnvVar{
+		"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: values[1], Public: false},
+		"DATABASE_USER":     {Name: "DATABASE_USER", Value: values[2], Public: false},
+	}
+	changes, err := diffEnvs(before, after)
+	c.Assert(err, IsNil)
+	c.Assert(changes, DeepEquals, []EnvChange{{Name: "DATABASE_USER", Public: false}})
+}
+
+func (s *S) TestSetEnvsToAppRecordsARevision(c *C) {
+	a := App{Name: "history", Teams: []string{s.team.Name}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer db.Session.EnvRevisions().RemoveAll(bson.M{"app": a.Name})
+	envs := []bind.EnvVar{
+		{Name: "DEBUG", Value: "true", Public: true},
+		{Name: "DATABASE_PASSWORD", Value: "secret", Public: false},
+	}
+	err = a.SetEnvsToApp(envs, false, false, "ringo@beatles.com")
+	c.Assert(err, IsNil)
+	err = a.UnsetEnvsFromApp([]string{"DEBUG"}, true, false, "john@beatles.com")
+	c.Assert(err, IsNil)
+	revisions, err := a.EnvHistory()
+	c.Assert(err, IsNil)
+	c.Assert(revisions, HasLen, 2)
+	c.Assert(revisions[0].Revision, Equals, 2)
+	c.Assert(revisions[0].User, Equals, "john@beatles.com")
+	c.Assert(revisions[0].Changes, DeepEquals, []EnvChange{{Name: "DEBUG", Public: true, Unset: true}})
+	c.Assert(revisions[0].Env, DeepEquals, map[string]string{})
+	c.Assert(revisions[1].Revision, Equals, 1)
+	c.Assert(revisions[1].User, Equals, "ringo@beatles.com")
+	expected := []EnvChange{
+		{Name: "DATABASE_PASSWORD", Public: false},
+		{Name: "DEBUG", Value: "true", Public: true},
+	}
+	c.Assert(revisions[1].Changes, DeepEquals, expected)
+	c.Assert(revisions[1].Env, DeepEquals, map[string]string{"DEBUG": "true"})
+}
+
+func (s *S) TestSetEnvsToAppDoesNotRecordARevisionWithoutChanges(c *C) {
+	a := App{
+		Name:  "history",
+		Teams: []string{s.team.Name},
+		Env:   map[string]bind.EnvVar{"DEBUG": {Name: "DEBUG", Value: "true", Public: true}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer db.Session.EnvRevisions().RemoveAll(bson.M{"app": a.Name})
+	err = a.SetEnvsToApp([]bind.EnvVar{{Name: "DEBUG", Value: "true", Public: true}}, true, false, "ringo@beatles.com")
+	c.Assert(err, IsNil)
+	revisions, err := a.EnvHistory()
+	c.Assert(err, IsNil)
+	c.Assert(revisions, HasLen, 0)
+}
+
+func (s *S) TestRollbackEnvs(c *C) {
+	a := App{
+		Name:  "history",
+		Teams: []string{s.team.Name},
+		Env: map[string]bind.EnvVar{
+			"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: "secret", Public: false},
+		},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer db.Session.EnvRevisions().RemoveAll(bson.M{"app": a.Name})
+	err = a.SetEnvsToApp([]bind.EnvVar{{Name: "DEBUG", Value: "true", Public: true}}, true, false, "ringo@beatles.com")
+	c.Assert(err, IsNil)
+	envs := []bind.EnvVar{
+		{Name: "DEBUG", Value: "false", Public: true},
+		{Name: "WORKERS", Value: "8", Public: true},
+	}
+	err = a.SetEnvsToApp(envs, true, false, "ringo@beatles.com")
+	c.Assert(err, IsNil)
+	err = a.RollbackEnvs(1, "john@beatles.com")
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Env, HasLen, 2)
+	c.Assert(a.Env["DEBUG"], DeepEquals, bind.EnvVar{Name: "DEBUG", Value: "true", Public: true})
+	c.Assert(a.Env["DATABASE_PASSWORD"].Value, Equals, "secret")
+	revisions, err := a.EnvHistory()
+	c.Assert(err, IsNil)
+	c.Assert(revisions, HasLen, 3)
+	c.Assert(revisions[0].Revision, Equals, 3)
+	c.Assert(revisions[0].Rollback, Equals, 1)
+	c.Assert(revisions[0].User, Equals, "john@beatles.com")
+	expected := []EnvChange{
+		{Name: "DEBUG", Value: "true", Public: true},
+		{Name: "WORKERS", Public: true, Unset: true},
+	}
+	c.Assert(revisions[0].Changes, DeepEquals, expected)
+}
+
+func (s *S) TestRollbackEnvsToAnUnknownRevision(c *C) {
+	a := App{Name: "history"}
+	err := a.RollbackEnvs(42, "john@beatles.com")
+	c.Assert(err, Equals, ErrEnvRevisionNotFound)
+}
@@ -0,0 +1,158 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	runOnAll = "all"
+	runOnce  = "once"
+)
+
+// defaultHookTimeout is the timeout of hooks that don't declare one, unless
+// hooks:timeout is set in tsuru.conf.
+const defaultHookTimeout = 10 * time.Minute
+
+// hook is a command declared in app.conf. A hook is either a plain command,
+// that runs in all units of the app:
+//
+//	pre-restart:
+//	  - deploy/pre.sh
+//
+// or a map, declaring where the command runs and its timeout, in seconds:
+//
+//	pre-deploy:
+//	  - command: python manage.py migrate
+//	    run-on: once
+//	    timeout: 300
+//
+// Hooks with run-on: once run in a single unit of the app, which is useful
+// for database migrations.
+type hook struct {
+	Command string
+	RunOn   string
+	Timeout time.Duration
+}
+
+// SetYAML implements goyaml.Setter, so hooks can be declared as plain
+// commands or as maps.
+func (h *hook) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		h.Command = v
+		return true
+	case map[interface{}]interface{}:
+		h.Command, _ = v["command"].(string)
+		h.RunOn, _ = v["run-on"].(string)
+		if timeout, ok := v["timeout"]; ok {
+			seconds, ok := timeout.(int)
+			if !ok {
+				return false
+			}
+			h.Timeout = time.Duration(seconds) * time.Second
+		}
+		return true
+	}
+	return false
+}
+
+// hookTimeout returns the timeout of hooks that don't declare one, configured
+// in tsuru.conf as hooks:timeout, in seconds.
+func hookTimeout() time.Duration {
+	value, err := config.Get("hooks:timeout")
+	if err != nil {
+		return defaultHookTimeout
+	}
+	switch seconds := value.(type) {
+	case int:
+		return time.Duration(seconds) * time.Second
+	case float64:
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return defaultHookTimeout
+}
+
+// hookUnit returns the unit that runs hooks declared with run-on: once,
+// preferring started units.
+func (a *App) hookUnit() (provision.AppUnit, error) {
+	units := a.ProvisionUnits()
+	if len(units) == 0 {
+		return nil, errors.New("the app has no units")
+	}
+	for _, u := range units {
+		if u.GetStatus() == provision.StatusStarted {
+			return u, nil
+		}
+	}
+	return units[0], nil
+}
+
+// runHookCommand runs the command of the hook in the units it's declared to
+// run on, failing if it doesn't finish within the timeout of the hook.
+//
+// The provisioner can't interrupt commands, so the command is wrapped with
+// timeout(1), which kills it in the units when the timeout expires.
+func (a *App) runHookCommand(w io.Writer, h hook, cmd string) error {
+	var target provision.App = a
+	if h.RunOn == runOnce {
+		u, err := a.hookUnit()
+		if err != nil {
+			return err
+		}
+		target = &unitApp{App: a, units: []provision.AppUnit{u}}
+	}
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = hookTimeout()
+	}
+	seconds := int64(math.Ceil(timeout.Seconds()))
+	cmd = fmt.Sprintf("timeout %d sh -c %s", seconds, shellQuote(cmd))
+	// Output written after the timeout is discarded, as the writer may not
+	// be usable anymore when the command finishes.
+	sw := &stoppableWriter{w: w}
+	done := make(chan error, 1)
+	go func() {
+		done <- a.runIn(target, cmd, sw)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		sw.stop()
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// stoppableWriter is a writer that discards everything written after it's
+// stopped.
+type stoppableWriter struct {
+	w       io.Writer
+	mut     sync.Mutex
+	stopped bool
+}
+
+func (w *stoppableWriter) Write(p []byte) (int, error) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if w.stopped {
+		return len(p), nil
+	}
+	return w.w.Write(p)
+}
+
+func (w *stoppableWriter) stop() {
+	w.mut.Lock()
+	w.stopped = true
+	w.mut.Unlock()
+}
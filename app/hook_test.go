@@ -0,0 +1,228 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"errors"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/provision/provisiontest"
+	"io"
+	. "launchpad.net/gocheck"
+	"strings"
+	"time"
+)
+
+func (s *S) TestHookSetYAMLWithPlainCommand(c *C) {
+	var h hook
+	ok := h.SetYAML("", "deploy/pre.sh")
+	c.Assert(ok, Equals, true)
+	c.Assert(h, DeepEquals, hook{Command: "deploy/pre.sh"})
+}
+
+func (s *S) TestHookSetYAMLWithMap(c *C) {
+	var h hook
+	value := map[interface{}]interface{}{
+		"command": "python manage.py migrate",
+		"run-on":  "once",
+		"timeout": 300,
+	}
+	ok := h.SetYAML("", value)
+	c.Assert(ok, Equals, true)
+	c.Assert(h, DeepEquals, hook{Command: "python manage.py migrate", RunOn: "once", Timeout: 5 * time.Minute})
+}
+
+func (s *S) TestHookSetYAMLWithInvalidTimeout(c *C) {
+	var h hook
+	ok := h.SetYAML("", map[interface{}]interface{}{"command": "migrate", "timeout": "soon"})
+	c.Assert(ok, Equals, false)
+}
+
+func (s *S) TestConfValidate(c *C) {
+	var tests = []struct {
+		conf conf
+		err  string
+	}{
+		{conf{PreDeploy: []hook{{Command: "migrate", RunOn: "once"}}}, ""},
+		{conf{Build: []hook{{RunOn: "all"}}}, `^Invalid build hook: the command is missing.$`},
+		{conf{PostDeploy: []hook{{Command: "notify", RunOn: "twice"}}}, `^Invalid post-deploy hook "notify": run-on must be "once" or "all".$`},
+		{conf{PreRestart: []hook{{Command: "pre.sh", Timeout: -1}}}, `^Invalid pre-restart hook "pre.sh": the timeout must be positive.$`},
+	}
+	for _, t := range tests {
+		err := t.conf.validate()
+		if t.err == "" {
+			c.Check(err, IsNil)
+		} else {
+			c.Check(err, ErrorMatches, t.err)
+		}
+	}
+}
+
+func (s *S) TestHookTimeout(c *C) {
+	c.Assert(hookTimeout(), Equals, defaultHookTimeout)
+	config.Set("hooks:timeout", 30)
+	defer config.Unset("hooks")
+	c.Assert(hookTimeout(), Equals, 30*time.Second)
+}
+
+func (s *S) TestRunHookOnce(c *C) {
+	s.provisioner.PrepareOutput([]byte("migrated"))
+	a := App{
+		Name:  "hooked",
+		State: string(provision.StatusStarted),
+		Units: []Unit{
+			{Name: "hooked/0", State: string(provision.StatusPending)},
+			{Name: "hooked/1", State: string(provision.StatusStarted)},
+		},
+	}
+	var buf bytes.Buffer
+	err := a.runHook(&buf, []hook{{Command: "migrate.sh", RunOn: "once"}}, "pre-deploy")
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(buf.String(), "migrated"), Equals, true)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 1)
+	units := cmds[0].App.ProvisionUnits()
+	c.Assert(units, HasLen, 1)
+	c.Assert(units[0].GetName(), Equals, "hooked/1")
+}
+
+func (s *S) TestRunHookInAllUnits(c *C) {
+	s.provisioner.PrepareOutput(nil)
+	a := App{
+		Name:  "hooked",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "hooked/0"}, {Name: "hooked/1"}},
+	}
+	err := a.runHook(&bytes.Buffer{}, []hook{{Command: "assets.sh"}}, "build")
+	c.Assert(err, IsNil)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 1)
+	c.Assert(cmds[0].App.ProvisionUnits(), HasLen, 2)
+}
+
+func (s *S) TestRunHookOnceWithoutUnits(c *C) {
+	a := App{Name: "hooked", State: string(provision.StatusStarted)}
+	err := a.runHook(&bytes.Buffer{}, []hook{{Command: "migrate.sh", RunOn: "once"}}, "pre-deploy")
+	c.Assert(err, ErrorMatches, `^The pre-deploy hook "migrate.sh" failed: the app has no units$`)
+}
+
+func (s *S) TestRunHookFailure(c *C) {
+	s.provisioner.PrepareOutput([]byte("relation does not exist"))
+	s.provisioner.PrepareFailure("ExecuteCommand", errors.New("exit status 1"))
+	a := App{
+		Name:  "hooked",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "hooked/0"}},
+	}
+	var buf bytes.Buffer
+	err := a.runHook(&buf, []hook{{Command: "migrate.sh"}, {Command: "notify.sh"}}, "pre-deploy")
+	c.Assert(err, ErrorMatches, `^The pre-deploy hook "migrate.sh" failed: exit status 1$`)
+	output := strings.Replace(buf.String(), "\n", "#", -1)
+	c.Assert(output, Matches, `.*relation does not exist# ---> The pre-deploy hook "migrate.sh" failed: exit status 1#$`)
+	c.Assert(s.provisioner.GetCmds("", &a), HasLen, 1)
+}
+
+func (s *S) TestRunHookKillsTheCommandInTheUnitsOnTimeout(c *C) {
+	s.provisioner.PrepareOutput(nil)
+	a := App{
+		Name:  "hooked",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "hooked/0"}},
+	}
+	err := a.runHook(&bytes.Buffer{}, []hook{{Command: "python manage.py migrate", Timeout: 5 * time.Minute}}, "pre-deploy")
+	c.Assert(err, IsNil)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 1)
+	c.Assert(strings.HasSuffix(cmds[0].Cmd, "; timeout 300 sh -c 'python manage.py migrate'"), Equals, true)
+}
+
+func (s *S) TestRunHookTimeout(c *C) {
+	release := make(chan bool)
+	defer close(release)
+	p := &execFuncProvisioner{FakeProvisioner: s.provisioner, exec: func(cmd string) error {
+		<-release
+		return nil
+	}}
+	Provisioner = p
+	defer func() { Provisioner = s.provisioner }()
+	a := App{
+		Name:  "hooked",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "hooked/0"}},
+	}
+	var buf bytes.Buffer
+	err := a.runHook(&buf, []hook{{Command: "sleep 3600", Timeout: 10 * time.Millisecond}}, "post-deploy")
+	c.Assert(err, ErrorMatches, `^The post-deploy hook "sleep 3600" failed: timed out after 10ms$`)
+}
+
+func (s *S) TestDeployRunsHooksInOrder(c *C) {
+	for i := 0; i < 8; i++ {
+		s.provisioner.PrepareOutput(nil)
+	}
+	a := App{
+		Name:  "hooked",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "hooked/0", State: string(provision.StatusStarted)}},
+		hooks: &conf{
+			Build:      []hook{{Command: "build.sh"}},
+			PreDeploy:  []hook{{Command: "migrate.sh", RunOn: "once"}},
+			PreRestart: []hook{{Command: "pre.sh"}},
+			PosRestart: []hook{{Command: "pos.sh"}},
+			PostDeploy: []hook{{Command: "notify.sh", RunOn: "once"}},
+		},
+	}
+	var buf bytes.Buffer
+	err := a.Deploy(&buf)
+	c.Assert(err, IsNil)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 8)
+	expected := []string{
+		"/var/lib/tsuru/hooks/dependencies$",
+		`^\[ ! -f .*/Procfile \] \|\| cat .*/Procfile$`,
+		".*timeout 600 sh -c 'build.sh'$",
+		".*timeout 600 sh -c 'migrate.sh'$",
+		".*timeout 600 sh -c 'pre.sh'$",
+		"/var/lib/tsuru/hooks/restart$",
+		".*timeout 600 sh -c 'pos.sh'$",
+		".*timeout 600 sh -c 'notify.sh'$",
+	}
+	for i, cmd := range cmds {
+		c.Check(cmd.Cmd, Matches, expected[i])
+	}
+}
+
+func (s *S) TestDeployStopsOnFailingHook(c *C) {
+	var executed []string
+	p := &execFuncProvisioner{FakeProvisioner: s.provisioner, exec: func(cmd string) error {
+		executed = append(executed, cmd)
+		if strings.HasSuffix(cmd, "build.sh'") {
+			return errors.New("exit status 2")
+		}
+		return nil
+	}}
+	Provisioner = p
+	defer func() { Provisioner = s.provisioner }()
+	a := App{
+		Name:  "hooked",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "hooked/0"}},
+		hooks: &conf{Build: []hook{{Command: "build.sh"}}, PreDeploy: []hook{{Command: "migrate.sh"}}},
+	}
+	err := a.Deploy(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, `^The build hook "build.sh" failed: exit status 2$`)
+	c.Assert(executed, HasLen, 3)
+}
+
+// execFuncProvisioner is a fake provisioner that executes commands with a
+// function.
+type execFuncProvisioner struct {
+	*provisiontest.FakeProvisioner
+	exec func(cmd string) error
+}
+
+func (p *execFuncProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
+	return p.exec(cmd)
+}
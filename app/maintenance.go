@@ -0,0 +1,51 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/router"
+	"labix.org/v2/mgo/bson"
+)
+
+// ErrAppInMaintenance is returned when changing an app that is in maintenance
+// mode without forcing the change.
+var ErrAppInMaintenance = errors.New("The app is in maintenance mode.")
+
+// SetMaintenance turns the maintenance mode of the app on or off. Deploys and
+// changes in the environment variables of apps in maintenance mode are blocked
+// unless forced, and the collector doesn't try to start them.
+//
+// When the router supports it, requests to the app are answered with a
+// maintenance page while the app is in maintenance mode.
+func (a *App) SetMaintenance(on bool) error {
+	if r, ok := Router.(router.MaintenanceRouter); ok {
+		err := r.SetMaintenance(a.Name, on)
+		if err == router.ErrBackendNotFound {
+			if err = r.AddBackend(a.Name); err == nil {
+				err = r.SetMaintenance(a.Name, on)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err := db.Session.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"maintenance": on}})
+	if err != nil {
+		return err
+	}
+	a.Maintenance = on
+	return nil
+}
+
+// CheckMaintenance returns ErrAppInMaintenance if the app is in maintenance
+// mode and the change is not forced.
+func (a *App) CheckMaintenance(force bool) error {
+	if a.Maintenance && !force {
+		return ErrAppInMaintenance
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+)
+
+func (s *S) TestSetMaintenance(c *C) {
+	a := App{Name: "tilt"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = a.SetMaintenance(true)
+	c.Assert(err, IsNil)
+	c.Assert(a.Maintenance, Equals, true)
+	c.Assert(s.router.InMaintenance("tilt"), Equals, true)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Maintenance, Equals, true)
+	err = a.SetMaintenance(false)
+	c.Assert(err, IsNil)
+	c.Assert(s.router.InMaintenance("tilt"), Equals, false)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Maintenance, Equals, false)
+}
+
+func (s *S) TestSetMaintenanceWithoutRouter(c *C) {
+	Router = nil
+	defer func() { Router = s.router }()
+	a := App{Name: "tilt"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = a.SetMaintenance(true)
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Maintenance, Equals, true)
+}
+
+func (s *S) TestCheckMaintenance(c *C) {
+	a := App{Name: "tilt"}
+	c.Assert(a.CheckMaintenance(false), IsNil)
+	a.Maintenance = true
+	c.Assert(a.CheckMaintenance(false), Equals, ErrAppInMaintenance)
+	c.Assert(a.CheckMaintenance(true), IsNil)
+}
@@ -0,0 +1,81 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	maxDescriptionLength = 1000
+	maxContactLength     = 200
+	maxTags              = 20
+)
+
+var tagRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,39}$`)
+
+// Metadata describes an app to the people that use it: what the app is, who
+// to contact about it, and free-form tags used to find it in app-list.
+type Metadata struct {
+	Description string
+	Contact     string
+	Tags        []string
+}
+
+// Metadata returns the metadata of the app.
+func (a *App) Metadata() Metadata {
+	return Metadata{Description: a.Description, Contact: a.Contact, Tags: a.Tags}
+}
+
+// SetMetadata replaces the metadata of the app. Tags are lowercased, sorted
+// and deduplicated.
+func (a *App) SetMetadata(m Metadata) error {
+	m.Description = strings.TrimSpace(m.Description)
+	m.Contact = strings.TrimSpace(m.Contact)
+	if len(m.Description) > maxDescriptionLength {
+		return &ValidationError{Message: fmt.Sprintf("The description must have at most %d characters.", maxDescriptionLength)}
+	}
+	if len(m.Contact) > maxContactLength {
+		return &ValidationError{Message: fmt.Sprintf("The contact must have at most %d characters.", maxContactLength)}
+	}
+	tags, err := normalizeTags(m.Tags)
+	if err != nil {
+		return err
+	}
+	m.Tags = tags
+	update := bson.M{"description": m.Description, "contact": m.Contact, "tags": m.Tags}
+	if err = db.Session.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": update}); err != nil {
+		return err
+	}
+	a.Description, a.Contact, a.Tags = m.Description, m.Contact, m.Tags
+	return nil
+}
+
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if !tagRegexp.MatchString(tag) {
+			msg := fmt.Sprintf("Invalid tag %q: tags must have at most 40 letters, numbers, dots, dashes and underscores.", tag)
+			return nil, &ValidationError{Message: msg}
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) > maxTags {
+		return nil, &ValidationError{Message: fmt.Sprintf("An app can have at most %d tags.", maxTags)}
+	}
+	sort.Strings(result)
+	return result, nil
+}
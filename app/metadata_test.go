@@ -0,0 +1,92 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"strings"
+)
+
+func (s *S) TestSetMetadata(c *C) {
+	a := App{Name: "lilith"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	m := Metadata{
+		Description: " The payments API ",
+		Contact:     "payments@company.com",
+		Tags:        []string{"payments", "API", "payments", " "},
+	}
+	err = a.SetMetadata(m)
+	c.Assert(err, IsNil)
+	expected := Metadata{
+		Description: "The payments API",
+		Contact:     "payments@company.com",
+		Tags:        []string{"api", "payments"},
+	}
+	c.Assert(a.Metadata(), DeepEquals, expected)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Metadata(), DeepEquals, expected)
+}
+
+func (s *S) TestSetMetadataValidation(c *C) {
+	a := App{Name: "lilith"}
+	var tests = []Metadata{
+		{Description: strings.Repeat("a", maxDescriptionLength+1)},
+		{Contact: strings.Repeat("a", maxContactLength+1)},
+		{Tags: []string{"with space"}},
+		{Tags: []string{strings.Repeat("a", 41)}},
+	}
+	for _, m := range tests {
+		err := a.SetMetadata(m)
+		c.Check(err, FitsTypeOf, &ValidationError{})
+	}
+}
+
+func (s *S) TestListWithFilter(c *C) {
+	apps := []App{
+		{Name: "payments-api", Framework: "python", State: "started", Teams: []string{s.team.Name}, Tags: []string{"api", "payments"}},
+		{Name: "payments-web", Framework: "ruby", State: "started", Teams: []string{s.team.Name}, Tags: []string{"payments"}},
+		{Name: "search", Framework: "python", State: "down", Teams: []string{s.team.Name, "search"}},
+		{Name: "secret", Framework: "python", State: "started", Teams: []string{"other"}},
+	}
+	for _, a := range apps {
+		err := db.Session.Apps().Insert(a)
+		c.Assert(err, IsNil)
+		defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	}
+	var tests = []struct {
+		filter Filter
+		names  []string
+	}{
+		{Filter{}, []string{"payments-api", "payments-web", "search"}},
+		{Filter{Name: "^payments-"}, []string{"payments-api", "payments-web"}},
+		{Filter{Framework: "python"}, []string{"payments-api", "search"}},
+		{Filter{State: "down"}, []string{"search"}},
+		{Filter{Team: "search"}, []string{"search"}},
+		{Filter{Team: "other"}, nil},
+		{Filter{Tags: []string{"payments"}}, []string{"payments-api", "payments-web"}},
+		{Filter{Tags: []string{"payments", "api"}}, []string{"payments-api"}},
+		{Filter{Limit: 2}, []string{"payments-api", "payments-web"}},
+		{Filter{Limit: 2, Page: 2}, []string{"search"}},
+	}
+	for _, t := range tests {
+		result, err := List(s.user, &t.filter)
+		c.Assert(err, IsNil)
+		var names []string
+		for _, a := range result {
+			names = append(names, a.Name)
+		}
+		c.Check(names, DeepEquals, t.names)
+	}
+}
+
+func (s *S) TestListWithInvalidNamePattern(c *C) {
+	_, err := List(s.user, &Filter{Name: "payments("})
+	c.Assert(err, FitsTypeOf, &ValidationError{})
+}
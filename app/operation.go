@@ -0,0 +1,236 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/pipeline"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+const (
+	OperationPending   = "pending"
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+)
+
+const (
+	StepPending    = pipeline.StepPending
+	StepRunning    = pipeline.StepRunning
+	StepDone       = pipeline.StepDone
+	StepFailed     = pipeline.StepFailed
+	StepRolledBack = pipeline.StepRolledBack
+)
+
+// ErrAppAlreadyExists is returned when starting the creation of an app with
+// the name of an existing app.
+var ErrAppAlreadyExists = errors.New("There is already an app with this name.")
+
+// OperationStep represents one of the actions executed by an operation.
+type OperationStep struct {
+	Name   string
+	Status string
+	Error  string
+}
+
+// Operation represents a long running operation on an app (like creating
+// the app or adding units to it), that runs in background.
+//
+// The progress of the operation is the progress of its pipeline, stored in
+// the database step by step, so clients can poll it. Status, Error, Steps
+// and Finished are loaded from the pipeline by GetOperation, so operations
+// whose pipeline was rolled back or resumed by another process, see
+// pipeline.Recover, report the right status.
+type Operation struct {
+	Id       string `bson:"_id"`
+	Kind     string
+	App      string
+	User     string
+	Pipeline string
+	Status   string
+	Error    string
+	Steps    []OperationStep
+	Started  time.Time
+	Finished time.Time
+}
+
+// GetOperation loads an operation from the database, using its id, along
+// with the progress of its pipeline.
+func GetOperation(id string) (*Operation, error) {
+	var op Operation
+	err := db.Session.Operations().Find(bson.M{"_id": id}).One(&op)
+	if err != nil {
+		return nil, err
+	}
+	if op.Pipeline == "" {
+		return &op, nil
+	}
+	state, err := pipeline.Get(op.Pipeline)
+	if err == mgo.ErrNotFound {
+		return &op, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	done := op.Done()
+	op.load(state)
+	// Pipelines are purged some time after they finish, so the final
+	// progress is kept in the operation.
+	if !done && op.Done() {
+		op.save()
+	}
+	return &op, nil
+}
+
+func newOperation(kind, appName, user string, p *pipeline.Pipeline) (*Operation, error) {
+	if p.Id == "" {
+		p.Id = bson.NewObjectId().Hex()
+	}
+	op := Operation{
+		Id:       bson.NewObjectId().Hex(),
+		Kind:     kind,
+		App:      appName,
+		User:     user,
+		Pipeline: p.Id,
+		Status:   OperationPending,
+		Steps:    make([]OperationStep, len(p.Actions)),
+		Started:  time.Now(),
+	}
+	for i, act := range p.Actions {
+		op.Steps[i] = OperationStep{Name: act.Name, Status: StepPending}
+	}
+	if err := db.Session.Operations().Insert(op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// Done indicates whether the operation has finished, successfully or not.
+func (op *Operation) Done() bool {
+	return op.Status == OperationSucceeded || op.Status == OperationFailed
+}
+
+// load copies the progress of the pipeline to the operation. Pipelines that
+// are rolling back are still running.
+func (op *Operation) load(state *pipeline.State) {
+	switch state.Status {
+	case pipeline.Succeeded:
+		op.Status = OperationSucceeded
+	case pipeline.Failed:
+		op.Status = OperationFailed
+	default:
+		op.Status = OperationRunning
+	}
+	op.Error = state.Error
+	op.Finished = state.Finished
+	op.Steps = make([]OperationStep, len(state.Steps))
+	for i, step := range state.Steps {
+		op.Steps[i] = OperationStep{Name: step.Name, Status: step.Status, Error: step.Error}
+	}
+}
+
+// save stores the progress of the operation.
+func (op *Operation) save() {
+	fields := bson.M{"status": op.Status, "error": op.Error, "steps": op.Steps, "finished": op.Finished}
+	err := db.Session.Operations().Update(bson.M{"_id": op.Id}, bson.M{"$set": fields})
+	if err != nil {
+		log.Printf("Failed to update operation %s: %s", op.Id, err)
+	}
+}
+
+// run executes the pipeline of the operation, storing its final progress in
+// the operation.
+func (op *Operation) run(p *pipeline.Pipeline) error {
+	err := p.Execute()
+	if err != nil {
+		log.Printf("Operation %s (%s of %s) failed: %s", op.Id, op.Kind, op.App, err)
+	}
+	if state, gerr := pipeline.Get(p.Id); gerr == nil {
+		op.load(state)
+	} else if err != nil {
+		// The pipeline failed before being stored.
+		op.Status = OperationFailed
+		op.Error = err.Error()
+		op.Finished = time.Now()
+	} else {
+		op.Status = OperationSucceeded
+		op.Finished = time.Now()
+	}
+	op.save()
+	return err
+}
+
+// startOperation creates the operation and runs the pipeline of the given
+// kind in background.
+func startOperation(kind, user string, ctx *pipelineContext) (*Operation, error) {
+	p := newPipeline(kind, ctx)
+	op, err := newOperation(kind, ctx.App.Name, user, p)
+	if err != nil {
+		return nil, err
+	}
+	go op.run(p)
+	return op, nil
+}
+
+// StartCreateApp validates the app and starts its creation in background,
+// returning the operation that tracks the progress of the creation. The steps
+// of the creation are the same described in CreateApp.
+func StartCreateApp(a *App, units uint, user string) (*Operation, error) {
+	if err := a.validateCreation(units); err != nil {
+		return nil, err
+	}
+	n, err := db.Session.Apps().Find(bson.M{"name": a.Name}).Count()
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, ErrAppAlreadyExists
+	}
+	if err = checkQuota(a.quotaOwners(), 1, int(units)); err != nil {
+		return nil, err
+	}
+	return startOperation("create-app", user, &pipelineContext{App: a, Units: units})
+}
+
+// StartAddUnits starts adding n units of the given process type to the app
+// in background, returning the operation that tracks the progress.
+func (a *App) StartAddUnits(n uint, process, user string) (*Operation, error) {
+	if n == 0 {
+		return nil, errors.New("Cannot add zero units.")
+	}
+	if process == "" {
+		process = provision.DefaultProcess
+	}
+	if err := a.validateProcess(process); err != nil {
+		return nil, err
+	}
+	if err := checkQuota(a.QuotaOwners, 0, int(n)); err != nil {
+		return nil, err
+	}
+	return startOperation("add-units", user, &pipelineContext{App: a, Units: n, Process: process})
+}
+
+// StartRemove starts the removal of the app in background, returning the
+// operation that tracks the progress. The removal includes the git repository
+// of the app and the steps described in Destroy.
+//
+// If a previous removal of the app didn't finish, StartRemove returns
+// ErrRemovalPending.
+func (a *App) StartRemove(user string) (*Operation, error) {
+	removals, err := StuckRemovals(a.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(removals) > 0 {
+		return nil, ErrRemovalPending
+	}
+	return startOperation("remove-app", user, &pipelineContext{App: a})
+}
@@ -0,0 +1,258 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/pipeline"
+	"github.com/globocom/tsuru/provision/provisiontest"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"time"
+)
+
+func waitOperation(c *C, id string) *Operation {
+	for i := 0; i < 100; i++ {
+		op, err := GetOperation(id)
+		c.Assert(err, IsNil)
+		if op.Done() {
+			return op
+		}
+		time.Sleep(1e8)
+	}
+	c.Fatalf("Operation %s did not finish.", id)
+	return nil
+}
+
+func (s *S) TestStartCreateApp(c *C) {
+	h := testHandler{}
+	ts := s.t.StartGandalfTestServer(&h)
+	defer ts.Close()
+	a := App{Name: "someapp", Framework: "django", Teams: []string{s.team.Name}}
+	op, err := StartCreateApp(&a, 2, "someone@tsuru.io")
+	c.Assert(err, IsNil)
+	defer db.Session.Operations().Remove(bson.M{"_id": op.Id})
+	op = waitOperation(c, op.Id)
+	defer a.Destroy()
+	c.Assert(op.Status, Equals, OperationSucceeded)
+	c.Assert(op.Kind, Equals, "create-app")
+	c.Assert(op.App, Equals, "someapp")
+	c.Assert(op.User, Equals, "someone@tsuru.io")
+	c.Assert(op.Steps, HasLen, 6)
+	c.Assert(op.Steps[0].Name, Equals, "reserve quota")
+	for _, step := range op.Steps {
+		c.Assert(step.Status, Equals, StepDone)
+	}
+	c.Assert(s.provisioner.GetUnits(&a), HasLen, 2)
+}
+
+func (s *S) TestStartCreateAppRollsBackOnFailure(c *C) {
+	ts := s.t.StartGandalfTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	a := App{Name: "someapp", Framework: "django", Teams: []string{s.team.Name}}
+	op, err := StartCreateApp(&a, 1, "someone@tsuru.io")
+	c.Assert(err, IsNil)
+	defer db.Session.Operations().Remove(bson.M{"_id": op.Id})
+	op = waitOperation(c, op.Id)
+	c.Assert(op.Status, Equals, OperationFailed)
+	c.Assert(op.Error, Not(Equals), "")
+	c.Assert(op.Steps[0].Status, Equals, StepRolledBack)
+	c.Assert(op.Steps[1].Status, Equals, StepRolledBack)
+	c.Assert(op.Steps[2].Status, Equals, StepRolledBack)
+	c.Assert(op.Steps[3].Status, Equals, StepFailed)
+	c.Assert(op.Steps[4].Status, Equals, StepPending)
+	count, err := db.Session.Apps().Find(bson.M{"name": a.Name}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 0)
+}
+
+func (s *S) TestStartCreateAppRollsBackWhenProvisioningFails(c *C) {
+	h := testHandler{}
+	ts := s.t.StartGandalfTestServer(&h)
+	defer ts.Close()
+	s.provisioner.SetChaos(&provisiontest.Chaos{Script: map[string][]string{"Provision": {"fail"}}})
+	a := App{Name: "someapp", Framework: "django", Teams: []string{s.team.Name}}
+	op, err := StartCreateApp(&a, 1, "someone@tsuru.io")
+	c.Assert(err, IsNil)
+	defer db.Session.Operations().Remove(bson.M{"_id": op.Id})
+	op = waitOperation(c, op.Id)
+	c.Assert(op.Status, Equals, OperationFailed)
+	c.Assert(op.Error, Equals, "chaos: Provision failed: injected failure.")
+	c.Assert(op.Steps[0].Status, Equals, StepRolledBack)
+	c.Assert(op.Steps[1].Status, Equals, StepRolledBack)
+	c.Assert(op.Steps[2].Status, Equals, StepRolledBack)
+	c.Assert(op.Steps[3].Status, Equals, StepRolledBack)
+	c.Assert(op.Steps[4].Status, Equals, StepFailed)
+	c.Assert(s.provisioner.FindApp(&a), Equals, -1)
+	count, err := db.Session.Apps().Find(bson.M{"name": a.Name}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 0)
+}
+
+func (s *S) TestStartCreateAppValidatesTheAppBeforeStarting(c *C) {
+	a := App{Name: "123app"}
+	op, err := StartCreateApp(&a, 1, "someone@tsuru.io")
+	c.Assert(op, IsNil)
+	_, ok := err.(*ValidationError)
+	c.Assert(ok, Equals, true)
+}
+
+func (s *S) TestStartCreateAppWithExistingApp(c *C) {
+	a := App{Name: "someapp", Framework: "django"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	op, err := StartCreateApp(&a, 1, "someone@tsuru.io")
+	c.Assert(op, IsNil)
+	c.Assert(err, Equals, ErrAppAlreadyExists)
+}
+
+func (s *S) TestStartAddUnits(c *C) {
+	server := testing.FakeQueueServer{}
+	server.Start("127.0.0.1:0")
+	defer server.Stop()
+	config.Set("queue-server", server.Addr())
+	a := App{Name: "warpaint", Framework: "python"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	op, err := a.StartAddUnits(2, "", "someone@tsuru.io")
+	c.Assert(err, IsNil)
+	defer db.Session.Operations().Remove(bson.M{"_id": op.Id})
+	op = waitOperation(c, op.Id)
+	c.Assert(op.Status, Equals, OperationSucceeded)
+	expected := []OperationStep{
+		{Name: "reserve quota", Status: StepDone},
+		{Name: "provision units", Status: StepDone},
+		{Name: "save the units in the database", Status: StepDone},
+		{Name: "bind the units to service instances", Status: StepDone},
+		{Name: "start units", Status: StepDone},
+	}
+	c.Assert(op.Steps, DeepEquals, expected)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Units, HasLen, 2)
+}
+
+func (s *S) TestStartAddUnitsRecordsTheError(c *C) {
+	a := App{Name: "warpaint", Framework: "python"}
+	s.provisioner.PrepareFailure("AddUnits", errors.New("Failed to add units."))
+	op, err := a.StartAddUnits(2, "", "someone@tsuru.io")
+	c.Assert(err, IsNil)
+	defer db.Session.Operations().Remove(bson.M{"_id": op.Id})
+	op = waitOperation(c, op.Id)
+	c.Assert(op.Status, Equals, OperationFailed)
+	c.Assert(op.Error, Equals, "Failed to add units.")
+	c.Assert(op.Steps[0].Status, Equals, StepRolledBack)
+	c.Assert(op.Steps[1].Error, Equals, "Failed to add units.")
+}
+
+func (s *S) TestStartAddZeroUnits(c *C) {
+	a := App{Name: "warpaint"}
+	op, err := a.StartAddUnits(0, "", "someone@tsuru.io")
+	c.Assert(op, IsNil)
+	c.Assert(err, ErrorMatches, "^Cannot add zero units.$")
+}
+
+func (s *S) TestStartRemove(c *C) {
+	h := testHandler{}
+	ts := s.t.StartGandalfTestServer(&h)
+	defer ts.Close()
+	a := App{
+		Name:      "ritual",
+		Framework: "ruby",
+		Teams:     []string{s.team.Name},
+		Units:     []Unit{{Name: "ritual/0", Machine: 3}},
+	}
+	err := CreateApp(&a, 1)
+	c.Assert(err, IsNil)
+	op, err := a.StartRemove("someone@tsuru.io")
+	c.Assert(err, IsNil)
+	defer db.Session.Operations().Remove(bson.M{"_id": op.Id})
+	op = waitOperation(c, op.Id)
+	c.Assert(op.Status, Equals, OperationSucceeded)
+	c.Assert(op.Steps, HasLen, 6)
+	c.Assert(op.Steps[0].Name, Equals, "remove the git repository")
+	count, err := db.Session.Apps().Find(bson.M{"name": a.Name}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 0)
+	c.Assert(s.provisioner.FindApp(&a), Equals, -1)
+}
+
+func (s *S) TestGetOperationReportsTheProgressOfThePipeline(c *C) {
+	op := Operation{Id: "recovered", Kind: "add-units", App: "tilt", Pipeline: "p-recovered", Status: OperationRunning}
+	err := db.Session.Operations().Insert(op)
+	c.Assert(err, IsNil)
+	defer db.Session.Operations().Remove(bson.M{"_id": op.Id})
+	// The pipeline was rolled back by another process, see pipeline.Recover.
+	state := bson.M{
+		"_id":    "p-recovered",
+		"kind":   "add-units",
+		"status": pipeline.Failed,
+		"error":  pipeline.ErrInterrupted.Error(),
+		"steps": []pipeline.Step{
+			{Name: "reserve quota", Status: StepRolledBack},
+			{Name: "provision units", Status: StepRunning},
+		},
+	}
+	err = db.Session.Pipelines().Insert(state)
+	c.Assert(err, IsNil)
+	defer db.Session.Pipelines().Remove(bson.M{"_id": "p-recovered"})
+	got, err := GetOperation(op.Id)
+	c.Assert(err, IsNil)
+	c.Assert(got.Status, Equals, OperationFailed)
+	c.Assert(got.Error, Equals, pipeline.ErrInterrupted.Error())
+	c.Assert(got.Steps, DeepEquals, []OperationStep{
+		{Name: "reserve quota", Status: StepRolledBack},
+		{Name: "provision units", Status: StepRunning},
+	})
+	err = db.Session.Pipelines().Remove(bson.M{"_id": "p-recovered"})
+	c.Assert(err, IsNil)
+	got, err = GetOperation(op.Id)
+	c.Assert(err, IsNil)
+	c.Assert(got.Status, Equals, OperationFailed)
+}
+
+func (s *S) TestPipelineContextStoresOnlyTheNameOfTheApp(c *C) {
+	a := App{Name: "stored", Framework: "python", QuotaOwners: []string{"qa"}, Env: map[string]bind.EnvVar{
+		"SECRET": {Name: "SECRET", Value: "s3cr3t"},
+	}}
+	ctx := pipelineContext{App: &a, Units: 2}
+	newPipeline("add-units", &ctx)
+	data, err := bson.Marshal(&ctx)
+	c.Assert(err, IsNil)
+	var stored bson.M
+	err = bson.Unmarshal(data, &stored)
+	c.Assert(err, IsNil)
+	c.Assert(stored["appname"], Equals, "stored")
+	c.Assert(stored["quotaowners"], DeepEquals, []interface{}{"qa"})
+	_, ok := stored["app"]
+	c.Assert(ok, Equals, false)
+}
+
+func (s *S) TestPipelineContextLoad(c *C) {
+	a := App{Name: "loaded", Framework: "python", Units: []Unit{{Name: "loaded/0"}}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	ctx := pipelineContext{AppName: "loaded"}
+	err = ctx.Load()
+	c.Assert(err, IsNil)
+	c.Assert(ctx.App.Units, HasLen, 1)
+	ctx = pipelineContext{AppName: "removed", QuotaOwners: []string{"qa"}}
+	err = ctx.Load()
+	c.Assert(err, IsNil)
+	c.Assert(ctx.App.Name, Equals, "removed")
+	c.Assert(ctx.App.QuotaOwners, DeepEquals, []string{"qa"})
+}
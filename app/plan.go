@@ -0,0 +1,199 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"regexp"
+)
+
+// Plan represents the size of the units of an app: how much memory, CPU and
+// disk the provisioner should allocate for each unit.
+//
+// Plans are defined by tsuru administrators. A plan may be restricted to some
+// teams, a plan without teams is available to everybody.
+type Plan struct {
+	Name     string `bson:"_id"`
+	Memory   int64
+	CpuShare int
+	Disk     int64
+	Default  bool
+	Teams    []string
+}
+
+// Get loads the plan from the database, using its name.
+func (p *Plan) Get() error {
+	return db.Session.Plans().Find(bson.M{"_id": p.Name}).One(p)
+}
+
+// Create stores the plan in the database. If the plan is marked as default,
+// it will replace the previous default plan, which is kept when the plan
+// can't be stored.
+func (p *Plan) Create() error {
+	if !p.isValid() {
+		msg := "Invalid plan name, the name should contain only letters, " +
+			"numbers, dashes and underscores, starting with a letter."
+		return &ValidationError{Message: msg}
+	}
+	if p.Memory < 0 || p.CpuShare < 0 || p.Disk < 0 {
+		return &ValidationError{Message: "Plan resources cannot be negative."}
+	}
+	if err := db.Session.Plans().Insert(p); err != nil {
+		return err
+	}
+	if p.Default {
+		query := bson.M{"_id": bson.M{"$ne": p.Name}, "default": true}
+		_, err := db.Session.Plans().UpdateAll(query, bson.M{"$set": bson.M{"default": false}})
+		return err
+	}
+	return nil
+}
+
+// Delete removes the plan from the database. Apps using the plan keep their
+// units as they are.
+func (p *Plan) Delete() error {
+	return db.Session.Plans().Remove(bson.M{"_id": p.Name})
+}
+
+func (p *Plan) update() error {
+	return db.Session.Plans().Update(bson.M{"_id": p.Name}, p)
+}
+
+func (p *Plan) isValid() bool {
+	regex := regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,62}$`)
+	return regex.MatchString(p.Name)
+}
+
+func (p *Plan) findTeam(team string) int {
+	for i, t := range p.Teams {
+		if t == team {
+			return i
+		}
+	}
+	return -1
+}
+
+// AllowedFor indicates whether any of the given teams is allowed to use the
+// plan.
+func (p *Plan) AllowedFor(teams []string) bool {
+	if len(p.Teams) == 0 {
+		return true
+	}
+	for _, team := range teams {
+		if p.findTeam(team) > -1 {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantAccess restricts the plan to the given team, in addition to the teams
+// that already have access to it.
+func (p *Plan) GrantAccess(team *auth.Team) error {
+	if p.findTeam(team.Name) > -1 {
+		return errors.New("This team already has access to this plan")
+	}
+	p.Teams = append(p.Teams, team.Name)
+	return p.update()
+}
+
+// RevokeAccess removes the given team from the list of teams that have
+// access to the plan.
+func (p *Plan) RevokeAccess(team *auth.Team) error {
+	index := p.findTeam(team.Name)
+	if index < 0 {
+		return errors.New("This team does not have access to this plan")
+	}
+	copy(p.Teams[index:], p.Teams[index+1:])
+	p.Teams = p.Teams[:len(p.Teams)-1]
+	return p.update()
+}
+
+func (p *Plan) provisionPlan() provision.Plan {
+	return provision.Plan{
+		Name:     p.Name,
+		Memory:   p.Memory,
+		CpuShare: p.CpuShare,
+		Disk:     p.Disk,
+	}
+}
+
+// DefaultPlan returns the plan used when an app is created without a plan.
+//
+// It returns an empty plan when there is no default plan, meaning that the
+// provisioner should use its own defaults.
+func DefaultPlan() (Plan, error) {
+	var plan Plan
+	err := db.Session.Plans().Find(bson.M{"default": true}).One(&plan)
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	return plan, err
+}
+
+// ListPlans returns all plans that the given user is allowed to use.
+func ListPlans(u *auth.User) ([]Plan, error) {
+	var plans []Plan
+	if u.IsAdmin() {
+		err := db.Session.Plans().Find(nil).Sort("_id").All(&plans)
+		return plans, err
+	}
+	teams, err := u.Teams()
+	if err != nil {
+		return nil, err
+	}
+	q := bson.M{"$or": []bson.M{
+		{"teams": bson.M{"$in": auth.GetTeamsNames(teams)}},
+		{"teams": bson.M{"$size": 0}},
+		{"teams": nil},
+	}}
+	err = db.Session.Plans().Find(q).Sort("_id").All(&plans)
+	return plans, err
+}
+
+// loadPlan resolves the plan of the app before creating it: apps without a
+// plan get the default plan, apps with a plan get the full definition from
+// the database.
+func (a *App) loadPlan() error {
+	if a.Plan.Name == "" {
+		plan, err := DefaultPlan()
+		if err != nil {
+			return err
+		}
+		a.Plan = plan
+		return nil
+	}
+	if err := a.Plan.Get(); err != nil {
+		return &ValidationError{Message: fmt.Sprintf("Plan %q not found.", a.Plan.Name)}
+	}
+	if !a.Plan.AllowedFor(a.Teams) {
+		return &ValidationError{Message: fmt.Sprintf("Your teams are not allowed to use the plan %q.", a.Plan.Name)}
+	}
+	return nil
+}
+
+// ChangePlan changes the plan of the app. Units added after the change will
+// be sized according to the new plan.
+func (a *App) ChangePlan(planName string) error {
+	plan := Plan{Name: planName}
+	if err := plan.Get(); err != nil {
+		return &ValidationError{Message: fmt.Sprintf("Plan %q not found.", planName)}
+	}
+	if !plan.AllowedFor(a.Teams) {
+		return &ValidationError{Message: fmt.Sprintf("The teams of this app are not allowed to use the plan %q.", planName)}
+	}
+	a.Plan = plan
+	err := db.Session.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"plan": a.Plan}})
+	if err != nil {
+		return err
+	}
+	return a.Log(fmt.Sprintf("changing plan to %s", planName), "tsuru")
+}
@@ -0,0 +1,276 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+)
+
+func (s *S) TestPlanCreate(c *C) {
+	plan := Plan{Name: "small", Memory: 512, CpuShare: 100, Disk: 1024}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	var got Plan
+	err = db.Session.Plans().Find(bson.M{"_id": "small"}).One(&got)
+	c.Assert(err, IsNil)
+	c.Assert(got.Memory, Equals, int64(512))
+	c.Assert(got.CpuShare, Equals, 100)
+	c.Assert(got.Disk, Equals, int64(1024))
+}
+
+func (s *S) TestPlanCreateInvalidName(c *C) {
+	plan := Plan{Name: "1 small"}
+	err := plan.Create()
+	c.Assert(err, NotNil)
+	_, ok := err.(*ValidationError)
+	c.Assert(ok, Equals, true)
+}
+
+func (s *S) TestPlanCreateNegativeResources(c *C) {
+	plan := Plan{Name: "small", Memory: -1}
+	err := plan.Create()
+	c.Assert(err, ErrorMatches, "^Plan resources cannot be negative.$")
+}
+
+func (s *S) TestPlanCreateDefaultReplacesPreviousDefault(c *C) {
+	old := Plan{Name: "small", Memory: 512, Default: true}
+	err := old.Create()
+	c.Assert(err, IsNil)
+	defer old.Delete()
+	plan := Plan{Name: "medium", Memory: 1024, Default: true}
+	err = plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	err = old.Get()
+	c.Assert(err, IsNil)
+	c.Assert(old.Default, Equals, false)
+	def, err := DefaultPlan()
+	c.Assert(err, IsNil)
+	c.Assert(def.Name, Equals, "medium")
+}
+
+func (s *S) TestPlanCreateDuplicateDefaultKeepsPreviousDefault(c *C) {
+	old := Plan{Name: "small", Memory: 512, Default: true}
+	err := old.Create()
+	c.Assert(err, IsNil)
+	defer old.Delete()
+	plan := Plan{Name: "small", Memory: 1024, Default: true}
+	err = plan.Create()
+	c.Assert(err, NotNil)
+	def, err := DefaultPlan()
+	c.Assert(err, IsNil)
+	c.Assert(def.Name, Equals, "small")
+	c.Assert(def.Memory, Equals, int64(512))
+}
+
+func (s *S) TestDefaultPlanWithoutPlans(c *C) {
+	plan, err := DefaultPlan()
+	c.Assert(err, IsNil)
+	c.Assert(plan, DeepEquals, Plan{})
+}
+
+func (s *S) TestPlanAllowedFor(c *C) {
+	plan := Plan{Name: "huge"}
+	c.Assert(plan.AllowedFor([]string{"team1"}), Equals, true)
+	plan.Teams = []string{"team2", "team3"}
+	c.Assert(plan.AllowedFor([]string{"team1"}), Equals, false)
+	c.Assert(plan.AllowedFor([]string{"team1", "team3"}), Equals, true)
+}
+
+func (s *S) TestPlanGrantAndRevokeAccess(c *C) {
+	plan := Plan{Name: "huge"}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	err = plan.GrantAccess(&s.team)
+	c.Assert(err, IsNil)
+	err = plan.GrantAccess(&s.team)
+	c.Assert(err, ErrorMatches, "^This team already has access to this plan$")
+	err = plan.Get()
+	c.Assert(err, IsNil)
+	c.Assert(plan.Teams, DeepEquals, []string{s.team.Name})
+	err = plan.RevokeAccess(&s.team)
+	c.Assert(err, IsNil)
+	err = plan.RevokeAccess(&s.team)
+	c.Assert(err, ErrorMatches, "^This team does not have access to this plan$")
+	err = plan.Get()
+	c.Assert(err, IsNil)
+	c.Assert(plan.Teams, HasLen, 0)
+}
+
+func (s *S) TestListPlansFiltersRestrictedPlans(c *C) {
+	plans := []Plan{
+		{Name: "small"},
+		{Name: "medium", Teams: []string{s.team.Name}},
+		{Name: "huge", Teams: []string{"otherteam"}},
+	}
+	for _, p := range plans {
+		err := p.Create()
+		c.Assert(err, IsNil)
+		defer p.Delete()
+	}
+	result, err := ListPlans(s.user)
+	c.Assert(err, IsNil)
+	names := make([]string, len(result))
+	for i, p := range result {
+		names[i] = p.Name
+	}
+	c.Assert(names, DeepEquals, []string{"medium", "small"})
+}
+
+func (s *S) TestListPlansReturnsAllPlansForAdmin(c *C) {
+	s.createAdminUserAndTeam(c)
+	defer s.removeAdminUserAndTeam(c)
+	plans := []Plan{
+		{Name: "small"},
+		{Name: "huge", Teams: []string{"otherteam"}},
+	}
+	for _, p := range plans {
+		err := p.Create()
+		c.Assert(err, IsNil)
+		defer p.Delete()
+	}
+	result, err := ListPlans(s.admin)
+	c.Assert(err, IsNil)
+	c.Assert(result, HasLen, 2)
+}
+
+func (s *S) TestCreateAppWithPlan(c *C) {
+	h := testHandler{}
+	ts := s.t.StartGandalfTestServer(&h)
+	defer ts.Close()
+	server := testing.FakeQueueServer{}
+	server.Start("127.0.0.1:0")
+	defer server.Stop()
+	config.Set("queue-server", server.Addr())
+	plan := Plan{Name: "small", Memory: 512, CpuShare: 100}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	a := App{
+		Name:      "sized",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Plan:      Plan{Name: "small"},
+	}
+	err = CreateApp(&a, 1)
+	c.Assert(err, IsNil)
+	defer a.Destroy()
+	c.Assert(a.Plan.Memory, Equals, int64(512))
+	var retrievedApp App
+	err = db.Session.Apps().Find(bson.M{"name": a.Name}).One(&retrievedApp)
+	c.Assert(err, IsNil)
+	c.Assert(retrievedApp.Plan.Name, Equals, "small")
+	c.Assert(retrievedApp.Plan.CpuShare, Equals, 100)
+}
+
+func (s *S) TestCreateAppUsesDefaultPlan(c *C) {
+	h := testHandler{}
+	ts := s.t.StartGandalfTestServer(&h)
+	defer ts.Close()
+	server := testing.FakeQueueServer{}
+	server.Start("127.0.0.1:0")
+	defer server.Stop()
+	config.Set("queue-server", server.Addr())
+	plan := Plan{Name: "small", Memory: 512, Default: true}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	a := App{Name: "defaultsized", Framework: "django"}
+	err = CreateApp(&a, 1)
+	c.Assert(err, IsNil)
+	defer a.Destroy()
+	c.Assert(a.Plan.Name, Equals, "small")
+	c.Assert(a.GetPlan(), DeepEquals, provision.Plan{Name: "small", Memory: 512})
+}
+
+func (s *S) TestCreateAppWithUnknownPlan(c *C) {
+	a := App{Name: "unknownplan", Framework: "django", Plan: Plan{Name: "unknown"}}
+	err := CreateApp(&a, 1)
+	c.Assert(err, NotNil)
+	e, ok := err.(*ValidationError)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Message, Equals, `Plan "unknown" not found.`)
+	count, err := db.Session.Apps().Find(bson.M{"name": a.Name}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 0)
+}
+
+func (s *S) TestCreateAppWithRestrictedPlan(c *C) {
+	plan := Plan{Name: "huge", Teams: []string{"otherteam"}}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	a := App{
+		Name:      "restricted",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Plan:      Plan{Name: "huge"},
+	}
+	err = CreateApp(&a, 1)
+	c.Assert(err, NotNil)
+	e, ok := err.(*ValidationError)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Message, Equals, `Your teams are not allowed to use the plan "huge".`)
+}
+
+func (s *S) TestChangePlan(c *C) {
+	plan := Plan{Name: "medium", Memory: 1024}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	a := App{Name: "growing", Teams: []string{s.team.Name}}
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = a.ChangePlan("medium")
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Plan.Name, Equals, "medium")
+	c.Assert(a.Plan.Memory, Equals, int64(1024))
+}
+
+func (s *S) TestChangePlanToRestrictedPlan(c *C) {
+	plan := Plan{Name: "huge", Teams: []string{"otherteam"}}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	a := App{Name: "growing", Teams: []string{s.team.Name}}
+	err = a.ChangePlan("huge")
+	c.Assert(err, NotNil)
+	_, ok := err.(*ValidationError)
+	c.Assert(ok, Equals, true)
+}
+
+func (s *S) TestChangePlanNotFound(c *C) {
+	a := App{Name: "growing", Teams: []string{s.team.Name}}
+	err := a.ChangePlan("unknown")
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, `Plan "unknown" not found.`)
+}
+
+func (s *S) TestGetPlanOfAppWithoutPlan(c *C) {
+	a := App{Name: "unsized"}
+	c.Assert(a.GetPlan(), DeepEquals, provision.Plan{})
+}
+
+func (s *S) TestPlanGrantAccessKeepsOtherTeams(c *C) {
+	plan := Plan{Name: "huge", Teams: []string{"otherteam"}}
+	err := plan.Create()
+	c.Assert(err, IsNil)
+	defer plan.Delete()
+	team := auth.Team{Name: "thirdteam"}
+	err = plan.GrantAccess(&team)
+	c.Assert(err, IsNil)
+	c.Assert(plan.Teams, DeepEquals, []string{"otherteam", "thirdteam"})
+}
@@ -0,0 +1,150 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"regexp"
+)
+
+var ErrPlatformInUse = errors.New("Cannot remove a platform that is used by apps.")
+
+// Platform is a framework that apps can use, like python or ruby.
+//
+// Platforms are managed by tsuru administrators. The template is the
+// provisioner-specific definition of the platform (a charm in juju). A
+// deprecated platform is disabled: it can't be used by new apps, but apps that
+// already use it keep working.
+type Platform struct {
+	Name        string `bson:"_id"`
+	Description string
+	Template    string
+	Enabled     bool
+}
+
+// Get loads the platform from the database, using its name.
+func (p *Platform) Get() error {
+	return db.Session.Platforms().Find(bson.M{"_id": p.Name}).One(p)
+}
+
+// Create stores the platform in the database. New platforms are always
+// enabled.
+func (p *Platform) Create() error {
+	if !p.isValid() {
+		msg := "Invalid platform name, the name should contain only lower case " +
+			"letters, numbers and dashes, starting with a letter."
+		return &ValidationError{Message: msg}
+	}
+	p.Enabled = true
+	return db.Session.Platforms().Insert(p)
+}
+
+// Delete removes the platform from the database. Platforms used by apps can't
+// be removed, they should be deprecated instead.
+func (p *Platform) Delete() error {
+	apps, err := p.Apps()
+	if err != nil {
+		return err
+	}
+	if len(apps) > 0 {
+		return ErrPlatformInUse
+	}
+	return db.Session.Platforms().Remove(bson.M{"_id": p.Name})
+}
+
+// Deprecate disables the platform for new apps.
+func (p *Platform) Deprecate() error {
+	return p.setEnabled(false)
+}
+
+// Enable makes the platform available for new apps again.
+func (p *Platform) Enable() error {
+	return p.setEnabled(true)
+}
+
+func (p *Platform) setEnabled(enabled bool) error {
+	p.Enabled = enabled
+	return db.Session.Platforms().Update(bson.M{"_id": p.Name}, bson.M{"$set": bson.M{"enabled": enabled}})
+}
+
+// Apps returns the names of the apps that use the platform.
+func (p *Platform) Apps() ([]string, error) {
+	var apps []App
+	err := db.Session.Apps().Find(bson.M{"framework": p.Name}).Select(bson.M{"name": 1}).Sort("name").All(&apps)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(apps))
+	for i, a := range apps {
+		names[i] = a.Name
+	}
+	return names, nil
+}
+
+func (p *Platform) isValid() bool {
+	regex := regexp.MustCompile(`^[a-z][a-z0-9-]{0,62}$`)
+	return regex.MatchString(p.Name)
+}
+
+// ListPlatforms returns the platforms available for the given user: admin
+// users see all platforms, other users see only the enabled ones.
+func ListPlatforms(u *auth.User) ([]Platform, error) {
+	var q bson.M
+	if !u.IsAdmin() {
+		q = bson.M{"enabled": true}
+	}
+	var platforms []Platform
+	err := db.Session.Platforms().Find(q).Sort("_id").All(&platforms)
+	return platforms, err
+}
+
+// SeedPlatforms registers the frameworks used by the existing apps that are
+// not in the platforms catalog yet, so apps created before the catalog keep
+// working and their frameworks can still be used by new apps. Platforms
+// already in the catalog are not changed.
+func SeedPlatforms() error {
+	var frameworks []string
+	err := db.Session.Apps().Find(nil).Distinct("framework", &frameworks)
+	if err != nil {
+		return err
+	}
+	for _, name := range frameworks {
+		if name == "" {
+			continue
+		}
+		n, err := db.Session.Platforms().FindId(name).Count()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		err = db.Session.Platforms().Insert(Platform{Name: name, Enabled: true})
+		if err != nil && !mgo.IsDup(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPlatform checks that the framework of the app is an enabled platform,
+// and resolves the template used by the provisioner.
+func (a *App) loadPlatform() error {
+	p := Platform{Name: a.Framework}
+	if err := p.Get(); err != nil {
+		msg := fmt.Sprintf("Platform %q not found. Use platform-list to see the available platforms.", a.Framework)
+		return &ValidationError{Message: msg}
+	}
+	if !p.Enabled {
+		return &ValidationError{Message: fmt.Sprintf("Platform %q is deprecated and cannot be used by new apps.", a.Framework)}
+	}
+	a.Template = p.Template
+	return nil
+}
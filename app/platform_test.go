@@ -0,0 +1,182 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/api/auth"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+)
+
+func (s *S) TestPlatformCreate(c *C) {
+	p := Platform{Name: "java", Description: "Java with Tomcat", Template: "cs:precise/tomcat"}
+	err := p.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().Remove(bson.M{"_id": p.Name})
+	var got Platform
+	err = db.Session.Platforms().Find(bson.M{"_id": "java"}).One(&got)
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, Platform{Name: "java", Description: "Java with Tomcat", Template: "cs:precise/tomcat", Enabled: true})
+}
+
+func (s *S) TestPlatformCreateInvalidName(c *C) {
+	p := Platform{Name: "Java 7"}
+	err := p.Create()
+	c.Assert(err, NotNil)
+	_, ok := err.(*ValidationError)
+	c.Assert(ok, Equals, true)
+}
+
+func (s *S) TestPlatformDeprecateAndEnable(c *C) {
+	p := Platform{Name: "java"}
+	err := p.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().Remove(bson.M{"_id": p.Name})
+	err = p.Deprecate()
+	c.Assert(err, IsNil)
+	got := Platform{Name: "java"}
+	err = got.Get()
+	c.Assert(err, IsNil)
+	c.Assert(got.Enabled, Equals, false)
+	err = p.Enable()
+	c.Assert(err, IsNil)
+	err = got.Get()
+	c.Assert(err, IsNil)
+	c.Assert(got.Enabled, Equals, true)
+}
+
+func (s *S) TestPlatformApps(c *C) {
+	a := App{Name: "coffee", Framework: "java"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	b := App{Name: "bean", Framework: "java"}
+	err = db.Session.Apps().Insert(b)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": b.Name})
+	p := Platform{Name: "java"}
+	apps, err := p.Apps()
+	c.Assert(err, IsNil)
+	c.Assert(apps, DeepEquals, []string{"bean", "coffee"})
+}
+
+func (s *S) TestPlatformDeleteRefusesPlatformsInUse(c *C) {
+	p := Platform{Name: "java"}
+	err := p.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().Remove(bson.M{"_id": p.Name})
+	a := App{Name: "coffee", Framework: "java"}
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = p.Delete()
+	c.Assert(err, Equals, ErrPlatformInUse)
+	n, err := db.Session.Platforms().Find(bson.M{"_id": "java"}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+}
+
+func (s *S) TestPlatformDelete(c *C) {
+	p := Platform{Name: "java"}
+	err := p.Create()
+	c.Assert(err, IsNil)
+	err = p.Delete()
+	c.Assert(err, IsNil)
+	n, err := db.Session.Platforms().Find(bson.M{"_id": "java"}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
+func (s *S) TestListPlatformsHidesDeprecatedPlatformsFromUsers(c *C) {
+	p := Platform{Name: "java"}
+	err := p.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().Remove(bson.M{"_id": p.Name})
+	err = p.Deprecate()
+	c.Assert(err, IsNil)
+	platforms, err := ListPlatforms(s.user)
+	c.Assert(err, IsNil)
+	for _, platform := range platforms {
+		c.Assert(platform.Name, Not(Equals), "java")
+	}
+	admin := &auth.User{Email: "admin@tsuru.io"}
+	err = admin.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Users().Remove(bson.M{"email": admin.Email})
+	adminTeam := auth.Team{Name: "admin", Users: []string{admin.Email}}
+	err = db.Session.Teams().Insert(adminTeam)
+	c.Assert(err, IsNil)
+	defer db.Session.Teams().Remove(bson.M{"_id": adminTeam.Name})
+	platforms, err = ListPlatforms(admin)
+	c.Assert(err, IsNil)
+	var found bool
+	for _, platform := range platforms {
+		found = found || platform.Name == "java"
+	}
+	c.Assert(found, Equals, true)
+}
+
+func (s *S) TestSeedPlatforms(c *C) {
+	p := Platform{Name: "erlang", Template: "cs:precise/erlang"}
+	err := p.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().Remove(bson.M{"_id": p.Name})
+	err = p.Deprecate()
+	c.Assert(err, IsNil)
+	apps := []App{{Name: "legacy", Framework: "haskell"}, {Name: "again", Framework: "haskell"}, {Name: "otp", Framework: "erlang"}}
+	for _, a := range apps {
+		err = db.Session.Apps().Insert(a)
+		c.Assert(err, IsNil)
+		defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	}
+	err = SeedPlatforms()
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().Remove(bson.M{"_id": "haskell"})
+	got := Platform{Name: "haskell"}
+	err = got.Get()
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, Platform{Name: "haskell", Enabled: true})
+	got = Platform{Name: "erlang"}
+	err = got.Get()
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, Platform{Name: "erlang", Template: "cs:precise/erlang", Enabled: false})
+}
+
+func (s *S) TestCreateAppWithUnknownPlatform(c *C) {
+	a := App{Name: "unknownplatform", Framework: "cobol"}
+	err := CreateApp(&a, 1)
+	c.Assert(err, NotNil)
+	e, ok := err.(*ValidationError)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Message, Equals, `Platform "cobol" not found. Use platform-list to see the available platforms.`)
+}
+
+func (s *S) TestCreateAppWithDeprecatedPlatform(c *C) {
+	p := Platform{Name: "java"}
+	err := p.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().Remove(bson.M{"_id": p.Name})
+	err = p.Deprecate()
+	c.Assert(err, IsNil)
+	a := App{Name: "oldjava", Framework: "java"}
+	err = CreateApp(&a, 1)
+	c.Assert(err, NotNil)
+	e, ok := err.(*ValidationError)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Message, Equals, `Platform "java" is deprecated and cannot be used by new apps.`)
+}
+
+func (s *S) TestValidateCreationLoadsThePlatformTemplate(c *C) {
+	p := Platform{Name: "java", Template: "cs:precise/tomcat"}
+	err := p.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Platforms().Remove(bson.M{"_id": p.Name})
+	a := App{Name: "tomcat", Framework: "java"}
+	err = a.validateCreation(1)
+	c.Assert(err, IsNil)
+	c.Assert(a.Template, Equals, "cs:precise/tomcat")
+	c.Assert(a.GetFramework(), Equals, "cs:precise/tomcat")
+}
@@ -0,0 +1,176 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/repository"
+	"io"
+	"labix.org/v2/mgo/bson"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const restartHook = "/var/lib/tsuru/hooks/restart"
+
+var processNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Process is a process type declared in the Procfile of the app. Each line
+// of the Procfile declares one process type, with its name and its command:
+//
+//	web: gunicorn -b 0.0.0.0:$PORT app:app
+//	worker: celery worker -A tasks
+//
+// Every unit of the app runs one process type.
+type Process struct {
+	Name    string
+	Command string
+}
+
+// parseProcfile parses the content of a Procfile, returning the process types
+// in the order they're declared. Blank lines and lines starting with # are
+// ignored.
+func parseProcfile(data []byte) ([]Process, error) {
+	var processes []Process
+	declared := make(map[string]bool)
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for n := 1; ; n++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			parts := strings.SplitN(line, ":", 2)
+			name := strings.TrimSpace(parts[0])
+			if !processNameRegexp.MatchString(name) {
+				return nil, fmt.Errorf("line %d: invalid process name %q", n, name)
+			}
+			if len(parts) < 2 || strings.TrimSpace(parts[1]) == "" {
+				return nil, fmt.Errorf("line %d: the command of the process %q is missing", n, name)
+			}
+			if declared[name] {
+				return nil, fmt.Errorf("line %d: the process %q is declared twice", n, name)
+			}
+			declared[name] = true
+			processes = append(processes, Process{Name: name, Command: strings.TrimSpace(parts[1])})
+		}
+		if err == io.EOF {
+			return processes, nil
+		}
+	}
+}
+
+// loadProcfile reads the Procfile in the repository of the app and saves the
+// process types it declares. Apps without a Procfile have no process types:
+// all their units run the restart hook without arguments.
+func (a *App) loadProcfile() error {
+	uRepo, err := repository.GetPath()
+	if err != nil {
+		a.Log(fmt.Sprintf("Got error while getting repository path: %s", err), "tsuru")
+		return err
+	}
+	// The code of the app lives in its units.
+	u, err := a.hookUnit()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	// The command succeeds without output when the Procfile doesn't exist,
+	// so any failure means that the Procfile couldn't be read.
+	procfile := path.Join(uRepo, "Procfile")
+	cmd := fmt.Sprintf("[ ! -f %s ] || cat %s", procfile, procfile)
+	target := &unitApp{App: a, units: []provision.AppUnit{u}}
+	if err = Provisioner.ExecuteCommand(&buf, &buf, target, cmd); err != nil {
+		a.Log(fmt.Sprintf("Got error while reading the Procfile: %s", err), "tsuru")
+		return err
+	}
+	processes, err := parseProcfile(buf.Bytes())
+	if err != nil {
+		a.Log(fmt.Sprintf("Got error while parsing the Procfile: %s", err), "tsuru")
+		return fmt.Errorf("Invalid Procfile: %s.", err)
+	}
+	if len(processes) == 0 {
+		a.Log("The app has no Procfile, all units run the restart hook.", "tsuru")
+	}
+	if reflect.DeepEqual(processes, a.Processes) {
+		return nil
+	}
+	a.Processes = processes
+	return db.Session.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"processes": a.Processes}})
+}
+
+// validateProcess returns a ValidationError if the app doesn't declare the
+// given process type. Apps without a Procfile run only the DefaultProcess.
+func (a *App) validateProcess(process string) error {
+	if len(a.Processes) == 0 {
+		if process == provision.DefaultProcess {
+			return nil
+		}
+		msg := fmt.Sprintf("App %q does not declare process types in a Procfile, it runs only the %q process.", a.Name, provision.DefaultProcess)
+		return &ValidationError{Message: msg}
+	}
+	for _, p := range a.Processes {
+		if p.Name == process {
+			return nil
+		}
+	}
+	msg := fmt.Sprintf("App %q does not declare the process %q in its Procfile.", a.Name, process)
+	return &ValidationError{Message: msg}
+}
+
+// processUnits returns the units of the app that run the given process type.
+func (a *App) processUnits(process string) []provision.AppUnit {
+	var units []provision.AppUnit
+	for i, u := range a.ProvisionUnits() {
+		if a.Units[i].GetProcess() == process {
+			units = append(units, u)
+		}
+	}
+	return units
+}
+
+// restart runs the restart hook in the units of the app. If the app declares
+// process types, the units of each process run the hook with the name and the
+// command of the process:
+//
+//	/var/lib/tsuru/hooks/restart worker 'celery worker -A tasks'
+//
+// Units of processes that are not declared anymore are not restarted.
+func (a *App) restart(w io.Writer) error {
+	if len(a.Processes) == 0 {
+		return a.run(restartHook, w)
+	}
+	if err := a.checkStarted(); err != nil {
+		return err
+	}
+	declared := make(map[string]bool)
+	for _, p := range a.Processes {
+		declared[p.Name] = true
+		units := a.processUnits(p.Name)
+		if len(units) == 0 {
+			continue
+		}
+		cmd := fmt.Sprintf("%s %s %s", restartHook, p.Name, shellQuote(p.Command))
+		if err := Provisioner.ExecuteCommand(w, w, &unitApp{App: a, units: units}, cmd); err != nil {
+			return err
+		}
+	}
+	for _, u := range a.Units {
+		if process := u.GetProcess(); !declared[process] {
+			msg := fmt.Sprintf("\n ---> Unit %s was not restarted: the process %q is not declared in the Procfile\n", u.Name, process)
+			if err := write(w, []byte(msg)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"errors"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"strings"
+)
+
+func (s *S) TestParseProcfile(c *C) {
+	data := `# processes of the app
+web: gunicorn -b 0.0.0.0:$PORT app:app
+
+worker:   celery worker -A tasks
+clock: python clock.py --interval=10:00`
+	processes, err := parseProcfile([]byte(data))
+	c.Assert(err, IsNil)
+	expected := []Process{
+		{Name: "web", Command: "gunicorn -b 0.0.0.0:$PORT app:app"},
+		{Name: "worker", Command: "celery worker -A tasks"},
+		{Name: "clock", Command: "python clock.py --interval=10:00"},
+	}
+	c.Assert(processes, DeepEquals, expected)
+}
+
+func (s *S) TestParseProcfileErrors(c *C) {
+	var tests = []struct {
+		data string
+		err  string
+	}{
+		{"web gunicorn app:app", `^line 1: invalid process name "web gunicorn app"$`},
+		{"web: gunicorn\nworker:\n", `^line 2: the command of the process "worker" is missing$`},
+		{"web: gunicorn\nweb: python app.py", `^line 2: the process "web" is declared twice$`},
+	}
+	for _, t := range tests {
+		_, err := parseProcfile([]byte(t.data))
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *S) TestValidateProcess(c *C) {
+	a := App{Name: "procs"}
+	c.Assert(a.validateProcess("web"), IsNil)
+	err := a.validateProcess("worker")
+	c.Assert(err, FitsTypeOf, &ValidationError{})
+	c.Assert(err, ErrorMatches, `^App "procs" does not declare process types in a Procfile, it runs only the "web" process.$`)
+	a.Processes = []Process{{Name: "worker", Command: "celery worker"}}
+	c.Assert(a.validateProcess("worker"), IsNil)
+	err = a.validateProcess("web")
+	c.Assert(err, FitsTypeOf, &ValidationError{})
+	c.Assert(err, ErrorMatches, `^App "procs" does not declare the process "web" in its Procfile.$`)
+}
+
+func (s *S) TestUnitGetProcess(c *C) {
+	u := Unit{Name: "procs/0"}
+	c.Assert(u.GetProcess(), Equals, provision.DefaultProcess)
+	u.Process = "worker"
+	c.Assert(u.GetProcess(), Equals, "worker")
+}
+
+func (s *S) TestLoadProcfile(c *C) {
+	s.provisioner.PrepareOutput([]byte("web: gunicorn app:app\nworker: celery worker\n"))
+	a := App{
+		Name:  "procs",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "procs/0"}, {Name: "procs/1", State: string(provision.StatusStarted)}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = a.loadProcfile()
+	c.Assert(err, IsNil)
+	expected := []Process{
+		{Name: "web", Command: "gunicorn app:app"},
+		{Name: "worker", Command: "celery worker"},
+	}
+	c.Assert(a.Processes, DeepEquals, expected)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 1)
+	c.Assert(cmds[0].Cmd, Matches, `^\[ ! -f .*/Procfile \] \|\| cat .*/Procfile$`)
+	units := cmds[0].App.ProvisionUnits()
+	c.Assert(units, HasLen, 1)
+	c.Assert(units[0].GetName(), Equals, "procs/1")
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Processes, DeepEquals, expected)
+}
+
+func (s *S) TestLoadProcfileWithoutProcfile(c *C) {
+	s.provisioner.PrepareOutput(nil)
+	a := App{
+		Name:      "procs",
+		State:     string(provision.StatusStarted),
+		Units:     []Unit{{Name: "procs/0"}},
+		Processes: []Process{{Name: "worker", Command: "celery worker"}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = a.loadProcfile()
+	c.Assert(err, IsNil)
+	c.Assert(a.Processes, HasLen, 0)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Processes, HasLen, 0)
+}
+
+func (s *S) TestLoadProcfileFailure(c *C) {
+	p := &execFuncProvisioner{FakeProvisioner: s.provisioner, exec: func(cmd string) error {
+		return errors.New("exit status 255")
+	}}
+	Provisioner = p
+	defer func() { Provisioner = s.provisioner }()
+	processes := []Process{{Name: "worker", Command: "celery worker"}}
+	a := App{
+		Name:      "procs",
+		State:     string(provision.StatusStarted),
+		Units:     []Unit{{Name: "procs/0"}},
+		Processes: processes,
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = a.loadProcfile()
+	c.Assert(err, ErrorMatches, "^exit status 255$")
+	c.Assert(a.Processes, DeepEquals, processes)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Processes, DeepEquals, processes)
+}
+
+func (s *S) TestLoadProcfileWithoutUnits(c *C) {
+	a := App{Name: "procs", State: string(provision.StatusStarted)}
+	err := a.loadProcfile()
+	c.Assert(err, ErrorMatches, "^the app has no units$")
+}
+
+func (s *S) TestLoadProcfileInvalid(c *C) {
+	s.provisioner.PrepareOutput([]byte("web: gunicorn app:app\nweb: python app.py\n"))
+	a := App{
+		Name:  "procs",
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: "procs/0"}},
+	}
+	err := a.loadProcfile()
+	c.Assert(err, ErrorMatches, `^Invalid Procfile: line 2: the process "web" is declared twice.$`)
+	c.Assert(a.Processes, HasLen, 0)
+}
+
+func (s *S) TestRestartRunsTheProcessesOfTheUnits(c *C) {
+	s.provisioner.PrepareOutput(nil)
+	s.provisioner.PrepareOutput(nil)
+	a := App{
+		Name:  "procs",
+		State: string(provision.StatusStarted),
+		Units: []Unit{
+			{Name: "procs/0"},
+			{Name: "procs/1", Process: "worker"},
+			{Name: "procs/2", Process: "web"},
+			{Name: "procs/3", Process: "clock"},
+		},
+		Processes: []Process{
+			{Name: "web", Command: "gunicorn app:app"},
+			{Name: "worker", Command: "celery worker -Q 'high'"},
+		},
+		hooks: &conf{},
+	}
+	var buf bytes.Buffer
+	err := a.Restart(&buf)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(buf.String(), `Unit procs/3 was not restarted: the process "clock" is not declared in the Procfile`), Equals, true)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 2)
+	web, worker := cmds[0], cmds[1]
+	c.Assert(web.Cmd, Equals, "/var/lib/tsuru/hooks/restart web 'gunicorn app:app'")
+	units := web.App.ProvisionUnits()
+	c.Assert(units, HasLen, 2)
+	c.Assert(units[0].GetName(), Equals, "procs/0")
+	c.Assert(units[1].GetName(), Equals, "procs/2")
+	c.Assert(worker.Cmd, Equals, `/var/lib/tsuru/hooks/restart worker 'celery worker -Q '\''high'\'''`)
+	units = worker.App.ProvisionUnits()
+	c.Assert(units, HasLen, 1)
+	c.Assert(units[0].GetName(), Equals, "procs/1")
+}
+
+func (s *S) TestAddUnitsOfAProcess(c *C) {
+	server := testing.FakeQueueServer{}
+	server.Start("127.0.0.1:0")
+	defer server.Stop()
+	config.Set("queue-server", server.Addr())
+	a := App{
+		Name:      "procs",
+		Framework: "python",
+		Processes: []Process{{Name: "web", Command: "gunicorn app:app"}, {Name: "worker", Command: "celery worker"}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = a.AddUnits(2, "worker")
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Units, HasLen, 2)
+	for _, u := range a.Units {
+		c.Assert(u.Process, Equals, "worker")
+	}
+	for _, u := range s.provisioner.GetUnits(&a)[1:] {
+		c.Assert(u.Process, Equals, "worker")
+	}
+}
+
+func (s *S) TestAddUnitsOfAnUndeclaredProcess(c *C) {
+	a := App{Name: "procs", Framework: "python"}
+	err := a.AddUnits(2, "worker")
+	c.Assert(err, FitsTypeOf, &ValidationError{})
+	c.Assert(s.provisioner.GetUnits(&a), HasLen, 0)
+}
+
+func (s *S) TestStartAddUnitsOfAnUndeclaredProcess(c *C) {
+	a := App{Name: "procs", Processes: []Process{{Name: "worker", Command: "celery worker"}}}
+	op, err := a.StartAddUnits(2, "clock", "someone@tsuru.io")
+	c.Assert(op, IsNil)
+	c.Assert(err, ErrorMatches, `^App "procs" does not declare the process "clock" in its Procfile.$`)
+}
@@ -0,0 +1,270 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"strings"
+)
+
+// Unlimited is the value of a quota limit that doesn't restrict the usage.
+const Unlimited = -1
+
+// Quota limits the number of apps and units of a team or a user.
+//
+// The owner of the quota is either a team name or a user email. Owners
+// without a quota are not limited. The usage is kept in the quota document
+// itself, so resources can be reserved atomically: apps and units are
+// reserved before they're created, and released when they're destroyed.
+type Quota struct {
+	Owner    string `bson:"_id"`
+	MaxApps  int
+	MaxUnits int
+	Apps     int
+	Units    int
+}
+
+// Reservation is the number of units of an app reserved in the quota of one
+// of its owners.
+type Reservation struct {
+	Owner string
+	Units int
+}
+
+// QuotaExceededError is returned when a reservation would exceed the quota of
+// one of the owners of an app.
+type QuotaExceededError struct {
+	Owner     string
+	Resource  string
+	Used      int
+	Max       int
+	Requested int
+}
+
+func (err *QuotaExceededError) Error() string {
+	return fmt.Sprintf("Quota exceeded for %s %q: using %d of %d %s, requested %d more.",
+		ownerKind(err.Owner), err.Owner, err.Used, err.Max, err.Resource, err.Requested)
+}
+
+func ownerKind(owner string) string {
+	if strings.Contains(owner, "@") {
+		return "user"
+	}
+	return "team"
+}
+
+// GetQuota returns the quota of the given owner. Owners without a quota get
+// an unlimited quota, with the usage unknown.
+func GetQuota(owner string) (*Quota, error) {
+	q := Quota{Owner: owner}
+	err := db.Session.Quotas().FindId(owner).One(&q)
+	if err == mgo.ErrNotFound {
+		return &Quota{Owner: owner, MaxApps: Unlimited, MaxUnits: Unlimited}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// SetQuota changes the limits of the given owner. When the owner doesn't have
+// a quota yet, the apps it currently has access to (through its teams, or as
+// the creator, for users) start counting towards the new quota.
+func SetQuota(owner string, maxApps, maxUnits int) error {
+	if maxApps < Unlimited || maxUnits < Unlimited {
+		return &ValidationError{Message: "Invalid quota limit, use -1 for unlimited."}
+	}
+	n, err := db.Session.Quotas().FindId(owner).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return db.Session.Quotas().UpdateId(owner, bson.M{"$set": bson.M{"maxapps": maxApps, "maxunits": maxUnits}})
+	}
+	owned := bson.M{"teams": owner}
+	if ownerKind(owner) == "user" {
+		owned = bson.M{"owner": owner}
+	}
+	_, err = db.Session.Apps().UpdateAll(owned, bson.M{"$addToSet": bson.M{"quotaowners": owner}})
+	if err != nil {
+		return err
+	}
+	var apps []App
+	selected := bson.M{"name": 1, "units": 1, "reservations": 1}
+	err = db.Session.Apps().Find(bson.M{"quotaowners": owner}).Select(selected).All(&apps)
+	if err != nil {
+		return err
+	}
+	q := Quota{Owner: owner, MaxApps: maxApps, MaxUnits: maxUnits, Apps: len(apps)}
+	for _, a := range apps {
+		n := a.reserved(owner)
+		a.setReserved(owner, n)
+		if err = a.saveReservations(); err != nil {
+			return err
+		}
+		q.Units += n
+	}
+	return db.Session.Quotas().Insert(q)
+}
+
+func (q *Quota) limit(resource string) int {
+	if resource == "apps" {
+		return q.MaxApps
+	}
+	return q.MaxUnits
+}
+
+func (q *Quota) used(resource string) int {
+	if resource == "apps" {
+		return q.Apps
+	}
+	return q.Units
+}
+
+// check returns a QuotaExceededError if n more items of the resource don't
+// fit in the quota.
+func (q *Quota) check(resource string, n int) error {
+	max := q.limit(resource)
+	if max != Unlimited && q.used(resource)+n > max {
+		return &QuotaExceededError{Owner: q.Owner, Resource: resource, Used: q.used(resource), Max: max, Requested: n}
+	}
+	return nil
+}
+
+// reserve atomically increments the usage of the resource by n, failing with
+// a QuotaExceededError if the limit of the owner doesn't allow it.
+func reserve(owner, resource string, n int) error {
+	var q Quota
+	err := db.Session.Quotas().FindId(owner).One(&q)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	max := q.limit(resource)
+	query := bson.M{"_id": owner}
+	if max != Unlimited {
+		query["max"+resource] = max
+		query[resource] = bson.M{"$lte": max - n}
+	}
+	err = db.Session.Quotas().Update(query, bson.M{"$inc": bson.M{resource: n}})
+	if err == mgo.ErrNotFound {
+		err = db.Session.Quotas().FindId(owner).One(&q)
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = q.check(resource, n); err != nil {
+			return err
+		}
+		// The limit changed between the read and the update.
+		return reserve(owner, resource, n)
+	}
+	return err
+}
+
+// release decrements the usage of the resource by n. Owners without a quota
+// are ignored.
+func release(owner, resource string, n int) {
+	query := bson.M{"_id": owner, resource: bson.M{"$gte": n}}
+	db.Session.Quotas().Update(query, bson.M{"$inc": bson.M{resource: -n}})
+}
+
+// quotaOwners returns the owners whose quotas are used by the app: the user
+// that created it and its teams.
+func (a *App) quotaOwners() []string {
+	var owners []string
+	if a.Owner != "" {
+		owners = append(owners, a.Owner)
+	}
+	return append(owners, a.Teams...)
+}
+
+// checkQuota checks, without reserving anything, whether the quotas of the
+// given owners allow the given number of new apps and units.
+func checkQuota(owners []string, apps, units int) error {
+	for _, owner := range owners {
+		q, err := GetQuota(owner)
+		if err != nil {
+			return err
+		}
+		if err = q.check("apps", apps); err != nil {
+			return err
+		}
+		if err = q.check("units", units); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserveUnits reserves n units in the quotas of the app owners. If any quota
+// is exceeded, the units reserved in the other quotas are released.
+func (a *App) reserveUnits(n int) error {
+	for i, owner := range a.QuotaOwners {
+		if err := reserve(owner, "units", n); err != nil {
+			for _, reserved := range a.QuotaOwners[:i] {
+				release(reserved, "units", n)
+			}
+			return err
+		}
+	}
+	for _, owner := range a.QuotaOwners {
+		a.setReserved(owner, a.reserved(owner)+n)
+	}
+	if err := a.saveReservations(); err != nil {
+		a.releaseUnits(n)
+		return err
+	}
+	return nil
+}
+
+// releaseUnits releases n units in the quotas of the app owners.
+func (a *App) releaseUnits(n int) {
+	for _, owner := range a.QuotaOwners {
+		release(owner, "units", n)
+		reserved := a.reserved(owner) - n
+		if reserved < 0 {
+			reserved = 0
+		}
+		a.setReserved(owner, reserved)
+	}
+	a.saveReservations()
+}
+
+// reserved returns the number of units of the app reserved in the quota of
+// the owner. Apps created before the reservations were stored have all of
+// their units reserved.
+func (a *App) reserved(owner string) int {
+	for _, r := range a.Reservations {
+		if r.Owner == owner {
+			return r.Units
+		}
+	}
+	return len(a.Units)
+}
+
+// setReserved changes the number of units of the app reserved in the quota
+// of the owner. The change is not stored, see saveReservations.
+func (a *App) setReserved(owner string, n int) {
+	for i := range a.Reservations {
+		if a.Reservations[i].Owner == owner {
+			a.Reservations[i].Units = n
+			return
+		}
+	}
+	a.Reservations = append(a.Reservations, Reservation{Owner: owner, Units: n})
+}
+
+// saveReservations stores the reservations of the app in the database.
+func (a *App) saveReservations() error {
+	return db.Session.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"reservations": a.Reservations}})
+}
@@ -0,0 +1,192 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+)
+
+func (s *S) TestGetQuotaWithoutQuota(c *C) {
+	q, err := GetQuota("nobody@tsuru.io")
+	c.Assert(err, IsNil)
+	c.Assert(*q, DeepEquals, Quota{Owner: "nobody@tsuru.io", MaxApps: Unlimited, MaxUnits: Unlimited})
+}
+
+func (s *S) TestSetQuotaCountsCurrentApps(c *C) {
+	a := App{Name: "counted", Teams: []string{"qa"}, Units: []Unit{{Name: "counted/0"}, {Name: "counted/1"}}}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = SetQuota("qa", 2, 10)
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId("qa")
+	q, err := GetQuota("qa")
+	c.Assert(err, IsNil)
+	c.Assert(*q, DeepEquals, Quota{Owner: "qa", MaxApps: 2, MaxUnits: 10, Apps: 1, Units: 2})
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.QuotaOwners, DeepEquals, []string{"qa"})
+	c.Assert(a.Reservations, DeepEquals, []Reservation{{Owner: "qa", Units: 2}})
+}
+
+func (s *S) TestSetQuotaChangesTheLimitsOfAnExistingQuota(c *C) {
+	err := db.Session.Quotas().Insert(Quota{Owner: "qa", MaxApps: 2, MaxUnits: 10, Apps: 1, Units: 3})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId("qa")
+	err = SetQuota("qa", 5, Unlimited)
+	c.Assert(err, IsNil)
+	q, err := GetQuota("qa")
+	c.Assert(err, IsNil)
+	c.Assert(*q, DeepEquals, Quota{Owner: "qa", MaxApps: 5, MaxUnits: Unlimited, Apps: 1, Units: 3})
+}
+
+func (s *S) TestSetQuotaInvalidLimit(c *C) {
+	err := SetQuota("qa", -2, 10)
+	c.Assert(err, NotNil)
+	_, ok := err.(*ValidationError)
+	c.Assert(ok, Equals, true)
+}
+
+func (s *S) TestReserve(c *C) {
+	err := db.Session.Quotas().Insert(Quota{Owner: "qa", MaxApps: 2, MaxUnits: 10})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId("qa")
+	err = reserve("qa", "units", 4)
+	c.Assert(err, IsNil)
+	err = reserve("qa", "units", 6)
+	c.Assert(err, IsNil)
+	err = reserve("qa", "units", 1)
+	c.Assert(err, DeepEquals, &QuotaExceededError{Owner: "qa", Resource: "units", Used: 10, Max: 10, Requested: 1})
+	c.Assert(err, ErrorMatches, `^Quota exceeded for team "qa": using 10 of 10 units, requested 1 more.$`)
+}
+
+func (s *S) TestReserveWithoutQuota(c *C) {
+	err := reserve("nobody@tsuru.io", "apps", 100)
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestRelease(c *C) {
+	err := db.Session.Quotas().Insert(Quota{Owner: "qa", MaxApps: 2, MaxUnits: 10, Apps: 1, Units: 3})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId("qa")
+	release("qa", "units", 2)
+	release("qa", "apps", 2)
+	q, err := GetQuota("qa")
+	c.Assert(err, IsNil)
+	c.Assert(q.Units, Equals, 1)
+	c.Assert(q.Apps, Equals, 1)
+}
+
+func (s *S) TestCreateAppReservesQuota(c *C) {
+	h := testHandler{}
+	ts := s.t.StartGandalfTestServer(&h)
+	defer ts.Close()
+	server := testing.FakeQueueServer{}
+	server.Start("127.0.0.1:0")
+	defer server.Stop()
+	config.Set("queue-server", server.Addr())
+	err := db.Session.Quotas().Insert(Quota{Owner: s.user.Email, MaxApps: 1, MaxUnits: 2})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId(s.user.Email)
+	a := App{Name: "quoted", Framework: "django", Owner: s.user.Email, Teams: []string{s.team.Name}}
+	err = CreateApp(&a, 2)
+	c.Assert(err, IsNil)
+	q, err := GetQuota(s.user.Email)
+	c.Assert(err, IsNil)
+	c.Assert(q.Apps, Equals, 1)
+	c.Assert(q.Units, Equals, 2)
+	b := App{Name: "exceeded", Framework: "django", Owner: s.user.Email}
+	err = CreateApp(&b, 1)
+	c.Assert(err, DeepEquals, &QuotaExceededError{Owner: s.user.Email, Resource: "apps", Used: 1, Max: 1, Requested: 1})
+	n, err := db.Session.Apps().Find(bson.M{"name": "exceeded"}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+	err = a.Destroy()
+	c.Assert(err, IsNil)
+	q, err = GetQuota(s.user.Email)
+	c.Assert(err, IsNil)
+	c.Assert(q.Apps, Equals, 0)
+	c.Assert(q.Units, Equals, 0)
+}
+
+func (s *S) TestCreateAppReleasesQuotaOfAllOwnersWhenOneIsExceeded(c *C) {
+	err := db.Session.Quotas().Insert(Quota{Owner: s.user.Email, MaxApps: 5, MaxUnits: 5})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId(s.user.Email)
+	err = db.Session.Quotas().Insert(Quota{Owner: s.team.Name, MaxApps: 5, MaxUnits: 1})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId(s.team.Name)
+	a := App{Name: "quoted", Framework: "django", Owner: s.user.Email, Teams: []string{s.team.Name}}
+	err = CreateApp(&a, 2)
+	c.Assert(err, NotNil)
+	e, ok := err.(*QuotaExceededError)
+	c.Assert(ok, Equals, true)
+	c.Assert(e.Owner, Equals, s.team.Name)
+	c.Assert(e.Resource, Equals, "units")
+	q, err := GetQuota(s.user.Email)
+	c.Assert(err, IsNil)
+	c.Assert(q.Apps, Equals, 0)
+	c.Assert(q.Units, Equals, 0)
+}
+
+func (s *S) TestAddUnitsReservesQuota(c *C) {
+	server := testing.FakeQueueServer{}
+	server.Start("127.0.0.1:0")
+	defer server.Stop()
+	config.Set("queue-server", server.Addr())
+	err := db.Session.Quotas().Insert(Quota{Owner: s.team.Name, MaxApps: 5, MaxUnits: 3, Apps: 1, Units: 1})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId(s.team.Name)
+	a := App{Name: "quoted", Framework: "django", QuotaOwners: []string{s.team.Name}}
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	err = a.AddUnits(3, "")
+	c.Assert(err, DeepEquals, &QuotaExceededError{Owner: s.team.Name, Resource: "units", Used: 1, Max: 3, Requested: 3})
+	c.Assert(a.Units, HasLen, 0)
+	err = a.AddUnits(2, "")
+	c.Assert(err, IsNil)
+	q, err := GetQuota(s.team.Name)
+	c.Assert(err, IsNil)
+	c.Assert(q.Units, Equals, 3)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Reservations, DeepEquals, []Reservation{{Owner: s.team.Name, Units: 2}})
+}
+
+func (s *S) TestReleaseQuotaReleasesTheReservedUnits(c *C) {
+	err := db.Session.Quotas().Insert(Quota{Owner: s.team.Name, MaxApps: 5, MaxUnits: 10, Apps: 2, Units: 5})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId(s.team.Name)
+	a := App{
+		Name:         "removed",
+		QuotaOwners:  []string{s.team.Name},
+		Reservations: []Reservation{{Owner: s.team.Name, Units: 3}},
+	}
+	ctx := pipelineContext{App: &a, QuotaOwners: a.QuotaOwners}
+	err = releaseQuota.forward(&ctx)
+	c.Assert(err, IsNil)
+	q, err := GetQuota(s.team.Name)
+	c.Assert(err, IsNil)
+	c.Assert(q.Apps, Equals, 1)
+	c.Assert(q.Units, Equals, 2)
+}
+
+func (s *S) TestStartAddUnitsChecksTheQuota(c *C) {
+	err := db.Session.Quotas().Insert(Quota{Owner: s.team.Name, MaxApps: 5, MaxUnits: 3, Apps: 1, Units: 3})
+	c.Assert(err, IsNil)
+	defer db.Session.Quotas().RemoveId(s.team.Name)
+	a := App{Name: "quoted", Framework: "django", QuotaOwners: []string{s.team.Name}}
+	op, err := a.StartAddUnits(1, "", "someone@tsuru.io")
+	c.Assert(op, IsNil)
+	_, ok := err.(*QuotaExceededError)
+	c.Assert(ok, Equals, true)
+}
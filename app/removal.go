@@ -0,0 +1,86 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/pipeline"
+	"labix.org/v2/mgo"
+	"time"
+)
+
+// removalKinds are the kinds of the pipelines that remove apps.
+var removalKinds = []string{"remove-app", "destroy-app"}
+
+// ErrRemovalPending is returned when removing an app whose previous removal
+// didn't finish.
+var ErrRemovalPending = errors.New("A previous removal of this app did not finish. An admin can finish it with app-cleanup.")
+
+// ErrRemovalNotFound is returned when retrying a removal that doesn't exist.
+var ErrRemovalNotFound = errors.New("Removal not found.")
+
+// Removal is the removal of an app, with the cleanup status of each resource
+// of the app.
+type Removal struct {
+	Id      string
+	App     string
+	Status  string
+	Error   string
+	Steps   []pipeline.Step
+	Started time.Time
+}
+
+func newRemoval(state *pipeline.State) Removal {
+	return Removal{
+		Id:      state.Id,
+		App:     state.Target,
+		Status:  state.Status,
+		Error:   state.Error,
+		Steps:   state.Steps,
+		Started: state.Started,
+	}
+}
+
+// StuckRemovals returns the removals of apps that failed or were interrupted,
+// oldest first. If appName is not empty, only the removals of that app are
+// returned.
+func StuckRemovals(appName string) ([]Removal, error) {
+	states, err := pipeline.Stuck(appName, removalKinds...)
+	if err != nil {
+		return nil, err
+	}
+	removals := make([]Removal, len(states))
+	for i := range states {
+		removals[i] = newRemoval(&states[i])
+	}
+	return removals, nil
+}
+
+// RetryRemoval resumes a stuck removal from the step that failed or was
+// interrupted, returning the removal with the new status of its steps.
+func RetryRemoval(id string) (*Removal, error) {
+	state, err := pipeline.Get(id)
+	if err == mgo.ErrNotFound || (err == nil && !isRemoval(state)) {
+		return nil, ErrRemovalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	state, err = pipeline.Resume(id)
+	if state == nil {
+		return nil, err
+	}
+	r := newRemoval(state)
+	return &r, err
+}
+
+func isRemoval(state *pipeline.State) bool {
+	for _, kind := range removalKinds {
+		if state.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/pipeline"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+)
+
+func (s *S) TestRemovalStopsAtTheFailingStepAndCanBeRetried(c *C) {
+	h := testHandler{}
+	ts := s.t.StartGandalfTestServer(&h)
+	defer ts.Close()
+	a := App{
+		Name:      "ritual",
+		Framework: "ruby",
+		Teams:     []string{s.team.Name},
+		Units:     []Unit{{Name: "ritual/0", Machine: 3}},
+	}
+	err := CreateApp(&a, 1)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer db.Session.Pipelines().RemoveAll(bson.M{"target": a.Name})
+	s.provisioner.PrepareFailure("Destroy", errors.New("machine is busy"))
+	err = a.Destroy()
+	c.Assert(err, ErrorMatches, "^Failed to destroy the app: machine is busy$")
+	count, err := db.Session.Apps().Find(bson.M{"name": a.Name}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 1)
+	removals, err := StuckRemovals(a.Name)
+	c.Assert(err, IsNil)
+	c.Assert(removals, HasLen, 1)
+	r := removals[0]
+	c.Assert(r.App, Equals, a.Name)
+	c.Assert(r.Status, Equals, pipeline.Failed)
+	c.Assert(r.Steps[0].Status, Equals, StepDone)
+	c.Assert(r.Steps[1].Status, Equals, StepDone)
+	c.Assert(r.Steps[2].Status, Equals, StepFailed)
+	c.Assert(r.Steps[2].Error, Equals, "Failed to destroy the app: machine is busy")
+	c.Assert(r.Steps[3].Status, Equals, StepPending)
+	op, err := a.StartRemove("someone@tsuru.io")
+	c.Assert(op, IsNil)
+	c.Assert(err, Equals, ErrRemovalPending)
+	retried, err := RetryRemoval(r.Id)
+	c.Assert(err, IsNil)
+	c.Assert(retried.Status, Equals, pipeline.Succeeded)
+	for _, step := range retried.Steps {
+		c.Assert(step.Status, Equals, StepDone)
+	}
+	count, err = db.Session.Apps().Find(bson.M{"name": a.Name}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 0)
+	c.Assert(s.provisioner.FindApp(&a), Equals, -1)
+	removals, err = StuckRemovals(a.Name)
+	c.Assert(err, IsNil)
+	c.Assert(removals, HasLen, 0)
+}
+
+func (s *S) TestRetryRemovalNotFound(c *C) {
+	_, err := RetryRemoval("unknown")
+	c.Assert(err, Equals, ErrRemovalNotFound)
+	var ctx struct{}
+	p := pipeline.New("create-app", &ctx, &pipeline.Action{Name: "fail", Forward: func() error {
+		return errors.New("failed")
+	}})
+	err = p.Execute()
+	c.Assert(err, NotNil)
+	var state pipeline.State
+	err = db.Session.Pipelines().Find(bson.M{"kind": "create-app"}).Sort("-started").One(&state)
+	c.Assert(err, IsNil)
+	defer db.Session.Pipelines().RemoveId(state.Id)
+	_, err = RetryRemoval(state.Id)
+	c.Assert(err, Equals, ErrRemovalNotFound)
+}
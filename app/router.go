@@ -0,0 +1,111 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/router"
+	"labix.org/v2/mgo/bson"
+	"regexp"
+)
+
+var cnameRegexp = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,}$`)
+
+var errNoRouter = &ValidationError{Message: "tsuru is not configured with a router."}
+
+// AddCName makes the app reachable through the given domain. The domain must
+// point to the address of the app in the router, and can't be used by another
+// app.
+func (a *App) AddCName(cname string) error {
+	if Router == nil {
+		return errNoRouter
+	}
+	if !cnameRegexp.MatchString(cname) {
+		return &ValidationError{Message: "Invalid cname."}
+	}
+	if err := Router.AddBackend(a.Name); err != nil {
+		return err
+	}
+	if err := Router.SetCName(cname, a.Name); err != nil {
+		return err
+	}
+	err := db.Session.Apps().Update(bson.M{"name": a.Name}, bson.M{"$addToSet": bson.M{"cname": cname}})
+	if err != nil {
+		Router.UnsetCName(cname, a.Name)
+		return err
+	}
+	a.CName = append(a.CName, cname)
+	return nil
+}
+
+// RemoveCName removes a domain from the app.
+func (a *App) RemoveCName(cname string) error {
+	if Router == nil {
+		return errNoRouter
+	}
+	if err := Router.UnsetCName(cname, a.Name); err != nil {
+		return err
+	}
+	err := db.Session.Apps().Update(bson.M{"name": a.Name}, bson.M{"$pull": bson.M{"cname": cname}})
+	if err != nil {
+		return err
+	}
+	for i, c := range a.CName {
+		if c == cname {
+			a.CName = append(a.CName[:i], a.CName[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// SyncRoutes makes the routes of the app in the router match its started
+// units: units that started are added, and units that stopped or were removed
+// are taken out. It also sets the Ip of the app to its address in the router.
+//
+// It doesn't save the app in the database.
+func (a *App) SyncRoutes() error {
+	if Router == nil {
+		return nil
+	}
+	routes, err := Router.Routes(a.Name)
+	if err == router.ErrBackendNotFound {
+		err = Router.AddBackend(a.Name)
+	}
+	if err != nil {
+		return err
+	}
+	current := make(map[string]bool)
+	for _, r := range routes {
+		current[r] = true
+	}
+	wanted := make(map[string]bool)
+	for _, u := range a.Units {
+		if u.State == string(provision.StatusStarted) && u.Ip != "" {
+			wanted[u.Ip] = true
+		}
+	}
+	for address := range wanted {
+		if !current[address] {
+			if err = Router.AddRoute(a.Name, address); err != nil {
+				return err
+			}
+		}
+	}
+	for address := range current {
+		if !wanted[address] {
+			if err = Router.RemoveRoute(a.Name, address); err != nil {
+				return err
+			}
+		}
+	}
+	addr, err := Router.Addr(a.Name)
+	if err != nil {
+		return err
+	}
+	a.Ip = addr
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/router"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+)
+
+func (s *S) TestAddCName(c *C) {
+	a := App{Name: "ktulu"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = a.AddCName("ktulu.mycompany.com")
+	c.Assert(err, IsNil)
+	c.Assert(a.CName, DeepEquals, []string{"ktulu.mycompany.com"})
+	c.Assert(s.router.HasCName("ktulu.mycompany.com", "ktulu"), Equals, true)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.CName, DeepEquals, []string{"ktulu.mycompany.com"})
+}
+
+func (s *S) TestAddCNameUsedByAnotherApp(c *C) {
+	a := App{Name: "ktulu"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	b := App{Name: "orion"}
+	err = db.Session.Apps().Insert(b)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": b.Name})
+	err = a.AddCName("ktulu.mycompany.com")
+	c.Assert(err, IsNil)
+	err = b.AddCName("ktulu.mycompany.com")
+	c.Assert(err, Equals, router.ErrCNameExists)
+}
+
+func (s *S) TestAddCNameValidatesTheDomain(c *C) {
+	a := App{Name: "ktulu"}
+	for _, cname := range []string{"", "ktulu", "-ktulu.com", "ktulu..com", "Ktulu.com", "ktulu.com/path"} {
+		err := a.AddCName(cname)
+		c.Assert(err, NotNil)
+		_, ok := err.(*ValidationError)
+		c.Assert(ok, Equals, true)
+	}
+}
+
+func (s *S) TestAddCNameWithoutRouter(c *C) {
+	Router = nil
+	defer func() { Router = s.router }()
+	a := App{Name: "ktulu"}
+	err := a.AddCName("ktulu.mycompany.com")
+	c.Assert(err, Equals, errNoRouter)
+}
+
+func (s *S) TestRemoveCName(c *C) {
+	a := App{Name: "ktulu"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = a.AddCName("ktulu.mycompany.com")
+	c.Assert(err, IsNil)
+	err = a.RemoveCName("ktulu.mycompany.com")
+	c.Assert(err, IsNil)
+	c.Assert(a.CName, HasLen, 0)
+	c.Assert(s.router.HasCName("ktulu.mycompany.com", "ktulu"), Equals, false)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.CName, HasLen, 0)
+}
+
+func (s *S) TestRemoveUnknownCName(c *C) {
+	s.router.AddBackend("ktulu")
+	a := App{Name: "ktulu"}
+	err := a.RemoveCName("ktulu.mycompany.com")
+	c.Assert(err, Equals, router.ErrCNameNotFound)
+}
+
+func (s *S) TestSyncRoutes(c *C) {
+	s.router.AddBackend("ktulu")
+	s.router.AddRoute("ktulu", "10.10.10.9")
+	a := App{
+		Name: "ktulu",
+		Units: []Unit{
+			{Name: "ktulu/0", Ip: "10.10.10.10", State: string(provision.StatusStarted)},
+			{Name: "ktulu/1", Ip: "10.10.10.11", State: string(provision.StatusPending)},
+			{Name: "ktulu/2", Ip: "", State: string(provision.StatusStarted)},
+		},
+	}
+	err := a.SyncRoutes()
+	c.Assert(err, IsNil)
+	routes, err := s.router.Routes("ktulu")
+	c.Assert(err, IsNil)
+	c.Assert(routes, DeepEquals, []string{"10.10.10.10"})
+	c.Assert(a.Ip, Equals, "ktulu.fakerouter.com")
+}
+
+func (s *S) TestSyncRoutesRegistersAppsCreatedBeforeTheRouter(c *C) {
+	a := App{
+		Name:  "ktulu",
+		Units: []Unit{{Name: "ktulu/0", Ip: "10.10.10.10", State: string(provision.StatusStarted)}},
+	}
+	err := a.SyncRoutes()
+	c.Assert(err, IsNil)
+	c.Assert(s.router.HasRoute("ktulu", "10.10.10.10"), Equals, true)
+}
+
+func (s *S) TestSyncRoutesWithoutRouter(c *C) {
+	Router = nil
+	defer func() { Router = s.router }()
+	a := App{
+		Name:  "ktulu",
+		Ip:    "10.10.10.10",
+		Units: []Unit{{Name: "ktulu/0", Ip: "10.10.10.10", State: string(provision.StatusStarted)}},
+	}
+	err := a.SyncRoutes()
+	c.Assert(err, IsNil)
+	c.Assert(a.Ip, Equals, "10.10.10.10")
+}
@@ -197,8 +197,14 @@ func createBucket(app *App) (*s3Env, error) {
 func destroyBucket(app *App) error {
 	appName := strings.ToLower(app.Name)
 	env := app.InstanceEnv(s3InstanceName)
-	accessKeyId := env["TSURU_S3_ACCESS_KEY_ID"].Value
-	bucketName := env["TSURU_S3_BUCKET"].Value
+	accessKeyId, err := decryptValue(env["TSURU_S3_ACCESS_KEY_ID"].Value)
+	if err != nil {
+		return err
+	}
+	bucketName, err := decryptValue(env["TSURU_S3_BUCKET"].Value)
+	if err != nil {
+		return err
+	}
 	policyName := fmt.Sprintf("app-%s-bucket", appName)
 	s3Endpoint := getS3Endpoint()
 	iamEndpoint := getIAMEndpoint()
@@ -212,6 +218,13 @@ func destroyBucket(app *App) error {
 	if _, err := iamEndpoint.DeleteAccessKey(accessKeyId, appName); err != nil {
 		return err
 	}
-	_, err := iamEndpoint.DeleteUser(appName)
+	// IAM users can't be deleted while they own keys, so the key replaced
+	// by a pending rotation is deleted too, see RotateStorageKeys.
+	if app.OldStorageKey != "" {
+		if _, err := iamEndpoint.DeleteAccessKey(app.OldStorageKey, appName); err != nil {
+			return err
+		}
+	}
+	_, err = iamEndpoint.DeleteUser(appName)
 	return err
 }
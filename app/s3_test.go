@@ -97,8 +97,9 @@ func (s *S) TestDestroyBucket(c *C) {
 	ts := s.t.StartGandalfTestServer(&h)
 	defer ts.Close()
 	app := App{
-		Name:  "battery",
-		Units: []Unit{{Machine: 1}},
+		Name:      "battery",
+		Framework: "django",
+		Units:     []Unit{{Machine: 1}},
 	}
 	bucket := fmt.Sprintf("battery%x", patchRandomReader())
 	defer unpatchRandomReader()
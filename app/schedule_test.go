@@ -0,0 +1,56 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestParseScheduleErrors(c *C) {
+	var tests = []struct {
+		spec string
+		err  string
+	}{
+		{"* * * *", `^Invalid schedule "\* \* \* \*": expected 5 fields .*`},
+		{"60 * * * *", `^Invalid schedule "60 \* \* \* \*": the minute field must be between 0 and 59: "60".$`},
+		{"* * 0 * *", `^Invalid schedule "\* \* 0 \* \*": the day of month field must be between 1 and 31: "0".$`},
+		{"*/0 * * * *", `^Invalid schedule "\*/0 \* \* \* \*": invalid step in the minute field: "\*/0".$`},
+		{"* mon * * *", `^Invalid schedule "\* mon \* \* \*": invalid value in the hour field: "mon".$`},
+		{"* * * 5-2 *", `^Invalid schedule "\* \* \* 5-2 \*": the month field must be between 1 and 12: "5-2".$`},
+	}
+	for _, t := range tests {
+		_, err := parseSchedule(t.spec)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *S) TestScheduleNext(c *C) {
+	base := time.Date(2013, time.March, 14, 10, 32, 45, 0, time.UTC)
+	var tests = []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2013, time.March, 14, 10, 33, 0, 0, time.UTC)},
+		{"*/10 * * * *", time.Date(2013, time.March, 14, 10, 40, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2013, time.March, 14, 10, 45, 0, 0, time.UTC)},
+		{"0,30 8-9 * * *", time.Date(2013, time.March, 15, 8, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2013, time.March, 14, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2013, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2013, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		// March 17, 2013 is a Sunday.
+		{"0 0 * * 7", time.Date(2013, time.March, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2013, time.March, 17, 0, 0, 0, 0, time.UTC)},
+		// Either the 20th or a Saturday.
+		{"0 0 20 * 6", time.Date(2013, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2016, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, t := range tests {
+		sched, err := parseSchedule(t.spec)
+		c.Assert(err, IsNil)
+		c.Check(sched.next(base), Equals, t.next)
+	}
+}
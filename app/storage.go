@@ -0,0 +1,357 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ObjectStorage provides the buckets of the apps. Each app gets its own
+// bucket, with credentials that grant access to that bucket only. The bucket
+// is exported to the app in the TSURU_S3_* environment variables.
+type ObjectStorage interface {
+	// CreateBucket creates the bucket of the app and its credentials.
+	CreateBucket(app *App) (*Bucket, error)
+
+	// DestroyBucket destroys the bucket of the app and its credentials.
+	DestroyBucket(app *App) error
+}
+
+// KeyRotator is an object storage that can replace the credentials of the
+// buckets, see App.RotateStorageKeys.
+//
+// Implementing this interface is optional.
+type KeyRotator interface {
+	ObjectStorage
+
+	// CreateKey creates new credentials for the bucket of the app. The
+	// current credentials keep working until they're deleted.
+	CreateKey(app *App) (accessKey, secretKey string, err error)
+
+	// DeleteKey deletes the given credentials of the bucket of the app.
+	DeleteKey(app *App, accessKey string) error
+}
+
+// Bucket is the bucket of an app, with the credentials the app uses to
+// access it.
+type Bucket struct {
+	Name               string
+	Endpoint           string
+	LocationConstraint bool
+	AccessKey          string
+	SecretKey          string
+}
+
+// Storage is the object storage of the apps. When it's nil, apps are created
+// without buckets.
+var Storage ObjectStorage = s3Storage{}
+
+var storages = map[string]ObjectStorage{
+	"s3":    s3Storage{},
+	"local": localStorage{},
+}
+
+// GetStorage returns the object storage with the given name. The name "none"
+// turns buckets off, and GetStorage returns nil for it.
+func GetStorage(name string) (ObjectStorage, error) {
+	if name == "none" {
+		return nil, nil
+	}
+	s, ok := storages[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown object storage: %q.", name)
+	}
+	return s, nil
+}
+
+// appBucket returns the bucket of the app, from its environment variables.
+// It returns nil if the app has no bucket.
+func appBucket(app *App) (*Bucket, error) {
+	env := app.InstanceEnv(s3InstanceName)
+	if _, ok := env["TSURU_S3_BUCKET"]; !ok {
+		return nil, nil
+	}
+	var (
+		b                  Bucket
+		locationConstraint string
+	)
+	values := map[string]*string{
+		"TSURU_S3_BUCKET":             &b.Name,
+		"TSURU_S3_ENDPOINT":           &b.Endpoint,
+		"TSURU_S3_LOCATIONCONSTRAINT": &locationConstraint,
+		"TSURU_S3_ACCESS_KEY_ID":      &b.AccessKey,
+		"TSURU_S3_SECRET_KEY":         &b.SecretKey,
+	}
+	for name, value := range values {
+		v, err := decryptValue(env[name].Value)
+		if err != nil {
+			return nil, err
+		}
+		*value = v
+	}
+	b.LocationConstraint = locationConstraint == "true"
+	return &b, nil
+}
+
+// s3Storage creates the buckets in Amazon S3, and their credentials in IAM.
+// See the aws settings in the configuration file.
+type s3Storage struct{}
+
+func (s3Storage) CreateBucket(app *App) (*Bucket, error) {
+	env, err := createBucket(app)
+	if err != nil {
+		return nil, err
+	}
+	return &Bucket{
+		Name:               env.bucket,
+		Endpoint:           env.endpoint,
+		LocationConstraint: env.locationConstraint,
+		AccessKey:          env.AccessKey,
+		SecretKey:          env.SecretKey,
+	}, nil
+}
+
+func (s3Storage) DestroyBucket(app *App) error {
+	return destroyBucket(app)
+}
+
+func (s3Storage) CreateKey(app *App) (string, string, error) {
+	resp, err := getIAMEndpoint().CreateAccessKey(strings.ToLower(app.Name))
+	if err != nil {
+		return "", "", err
+	}
+	return resp.AccessKey.Id, resp.AccessKey.Secret, nil
+}
+
+func (s3Storage) DeleteKey(app *App, accessKey string) error {
+	_, err := getIAMEndpoint().DeleteAccessKey(accessKey, strings.ToLower(app.Name))
+	return err
+}
+
+// localStorage keeps the buckets in a local directory, set in the
+// local-storage:path setting. Each bucket is a directory, named after the
+// app, and its credentials are stored next to it, in the file
+// <bucket>.credentials, so the server that exposes the directory to the units
+// can check them. The local-storage:endpoint setting is the address of this
+// server, and defaults to a file:// URL of the directory.
+//
+// It's meant for development environments, where there's no S3.
+type localStorage struct{}
+
+func (localStorage) root() (string, error) {
+	root, err := config.GetString("local-storage:path")
+	if err != nil {
+		return "", errors.New("local-storage:path must be defined in the configuration file.")
+	}
+	return root, nil
+}
+
+func (s localStorage) CreateBucket(app *App) (*Bucket, error) {
+	root, err := s.root()
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := config.GetString("local-storage:endpoint")
+	if err != nil {
+		endpoint = "file://" + root
+	}
+	b := Bucket{Name: strings.ToLower(app.Name), Endpoint: endpoint}
+	if b.AccessKey, err = newUUID(); err != nil {
+		return nil, err
+	}
+	if b.SecretKey, err = newUUID(); err != nil {
+		return nil, err
+	}
+	dir := path.Join(root, b.Name)
+	if err = filesystem().MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := filesystem().OpenFile(dir+".credentials", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err == nil {
+		err = json.NewEncoder(f).Encode(map[string]string{"AccessKey": b.AccessKey, "SecretKey": b.SecretKey})
+		f.Close()
+	}
+	if err != nil {
+		filesystem().RemoveAll(dir)
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (s localStorage) DestroyBucket(app *App) error {
+	root, err := s.root()
+	if err != nil {
+		return err
+	}
+	b, err := appBucket(app)
+	if err != nil || b == nil {
+		return err
+	}
+	dir := path.Join(root, b.Name)
+	if err = filesystem().RemoveAll(dir); err != nil {
+		return err
+	}
+	err = filesystem().Remove(dir + ".credentials")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// apprcTimeout is how long the rotation of the storage keys waits for the
+// new credentials to be written to the units of the app.
+var apprcTimeout = 5 * time.Minute
+
+var apprcPollInterval = time.Second
+
+// RotateStorageKeys replaces the credentials of the bucket of the app. New
+// credentials are created and exported to the app through the queue, and the
+// old ones are deleted once they've been written to all units of the app, so
+// the units are never left with invalid credentials.
+//
+// If the units aren't updated within five minutes, RotateStorageKeys fails
+// and the old credentials are recorded in OldStorageKey, to be deleted as
+// soon as the new ones are written to all units, see saveApprcVersion. Apps
+// without units are updated at once.
+func (a *App) RotateStorageKeys() error {
+	if err := a.checkRotateStorageKeys(); err != nil {
+		return err
+	}
+	return newPipeline("rotate-storage-keys", &pipelineContext{App: a}).Execute()
+}
+
+// StartRotateStorageKeys starts the rotation of the storage keys of the app
+// in background, returning the operation that tracks the progress. The steps
+// of the rotation are the same described in RotateStorageKeys.
+func (a *App) StartRotateStorageKeys(user string) (*Operation, error) {
+	if err := a.checkRotateStorageKeys(); err != nil {
+		return nil, err
+	}
+	return startOperation("rotate-storage-keys", user, &pipelineContext{App: a})
+}
+
+// checkRotateStorageKeys checks that the storage keys of the app can be
+// rotated: the object storage must support it, the app must have a bucket,
+// must not be in maintenance and the old key of a previous rotation must
+// have been deleted.
+func (a *App) checkRotateStorageKeys() error {
+	if _, ok := Storage.(KeyRotator); !ok {
+		return &ValidationError{Message: "The object storage doesn't support rotating keys."}
+	}
+	if err := a.CheckMaintenance(false); err != nil {
+		return err
+	}
+	b, err := appBucket(a)
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		return &ValidationError{Message: fmt.Sprintf("The app %q doesn't have a bucket.", a.Name)}
+	}
+	if a.OldStorageKey != "" {
+		msg := fmt.Sprintf("The previous storage keys of the app %q weren't written to all units yet. Try again later.", a.Name)
+		return &ValidationError{Message: msg}
+	}
+	return nil
+}
+
+// exportStorageKey creates new credentials for the bucket of the app and
+// exports them to the app, recording the replaced access key in
+// OldStorageKey. The new credentials are deleted if they can't be exported.
+func (a *App) exportStorageKey() error {
+	rotator, ok := Storage.(KeyRotator)
+	if !ok {
+		return &ValidationError{Message: "The object storage doesn't support rotating keys."}
+	}
+	old, err := appBucket(a)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return &ValidationError{Message: fmt.Sprintf("The app %q doesn't have a bucket.", a.Name)}
+	}
+	accessKey, secretKey, err := rotator.CreateKey(a)
+	if err != nil {
+		return err
+	}
+	envs := []bind.EnvVar{
+		{Name: "TSURU_S3_ACCESS_KEY_ID", Value: accessKey, InstanceName: s3InstanceName},
+		{Name: "TSURU_S3_SECRET_KEY", Value: secretKey, InstanceName: s3InstanceName},
+	}
+	if err = a.SetEnvsToApp(envs, false, true, ""); err != nil {
+		rotator.DeleteKey(a, accessKey)
+		return err
+	}
+	a.OldStorageKey = old.AccessKey
+	a.OldStorageKeyVersion = a.EnvVersion
+	update := bson.M{"$set": bson.M{"oldstoragekey": a.OldStorageKey, "oldstoragekeyversion": a.OldStorageKeyVersion}}
+	return db.Session.Apps().Update(bson.M{"name": a.Name}, update)
+}
+
+// deleteOldStorageKey deletes the storage key replaced by RotateStorageKeys,
+// once the version of the variables that replaced it is written to all units
+// of the app. Apps without a pending key are ignored.
+//
+// The key is claimed in the database before being deleted, so concurrent
+// calls don't delete it twice, and is recorded again if it can't be deleted.
+func deleteOldStorageKey(appName string) error {
+	rotator, ok := Storage.(KeyRotator)
+	if !ok {
+		return nil
+	}
+	var a App
+	if err := db.Session.Apps().Find(bson.M{"name": appName}).One(&a); err != nil {
+		return err
+	}
+	if a.OldStorageKey == "" || (len(a.Units) > 0 && a.ApprcVersion < a.OldStorageKeyVersion) {
+		return nil
+	}
+	query := bson.M{"name": a.Name, "oldstoragekey": a.OldStorageKey}
+	update := bson.M{"$set": bson.M{"oldstoragekey": "", "oldstoragekeyversion": 0}}
+	err := db.Session.Apps().Update(query, update)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = rotator.DeleteKey(&a, a.OldStorageKey); err != nil {
+		update = bson.M{"$set": bson.M{"oldstoragekey": a.OldStorageKey, "oldstoragekeyversion": a.OldStorageKeyVersion}}
+		db.Session.Apps().Update(bson.M{"name": a.Name, "oldstoragekey": ""}, update)
+		return err
+	}
+	return nil
+}
+
+// waitApprc waits until the given version of the variables of the app is
+// written to all of its units.
+func (a *App) waitApprc(version int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var app App
+		err := db.Session.Apps().Find(bson.M{"name": a.Name}).One(&app)
+		if err != nil {
+			return err
+		}
+		if app.ApprcVersion >= version {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for the new credentials to be written to the units of the app %q. The old credentials will be deleted once they are.", a.Name)
+		}
+		time.Sleep(apprcPollInterval)
+	}
+}
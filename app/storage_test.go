@@ -0,0 +1,282 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/json"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	fsTesting "github.com/globocom/tsuru/fs/testing"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/queue"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestGetStorage(c *C) {
+	storage, err := GetStorage("s3")
+	c.Assert(err, IsNil)
+	c.Assert(storage, FitsTypeOf, s3Storage{})
+	storage, err = GetStorage("local")
+	c.Assert(err, IsNil)
+	c.Assert(storage, FitsTypeOf, localStorage{})
+	storage, err = GetStorage("none")
+	c.Assert(err, IsNil)
+	c.Assert(storage, IsNil)
+	_, err = GetStorage("dropbox")
+	c.Assert(err, ErrorMatches, `^Unknown object storage: "dropbox".$`)
+}
+
+func (s *S) TestLocalStorageCreateBucket(c *C) {
+	rfs := &fsTesting.RecordingFs{FileContent: "0123456789abcdef"}
+	fsystem = rfs
+	defer func() { fsystem = s.rfs }()
+	config.Set("local-storage:path", "/var/lib/tsuru/buckets")
+	defer config.Unset("local-storage")
+	bucket, err := localStorage{}.CreateBucket(&App{Name: "myApp"})
+	c.Assert(err, IsNil)
+	c.Assert(bucket.Name, Equals, "myapp")
+	c.Assert(bucket.Endpoint, Equals, "file:///var/lib/tsuru/buckets")
+	c.Assert(bucket.AccessKey, Equals, "30313233343536373839616263646566")
+	c.Assert(bucket.SecretKey, Equals, bucket.AccessKey)
+	c.Assert(rfs.HasAction("mkdirall /var/lib/tsuru/buckets/myapp with mode 0755"), Equals, true)
+	c.Assert(rfs.HasAction("openfile /var/lib/tsuru/buckets/myapp.credentials with mode 0600"), Equals, true)
+	f, err := rfs.Open("/var/lib/tsuru/buckets/myapp.credentials")
+	c.Assert(err, IsNil)
+	var credentials map[string]string
+	err = json.NewDecoder(f).Decode(&credentials)
+	c.Assert(err, IsNil)
+	c.Assert(credentials["AccessKey"], Equals, bucket.AccessKey)
+	c.Assert(credentials["SecretKey"], Equals, bucket.SecretKey)
+}
+
+func (s *S) TestLocalStorageCreateBucketUsesTheConfiguredEndpoint(c *C) {
+	rfs := &fsTesting.RecordingFs{FileContent: "0123456789abcdef"}
+	fsystem = rfs
+	defer func() { fsystem = s.rfs }()
+	config.Set("local-storage:path", "/var/lib/tsuru/buckets")
+	config.Set("local-storage:endpoint", "http://storage.tsuru.io")
+	defer config.Unset("local-storage")
+	bucket, err := localStorage{}.CreateBucket(&App{Name: "myapp"})
+	c.Assert(err, IsNil)
+	c.Assert(bucket.Endpoint, Equals, "http://storage.tsuru.io")
+}
+
+func (s *S) TestLocalStorageWithoutPath(c *C) {
+	_, err := localStorage{}.CreateBucket(&App{Name: "myapp"})
+	c.Assert(err, ErrorMatches, "^local-storage:path must be defined in the configuration file.$")
+}
+
+func (s *S) TestLocalStorageDestroyBucket(c *C) {
+	rfs := &fsTesting.RecordingFs{}
+	fsystem = rfs
+	defer func() { fsystem = s.rfs }()
+	config.Set("local-storage:path", "/var/lib/tsuru/buckets")
+	defer config.Unset("local-storage")
+	a := App{Name: "myapp", Env: map[string]bind.EnvVar{
+		"TSURU_S3_BUCKET": {Name: "TSURU_S3_BUCKET", Value: "myapp", InstanceName: s3InstanceName},
+	}}
+	err := localStorage{}.DestroyBucket(&a)
+	c.Assert(err, IsNil)
+	c.Assert(rfs.HasAction("removeall /var/lib/tsuru/buckets/myapp"), Equals, true)
+	c.Assert(rfs.HasAction("remove /var/lib/tsuru/buckets/myapp.credentials"), Equals, true)
+}
+
+func (s *S) TestCreateBucketForwardWithoutStorage(c *C) {
+	Storage = nil
+	defer func() { Storage = s3Storage{} }()
+	config.Set("host", "localhost")
+	a := App{Name: "nobucket", Framework: "django"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	err = createBucketIam.forward(&pipelineContext{App: &a})
+	c.Assert(err, IsNil)
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.InstanceEnv(s3InstanceName), HasLen, 0)
+	env := a.InstanceEnv("")
+	c.Assert(env["APPNAME"].Value, Equals, a.Name)
+	c.Assert(env["TSURU_HOST"].Value, Equals, "localhost")
+}
+
+func (s *S) TestDestroyBucketForwardSkipsAppsWithoutBucket(c *C) {
+	a := App{Name: "nobucket"}
+	err := destroyBucketIam.forward(&pipelineContext{App: &a})
+	c.Assert(err, IsNil)
+	Storage = nil
+	defer func() { Storage = s3Storage{} }()
+	a.Env = map[string]bind.EnvVar{
+		"TSURU_S3_BUCKET": {Name: "TSURU_S3_BUCKET", Value: "nobucket", InstanceName: s3InstanceName},
+	}
+	err = destroyBucketIam.forward(&pipelineContext{App: &a})
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestAppBucketDecryptsTheVariables(c *C) {
+	config.Set("env-encryption:key", "current")
+	defer config.Unset("env-encryption")
+	a := App{Name: "encrypted", Env: map[string]bind.EnvVar{}}
+	for name, value := range map[string]string{
+		"TSURU_S3_BUCKET":             "encrypted",
+		"TSURU_S3_LOCATIONCONSTRAINT": "true",
+		"TSURU_S3_SECRET_KEY":         "secret",
+	} {
+		encrypted, err := encryptValue(value)
+		c.Assert(err, IsNil)
+		a.Env[name] = bind.EnvVar{Name: name, Value: encrypted, InstanceName: s3InstanceName}
+	}
+	b, err := appBucket(&a)
+	c.Assert(err, IsNil)
+	c.Assert(b.Name, Equals, "encrypted")
+	c.Assert(b.LocationConstraint, Equals, true)
+	c.Assert(b.SecretKey, Equals, "secret")
+}
+
+// bucketApp creates the bucket of an app in the fake S3 and IAM servers, and
+// returns the app with the variables of the bucket, saved in the database.
+func (s *S) bucketApp(c *C, name string) App {
+	a := App{
+		Name:  name,
+		State: string(provision.StatusStarted),
+		Units: []Unit{{Name: name + "/0"}},
+	}
+	bucket, err := Storage.CreateBucket(&a)
+	c.Assert(err, IsNil)
+	a.Env = map[string]bind.EnvVar{
+		"TSURU_S3_BUCKET":        {Name: "TSURU_S3_BUCKET", Value: bucket.Name, InstanceName: s3InstanceName},
+		"TSURU_S3_ACCESS_KEY_ID": {Name: "TSURU_S3_ACCESS_KEY_ID", Value: bucket.AccessKey, InstanceName: s3InstanceName},
+		"TSURU_S3_SECRET_KEY":    {Name: "TSURU_S3_SECRET_KEY", Value: bucket.SecretKey, InstanceName: s3InstanceName},
+	}
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	return a
+}
+
+func (s *S) accessKeys(c *C, userName string) []string {
+	resp, err := getIAMEndpoint().AccessKeys(userName)
+	c.Assert(err, IsNil)
+	keys := make([]string, len(resp.AccessKeys))
+	for i, k := range resp.AccessKeys {
+		keys[i] = k.Id
+	}
+	return keys
+}
+
+func (s *S) TestRotateStorageKeys(c *C) {
+	server := testing.FakeQueueServer{}
+	server.Start("127.0.0.1:0")
+	defer server.Stop()
+	config.Set("queue-server", server.Addr())
+	apprcPollInterval = 10 * time.Millisecond
+	defer func() { apprcPollInterval = time.Second }()
+	a := s.bucketApp(c, "rotating")
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer destroyBucket(&a)
+	old := a.Env["TSURU_S3_ACCESS_KEY_ID"].Value
+	s.provisioner.PrepareOutput(nil)
+	// The collector writes the apprc file when it receives the message.
+	go func() {
+		for len(server.Messages()) == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		var written App
+		db.Session.Apps().Find(bson.M{"name": a.Name}).One(&written)
+		written.WriteApprc()
+	}()
+	err := a.RotateStorageKeys()
+	c.Assert(err, IsNil)
+	c.Assert(server.Messages(), DeepEquals, []queue.Message{{Action: RegenerateApprc, Args: []string{a.Name}}})
+	err = a.Get()
+	c.Assert(err, IsNil)
+	accessKey, err := decryptValue(a.Env["TSURU_S3_ACCESS_KEY_ID"].Value)
+	c.Assert(err, IsNil)
+	c.Assert(accessKey, Not(Equals), old)
+	c.Assert(s.accessKeys(c, "rotating"), DeepEquals, []string{accessKey})
+}
+
+func (s *S) TestRotateStorageKeysDeletesTheOldKeyWhenTheUnitsAreUpdated(c *C) {
+	server := testing.FakeQueueServer{}
+	server.Start("127.0.0.1:0")
+	defer server.Stop()
+	config.Set("queue-server", server.Addr())
+	apprcTimeout = 50 * time.Millisecond
+	apprcPollInterval = 10 * time.Millisecond
+	defer func() {
+		apprcTimeout = 5 * time.Minute
+		apprcPollInterval = time.Second
+	}()
+	a := s.bucketApp(c, "stale")
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer destroyBucket(&a)
+	old := a.Env["TSURU_S3_ACCESS_KEY_ID"].Value
+	err := a.RotateStorageKeys()
+	c.Assert(err, ErrorMatches, `^Timed out waiting for the new credentials .* The old credentials will be deleted once they are.$`)
+	c.Assert(s.accessKeys(c, "stale"), HasLen, 2)
+	var written App
+	err = db.Session.Apps().Find(bson.M{"name": a.Name}).One(&written)
+	c.Assert(err, IsNil)
+	c.Assert(written.OldStorageKey, Equals, old)
+	c.Assert(written.OldStorageKeyVersion, Equals, written.EnvVersion)
+	s.provisioner.PrepareOutput(nil)
+	_, err = written.WriteApprc()
+	c.Assert(err, IsNil)
+	err = written.Get()
+	c.Assert(err, IsNil)
+	c.Assert(written.OldStorageKey, Equals, "")
+	accessKey, err := decryptValue(written.Env["TSURU_S3_ACCESS_KEY_ID"].Value)
+	c.Assert(err, IsNil)
+	c.Assert(s.accessKeys(c, "stale"), DeepEquals, []string{accessKey})
+}
+
+func (s *S) TestRotateStorageKeysWithAPendingOldKey(c *C) {
+	a := s.bucketApp(c, "pending")
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	defer destroyBucket(&a)
+	a.OldStorageKey = "old"
+	err := a.RotateStorageKeys()
+	c.Assert(err, FitsTypeOf, &ValidationError{})
+	c.Assert(err, ErrorMatches, `^The previous storage keys of the app "pending" weren't written to all units yet. Try again later.$`)
+	c.Assert(s.accessKeys(c, "pending"), HasLen, 1)
+}
+
+func (s *S) TestDestroyBucketWithAPendingRotation(c *C) {
+	a := s.bucketApp(c, "pending-removal")
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	accessKey, secretKey, err := s3Storage{}.CreateKey(&a)
+	c.Assert(err, IsNil)
+	a.OldStorageKey = a.Env["TSURU_S3_ACCESS_KEY_ID"].Value
+	a.Env["TSURU_S3_ACCESS_KEY_ID"] = bind.EnvVar{Name: "TSURU_S3_ACCESS_KEY_ID", Value: accessKey, InstanceName: s3InstanceName}
+	a.Env["TSURU_S3_SECRET_KEY"] = bind.EnvVar{Name: "TSURU_S3_SECRET_KEY", Value: secretKey, InstanceName: s3InstanceName}
+	err = destroyBucket(&a)
+	c.Assert(err, IsNil)
+	_, err = getIAMEndpoint().AccessKeys("pending-removal")
+	c.Assert(err, NotNil)
+}
+
+func (s *S) TestRotateStorageKeysWithoutBucket(c *C) {
+	a := App{Name: "nobucket"}
+	err := a.RotateStorageKeys()
+	c.Assert(err, FitsTypeOf, &ValidationError{})
+	c.Assert(err, ErrorMatches, `^The app "nobucket" doesn't have a bucket.$`)
+}
+
+func (s *S) TestRotateStorageKeysNotSupported(c *C) {
+	Storage = localStorage{}
+	defer func() { Storage = s3Storage{} }()
+	a := App{Name: "local"}
+	err := a.RotateStorageKeys()
+	c.Assert(err, FitsTypeOf, &ValidationError{})
+	c.Assert(err, ErrorMatches, "^The object storage doesn't support rotating keys.$")
+}
+
+func (s *S) TestRotateStorageKeysInMaintenance(c *C) {
+	a := App{Name: "tilt", Maintenance: true}
+	err := a.RotateStorageKeys()
+	c.Assert(err, Equals, ErrAppInMaintenance)
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/globocom/tsuru/api/auth"
 	"github.com/globocom/tsuru/db"
 	fsTesting "github.com/globocom/tsuru/fs/testing"
+	"github.com/globocom/tsuru/provision/provisiontest"
+	"github.com/globocom/tsuru/router/routertest"
 	tsuruTesting "github.com/globocom/tsuru/testing"
 	"io"
 	"labix.org/v2/mgo/bson"
@@ -28,7 +30,8 @@ type S struct {
 	admin       *auth.User
 	rfs         *fsTesting.RecordingFs
 	t           *tsuruTesting.T
-	provisioner *tsuruTesting.FakeProvisioner
+	provisioner *provisiontest.FakeProvisioner
+	router      *routertest.FakeRouter
 }
 
 var _ = Suite(&S{})
@@ -84,8 +87,18 @@ func (s *S) SetUpSuite(c *C) {
 	s.createUserAndTeam(c)
 	s.t.StartAmzS3AndIAM(c)
 	s.t.SetGitConfs(c)
-	s.provisioner = tsuruTesting.NewFakeProvisioner()
+	s.provisioner = provisiontest.NewFakeProvisioner()
 	Provisioner = s.provisioner
+	s.router = routertest.NewFakeRouter()
+	Router = s.router
+	s.createPlatforms(c)
+}
+
+func (s *S) createPlatforms(c *C) {
+	for _, name := range []string{"django", "golang", "gotthard", "python", "ruby", "vougan"} {
+		err := db.Session.Platforms().Insert(Platform{Name: name, Enabled: true})
+		c.Assert(err, IsNil)
+	}
 }
 
 func (s *S) TearDownSuite(c *C) {
@@ -99,6 +112,7 @@ func (s *S) TearDownSuite(c *C) {
 func (s *S) TearDownTest(c *C) {
 	s.t.RollbackGitConfs(c)
 	s.provisioner.Reset()
+	s.router.Reset()
 }
 
 func (s *S) getTestData(p ...string) io.ReadCloser {
@@ -14,6 +14,7 @@ type Unit struct {
 	Machine int
 	Ip      string
 	State   string
+	Process string
 	app     *App
 }
 
@@ -32,3 +33,12 @@ func (u *Unit) GetIp() string {
 func (u *Unit) GetStatus() provision.Status {
 	return provision.Status(u.State)
 }
+
+// GetProcess returns the process type that the unit runs. Units created
+// before apps could declare process types run the DefaultProcess.
+func (u *Unit) GetProcess() string {
+	if u.Process == "" {
+		return provision.DefaultProcess
+	}
+	return u.Process
+}
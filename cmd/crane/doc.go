@@ -215,6 +215,25 @@ Here is an example of usage:
 You can use "crane template" to generate a template. Both id and production
 endpoint are required fields.
 
+The optional field api-version sets the version of the services API
+implemented by the service. It defaults to 1, and the latest version is 2:
+
+	api-version: 2
+
+The optional field plans declares the plans of the service, which application
+developers choose when creating instances. A plan can be restricted to some
+teams:
+
+	plans:
+	  - name: small
+	    description: 1GB of storage
+	  - name: big
+	    description: 10GB of storage
+	    teams: [admin]
+
+When the manifest doesn't declare plans, tsuru asks the service API for them,
+see the text "Services API Workflow".
+
 When creating a new service, crane will add all user's teams as administrator
 teams of the service.
 
@@ -226,7 +245,7 @@ Usage:
 	% crane update <manifest-file.yaml>
 
 Update will update a service using a manifest file. Currently, it's only
-possible to edit an endpoint, or add new endpoints. You need to be an
+possible to edit the endpoints, the API version and the plans. You need to be an
 administrator of the team to perform an update.
 
 
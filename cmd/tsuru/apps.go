@@ -5,6 +5,7 @@
 package tsuru
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/globocom/tsuru/cmd"
@@ -12,6 +13,9 @@ import (
 	"io/ioutil"
 	"launchpad.net/gnuflag"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -19,6 +23,29 @@ var AppName = gnuflag.String("app", "", "App name for running app related comman
 var LogLines = gnuflag.Int("lines", 10, "The number of log lines to display")
 var LogSource = gnuflag.String("source", "", "The log from the given source")
 
+// Filters of app-list.
+var (
+	NamePattern = gnuflag.String("name", "", "A regular expression matched against the names of the apps.")
+	Framework   = gnuflag.String("framework", "", "The platform of the apps.")
+	State       = gnuflag.String("state", "", "The state of the apps.")
+	TeamName    = gnuflag.String("team", "", "The team of the app.")
+	Tag         = gnuflag.String("tag", "", "Comma separated tags the apps must have.")
+	Limit       = gnuflag.Int("limit", 0, "The number of apps in a page, all apps by default.")
+	Page        = gnuflag.Int("page", 1, "The page of apps to display.")
+)
+
+// Force is used to change apps that are in maintenance mode.
+var Force = gnuflag.Bool("force", false, "Change the app even if it's in maintenance mode.")
+
+// forceQuery returns the query string that forces a change in an app in
+// maintenance mode, when --force is given.
+func forceQuery() string {
+	if *Force {
+		return "?force=true"
+	}
+	return ""
+}
+
 type AppInfo struct {
 	GuessingCommand
 }
@@ -60,18 +87,41 @@ func (c *AppInfo) Run(context *cmd.Context, client cmd.Doer) error {
 }
 
 type unit struct {
-	Name  string
-	Ip    string
-	State string
+	Name    string
+	Ip      string
+	State   string
+	Process string
+}
+
+// process returns the process type of the unit. Units created before apps
+// could declare process types run the web process.
+func (u *unit) process() string {
+	if u.Process == "" {
+		return "web"
+	}
+	return u.Process
+}
+
+type process struct {
+	Name    string
+	Command string
 }
 
 type app struct {
-	Name       string
-	Framework  string
-	Repository string
-	State      string
-	Teams      []string
-	Units      []unit
+	Name        string
+	Framework   string
+	Repository  string
+	State       string
+	Teams       []string
+	Units       []unit
+	Processes   []process
+	Plan        plan
+	Ip          string
+	CName       []string
+	Maintenance bool
+	Description string
+	Contact     string
+	Tags        []string
 }
 
 func (a *app) String() string {
@@ -82,19 +132,81 @@ Platform: %s
 Teams: %s
 `
 	teams := strings.Join(a.Teams, ", ")
-	units := cmd.NewTable()
-	units.Headers = cmd.Row([]string{"Unit", "Ip", "State"})
-	for _, unit := range a.Units {
-		units.AddRow(cmd.Row([]string{unit.Name, unit.Ip, unit.State}))
-	}
 	args := []interface{}{a.Name, a.State, a.Repository, a.Framework, teams}
-	if len(a.Units) > 0 {
+	if a.Maintenance {
+		format += "Maintenance: on\n"
+	}
+	if a.Description != "" {
+		format += "Description: %s\n"
+		args = append(args, a.Description)
+	}
+	if a.Contact != "" {
+		format += "Contact: %s\n"
+		args = append(args, a.Contact)
+	}
+	if len(a.Tags) > 0 {
+		format += "Tags: %s\n"
+		args = append(args, strings.Join(a.Tags, ", "))
+	}
+	if a.Plan.Name != "" {
+		format += "Plan: %s\n"
+		args = append(args, &a.Plan)
+	}
+	if a.Ip != "" {
+		format += "Address: %s\n"
+		args = append(args, a.Ip)
+	}
+	if len(a.CName) > 0 {
+		format += "CNames: %s\n"
+		args = append(args, strings.Join(a.CName, ", "))
+	}
+	processes := a.processNames()
+	if len(processes) == 1 && processes[0] == "web" {
 		format += "Units:\n%s"
-		args = append(args, units)
+		args = append(args, a.unitTable("web"))
+	} else {
+		for _, p := range processes {
+			format += "Units [%s]:\n%s"
+			args = append(args, p, a.unitTable(p))
+		}
 	}
 	return fmt.Sprintf(format, args...)
 }
 
+// processNames returns the process types that have units, in the order they
+// are declared in the Procfile. Processes that are not declared anymore come
+// last.
+func (a *app) processNames() []string {
+	count := make(map[string]int)
+	for _, u := range a.Units {
+		count[u.process()]++
+	}
+	var names []string
+	for _, p := range a.Processes {
+		if count[p.Name] > 0 {
+			names = append(names, p.Name)
+			delete(count, p.Name)
+		}
+	}
+	var undeclared []string
+	for name := range count {
+		undeclared = append(undeclared, name)
+	}
+	sort.Strings(undeclared)
+	return append(names, undeclared...)
+}
+
+func (a *app) unitTable(process string) *cmd.Table {
+	units := cmd.NewTable()
+	units.Headers = cmd.Row([]string{"Unit", "Ip", "State"})
+	for _, unit := range a.Units {
+		if unit.process() == process {
+			units.AddRow(cmd.Row([]string{unit.Name, unit.Ip, unit.State}))
+		}
+	}
+	return units
+}
+
 func (c *AppInfo) Show(result []byte, context *cmd.Context) error {
 	var a app
 	err := json.Unmarshal(result, &a)
@@ -174,9 +286,10 @@ func (c *AppRevoke) Run(context *cmd.Context, client cmd.Doer) error {
 }
 
 type AppModel struct {
-	Name  string
-	State string
-	Ip    string
+	Name        string
+	State       string
+	Ip          string
+	Maintenance bool
 }
 
 type Units struct {
@@ -185,8 +298,38 @@ type Units struct {
 
 type AppList struct{}
 
+// listQuery returns the query string with the filters given to app-list.
+func listQuery() string {
+	query := make(url.Values)
+	for param, value := range map[string]string{
+		"name":      *NamePattern,
+		"framework": *Framework,
+		"state":     *State,
+		"team":      *TeamName,
+	} {
+		if value != "" {
+			query.Set(param, value)
+		}
+	}
+	for _, tag := range strings.Split(*Tag, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			query.Add("tag", tag)
+		}
+	}
+	if *Limit > 0 {
+		query.Set("limit", strconv.Itoa(*Limit))
+		if *Page > 1 {
+			query.Set("page", strconv.Itoa(*Page))
+		}
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
 func (c *AppList) Run(context *cmd.Context, client cmd.Doer) error {
-	request, err := http.NewRequest("GET", cmd.GetUrl("/apps"), nil)
+	request, err := http.NewRequest("GET", cmd.GetUrl("/apps")+listQuery(), nil)
 	if err != nil {
 		return err
 	}
@@ -214,17 +357,31 @@ func (c *AppList) Show(result []byte, context *cmd.Context) error {
 	table := cmd.NewTable()
 	table.Headers = cmd.Row([]string{"Application", "State", "Ip"})
 	for _, app := range apps {
-		table.AddRow(cmd.Row([]string{app.Name, app.State, app.Ip}))
+		state := app.State
+		if app.Maintenance {
+			state += " (maintenance)"
+		}
+		table.AddRow(cmd.Row([]string{app.Name, state, app.Ip}))
 	}
 	context.Stdout.Write(table.Bytes())
+	if *Limit > 0 && len(apps) == *Limit {
+		page := *Page
+		if page < 1 {
+			page = 1
+		}
+		fmt.Fprintf(context.Stdout, "Use --page %d to see more apps.\n", page+1)
+	}
 	return nil
 }
 
 func (c *AppList) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "app-list",
-		Usage: "app-list",
-		Desc:  "list all your apps.",
+		Usage: "app-list [--name pattern] [--framework name] [--state state] [--team name] [--tag tag1,tag2] [--limit n] [--page n]",
+		Desc: `list all your apps.
+
+The apps may be filtered by a regular expression matched against their names,
+by platform, state, team and tags. With --limit, apps are displayed in pages.`,
 	}
 }
 
@@ -264,3 +421,141 @@ If you don't provide the app name, tsuru will try to guess it.`,
 		MinArgs: 0,
 	}
 }
+
+type AppMaintenance struct {
+	GuessingCommand
+}
+
+func (c *AppMaintenance) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-maintenance",
+		Usage: "app-maintenance <on|off> [--app appname]",
+		Desc: `turns the maintenance mode of an app on or off.
+
+Deploys and changes in the environment variables of an app in maintenance mode
+are blocked, unless forced with --force. If you don't provide the app name,
+tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *AppMaintenance) Run(context *cmd.Context, client cmd.Doer) error {
+	mode := context.Args[0]
+	if mode != "on" && mode != "off" {
+		return fmt.Errorf(`Invalid maintenance mode %q, use "on" or "off".`, mode)
+	}
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/maintenance/%s", appName, mode))
+	request, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = client.Do(request); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Maintenance mode of the app %q turned %s.\n", appName, mode)
+	return nil
+}
+
+type AppStorageRotateKeys struct {
+	GuessingCommand
+}
+
+func (c *AppStorageRotateKeys) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-storage-rotate-keys",
+		Usage: "app-storage-rotate-keys [--app appname]",
+		Desc: `replaces the credentials of the bucket of an app.
+
+The new credentials are written to the TSURU_S3_* environment variables of all
+units, and only then the old credentials are deleted. If the units take longer
+than five minutes to be updated, the command fails and the old credentials are
+deleted as soon as they are. If you don't provide the app name, tsuru will try
+to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AppStorageRotateKeys) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/storage/rotate-keys", appName))
+	request, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var op map[string]string
+	if err = json.NewDecoder(response.Body).Decode(&op); err != nil {
+		return err
+	}
+	if err = WaitOperation(context, client, op["operation"]); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Storage keys of the app %q successfully rotated!\n", appName)
+	return nil
+}
+
+type AppUpdate struct {
+	GuessingCommand
+}
+
+func (c *AppUpdate) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-update",
+		Usage: "app-update <description|contact|tags> <value> [--app appname]",
+		Desc: `changes the description, the contact or the tags of an app.
+
+Tags are separated by commas, and replace the current tags of the app. An empty
+value clears the field. If you don't provide the app name, tsuru will try to
+guess it.`,
+		MinArgs: 2,
+	}
+}
+
+func (c *AppUpdate) Run(context *cmd.Context, client cmd.Doer) error {
+	field, value := context.Args[0], strings.Join(context.Args[1:], " ")
+	metadata := make(map[string]interface{})
+	switch field {
+	case "description", "contact":
+		metadata[field] = value
+	case "tags":
+		tags := []string{}
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		metadata[field] = tags
+	default:
+		return fmt.Errorf(`Invalid field %q, use "description", "contact" or "tags".`, field)
+	}
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/metadata", appName))
+	request, err := http.NewRequest("PUT", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if _, err = client.Do(request); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "The %s of the app %q was updated.\n", field, appName)
+	return nil
+}
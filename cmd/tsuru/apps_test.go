@@ -6,9 +6,12 @@ package tsuru
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
 	. "launchpad.net/gocheck"
 	"net/http"
+	"net/url"
 )
 
 func (s *S) TestAppInfo(c *C) {
@@ -41,6 +44,118 @@ Units:
 	c.Assert(stdout.String(), Equals, expected)
 }
 
+func (s *S) TestAppInfoShowsMaintenance(c *C) {
+	*AppName = "app1"
+	var stdout, stderr bytes.Buffer
+	result := `{"Name":"app1","Framework":"php","Repository":"git@git.com:php.git","State":"started","Maintenance":true,"Units":[{"Ip":"10.10.10.10","Name":"app1/0","State":"started"}],"Teams":["tsuruteam"]}`
+	expected := `Application: app1
+State: started
+Repository: git@git.com:php.git
+Platform: php
+Teams: tsuruteam
+Maintenance: on
+Units:
++--------+-------------+---------+
+| Unit   | Ip          | State   |
++--------+-------------+---------+
+| app1/0 | 10.10.10.10 | started |
++--------+-------------+---------+
+
+`
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	command := AppInfo{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestAppInfoShowsMetadata(c *C) {
+	*AppName = "app1"
+	var stdout, stderr bytes.Buffer
+	result := `{"Name":"app1","Framework":"php","Repository":"git@git.com:php.git","State":"started","Description":"The payments API","Contact":"payments@company.com","Tags":["api","payments"],"Units":[],"Teams":["tsuruteam"]}`
+	expected := `Application: app1
+State: started
+Repository: git@git.com:php.git
+Platform: php
+Teams: tsuruteam
+Description: The payments API
+Contact: payments@company.com
+Tags: api, payments
+`
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	command := AppInfo{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected+"\n")
+}
+
+func (s *S) TestAppInfoGroupsUnitsByProcess(c *C) {
+	*AppName = "app1"
+	var stdout, stderr bytes.Buffer
+	result := `{"Name":"app1","Framework":"python","Repository":"git@git.com:python.git","State":"started", "Units":[{"Ip":"10.10.10.10","Name":"app1/0","State":"started"}, {"Ip":"9.9.9.9","Name":"app1/1","State":"started","Process":"worker"}, {"Ip":"10.10.10.11","Name":"app1/2","State":"started","Process":"web"}, {"Ip":"","Name":"app1/3","State":"pending","Process":"clock"}],"Processes":[{"Name":"web","Command":"gunicorn app:app"},{"Name":"worker","Command":"celery worker"}],"Teams":["tsuruteam"]}`
+	expected := `Application: app1
+State: started
+Repository: git@git.com:python.git
+Platform: python
+Teams: tsuruteam
+Units [web]:
++--------+-------------+---------+
+| Unit   | Ip          | State   |
++--------+-------------+---------+
+| app1/0 | 10.10.10.10 | started |
+| app1/2 | 10.10.10.11 | started |
++--------+-------------+---------+
+Units [worker]:
++--------+---------+---------+
+| Unit   | Ip      | State   |
++--------+---------+---------+
+| app1/1 | 9.9.9.9 | started |
++--------+---------+---------+
+Units [clock]:
++--------+----+---------+
+| Unit   | Ip | State   |
++--------+----+---------+
+| app1/3 |    | pending |
++--------+----+---------+
+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	command := AppInfo{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestAppInfoWithCNames(c *C) {
+	*AppName = "app1"
+	var stdout, stderr bytes.Buffer
+	result := `{"Name":"app1","Framework":"php","Repository":"git@git.com:php.git","State":"dead","Teams":["tsuruteam"],"Ip":"app1.cloud.com","CName":["app1.com","www.app1.com"]}`
+	expected := `Application: app1
+State: dead
+Repository: git@git.com:php.git
+Platform: php
+Teams: tsuruteam
+Address: app1.cloud.com
+CNames: app1.com, www.app1.com
+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	command := AppInfo{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
+
 func (s *S) TestAppInfoNoUnits(c *C) {
 	*AppName = "app1"
 	var stdout, stderr bytes.Buffer
@@ -223,16 +338,74 @@ func (s *S) TestAppList(c *C) {
 	c.Assert(stdout.String(), Equals, expected)
 }
 
+func (s *S) TestAppListShowsMaintenance(c *C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Name":"app1","State":"started","Ip":"10.10.10.10","Maintenance":true}]`
+	expected := `+-------------+-----------------------+-------------+
+| Application | State                 | Ip          |
++-------------+-----------------------+-------------+
+| app1        | started (maintenance) | 10.10.10.10 |
++-------------+-----------------------+-------------+
+`
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	command := AppList{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
+
 func (s *S) TestAppListInfo(c *C) {
 	expected := &cmd.Info{
-		Name:    "app-list",
-		Usage:   "app-list",
-		Desc:    "list all your apps.",
+		Name:  "app-list",
+		Usage: "app-list [--name pattern] [--framework name] [--state state] [--team name] [--tag tag1,tag2] [--limit n] [--page n]",
+		Desc: `list all your apps.
+
+The apps may be filtered by a regular expression matched against their names,
+by platform, state, team and tags. With --limit, apps are displayed in pages.`,
 		MinArgs: 0,
 	}
 	c.Assert((&AppList{}).Info(), DeepEquals, expected)
 }
 
+func (s *S) TestAppListWithFilters(c *C) {
+	*Framework = "python"
+	*TeamName = "payments"
+	*Tag = "api, web"
+	*Limit = 1
+	*Page = 2
+	var stdout, stderr bytes.Buffer
+	result := `[{"Name":"app1","State":"started","Ip":"10.10.10.10"}]`
+	expected := `+-------------+---------+-------------+
+| Application | State   | Ip          |
++-------------+---------+-------------+
+| app1        | started | 10.10.10.10 |
++-------------+---------+-------------+
+Use --page 3 to see more apps.
+`
+	var query url.Values
+	trans := &conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			query = req.URL.Query()
+			return req.URL.Path == "/apps"
+		},
+	}
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&AppList{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+	want := url.Values{
+		"framework": []string{"python"},
+		"team":      []string{"payments"},
+		"tag":       []string{"api", "web"},
+		"limit":     []string{"1"},
+		"page":      []string{"2"},
+	}
+	c.Assert(query, DeepEquals, want)
+}
+
 func (s *S) TestAppRestart(c *C) {
 	*AppName = "handful_of_nothing"
 	var (
@@ -306,3 +479,111 @@ func (s *S) TestAppRestartIsACommand(c *C) {
 func (s *S) TestAppRestartIsAnInfoer(c *C) {
 	var _ cmd.Infoer = &AppRestart{}
 }
+
+func (s *S) TestAppMaintenanceInfo(c *C) {
+	info := (&AppMaintenance{}).Info()
+	c.Assert(info.Name, Equals, "app-maintenance")
+	c.Assert(info.Usage, Equals, "app-maintenance <on|off> [--app appname]")
+	c.Assert(info.MinArgs, Equals, 1)
+}
+
+func (s *S) TestAppMaintenance(c *C) {
+	*AppName = "tilt"
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Args: []string{"on"}, Stdout: &stdout, Stderr: &stderr}
+	trans := &conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "POST" && req.URL.Path == "/apps/tilt/maintenance/on"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&AppMaintenance{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Maintenance mode of the app "tilt" turned on.`+"\n")
+}
+
+func (s *S) TestAppMaintenanceInvalidMode(c *C) {
+	*AppName = "tilt"
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Args: []string{"maybe"}, Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: "", status: http.StatusOK}}, nil, manager)
+	err := (&AppMaintenance{}).Run(&context, client)
+	c.Assert(err, ErrorMatches, `^Invalid maintenance mode "maybe", use "on" or "off".$`)
+}
+
+func (s *S) TestAppStorageRotateKeysInfo(c *C) {
+	info := (&AppStorageRotateKeys{}).Info()
+	c.Assert(info.Name, Equals, "app-storage-rotate-keys")
+	c.Assert(info.Usage, Equals, "app-storage-rotate-keys [--app appname]")
+	c.Assert(info.MinArgs, Equals, 0)
+}
+
+func (s *S) TestAppStorageRotateKeys(c *C) {
+	old := PollInterval
+	PollInterval = 1e6
+	defer func() { PollInterval = old }()
+	*AppName = "tilt"
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	trans := sequentialTransport{msgs: []string{
+		`{"operation":"123"}`,
+		`{"Id":"123","Status":"succeeded","Steps":[{"Name":"create and export the new storage key","Status":"done"}]}`,
+	}}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := (&AppStorageRotateKeys{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(trans.requests, HasLen, 2)
+	c.Assert(trans.requests[0].Method, Equals, "POST")
+	c.Assert(trans.requests[0].URL.Path, Equals, "/apps/tilt/storage/rotate-keys")
+	c.Assert(trans.requests[1].URL.Path, Equals, "/operations/123")
+	expected := " ---> create and export the new storage key... done\n" + `Storage keys of the app "tilt" successfully rotated!` + "\n"
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestAppUpdateInfo(c *C) {
+	info := (&AppUpdate{}).Info()
+	c.Assert(info.Name, Equals, "app-update")
+	c.Assert(info.Usage, Equals, "app-update <description|contact|tags> <value> [--app appname]")
+	c.Assert(info.MinArgs, Equals, 2)
+}
+
+func (s *S) TestAppUpdate(c *C) {
+	var tests = []struct {
+		args []string
+		body string
+	}{
+		{[]string{"description", "The", "payments", "API"}, `{"description":"The payments API"}`},
+		{[]string{"contact", "payments@company.com"}, `{"contact":"payments@company.com"}`},
+		{[]string{"tags", "api, payments"}, `{"tags":["api","payments"]}`},
+		{[]string{"tags", ""}, `{"tags":[]}`},
+	}
+	for _, t := range tests {
+		var stdout, stderr bytes.Buffer
+		context := cmd.Context{Args: t.args, Stdout: &stdout, Stderr: &stderr}
+		var body string
+		trans := &conditionalTransport{
+			transport{msg: "", status: http.StatusOK},
+			func(req *http.Request) bool {
+				b, _ := ioutil.ReadAll(req.Body)
+				body = string(b)
+				return req.Method == "PUT" && req.URL.Path == "/apps/lilith/metadata"
+			},
+		}
+		client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+		command := AppUpdate{GuessingCommand{G: &FakeGuesser{name: "lilith"}}}
+		err := command.Run(&context, client)
+		c.Assert(err, IsNil)
+		c.Assert(body, Equals, t.body)
+		c.Assert(stdout.String(), Equals, fmt.Sprintf("The %s of the app \"lilith\" was updated.\n", t.args[0]))
+	}
+}
+
+func (s *S) TestAppUpdateInvalidField(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Args: []string{"owner", "me"}, Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: "", status: http.StatusOK}}, nil, manager)
+	command := AppUpdate{GuessingCommand{G: &FakeGuesser{name: "lilith"}}}
+	err := command.Run(&context, client)
+	c.Assert(err, ErrorMatches, `^Invalid field "owner", use "description", "contact" or "tags".$`)
+}
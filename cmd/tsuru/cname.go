@@ -0,0 +1,86 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"net/http"
+)
+
+type CNameAdd struct {
+	GuessingCommand
+}
+
+func (c *CNameAdd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "cname-add",
+		Usage: "cname-add <cname> [--app appname]",
+		Desc: `adds a custom domain to your app.
+
+The domain must be a CNAME pointing to the address of the app.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *CNameAdd) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	cname := context.Args[0]
+	b, err := json.Marshal(map[string]string{"cname": cname})
+	if err != nil {
+		return err
+	}
+	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/cname", appName))
+	request, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if _, err = client.Do(request); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "cname %q successfully added to the app %q.\n", cname, appName)
+	return nil
+}
+
+type CNameRemove struct {
+	GuessingCommand
+}
+
+func (c *CNameRemove) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "cname-remove",
+		Usage: "cname-remove <cname> [--app appname]",
+		Desc: `removes a custom domain from your app.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *CNameRemove) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	cname := context.Args[0]
+	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/cname/%s", appName, cname))
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = client.Do(request); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "cname %q successfully removed from the app %q.\n", cname, appName)
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestCNameAddInfo(c *C) {
+	info := (&CNameAdd{}).Info()
+	c.Assert(info.Name, Equals, "cname-add")
+	c.Assert(info.Usage, Equals, "cname-add <cname> [--app appname]")
+	c.Assert(info.MinArgs, Equals, 1)
+}
+
+func (s *S) TestCNameAdd(c *C) {
+	*AppName = "death"
+	var stdout, stderr bytes.Buffer
+	expected := `cname "death.evergrey.com" successfully added to the app "death".` + "\n"
+	context := cmd.Context{
+		Args:   []string{"death.evergrey.com"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	var body string
+	trans := &conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			b, _ := ioutil.ReadAll(req.Body)
+			body = string(b)
+			return req.Method == "POST" && req.URL.Path == "/apps/death/cname"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := CNameAdd{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+	c.Assert(body, Equals, `{"cname":"death.evergrey.com"}`)
+}
+
+func (s *S) TestCNameAddGuessesTheAppName(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"death.evergrey.com"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apps/inferno/cname"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := CNameAdd{GuessingCommand{G: &FakeGuesser{name: "inferno"}}}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestCNameAddFailure(c *C) {
+	*AppName = "death"
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"death.evergrey.com"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &transport{msg: "This cname is already used by another app.", status: http.StatusConflict}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := CNameAdd{}
+	err := command.Run(&context, client)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "This cname is already used by another app.")
+}
+
+func (s *S) TestCNameRemoveInfo(c *C) {
+	info := (&CNameRemove{}).Info()
+	c.Assert(info.Name, Equals, "cname-remove")
+	c.Assert(info.Usage, Equals, "cname-remove <cname> [--app appname]")
+	c.Assert(info.MinArgs, Equals, 1)
+}
+
+func (s *S) TestCNameRemove(c *C) {
+	*AppName = "death"
+	var stdout, stderr bytes.Buffer
+	expected := `cname "death.evergrey.com" successfully removed from the app "death".` + "\n"
+	context := cmd.Context{
+		Args:   []string{"death.evergrey.com"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "DELETE" && req.URL.Path == "/apps/death/cname/death.evergrey.com"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := CNameRemove{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
@@ -0,0 +1,169 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type cronRun struct {
+	Date       time.Time
+	Duration   time.Duration
+	ExitStatus int
+	Error      string
+}
+
+type cronJob struct {
+	Id       string
+	Schedule string
+	Command  string
+	History  []cronRun
+}
+
+type CronAdd struct {
+	GuessingCommand
+}
+
+func (c *CronAdd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "cron-add",
+		Usage: `cron-add "<schedule>" <command> [--app appname]`,
+		Desc: `schedules a command to run periodically in one unit of an app.
+
+The schedule has the five fields of crontab (minute, hour, day of month, month
+and day of week), or one of @hourly, @daily, @weekly, @monthly and @yearly.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 2,
+	}
+}
+
+func (c *CronAdd) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(map[string]string{
+		"schedule": context.Args[0],
+		"command":  strings.Join(context.Args[1:], " "),
+	})
+	if err != nil {
+		return err
+	}
+	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/cron", appName))
+	request, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var job cronJob
+	if err = json.NewDecoder(response.Body).Decode(&job); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Cron job %s successfully added to the app %q.\n", job.Id, appName)
+	return nil
+}
+
+type CronList struct {
+	GuessingCommand
+}
+
+func (c *CronList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "cron-list",
+		Usage: "cron-list [--app appname]",
+		Desc: `lists the cron jobs of an app, with the result of their last run.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *CronList) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", cmd.GetUrl(fmt.Sprintf("/apps/%s/cron", appName)), nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "The app has no cron jobs.")
+		return nil
+	}
+	var jobs []cronJob
+	if err = json.NewDecoder(response.Body).Decode(&jobs); err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Id", "Schedule", "Command", "Last run", "Duration", "Exit status"})
+	for _, job := range jobs {
+		lastRun, duration, status := "never", "", ""
+		if len(job.History) > 0 {
+			run := job.History[len(job.History)-1]
+			lastRun = run.Date.Format("2006-01-02 15:04:05")
+			duration = run.Duration.String()
+			status = strconv.Itoa(run.ExitStatus)
+			if run.ExitStatus < 0 {
+				status = "unknown"
+			}
+		}
+		table.AddRow(cmd.Row([]string{job.Id, job.Schedule, job.Command, lastRun, duration, status}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type CronRemove struct {
+	GuessingCommand
+}
+
+func (c *CronRemove) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "cron-remove",
+		Usage: "cron-remove <id> [--app appname]",
+		Desc: `removes a cron job from an app.
+
+Use cron-list to find the id of the job. If you don't provide the app name,
+tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *CronRemove) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	id := context.Args[0]
+	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/cron/%s", appName, id))
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = client.Do(request); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Cron job %s successfully removed from the app %q.\n", id, appName)
+	return nil
+}
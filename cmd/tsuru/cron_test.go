@@ -0,0 +1,133 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestCronAddInfo(c *C) {
+	info := (&CronAdd{}).Info()
+	c.Assert(info.Name, Equals, "cron-add")
+	c.Assert(info.Usage, Equals, `cron-add "<schedule>" <command> [--app appname]`)
+	c.Assert(info.MinArgs, Equals, 2)
+}
+
+func (s *S) TestCronAdd(c *C) {
+	*AppName = "leper"
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"*/10 * * * *", "python", "manage.py", "clearsessions"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	var body string
+	trans := &conditionalTransport{
+		transport{msg: `{"Id":"513f3a2e1b2d4c6f8a000001"}`, status: http.StatusOK},
+		func(req *http.Request) bool {
+			b, _ := ioutil.ReadAll(req.Body)
+			body = string(b)
+			return req.Method == "POST" && req.URL.Path == "/apps/leper/cron"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := CronAdd{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Cron job 513f3a2e1b2d4c6f8a000001 successfully added to the app "leper".`+"\n")
+	c.Assert(body, Equals, `{"command":"python manage.py clearsessions","schedule":"*/10 * * * *"}`)
+}
+
+func (s *S) TestCronAddFailure(c *C) {
+	*AppName = "leper"
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"every minute", "ls"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &transport{msg: `Invalid schedule "every minute".`, status: http.StatusBadRequest}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := CronAdd{}
+	err := command.Run(&context, client)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, `Invalid schedule "every minute".`)
+}
+
+func (s *S) TestCronListInfo(c *C) {
+	info := (&CronList{}).Info()
+	c.Assert(info.Name, Equals, "cron-list")
+	c.Assert(info.Usage, Equals, "cron-list [--app appname]")
+	c.Assert(info.MinArgs, Equals, 0)
+}
+
+func (s *S) TestCronList(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	result := `[{"Id":"513f3a2e1b2d4c6f8a000001","Schedule":"@daily","Command":"ls","History":null},
+{"Id":"513f3a2e1b2d4c6f8a000002","Schedule":"*/10 * * * *","Command":"false","History":[
+{"Date":"2013-03-12T10:20:00Z","Duration":1500000000,"ExitStatus":0},
+{"Date":"2013-03-12T10:30:00Z","Duration":2000000000,"ExitStatus":1,"Error":"exit status 1"}]}]`
+	trans := &conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/apps/leper/cron"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := CronList{GuessingCommand{G: &FakeGuesser{name: "leper"}}}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	expected := `+--------------------------+--------------+---------+---------------------+----------+-------------+
+| Id                       | Schedule     | Command | Last run            | Duration | Exit status |
++--------------------------+--------------+---------+---------------------+----------+-------------+
+| 513f3a2e1b2d4c6f8a000001 | @daily       | ls      | never               |          |             |
+| 513f3a2e1b2d4c6f8a000002 | */10 * * * * | false   | 2013-03-12 10:30:00 | 2s       | 1           |
++--------------------------+--------------+---------+---------------------+----------+-------------+
+`
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestCronListWithoutJobs(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	trans := &transport{msg: "", status: http.StatusNoContent}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := CronList{GuessingCommand{G: &FakeGuesser{name: "leper"}}}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "The app has no cron jobs.\n")
+}
+
+func (s *S) TestCronRemoveInfo(c *C) {
+	info := (&CronRemove{}).Info()
+	c.Assert(info.Name, Equals, "cron-remove")
+	c.Assert(info.Usage, Equals, "cron-remove <id> [--app appname]")
+	c.Assert(info.MinArgs, Equals, 1)
+}
+
+func (s *S) TestCronRemove(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"513f3a2e1b2d4c6f8a000001"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "DELETE" && req.URL.Path == "/apps/leper/cron/513f3a2e1b2d4c6f8a000001"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := CronRemove{GuessingCommand{G: &FakeGuesser{name: "leper"}}}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Cron job 513f3a2e1b2d4c6f8a000001 successfully removed from the app "leper".`+"\n")
+}
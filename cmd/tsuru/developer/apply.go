@@ -0,0 +1,197 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/tsuru"
+	"github.com/globocom/tsuru/fs"
+	"io"
+	"io/ioutil"
+	"launchpad.net/gnuflag"
+	"net/http"
+)
+
+var ManifestFile = gnuflag.String("f", "tsuru.yaml", "The manifest describing the app.")
+var DryRun = gnuflag.Bool("dry-run", false, "Only display the changes, without applying them.")
+
+// CloneTeam is the team that will own the cloned app. The --team flag is
+// shared with app-list, that filters apps by team.
+var CloneTeam = tsuru.TeamName
+
+type manifestChange struct {
+	Action      string
+	Description string
+	Status      string
+	Error       string
+}
+
+type AppApply struct {
+	fsystem fs.Fs
+}
+
+func (c *AppApply) fs() fs.Fs {
+	if c.fsystem == nil {
+		c.fsystem = fs.OsFs{}
+	}
+	return c.fsystem
+}
+
+func (c *AppApply) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "app-apply",
+		Usage:   "app-apply [-f tsuru.yaml] [--dry-run]",
+		Desc:    "brings an app to the state described in a manifest file.",
+		MinArgs: 0,
+	}
+}
+
+func (c *AppApply) Run(context *cmd.Context, client cmd.Doer) error {
+	f, err := c.fs().Open(*ManifestFile)
+	if err != nil {
+		return fmt.Errorf("Could not read the manifest %s: %s", *ManifestFile, err)
+	}
+	manifest, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	url := cmd.GetUrl("/apply")
+	if *DryRun {
+		url += "?dry=true"
+	}
+	request, err := http.NewRequest("POST", url, bytes.NewReader(manifest))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-yaml")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var changes []manifestChange
+	if err = json.Unmarshal(result, &changes); err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(context.Stdout, "Nothing to change.")
+		return nil
+	}
+	if *DryRun {
+		fmt.Fprintln(context.Stdout, "The following changes would be applied:")
+		for _, change := range changes {
+			fmt.Fprintf(context.Stdout, " ---> %s\n", change.Description)
+		}
+		return nil
+	}
+	return printChanges(context, changes)
+}
+
+// printChanges displays the changes applied by the server, returning the
+// error of the change that failed, if any.
+func printChanges(context *cmd.Context, changes []manifestChange) error {
+	for _, change := range changes {
+		switch change.Status {
+		case "done":
+			fmt.Fprintf(context.Stdout, " ---> %s... done\n", change.Description)
+		case "failed":
+			fmt.Fprintf(context.Stdout, " ---> %s... failed: %s\n", change.Description, change.Error)
+			return errors.New(change.Error)
+		case "skipped":
+			if change.Error != "" {
+				fmt.Fprintf(context.Stdout, " ---> %s... skipped: %s\n", change.Description, change.Error)
+			}
+		}
+	}
+	return nil
+}
+
+type AppExport struct {
+	tsuru.GuessingCommand
+}
+
+func (c *AppExport) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-export",
+		Usage: "app-export [--app appname]",
+		Desc: `displays the manifest of an app, which can be used with app-apply.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AppExport) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", cmd.GetUrl(fmt.Sprintf("/apps/%s/export", appName)), nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, err = io.Copy(context.Stdout, response.Body)
+	return err
+}
+
+type AppClone struct{}
+
+func (c *AppClone) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "app-clone",
+		Usage:   "app-clone <source> <destination> [--team teamname]",
+		Desc:    "creates a new app with the configuration and fresh service instances of an existing app.",
+		MinArgs: 2,
+	}
+}
+
+func (c *AppClone) Run(context *cmd.Context, client cmd.Doer) error {
+	params := map[string]string{"name": context.Args[1]}
+	if *CloneTeam != "" {
+		params["team"] = *CloneTeam
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/clone", context.Args[0]))
+	request, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var changes []manifestChange
+	if err = json.Unmarshal(result, &changes); err != nil {
+		return err
+	}
+	if err = printChanges(context, changes); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "App %q successfully cloned to %q.\n", context.Args[0], context.Args[1])
+	return nil
+}
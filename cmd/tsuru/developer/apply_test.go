@@ -0,0 +1,210 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/cmd/tsuru"
+	fs_test "github.com/globocom/tsuru/fs/testing"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"net/http"
+)
+
+const testManifest = `name: myapp
+framework: python
+units: 2
+`
+
+func (s *S) TestAppApplyInfo(c *C) {
+	expected := &cmd.Info{
+		Name:    "app-apply",
+		Usage:   "app-apply [-f tsuru.yaml] [--dry-run]",
+		Desc:    "brings an app to the state described in a manifest file.",
+		MinArgs: 0,
+	}
+	c.Assert((&AppApply{}).Info(), DeepEquals, expected)
+}
+
+func (s *S) TestAppApply(c *C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Action":"create-app","Description":"create app \"myapp\"","Status":"done"},` +
+		`{"Action":"env-set","Description":"set env vars [DEBUG]","Status":"done"}]`
+	expected := " ---> create app \"myapp\"... done\n ---> set env vars [DEBUG]... done\n"
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	var body string
+	trans := &conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			b, _ := ioutil.ReadAll(req.Body)
+			body = string(b)
+			return req.Method == "POST" && req.URL.Path == "/apply" && req.URL.RawQuery == ""
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	fs := fs_test.RecordingFs{FileContent: testManifest}
+	command := AppApply{fsystem: &fs}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+	c.Assert(body, Equals, testManifest)
+	c.Assert(fs.HasAction("open tsuru.yaml"), Equals, true)
+}
+
+func (s *S) TestAppApplyDryRun(c *C) {
+	*DryRun = true
+	*ManifestFile = "/home/me/myapp.yaml"
+	var stdout, stderr bytes.Buffer
+	result := `[{"Action":"add-units","Description":"add 1 unit(s)","Status":"planned"}]`
+	expected := "The following changes would be applied:\n ---> add 1 unit(s)\n"
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.URL.Path == "/apply" && req.URL.RawQuery == "dry=true"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	fs := fs_test.RecordingFs{FileContent: testManifest}
+	command := AppApply{fsystem: &fs}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+	c.Assert(fs.HasAction("open /home/me/myapp.yaml"), Equals, true)
+}
+
+func (s *S) TestAppApplyWithoutChanges(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: "[]", status: http.StatusOK}}, nil, manager)
+	command := AppApply{fsystem: &fs_test.RecordingFs{FileContent: testManifest}}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "Nothing to change.\n")
+}
+
+func (s *S) TestAppApplyShowsTheReasonOfChangesThatCouldNotRunYet(c *C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Action":"create-service-instance","Description":"create service instance \"mydb\" of service \"mysql\"","Status":"done"},` +
+		`{"Action":"bind","Description":"bind service instance \"mydb\"","Status":"skipped","Error":"still being created"},` +
+		`{"Action":"env-set","Description":"set env vars [DEBUG]","Status":"done"}]`
+	expected := ` ---> create service instance "mydb" of service "mysql"... done
+ ---> bind service instance "mydb"... skipped: still being created
+ ---> set env vars [DEBUG]... done
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	command := AppApply{fsystem: &fs_test.RecordingFs{FileContent: testManifest}}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestAppApplyReturnsTheErrorOfTheFailedChange(c *C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Action":"add-units","Description":"add 1 unit(s)","Status":"done"},` +
+		`{"Action":"bind","Description":"bind service instance \"mydb\"","Status":"failed","Error":"instance not ready"},` +
+		`{"Action":"env-set","Description":"set env vars [DEBUG]","Status":"skipped"}]`
+	expected := " ---> add 1 unit(s)... done\n ---> bind service instance \"mydb\"... failed: instance not ready\n"
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	command := AppApply{fsystem: &fs_test.RecordingFs{FileContent: testManifest}}
+	err := command.Run(&context, client)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "instance not ready")
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestAppApplyFailsWhenTheManifestCannotBeRead(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: "[]", status: http.StatusOK}}, nil, manager)
+	command := AppApply{fsystem: &fs_test.FailureFs{}}
+	err := command.Run(&context, client)
+	c.Assert(err, NotNil)
+}
+
+func (s *S) TestAppExport(c *C) {
+	var stdout, stderr bytes.Buffer
+	result := "name: myapp\nframework: python\nunits: 2\n"
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/apps/myapp/export"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	fake := FakeGuesser{name: "myapp"}
+	command := AppExport{tsuru.GuessingCommand{G: &fake}}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, result)
+}
+
+func (s *S) TestAppClone(c *C) {
+	*CloneTeam = "qa"
+	var stdout, stderr bytes.Buffer
+	result := `[{"Action":"create-app","Description":"create app \"staging\"","Status":"done"}]`
+	expected := " ---> create app \"staging\"... done\n" + `App "myapp" successfully cloned to "staging".` + "\n"
+	context := cmd.Context{
+		Args:   []string{"myapp", "staging"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	var params map[string]string
+	trans := &conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			json.NewDecoder(req.Body).Decode(&params)
+			return req.Method == "POST" && req.URL.Path == "/apps/myapp/clone"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppClone{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+	c.Assert(params, DeepEquals, map[string]string{"name": "staging", "team": "qa"})
+}
+
+func (s *S) TestAppCloneWithFailure(c *C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Action":"create-app","Description":"create app \"staging\"","Status":"done"},` +
+		`{"Action":"bind","Description":"bind service instance \"staging-mysql\"","Status":"failed","Error":"timeout"}]`
+	context := cmd.Context{
+		Args:   []string{"myapp", "staging"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	command := AppClone{}
+	err := command.Run(&context, client)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "timeout")
+}
@@ -18,6 +18,32 @@ import (
 
 var AssumeYes = gnuflag.Bool("assume-yes", false, "Don't ask for confirmation on operations.")
 var NumUnits = gnuflag.Uint("units", 1, "How many units should be created with the app.")
+var ProcessName = gnuflag.String("process", "", "The process type of the new units, as declared in the Procfile of the app.")
+var Async = gnuflag.Bool("async", false, "Don't wait for the operation to finish.")
+
+// operationId extracts the id of the operation started by the server from
+// the body of the response, if any.
+func operationId(body []byte) string {
+	out := make(map[string]string)
+	if err := json.Unmarshal(body, &out); err != nil {
+		return ""
+	}
+	return out["operation"]
+}
+
+// followOperation waits for the given operation to finish, unless the user
+// asked to run it asynchronously. It returns true when the operation is
+// finished.
+func followOperation(context *cmd.Context, client cmd.Doer, id string) (bool, error) {
+	if id == "" {
+		return true, nil
+	}
+	if *Async {
+		fmt.Fprintf(context.Stdout, "Operation %s started, use \"operation-info %s\" to check its progress.\n", id, id)
+		return false, nil
+	}
+	return true, tsuru.WaitOperation(context, client, id)
+}
 
 type AppCreate struct{}
 
@@ -27,7 +53,11 @@ func (c *AppCreate) Run(context *cmd.Context, client cmd.Doer) error {
 	}
 	appName := context.Args[0]
 	framework := context.Args[1]
-	b := bytes.NewBufferString(fmt.Sprintf(`{"name":"%s","framework":"%s","units":%d}`, appName, framework, *NumUnits))
+	var plan string
+	if *tsuru.PlanName != "" {
+		plan = fmt.Sprintf(`,"plan":"%s"`, *tsuru.PlanName)
+	}
+	b := bytes.NewBufferString(fmt.Sprintf(`{"name":"%s","framework":"%s","units":%d%s}`, appName, framework, *NumUnits, plan))
 	request, err := http.NewRequest("POST", cmd.GetUrl("/apps"), b)
 	request.Header.Set("Content-Type", "application/json")
 	if err != nil {
@@ -53,6 +83,9 @@ func (c *AppCreate) Run(context *cmd.Context, client cmd.Doer) error {
 	}
 	fmt.Fprintf(context.Stdout, "App %q is being created with %d unit%s!\n", appName, *NumUnits, plural)
 	fmt.Fprintln(context.Stdout, "Use app-info to check the status of the app and its units.")
+	if _, err := followOperation(context, client, out["operation"]); err != nil {
+		return err
+	}
 	fmt.Fprintf(context.Stdout, "Your repository for %q project is %q\n", appName, out["repository_url"])
 	return nil
 }
@@ -60,7 +93,7 @@ func (c *AppCreate) Run(context *cmd.Context, client cmd.Doer) error {
 func (c *AppCreate) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "app-create",
-		Usage:   "app-create <appname> <framework> [--units 1]",
+		Usage:   "app-create <appname> <framework> [--units 1] [--plan planname] [--async]",
 		Desc:    "create a new app.",
 		MinArgs: 2,
 	}
@@ -73,7 +106,7 @@ type AppRemove struct {
 func (c *AppRemove) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "app-remove",
-		Usage: "app-remove [--app appname] [--assume-yes]",
+		Usage: "app-remove [--app appname] [--assume-yes] [--async]",
 		Desc: `removes an app.
 
 If you don't provide the app name, tsuru will try to guess it.`,
@@ -100,10 +133,18 @@ func (c *AppRemove) Run(context *cmd.Context, client cmd.Doer) error {
 	if err != nil {
 		return err
 	}
-	_, err = client.Do(request)
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		return err
 	}
+	if finished, err := followOperation(context, client, operationId(result)); !finished || err != nil {
+		return err
+	}
 	fmt.Fprintf(context.Stdout, `App "%s" successfully removed!`+"\n", appName)
 	return nil
 }
@@ -115,7 +156,7 @@ type UnitAdd struct {
 func (c *UnitAdd) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "unit-add",
-		Usage:   "unit-add <# of units> [--app appname]",
+		Usage:   "unit-add <# of units> [--app appname] [--process name] [--async]",
 		Desc:    "add new units to an app.",
 		MinArgs: 1,
 	}
@@ -127,14 +168,25 @@ func (c *UnitAdd) Run(context *cmd.Context, client cmd.Doer) error {
 		return err
 	}
 	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/units", appName))
+	if *ProcessName != "" {
+		url += "?process=" + *ProcessName
+	}
 	request, err := http.NewRequest("PUT", url, bytes.NewBufferString(context.Args[0]))
 	if err != nil {
 		return err
 	}
-	_, err = client.Do(request)
+	response, err := client.Do(request)
 	if err != nil {
 		return err
 	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if finished, err := followOperation(context, client, operationId(result)); !finished || err != nil {
+		return err
+	}
 	fmt.Fprintln(context.Stdout, "Units successfully added!")
 	return nil
 }
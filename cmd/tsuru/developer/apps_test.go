@@ -17,7 +17,7 @@ import (
 func (s *S) TestAppCreateInfo(c *C) {
 	expected := &cmd.Info{
 		Name:    "app-create",
-		Usage:   "app-create <appname> <framework> [--units 1]",
+		Usage:   "app-create <appname> <framework> [--units 1] [--plan planname] [--async]",
 		Desc:    "create a new app.",
 		MinArgs: 2,
 	}
@@ -81,6 +81,31 @@ Your repository for "ble" project is "git@tsuru.plataformas.glb.com:ble.git"` +
 	c.Assert(stdout.String(), Equals, expected)
 }
 
+func (s *S) TestAppCreateWithPlan(c *C) {
+	*tsuru.PlanName = "small"
+	var stdout, stderr bytes.Buffer
+	result := `{"status":"success", "repository_url":"git@tsuru.plataformas.glb.com:ble.git"}`
+	context := cmd.Context{
+		Args:   []string{"ble", "django"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	transport := conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			defer req.Body.Close()
+			body, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, IsNil)
+			c.Assert(string(body), Equals, `{"name":"ble","framework":"django","units":1,"plan":"small"}`)
+			return req.Method == "POST" && req.URL.Path == "/apps"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, manager)
+	command := AppCreate{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+}
+
 func (s *S) TestAppCreateZeroUnits(c *C) {
 	*NumUnits = 0
 	command := AppCreate{}
@@ -202,7 +227,7 @@ func (s *S) TestAppRemoveWithoutConfirmation(c *C) {
 func (s *S) TestAppRemoveInfo(c *C) {
 	expected := &cmd.Info{
 		Name:  "app-remove",
-		Usage: "app-remove [--app appname] [--assume-yes]",
+		Usage: "app-remove [--app appname] [--assume-yes] [--async]",
 		Desc: `removes an app.
 
 If you don't provide the app name, tsuru will try to guess it.`,
@@ -242,6 +267,34 @@ func (s *S) TestUnitAdd(c *C) {
 	c.Assert(stdout.String(), Equals, expected)
 }
 
+func (s *S) TestUnitAddWithProcess(c *C) {
+	*tsuru.AppName = "radio"
+	*ProcessName = "worker"
+	var stdout, stderr bytes.Buffer
+	var called bool
+	context := cmd.Context{
+		Args:   []string{"2"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &conditionalTransport{
+		transport{
+			msg:    "",
+			status: http.StatusOK,
+		},
+		func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/radio/units" && req.URL.Query().Get("process") == "worker"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := UnitAdd{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(called, Equals, true)
+	c.Assert(stdout.String(), Equals, "Units successfully added!\n")
+}
+
 func (s *S) TestUnitAddFailure(c *C) {
 	*tsuru.AppName = "radio"
 	var stdout, stderr bytes.Buffer
@@ -260,7 +313,7 @@ func (s *S) TestUnitAddFailure(c *C) {
 func (s *S) TestUnitAddInfo(c *C) {
 	expected := &cmd.Info{
 		Name:    "unit-add",
-		Usage:   "unit-add <# of units> [--app appname]",
+		Usage:   "unit-add <# of units> [--app appname] [--process name] [--async]",
 		Desc:    "add new units to an app.",
 		MinArgs: 1,
 	}
@@ -340,3 +393,86 @@ func (s *S) TestUnitRemoveIsACommand(c *C) {
 func (s *S) TestUnitRemoveIsAnInfoer(c *C) {
 	var _ cmd.Infoer = &UnitRemove{}
 }
+
+func (s *S) TestAppCreateWaitsForTheOperation(c *C) {
+	var stdout, stderr bytes.Buffer
+	trans := routingTransport{
+		"POST /apps":          `{"status":"pending","repository_url":"git@tsuru.plataformas.glb.com:ble.git","operation":"123"}`,
+		"GET /operations/123": `{"Id":"123","Status":"succeeded","Steps":[{"Name":"save the app in the database","Status":"done"}]}`,
+	}
+	expected := `App "ble" is being created with 1 unit!
+Use app-info to check the status of the app and its units.
+ ---> save the app in the database... done
+Your repository for "ble" project is "git@tsuru.plataformas.glb.com:ble.git"` + "\n"
+	context := cmd.Context{
+		Args:   []string{"ble", "django"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&AppCreate{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestAppCreateAsync(c *C) {
+	*Async = true
+	var stdout, stderr bytes.Buffer
+	trans := routingTransport{
+		"POST /apps": `{"status":"pending","repository_url":"git@tsuru.plataformas.glb.com:ble.git","operation":"123"}`,
+	}
+	expected := `App "ble" is being created with 1 unit!
+Use app-info to check the status of the app and its units.
+Operation 123 started, use "operation-info 123" to check its progress.
+Your repository for "ble" project is "git@tsuru.plataformas.glb.com:ble.git"` + "\n"
+	context := cmd.Context{
+		Args:   []string{"ble", "django"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&AppCreate{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestAppRemoveWaitsForTheOperation(c *C) {
+	*tsuru.AppName = "ble"
+	*AssumeYes = true
+	var stdout, stderr bytes.Buffer
+	trans := routingTransport{
+		"DELETE /apps/ble":    `{"operation":"123"}`,
+		"GET /operations/123": `{"Id":"123","Status":"failed","Error":"juju is down","Steps":[{"Name":"destroy units","Status":"failed","Error":"juju is down"}]}`,
+	}
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&AppRemove{}).Run(&context, client)
+	c.Assert(err, ErrorMatches, "^juju is down$")
+	c.Assert(stdout.String(), Equals, " ---> destroy units... failed: juju is down\n")
+}
+
+func (s *S) TestUnitAddWaitsForTheOperation(c *C) {
+	*tsuru.AppName = "radio"
+	var stdout, stderr bytes.Buffer
+	trans := routingTransport{
+		"PUT /apps/radio/units": `{"operation":"123"}`,
+		"GET /operations/123":   `{"Id":"123","Status":"succeeded","Steps":[{"Name":"add units","Status":"done"}]}`,
+	}
+	context := cmd.Context{Args: []string{"3"}, Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&UnitAdd{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, " ---> add units... done\nUnits successfully added!\n")
+}
+
+func (s *S) TestUnitAddAsync(c *C) {
+	*tsuru.AppName = "radio"
+	*Async = true
+	var stdout, stderr bytes.Buffer
+	trans := routingTransport{"PUT /apps/radio/units": `{"operation":"123"}`}
+	context := cmd.Context{Args: []string{"3"}, Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&UnitAdd{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "Operation 123 started, use \"operation-info 123\" to check its progress.\n")
+}
@@ -33,8 +33,12 @@ The currently available commands are (grouped by subject):
 
 	app-create        creates an app
 	app-remove        removes an app
+	app-apply         brings an app to the state described in a manifest
+	app-export        displays the manifest of an app
+	app-clone         creates a copy of an app
 	app-list          lists apps that the user has access (see app-grant and team-user-add)
 	app-info          displays information about an app
+	app-update        changes the description, the contact or the tags of an app
 	app-grant         allows a team to have access to an app
 	app-revoke        revokes access to an app from a team
 	unit-add          adds new units to an app
@@ -42,10 +46,22 @@ The currently available commands are (grouped by subject):
 	log               shows log for an app
 	run               runs a command in all units of an app
 	restart           restarts the app's application server
+	app-maintenance   turns the maintenance mode of an app on or off
+	app-storage-rotate-keys
+	                  replaces the credentials of the bucket of an app
 
 	env-get           display environment variables for an app
 	env-set           set environment variable(s) to an app
 	env-unset         unset environment variable(s) from an app
+	env-history       display the history of environment variable changes
+	env-rollback      roll environment variables back to a revision
+
+	cname-add         adds a custom domain to an app
+	cname-remove      removes a custom domain from an app
+
+	cron-add          schedules a command to run periodically in an app
+	cron-list         lists the cron jobs of an app
+	cron-remove       removes a cron job from an app
 
 	bind              binds an app to a service instance
 	unbind            unbinds an app from a service instance
@@ -54,7 +70,7 @@ The currently available commands are (grouped by subject):
 	service-add       creates a new instance of a service
 	service-remove    removes a instance of a service
 	service-status    checks the status of a service instance
-	service-info      list instances of a service, and apps binded to each instance
+	service-info      list instances and plans of a service, and apps binded to each instance
 	service-doc       displays documentation for a service
 
 Use "tsuru help <command>" for more information about a command.
@@ -251,9 +267,9 @@ Usage:
 
 	% tsuru app-create <app-name> <platform> [--units 1]
 
-app-create will create a new app using the given name and platform. For tsuru,
-a platform is a Juju charm. To check the available platforms/charms, check this
-URL: https://github.com/globocom/charms/tree/master/precise.
+app-create will create a new app using the given name and platform. The
+platform must be one of the platforms available in the tsuru server (see "tsuru
+platform-list").
 
 The --units flag is optional, it indicates how many units will be added to the
 app when creating it. The default value is 1.
@@ -263,6 +279,18 @@ teams that you are member (see "tsuru team-list") will be able to access the
 app.
 
 
+List available platforms
+
+Usage:
+
+	% tsuru platform-list
+
+platform-list lists the platforms (frameworks) that can be used to create new
+apps. Platforms are managed by tsuru administrators, who may deprecate old
+platforms: apps that already use a deprecated platform keep working, but new
+apps can't use it.
+
+
 Remove an app
 
 Usage:
@@ -281,11 +309,17 @@ List apps that you have access to
 
 Usage:
 
-	% tsuru app-list
+	% tsuru app-list [--name pattern] [--framework name] [--state state] [--team name] [--tag tag1,tag2] [--limit n] [--page n]
 
 app-list will list all apps that you have access to. App access is controlled
 by teams. If your team has access to an app, then you have access to it.
 
+The apps may be filtered by a regular expression matched against their names,
+and by platform, state, team and tags. Apps must have all the given tags. With
+--limit, app-list displays a page of apps, selected by --page:
+
+	% tsuru app-list --name "^payments" --tag api --limit 20 --page 2
+
 
 Display information about an app
 
@@ -300,6 +334,25 @@ to the app to be able to see informations about it.
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
+Change the description, the contact or the tags of an app
+
+Usage:
+
+	% tsuru app-update <description|contact|tags> <value> [--app appname]
+
+Apps may have a description, a contact for the people responsible for them, and
+tags, displayed by app-info. Tags are separated by commas, and may be used to
+filter apps in app-list:
+
+	% tsuru app-update description "The payments API"
+	% tsuru app-update contact payments@company.com
+	% tsuru app-update tags api,payments
+
+An empty value clears the field.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
 Allow a team to access an app
 
 Usage:
@@ -326,15 +379,86 @@ An app cannot be orphaned, so it will always have at least one authorized team.
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
+Apply a manifest
+
+Usage:
+
+	% tsuru app-apply [-f tsuru.yaml] [--dry-run]
+
+app-apply reads a manifest describing the desired state of an app and makes
+only the changes needed to reach it: creating the app, changing its plan and
+teams, adding or removing units, setting environment variables and creating
+and binding service instances. Running it again with the same manifest does
+nothing. Example of manifest:
+
+	name: myapp
+	framework: python
+	units: 3
+	teams: [developers]
+	env:
+	  DEBUG: "false"
+	services:
+	  - name: myapp-db
+	    service: mysql
+	    plan: small
+
+The plan of a service instance is only used when the instance is created.
+Instances that their services create asynchronously can't be bound right away:
+run app-apply again once they're ready.
+
+The -f flag is optional, it indicates the path of the manifest. The default
+value is "tsuru.yaml". With the --dry-run flag, app-apply only displays the
+changes, without applying them.
+
+
+Export an app
+
+Usage:
+
+	% tsuru app-export [--app appname]
+
+app-export displays the manifest of an app: its framework, units, plan, teams,
+public environment variables, service instances and hooks. The manifest can be
+saved and given to app-apply, in the same tsuru server or in another one:
+
+	% tsuru app-export --app myapp > tsuru.yaml
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Clone an app
+
+Usage:
+
+	% tsuru app-clone <source> <destination> [--team teamname]
+
+app-clone creates a new app with the same configuration of an existing app.
+Service instances are not shared: the new app gets a new instance of each
+service bound to the source app.
+
+The --team flag is optional, it indicates the team that will own the new app.
+By default, the new app is owned by the same teams of the source app.
+
+
 Add new units to the app
 
 Usage:
 
-	% tsuru unit-add <# of units> [--app appname]
+	% tsuru unit-add <# of units> [--app appname] [--process name]
 
 unit-add will add new units (instances) to an app. You need to have access to
 the app to be able to add new units to it.
 
+Apps may declare process types in a Procfile, in the root of the repository:
+
+	web: gunicorn -b 0.0.0.0:$PORT app:app
+	worker: celery worker -A tasks
+
+New units run the web process, unless the --process flag is given. For
+example, to add two units running the worker process:
+
+	% tsuru unit-add 2 --process worker
+
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
@@ -405,6 +529,38 @@ application.
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
+Turn the maintenance mode of an app on or off
+
+Usage:
+
+	% tsuru app-maintenance <on|off> [--app appname]
+
+While an app is in maintenance mode, deploys and changes in its environment
+variables (env-set, env-unset and env-rollback) are refused, unless they're
+given the --force flag. tsuru doesn't try to start the app either, and when the
+router supports it, requests to the app are answered with a maintenance page.
+app-info and app-list display the apps in maintenance mode.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Rotate the credentials of the bucket of an app
+
+Usage:
+
+	% tsuru app-storage-rotate-keys [--app appname]
+
+Each app has a bucket in the object storage, exported to the app in the
+TSURU_S3_* environment variables. app-storage-rotate-keys creates new
+credentials for the bucket and writes them to all units of the app, and only
+then deletes the old credentials, so the app doesn't lose access to its bucket.
+If the units aren't updated within five minutes, the command fails and the old
+credentials are deleted as soon as the units are updated; the keys can't be
+rotated again until then. Apps in maintenance mode can't rotate their keys.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
 Display environment variables of an application
 
 Usage:
@@ -439,7 +595,7 @@ Define the value of one or more environment variables
 
 Usage:
 
-	% tsuru env-set <NAME_1=VALUE_1> [NAME_2=VALUE_2] ... [NAME_N=VALUE_N] [--app appname]
+	% tsuru env-set <NAME_1=VALUE_1> [NAME_2=VALUE_2] ... [NAME_N=VALUE_N] [--file .env] [--app appname] [--force]
 
 env-set will (re)define environment variables for your app.  You can specify
 one or more environment variables to (re)define. env-set cannot redefine
@@ -455,6 +611,13 @@ use:
 
 Notice that env-set will fail silently to redefine private variables.
 
+With the --file flag, env-set imports the variables defined in a .env file,
+with one NAME=value per line. Values may be quoted, and lines starting with #
+are ignored. The variables in the file and in the arguments are set in a single
+change:
+
+	% tsuru env-set --file .env DEBUG=false
+
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
@@ -462,7 +625,7 @@ Undefine an environment variable
 
 Usage:
 
-	% tsuru env-unset <NAME_1> [NAME_2] ... [NAME_N] [--app appname]
+	% tsuru env-unset <NAME_1> [NAME_2] ... [NAME_N] [--app appname] [--force]
 
 env-unset will undefine environments variables in your app.  You can specify
 one or more environment variables to undefine.  env-unset cannot remove private
@@ -477,6 +640,105 @@ Notice that env-unset will fail silently to undefine private variables.
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
+Display the history of environment variable changes
+
+Usage:
+
+	% tsuru env-history [--app appname]
+
+Every change in the environment variables of an app is recorded as a new
+revision, with the user that made the change and the variables that changed.
+Values of private variables are not displayed:
+
+	% tsuru env-history
+	Revision 2 by ringo@beatles.com at 2013-03-01 10:20:30
+	  - DEBUG
+	  + MYSQL_PASSWORD=*** (private variable)
+
+	Revision 1 by ringo@beatles.com at 2013-02-28 08:00:00
+	  + DEBUG=true
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Roll environment variables back to a revision
+
+Usage:
+
+	% tsuru env-rollback <revision> [--app appname] [--force]
+
+env-rollback sets the public environment variables of the app to the values
+they had in the given revision, and unsets public variables created after it.
+Private variables are not changed. The rollback is recorded as a new revision.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Add a custom domain to an app
+
+Usage:
+
+	% tsuru cname-add <cname> [--app appname]
+
+Every app is reachable through a stable address, displayed by app-info.
+cname-add makes the app reachable through a custom domain too. The domain must
+be a CNAME pointing to the address of the app, and can't be used by another
+app. An app may have many custom domains.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Remove a custom domain from an app
+
+Usage:
+
+	% tsuru cname-remove <cname> [--app appname]
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Schedule a command in an app
+
+Usage:
+
+	% tsuru cron-add "<schedule>" <command> [--app appname]
+
+cron-add schedules a command to run periodically in one unit of the app. The
+schedule has the five fields of crontab: minute, hour, day of month, month and
+day of week. Fields accept lists and ranges, like "0,30 8-18 * * 1-5", and steps,
+like "0-59/10" for every ten minutes. The schedules @hourly, @daily, @weekly,
+@monthly and @yearly are accepted too. Times are in the timezone of the tsuru
+server.
+
+The output of the command goes to the logs of the app, with the source "cron":
+
+	% tsuru cron-add "0 3 * * *" python manage.py clearsessions
+	Cron job 513f3a2e1b2d4c6f8a000001 successfully added to the app "myapp".
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+List the cron jobs of an app
+
+Usage:
+
+	% tsuru cron-list [--app appname]
+
+cron-list displays the cron jobs of the app, with the date, the duration and the
+exit status of their last run.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Remove a cron job from an app
+
+Usage:
+
+	% tsuru cron-remove <id> [--app appname]
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
 Bind an application to a service instance
 
 Usage:
@@ -521,11 +783,17 @@ Create a new service instance
 
 Usage:
 
-	% tsuru service-add <service-name> <instance-name>
+	% tsuru service-add <service-name> <instance-name> [--plan plan-name]
 
 service-add will create a new service instance. After listing services with
 "service-list", you may want to create a new service instance.
 
+Some services have plans, e.g. the size of a database. The --plan flag chooses
+the plan of the new instance, among the plans listed by "service-info".
+
+Some services create instances asynchronously. These instances can be bound to
+apps only when they're ready; use "service-status" to check their state.
+
 Example of use:
 
 	% tsuru service-list
@@ -562,7 +830,8 @@ Usage:
 	% tsuru service-info <service-name>
 
 service-info will display a list of all instances of a given service (that the
-user has access to), and apps binded to these instances.
+user has access to), and apps binded to these instances. It also displays the
+plans of the service that the user is allowed to use, if there are any.
 
 Example of use:
 
@@ -590,9 +859,10 @@ Usage:
 
 	% tsuru service-status <instance-name>
 
-service-status will display the status of the given service instance. For now,
-it checks only if the instance is "up" (receiving connections) or "down"
-(refusing connections).
+service-status will display the status of the given service instance. Ready
+instances are either "up" (receiving connections) or "down" (refusing
+connections). Other instances are "being created", "being removed" or "in
+error", followed by the error reported by the service.
 
 
 Display the documentation of a service
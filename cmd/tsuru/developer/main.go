@@ -22,6 +22,9 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&tsuru.AppInfo{})
 	m.Register(&AppCreate{})
 	m.Register(&AppRemove{})
+	m.Register(&AppApply{})
+	m.Register(&AppExport{})
+	m.Register(&AppClone{})
 	m.Register(&UnitAdd{})
 	m.Register(&UnitRemove{})
 	m.Register(&tsuru.AppList{})
@@ -29,9 +32,19 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&tsuru.AppGrant{})
 	m.Register(&tsuru.AppRevoke{})
 	m.Register(&tsuru.AppRestart{})
+	m.Register(&tsuru.AppMaintenance{})
+	m.Register(&tsuru.AppStorageRotateKeys{})
+	m.Register(&tsuru.AppUpdate{})
 	m.Register(&tsuru.EnvGet{})
 	m.Register(&tsuru.EnvSet{})
 	m.Register(&tsuru.EnvUnset{})
+	m.Register(&tsuru.EnvHistory{})
+	m.Register(&tsuru.EnvRollback{})
+	m.Register(&tsuru.CNameAdd{})
+	m.Register(&tsuru.CNameRemove{})
+	m.Register(&tsuru.CronAdd{})
+	m.Register(&tsuru.CronList{})
+	m.Register(&tsuru.CronRemove{})
 	m.Register(&KeyAdd{})
 	m.Register(&KeyRemove{})
 	m.Register(&tsuru.ServiceList{})
@@ -42,6 +55,10 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&tsuru.ServiceDoc{})
 	m.Register(&tsuru.ServiceInfo{})
 	m.Register(&tsuru.ServiceInstanceStatus{})
+	m.Register(&tsuru.PlanList{})
+	m.Register(&tsuru.PlatformList{})
+	m.Register(&tsuru.OperationInfo{})
+	m.Register(&tsuru.AppChangePlan{})
 	return m
 }
 
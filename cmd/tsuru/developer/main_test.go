@@ -97,6 +97,62 @@ func (s *S) TestEnvUnsetIsRegistered(c *C) {
 	c.Assert(unset, FitsTypeOf, &tsuru.EnvUnset{})
 }
 
+func (s *S) TestEnvHistoryIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	history, ok := manager.Commands["env-history"]
+	c.Assert(ok, Equals, true)
+	c.Assert(history, FitsTypeOf, &tsuru.EnvHistory{})
+}
+
+func (s *S) TestEnvRollbackIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	rollback, ok := manager.Commands["env-rollback"]
+	c.Assert(ok, Equals, true)
+	c.Assert(rollback, FitsTypeOf, &tsuru.EnvRollback{})
+}
+
+func (s *S) TestCronAddIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	cron, ok := manager.Commands["cron-add"]
+	c.Assert(ok, Equals, true)
+	c.Assert(cron, FitsTypeOf, &tsuru.CronAdd{})
+}
+
+func (s *S) TestCronListIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	cron, ok := manager.Commands["cron-list"]
+	c.Assert(ok, Equals, true)
+	c.Assert(cron, FitsTypeOf, &tsuru.CronList{})
+}
+
+func (s *S) TestCronRemoveIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	cron, ok := manager.Commands["cron-remove"]
+	c.Assert(ok, Equals, true)
+	c.Assert(cron, FitsTypeOf, &tsuru.CronRemove{})
+}
+
+func (s *S) TestAppMaintenanceIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	maintenance, ok := manager.Commands["app-maintenance"]
+	c.Assert(ok, Equals, true)
+	c.Assert(maintenance, FitsTypeOf, &tsuru.AppMaintenance{})
+}
+
+func (s *S) TestAppStorageRotateKeysIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	rotate, ok := manager.Commands["app-storage-rotate-keys"]
+	c.Assert(ok, Equals, true)
+	c.Assert(rotate, FitsTypeOf, &tsuru.AppStorageRotateKeys{})
+}
+
+func (s *S) TestAppUpdateIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	update, ok := manager.Commands["app-update"]
+	c.Assert(ok, Equals, true)
+	c.Assert(update, FitsTypeOf, &tsuru.AppUpdate{})
+}
+
 func (s *S) TestKeyAddIsRegistered(c *C) {
 	manager := buildManager("tsuru")
 	add, ok := manager.Commands["key-add"]
@@ -187,3 +243,66 @@ func (s *S) TestUnitRemoveIsRegistered(c *C) {
 	c.Assert(ok, Equals, true)
 	c.Assert(rmunit, FitsTypeOf, &UnitRemove{})
 }
+
+func (s *S) TestPlanListIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	list, ok := manager.Commands["plan-list"]
+	c.Assert(ok, Equals, true)
+	c.Assert(list, FitsTypeOf, &tsuru.PlanList{})
+}
+
+func (s *S) TestPlatformListIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	list, ok := manager.Commands["platform-list"]
+	c.Assert(ok, Equals, true)
+	c.Assert(list, FitsTypeOf, &tsuru.PlatformList{})
+}
+
+func (s *S) TestAppChangePlanIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	change, ok := manager.Commands["app-change-plan"]
+	c.Assert(ok, Equals, true)
+	c.Assert(change, FitsTypeOf, &tsuru.AppChangePlan{})
+}
+
+func (s *S) TestOperationInfoIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	info, ok := manager.Commands["operation-info"]
+	c.Assert(ok, Equals, true)
+	c.Assert(info, FitsTypeOf, &tsuru.OperationInfo{})
+}
+
+func (s *S) TestAppApplyIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	apply, ok := manager.Commands["app-apply"]
+	c.Assert(ok, Equals, true)
+	c.Assert(apply, FitsTypeOf, &AppApply{})
+}
+
+func (s *S) TestAppExportIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	export, ok := manager.Commands["app-export"]
+	c.Assert(ok, Equals, true)
+	c.Assert(export, FitsTypeOf, &AppExport{})
+}
+
+func (s *S) TestAppCloneIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	clone, ok := manager.Commands["app-clone"]
+	c.Assert(ok, Equals, true)
+	c.Assert(clone, FitsTypeOf, &AppClone{})
+}
+
+func (s *S) TestCNameAddIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	add, ok := manager.Commands["cname-add"]
+	c.Assert(ok, Equals, true)
+	c.Assert(add, FitsTypeOf, &tsuru.CNameAdd{})
+}
+
+func (s *S) TestCNameRemoveIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	remove, ok := manager.Commands["cname-remove"]
+	c.Assert(ok, Equals, true)
+	c.Assert(remove, FitsTypeOf, &tsuru.CNameRemove{})
+}
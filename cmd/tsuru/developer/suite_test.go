@@ -28,6 +28,21 @@ type conditionalTransport struct {
 	condFunc func(*http.Request) bool
 }
 
+// routingTransport answers each request with the message registered for its
+// method and path, like "GET /operations/123".
+type routingTransport map[string]string
+
+func (t routingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	msg, ok := t[req.Method+" "+req.URL.Path]
+	if !ok {
+		return &http.Response{Body: nil, StatusCode: 500}, errors.New("unexpected request")
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(msg)),
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
 var _ = Suite(&S{})
 var manager *cmd.Manager
 
@@ -54,4 +69,11 @@ func (s *S) SetUpTest(c *C) {
 	*tsuru.AppName = ""
 	*AssumeYes = false
 	*NumUnits = 1
+	*tsuru.PlanName = ""
+	*ProcessName = ""
+	*Async = false
+	*ManifestFile = "tsuru.yaml"
+	*DryRun = false
+	*CloneTeam = ""
+	tsuru.PollInterval = 1e6
 }
@@ -5,11 +5,21 @@
 package tsuru
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/fs"
+	"io"
 	"io/ioutil"
+	"launchpad.net/gnuflag"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type EnvGet struct {
@@ -36,30 +46,165 @@ func (c *EnvGet) Run(context *cmd.Context, client cmd.Doer) error {
 	return nil
 }
 
+// EnvFile is the .env file imported by env-set.
+var EnvFile = gnuflag.String("file", "", "A .env file with the environment variables to set.")
+
 type EnvSet struct {
 	GuessingCommand
+	fsystem fs.Fs
+}
+
+func (c *EnvSet) fs() fs.Fs {
+	if c.fsystem == nil {
+		c.fsystem = fs.OsFs{}
+	}
+	return c.fsystem
 }
 
 func (c *EnvSet) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "env-set",
-		Usage: "env-set <NAME=value> [NAME=value] ... [--app appname]",
+		Usage: "env-set <NAME=value> [NAME=value] ... [--file .env] [--app appname] [--force]",
 		Desc: `set environment variables for an app.
 
+The variables may also be imported from a .env file, with one NAME=value per
+line. All variables, from the file and from the arguments, are set in a single
+change.
+
 If you don't provide the app name, tsuru will try to guess it.`,
-		MinArgs: 1,
+		MinArgs: 0,
 	}
 }
 
 func (c *EnvSet) Run(context *cmd.Context, client cmd.Doer) error {
-	_, err := requestEnvUrl("POST", c.GuessingCommand, context.Args, client)
+	if *EnvFile == "" {
+		if len(context.Args) == 0 {
+			return errors.New("You must provide the environment variables.")
+		}
+		_, err := requestEnvUrl("POST", c.GuessingCommand, context.Args, client)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(context.Stdout, "variable(s) successfully exported\n")
+		return nil
+	}
+	f, err := c.fs().Open(*EnvFile)
+	if err != nil {
+		return fmt.Errorf("Could not read the file %s: %s", *EnvFile, err)
+	}
+	envs, err := parseDotenv(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("Invalid env file %s: %s", *EnvFile, err)
+	}
+	for _, arg := range context.Args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid variable %q, use NAME=value.", arg)
+		}
+		envs[parts[0]] = parts[1]
+	}
+	if len(envs) == 0 {
+		return errors.New("You must provide the environment variables.")
+	}
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(envs)
+	if err != nil {
+		return err
+	}
+	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/env", appName)) + forceQuery()
+	request, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(request)
 	if err != nil {
 		return err
 	}
-	fmt.Fprint(context.Stdout, "variable(s) successfully exported\n")
+	response.Body.Close()
+	fmt.Fprintf(context.Stdout, "%d variable(s) successfully exported\n", len(envs))
 	return nil
 }
 
+// parseDotenv parses a .env file. Each line defines one variable, in the
+// format NAME=value, optionally prefixed by "export". Blank lines and lines
+// starting with # are ignored. Values may be quoted: single quoted values are
+// taken literally, and double quoted values support the escapes \n, \" and
+// \\. Unquoted values end at the first " #", which starts a comment.
+func parseDotenv(r io.Reader) (map[string]string, error) {
+	envs := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected NAME=value", n)
+		}
+		name := strings.TrimSpace(parts[0])
+		if !envNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", n, name)
+		}
+		value, err := parseDotenvValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		envs[name] = value
+	}
+	return envs, scanner.Err()
+}
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func parseDotenvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch value[0] {
+	case '\'':
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", errors.New("unterminated quoted value")
+		}
+		return value[1 : end+1], nil
+	case '"':
+		var buf bytes.Buffer
+		for i := 1; i < len(value); i++ {
+			switch value[i] {
+			case '"':
+				return buf.String(), nil
+			case '\\':
+				if i+1 == len(value) {
+					return "", errors.New("unterminated quoted value")
+				}
+				i++
+				switch value[i] {
+				case 'n':
+					buf.WriteByte('\n')
+				case 't':
+					buf.WriteByte('\t')
+				default:
+					buf.WriteByte(value[i])
+				}
+			default:
+				buf.WriteByte(value[i])
+			}
+		}
+		return "", errors.New("unterminated quoted value")
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
 type EnvUnset struct {
 	GuessingCommand
 }
@@ -67,7 +212,7 @@ type EnvUnset struct {
 func (c *EnvUnset) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "env-unset",
-		Usage: "env-unset <ENVIRONMENT_VARIABLE1> [ENVIRONMENT_VARIABLE2] ... [ENVIRONMENT_VARIABLEN] [--app appname]",
+		Usage: "env-unset <ENVIRONMENT_VARIABLE1> [ENVIRONMENT_VARIABLE2] ... [ENVIRONMENT_VARIABLEN] [--app appname] [--force]",
 		Desc: `unset environment variables for an app.
 
 If you don't provide the app name, tsuru will try to guess it.`,
@@ -91,6 +236,9 @@ func requestEnvUrl(method string, g GuessingCommand, args []string, client cmd.D
 	}
 	varsStr := strings.Join(args, " ")
 	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/env", appName))
+	if method != "GET" {
+		url += forceQuery()
+	}
 	body := strings.NewReader(varsStr)
 	request, err := http.NewRequest(method, url, body)
 	if err != nil {
@@ -106,3 +254,123 @@ func requestEnvUrl(method string, g GuessingCommand, args []string, client cmd.D
 	}
 	return string(b), nil
 }
+
+type envChange struct {
+	Name   string
+	Value  string
+	Public bool
+	Unset  bool
+}
+
+type envRevision struct {
+	Revision int
+	User     string
+	Date     time.Time
+	Rollback int
+	Changes  []envChange
+}
+
+type EnvHistory struct {
+	GuessingCommand
+}
+
+func (c *EnvHistory) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "env-history",
+		Usage: "env-history [--app appname]",
+		Desc: `display the history of changes of the environment variables of an app.
+
+Values of private variables are not displayed. If you don't provide the app
+name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *EnvHistory) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", cmd.GetUrl(fmt.Sprintf("/apps/%s/env/history", appName)), nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "No changes in the environment variables of the app.")
+		return nil
+	}
+	var revisions []envRevision
+	if err = json.NewDecoder(response.Body).Decode(&revisions); err != nil {
+		return err
+	}
+	for i, rev := range revisions {
+		if i > 0 {
+			fmt.Fprintln(context.Stdout)
+		}
+		user := rev.User
+		if user == "" {
+			user = "tsuru"
+		}
+		fmt.Fprintf(context.Stdout, "Revision %d by %s at %s", rev.Revision, user, rev.Date.Format("2006-01-02 15:04:05"))
+		if rev.Rollback > 0 {
+			fmt.Fprintf(context.Stdout, " (rollback to revision %d)", rev.Rollback)
+		}
+		fmt.Fprintln(context.Stdout)
+		for _, change := range rev.Changes {
+			switch {
+			case change.Unset:
+				fmt.Fprintf(context.Stdout, "  - %s\n", change.Name)
+			case change.Public:
+				fmt.Fprintf(context.Stdout, "  + %s=%s\n", change.Name, change.Value)
+			default:
+				fmt.Fprintf(context.Stdout, "  + %s=*** (private variable)\n", change.Name)
+			}
+		}
+	}
+	return nil
+}
+
+type EnvRollback struct {
+	GuessingCommand
+}
+
+func (c *EnvRollback) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "env-rollback",
+		Usage: "env-rollback <revision> [--app appname] [--force]",
+		Desc: `bring the public environment variables of an app back to a revision.
+
+Variables are set to the values they had in the revision, and variables created
+after it are unset. Private variables are not changed. Use env-history to see
+the revisions. If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *EnvRollback) Run(context *cmd.Context, client cmd.Doer) error {
+	revision, err := strconv.Atoi(context.Args[0])
+	if err != nil || revision < 1 {
+		return fmt.Errorf("Invalid revision %q.", context.Args[0])
+	}
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/env/rollback/%d", appName, revision)) + forceQuery()
+	request, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	fmt.Fprintf(context.Stdout, "Environment variables of the app %q rolled back to revision %d.\n", appName, revision)
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// PollInterval is the interval between two requests for the progress of an
+// operation.
+var PollInterval time.Duration = 2e9
+
+type operationStep struct {
+	Name   string
+	Status string
+	Error  string
+}
+
+type operation struct {
+	Id     string
+	Kind   string
+	App    string
+	Status string
+	Error  string
+	Steps  []operationStep
+}
+
+func (op *operation) done() bool {
+	return op.Status == "succeeded" || op.Status == "failed"
+}
+
+func getOperation(client cmd.Doer, id string) (*operation, error) {
+	request, err := http.NewRequest("GET", cmd.GetUrl("/operations/"+id), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	var op operation
+	if err = json.Unmarshal(result, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+func formatStep(step operationStep) string {
+	switch step.Status {
+	case "done", "rolled back":
+		return fmt.Sprintf(" ---> %s... %s\n", step.Name, step.Status)
+	case "failed":
+		return fmt.Sprintf(" ---> %s... failed: %s\n", step.Name, step.Error)
+	}
+	return ""
+}
+
+// WaitOperation polls the server until the given operation finishes,
+// displaying the progress of each step. It returns an error if the operation
+// fails.
+func WaitOperation(context *cmd.Context, client cmd.Doer, id string) error {
+	printed := make(map[int]string)
+	for {
+		op, err := getOperation(client, id)
+		if err != nil {
+			return err
+		}
+		for i, step := range op.Steps {
+			if printed[i] == step.Status {
+				continue
+			}
+			if line := formatStep(step); line != "" {
+				fmt.Fprint(context.Stdout, line)
+				printed[i] = step.Status
+			}
+		}
+		if op.Status == "failed" {
+			return errors.New(op.Error)
+		}
+		if op.done() {
+			break
+		}
+		time.Sleep(PollInterval)
+	}
+	return nil
+}
+
+type OperationInfo struct{}
+
+func (c *OperationInfo) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "operation-info",
+		Usage:   "operation-info <id>",
+		Desc:    "show the progress of an operation started with --async.",
+		MinArgs: 1,
+	}
+}
+
+func (c *OperationInfo) Run(context *cmd.Context, client cmd.Doer) error {
+	op, err := getOperation(client, context.Args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Operation: %s\nApp: %s\nStatus: %s\n", op.Kind, op.App, op.Status)
+	if op.Error != "" {
+		fmt.Fprintf(context.Stdout, "Error: %s\n", op.Error)
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Step", "Status"})
+	for _, step := range op.Steps {
+		table.AddRow(cmd.Row([]string{step.Name, step.Status}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
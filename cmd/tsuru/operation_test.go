@@ -0,0 +1,97 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"net/http"
+)
+
+// sequentialTransport returns its messages in order, one for each request.
+type sequentialTransport struct {
+	msgs     []string
+	requests []*http.Request
+}
+
+func (t *sequentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	msg := t.msgs[len(t.requests)]
+	t.requests = append(t.requests, req)
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(msg)),
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+func (s *S) TestWaitOperation(c *C) {
+	old := PollInterval
+	PollInterval = 1e6
+	defer func() { PollInterval = old }()
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	trans := sequentialTransport{msgs: []string{
+		`{"Id":"123","Status":"running","Steps":[{"Name":"save the app","Status":"done"},{"Name":"provision units","Status":"running"}]}`,
+		`{"Id":"123","Status":"running","Steps":[{"Name":"save the app","Status":"done"},{"Name":"provision units","Status":"running"}]}`,
+		`{"Id":"123","Status":"succeeded","Steps":[{"Name":"save the app","Status":"done"},{"Name":"provision units","Status":"done"}]}`,
+	}}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := WaitOperation(&context, client, "123")
+	c.Assert(err, IsNil)
+	c.Assert(trans.requests, HasLen, 3)
+	c.Assert(trans.requests[0].URL.Path, Equals, "/operations/123")
+	expected := " ---> save the app... done\n ---> provision units... done\n"
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestWaitOperationFailure(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	trans := sequentialTransport{msgs: []string{
+		`{"Id":"123","Status":"failed","Error":"gandalf is down","Steps":[{"Name":"save the app","Status":"rolled back"},{"Name":"create the git repository","Status":"failed","Error":"gandalf is down"}]}`,
+	}}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := WaitOperation(&context, client, "123")
+	c.Assert(err, ErrorMatches, "^gandalf is down$")
+	expected := " ---> save the app... rolled back\n ---> create the git repository... failed: gandalf is down\n"
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestOperationInfoInfo(c *C) {
+	expected := &cmd.Info{
+		Name:    "operation-info",
+		Usage:   "operation-info <id>",
+		Desc:    "show the progress of an operation started with --async.",
+		MinArgs: 1,
+	}
+	c.Assert((&OperationInfo{}).Info(), DeepEquals, expected)
+}
+
+func (s *S) TestOperationInfoRun(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Args: []string{"123"}, Stdout: &stdout, Stderr: &stderr}
+	result := `{"Id":"123","Kind":"create-app","App":"ble","Status":"running","Steps":[{"Name":"save the app","Status":"done"},{"Name":"provision units","Status":"running"}]}`
+	trans := conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/operations/123"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := (&OperationInfo{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	expected := `Operation: create-app
+App: ble
+Status: running
++-----------------+---------+
+| Step            | Status  |
++-----------------+---------+
+| save the app    | done    |
+| provision units | running |
++-----------------+---------+
+`
+	c.Assert(stdout.String(), Equals, expected)
+}
@@ -0,0 +1,78 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+type AppCleanup struct{}
+
+func (c *AppCleanup) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-cleanup",
+		Usage: "app-cleanup [appname]",
+		Desc: `finishes the removals of apps that did not complete.
+
+When the removal of an app fails, the resources already destroyed stay
+destroyed and the app can't be removed again until its removal finishes. This
+command retries every stuck removal, or only the ones of the given app, from
+the step that failed, and displays the status of each step. Removals that
+failed more than a week ago are forgotten.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AppCleanup) Run(context *cmd.Context, client cmd.Doer) error {
+	u := cmd.GetUrl("/removals/cleanup")
+	if len(context.Args) > 0 {
+		u += "?app=" + url.QueryEscape(context.Args[0])
+	}
+	request, err := http.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "No stuck removals.")
+		return nil
+	}
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var removals []struct {
+		App    string
+		Status string
+		Steps  []struct {
+			Name   string
+			Status string
+			Error  string
+		}
+	}
+	if err = json.Unmarshal(result, &removals); err != nil {
+		return err
+	}
+	for _, r := range removals {
+		fmt.Fprintf(context.Stdout, "Removal of the app %q: %s\n", r.App, r.Status)
+		for _, step := range r.Steps {
+			fmt.Fprintf(context.Stdout, "  %s: %s", step.Name, step.Status)
+			if step.Error != "" {
+				fmt.Fprintf(context.Stdout, " (%s)", step.Error)
+			}
+			fmt.Fprintln(context.Stdout)
+		}
+	}
+	return nil
+}
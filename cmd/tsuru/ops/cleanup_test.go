@@ -0,0 +1,61 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	. "launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestAppCleanup(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"myapp"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	result := `[{"App":"myapp","Status":"failed","Steps":[` +
+		`{"Name":"destroy units","Status":"done"},` +
+		`{"Name":"remove the app from the router","Status":"failed","Error":"router is down"},` +
+		`{"Name":"remove the app from the database","Status":"pending"}]}]`
+	trans := conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "POST" && req.URL.Path == "/removals/cleanup" &&
+				req.URL.Query().Get("app") == "myapp"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := AppCleanup{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	expected := `Removal of the app "myapp": failed
+  destroy units: done
+  remove the app from the router: failed (router is down)
+  remove the app from the database: pending
+`
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestAppCleanupWithoutStuckRemovals(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusNoContent},
+		func(req *http.Request) bool {
+			return req.Method == "POST" && req.URL.Path == "/removals/cleanup" && req.URL.RawQuery == ""
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := AppCleanup{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "No stuck removals.\n")
+}
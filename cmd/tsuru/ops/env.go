@@ -0,0 +1,48 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"net/http"
+)
+
+type EnvReencrypt struct{}
+
+func (c *EnvReencrypt) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "env-reencrypt",
+		Usage: "env-reencrypt",
+		Desc: `encrypts the private environment variables of all apps with the current key.
+
+Run it after rotating the key in env-encryption:key, before removing the
+previous key from env-encryption:old-keys.`,
+	}
+}
+
+func (c *EnvReencrypt) Run(context *cmd.Context, client cmd.Doer) error {
+	request, err := http.NewRequest("POST", cmd.GetUrl("/env/reencrypt"), nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var out map[string]int
+	if err = json.Unmarshal(result, &out); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Private env vars of %d app(s) re-encrypted.\n", out["apps"])
+	return nil
+}
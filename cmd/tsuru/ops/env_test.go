@@ -0,0 +1,31 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	. "launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestEnvReencrypt(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: `{"apps":3}`, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "POST" && req.URL.Path == "/env/reencrypt"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := EnvReencrypt{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "Private env vars of 3 app(s) re-encrypted.\n")
+}
@@ -0,0 +1,130 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type HostList struct{}
+
+func (c *HostList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "host-list",
+		Usage:   "host-list",
+		Desc:    "lists the hosts in the pool of the ssh provisioner.",
+		MinArgs: 0,
+	}
+}
+
+func (c *HostList) Run(context *cmd.Context, client cmd.Doer) error {
+	request, err := http.NewRequest("GET", cmd.GetUrl("/hosts"), nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var hosts []struct {
+		Address  string
+		Machine  int
+		Capacity int
+		Units    []struct{ Name string }
+	}
+	if err = json.Unmarshal(result, &hosts); err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Host", "Machine", "Capacity", "Units"})
+	for _, h := range hosts {
+		units := make([]string, len(h.Units))
+		for i, u := range h.Units {
+			units[i] = u.Name
+		}
+		table.AddRow(cmd.Row([]string{
+			h.Address,
+			strconv.Itoa(h.Machine),
+			fmt.Sprintf("%d/%d", len(h.Units), h.Capacity),
+			strings.Join(units, ", "),
+		}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type HostAdd struct{}
+
+func (c *HostAdd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "host-add",
+		Usage:   "host-add <address> <capacity>",
+		Desc:    "adds a host to the pool of the ssh provisioner. The capacity is the maximum number of units in the host.",
+		MinArgs: 2,
+	}
+}
+
+func (c *HostAdd) Run(context *cmd.Context, client cmd.Doer) error {
+	address := context.Args[0]
+	capacity, err := strconv.Atoi(context.Args[1])
+	if err != nil {
+		return fmt.Errorf("Invalid capacity: %q.", context.Args[1])
+	}
+	b, err := json.Marshal(map[string]interface{}{"address": address, "capacity": capacity})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", cmd.GetUrl("/hosts"), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Host %q successfully added!\n", address)
+	return nil
+}
+
+type HostRemove struct{}
+
+func (c *HostRemove) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "host-remove",
+		Usage:   "host-remove <address>",
+		Desc:    "removes a host from the pool of the ssh provisioner. Only hosts without units can be removed.",
+		MinArgs: 1,
+	}
+}
+
+func (c *HostRemove) Run(context *cmd.Context, client cmd.Doer) error {
+	address := context.Args[0]
+	request, err := http.NewRequest("DELETE", cmd.GetUrl("/hosts/"+address), nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Host %q successfully removed!\n", address)
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestHostList(c *C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Address":"10.10.10.1","Machine":1,"Capacity":4,"Units":[{"Name":"myapp/0"},{"Name":"myapp/1"}]},
+{"Address":"10.10.10.2","Machine":2,"Capacity":2,"Units":[]}]`
+	expected := `+------------+---------+----------+------------------+
+| Host       | Machine | Capacity | Units            |
++------------+---------+----------+------------------+
+| 10.10.10.1 | 1       | 2/4      | myapp/0, myapp/1 |
+| 10.10.10.2 | 2       | 0/2      |                  |
++------------+---------+----------+------------------+
+`
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	trans := conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/hosts"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := (&HostList{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestHostListWithoutHosts(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: "", status: http.StatusNoContent}}, nil, manager)
+	err := (&HostList{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "")
+}
+
+func (s *S) TestHostAdd(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"10.10.10.1", "4"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusCreated},
+		func(req *http.Request) bool {
+			defer req.Body.Close()
+			body, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, IsNil)
+			c.Assert(string(body), Equals, `{"address":"10.10.10.1","capacity":4}`)
+			return req.Method == "POST" && req.URL.Path == "/hosts"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := (&HostAdd{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Host "10.10.10.1" successfully added!`+"\n")
+}
+
+func (s *S) TestHostAddInvalidCapacity(c *C) {
+	context := cmd.Context{Args: []string{"10.10.10.1", "four"}}
+	err := (&HostAdd{}).Run(&context, nil)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, `Invalid capacity: "four".`)
+}
+
+func (s *S) TestHostRemove(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"10.10.10.1"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "DELETE" && req.URL.Path == "/hosts/10.10.10.1"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := (&HostRemove{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Host "10.10.10.1" successfully removed!`+"\n")
+}
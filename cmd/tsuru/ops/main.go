@@ -19,6 +19,24 @@ const (
 func buildManager(name string) *cmd.Manager {
 	m := cmd.BuildBaseManager(name, version, header)
 	m.Register(&tsuru.AppList{})
+	m.Register(&tsuru.PlanList{})
+	m.Register(&PlanCreate{})
+	m.Register(&PlanRemove{})
+	m.Register(&PlanGrant{})
+	m.Register(&PlanRevoke{})
+	m.Register(&tsuru.PlatformList{})
+	m.Register(&PlatformAdd{})
+	m.Register(&PlatformRemove{})
+	m.Register(&PlatformDeprecate{})
+	m.Register(&PlatformEnable{})
+	m.Register(&PlatformApps{})
+	m.Register(&QuotaGet{})
+	m.Register(&QuotaSet{})
+	m.Register(&EnvReencrypt{})
+	m.Register(&AppCleanup{})
+	m.Register(&HostList{})
+	m.Register(&HostAdd{})
+	m.Register(&HostRemove{})
 	return m
 }
 
@@ -17,6 +17,80 @@ func (s *S) TestAppListIsRegistered(c *C) {
 	c.Assert(list, FitsTypeOf, &tsuru.AppList{})
 }
 
+func (s *S) TestPlanCommandsAreRegistered(c *C) {
+	manager := buildManager("tsuru")
+	commands := map[string]interface{}{
+		"plan-list":   &tsuru.PlanList{},
+		"plan-create": &PlanCreate{},
+		"plan-remove": &PlanRemove{},
+		"plan-grant":  &PlanGrant{},
+		"plan-revoke": &PlanRevoke{},
+	}
+	for name, instance := range commands {
+		command, ok := manager.Commands[name]
+		c.Assert(ok, Equals, true)
+		c.Assert(command, FitsTypeOf, instance)
+	}
+}
+
+func (s *S) TestPlatformCommandsAreRegistered(c *C) {
+	manager := buildManager("tsuru")
+	commands := map[string]interface{}{
+		"platform-list":      &tsuru.PlatformList{},
+		"platform-add":       &PlatformAdd{},
+		"platform-remove":    &PlatformRemove{},
+		"platform-deprecate": &PlatformDeprecate{},
+		"platform-enable":    &PlatformEnable{},
+		"platform-apps":      &PlatformApps{},
+	}
+	for name, instance := range commands {
+		command, ok := manager.Commands[name]
+		c.Assert(ok, Equals, true)
+		c.Assert(command, FitsTypeOf, instance)
+	}
+}
+
+func (s *S) TestQuotaCommandsAreRegistered(c *C) {
+	manager := buildManager("tsuru")
+	commands := map[string]interface{}{
+		"quota-get": &QuotaGet{},
+		"quota-set": &QuotaSet{},
+	}
+	for name, instance := range commands {
+		command, ok := manager.Commands[name]
+		c.Assert(ok, Equals, true)
+		c.Assert(command, FitsTypeOf, instance)
+	}
+}
+
+func (s *S) TestEnvReencryptIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	command, ok := manager.Commands["env-reencrypt"]
+	c.Assert(ok, Equals, true)
+	c.Assert(command, FitsTypeOf, &EnvReencrypt{})
+}
+
+func (s *S) TestAppCleanupIsRegistered(c *C) {
+	manager := buildManager("tsuru")
+	command, ok := manager.Commands["app-cleanup"]
+	c.Assert(ok, Equals, true)
+	c.Assert(command, FitsTypeOf, &AppCleanup{})
+}
+
+func (s *S) TestHostCommandsAreRegistered(c *C) {
+	manager := buildManager("tsuru")
+	commands := map[string]interface{}{
+		"host-list":   &HostList{},
+		"host-add":    &HostAdd{},
+		"host-remove": &HostRemove{},
+	}
+	for name, instance := range commands {
+		command, ok := manager.Commands[name]
+		c.Assert(ok, Equals, true)
+		c.Assert(command, FitsTypeOf, instance)
+	}
+}
+
 func (s *S) TestCommandsFromBaseManagerAreRegistered(c *C) {
 	baseManager := cmd.BuildBaseManager("tsuru", version, header)
 	manager := buildManager("tsuru")
@@ -0,0 +1,143 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"net/http"
+	"strconv"
+)
+
+type PlanCreate struct{}
+
+func (c *PlanCreate) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "plan-create",
+		Usage: "plan-create <name> <memory> <cpushare> [disk] [default]",
+		Desc: `creates a new plan.
+
+Memory and disk are expressed in megabytes, zero means unlimited. If the last
+argument is "default", the plan will be used by apps created without a plan.`,
+		MinArgs: 3,
+	}
+}
+
+func (c *PlanCreate) Run(context *cmd.Context, client cmd.Doer) error {
+	plan := map[string]interface{}{"Name": context.Args[0]}
+	args := context.Args[1:]
+	if n := len(args); n > 0 && args[n-1] == "default" {
+		plan["Default"] = true
+		args = args[:n-1]
+	}
+	fields := []string{"Memory", "CpuShare", "Disk"}
+	if len(args) > len(fields) {
+		return errors.New("Too many arguments.")
+	}
+	for i, arg := range args {
+		value, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid value for %s: %q.", fields[i], arg)
+		}
+		plan[fields[i]] = value
+	}
+	b, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", cmd.GetUrl("/plans"), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Plan %q successfully created!\n", context.Args[0])
+	return nil
+}
+
+type PlanRemove struct{}
+
+func (c *PlanRemove) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "plan-remove",
+		Usage:   "plan-remove <name>",
+		Desc:    "removes a plan. Apps using the plan keep their units as they are.",
+		MinArgs: 1,
+	}
+}
+
+func (c *PlanRemove) Run(context *cmd.Context, client cmd.Doer) error {
+	name := context.Args[0]
+	request, err := http.NewRequest("DELETE", cmd.GetUrl("/plans/"+name), nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Plan %q successfully removed!\n", name)
+	return nil
+}
+
+type PlanGrant struct{}
+
+func (c *PlanGrant) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "plan-grant",
+		Usage: "plan-grant <planname> <teamname>",
+		Desc: `restricts a plan to a team.
+
+Plans without teams are available to everybody.`,
+		MinArgs: 2,
+	}
+}
+
+func (c *PlanGrant) Run(context *cmd.Context, client cmd.Doer) error {
+	planName, teamName := context.Args[0], context.Args[1]
+	url := cmd.GetUrl(fmt.Sprintf("/plans/%s/%s", planName, teamName))
+	request, err := http.NewRequest("PUT", url, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, `Team "%s" was added to the plan "%s"`+"\n", teamName, planName)
+	return nil
+}
+
+type PlanRevoke struct{}
+
+func (c *PlanRevoke) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "plan-revoke",
+		Usage:   "plan-revoke <planname> <teamname>",
+		Desc:    "revokes the access of a team to a plan.",
+		MinArgs: 2,
+	}
+}
+
+func (c *PlanRevoke) Run(context *cmd.Context, client cmd.Doer) error {
+	planName, teamName := context.Args[0], context.Args[1]
+	url := cmd.GetUrl(fmt.Sprintf("/plans/%s/%s", planName, teamName))
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, `Team "%s" was removed from the plan "%s"`+"\n", teamName, planName)
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestPlanCreate(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"small", "512", "100", "default"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusCreated},
+		func(req *http.Request) bool {
+			defer req.Body.Close()
+			body, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, IsNil)
+			c.Assert(string(body), Equals, `{"CpuShare":100,"Default":true,"Memory":512,"Name":"small"}`)
+			return req.Method == "POST" && req.URL.Path == "/plans"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := PlanCreate{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Plan "small" successfully created!`+"\n")
+}
+
+func (s *S) TestPlanCreateInvalidValue(c *C) {
+	context := cmd.Context{Args: []string{"small", "512MB", "100"}}
+	command := PlanCreate{}
+	err := command.Run(&context, nil)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, `Invalid value for Memory: "512MB".`)
+}
+
+func (s *S) TestPlanCreateTooManyArguments(c *C) {
+	context := cmd.Context{Args: []string{"small", "512", "100", "1024", "10"}}
+	command := PlanCreate{}
+	err := command.Run(&context, nil)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "Too many arguments.")
+}
+
+func (s *S) TestPlanRemove(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"small"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "DELETE" && req.URL.Path == "/plans/small"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := PlanRemove{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Plan "small" successfully removed!`+"\n")
+}
+
+func (s *S) TestPlanGrant(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"huge", "ops"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "PUT" && req.URL.Path == "/plans/huge/ops"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := PlanGrant{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Team "ops" was added to the plan "huge"`+"\n")
+}
+
+func (s *S) TestPlanRevoke(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"huge", "ops"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "DELETE" && req.URL.Path == "/plans/huge/ops"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := PlanRevoke{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Team "ops" was removed from the plan "huge"`+"\n")
+}
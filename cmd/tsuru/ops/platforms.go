@@ -0,0 +1,171 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"net/http"
+)
+
+type PlatformAdd struct{}
+
+func (c *PlatformAdd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "platform-add",
+		Usage: "platform-add <name> [description] [template]",
+		Desc: `adds a platform to the catalog of frameworks available for new apps.
+
+The template is the provisioner-specific definition of the platform, like the
+charm used by juju. When omitted, the provisioner uses the name of the
+platform.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *PlatformAdd) Run(context *cmd.Context, client cmd.Doer) error {
+	platform := map[string]string{"Name": context.Args[0]}
+	if len(context.Args) > 1 {
+		platform["Description"] = context.Args[1]
+	}
+	if len(context.Args) > 2 {
+		platform["Template"] = context.Args[2]
+	}
+	b, err := json.Marshal(platform)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", cmd.GetUrl("/platforms"), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Platform %q successfully added!\n", context.Args[0])
+	return nil
+}
+
+type PlatformRemove struct{}
+
+func (c *PlatformRemove) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "platform-remove",
+		Usage:   "platform-remove <name>",
+		Desc:    "removes a platform. Platforms used by apps can't be removed, deprecate them instead.",
+		MinArgs: 1,
+	}
+}
+
+func (c *PlatformRemove) Run(context *cmd.Context, client cmd.Doer) error {
+	name := context.Args[0]
+	request, err := http.NewRequest("DELETE", cmd.GetUrl("/platforms/"+name), nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Platform %q successfully removed!\n", name)
+	return nil
+}
+
+type PlatformDeprecate struct{}
+
+func (c *PlatformDeprecate) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "platform-deprecate",
+		Usage: "platform-deprecate <name>",
+		Desc: `deprecates a platform, so it can't be used by new apps.
+
+Apps that already use the platform keep working. Use platform-apps to see them.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *PlatformDeprecate) Run(context *cmd.Context, client cmd.Doer) error {
+	name := context.Args[0]
+	request, err := http.NewRequest("PUT", cmd.GetUrl(fmt.Sprintf("/platforms/%s/deprecate", name)), nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Platform %q successfully deprecated!\n", name)
+	return nil
+}
+
+type PlatformEnable struct{}
+
+func (c *PlatformEnable) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "platform-enable",
+		Usage:   "platform-enable <name>",
+		Desc:    "makes a deprecated platform available for new apps again.",
+		MinArgs: 1,
+	}
+}
+
+func (c *PlatformEnable) Run(context *cmd.Context, client cmd.Doer) error {
+	name := context.Args[0]
+	request, err := http.NewRequest("PUT", cmd.GetUrl(fmt.Sprintf("/platforms/%s/enable", name)), nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Platform %q successfully enabled!\n", name)
+	return nil
+}
+
+type PlatformApps struct{}
+
+func (c *PlatformApps) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "platform-apps",
+		Usage:   "platform-apps <name>",
+		Desc:    "lists the apps that use a platform.",
+		MinArgs: 1,
+	}
+}
+
+func (c *PlatformApps) Run(context *cmd.Context, client cmd.Doer) error {
+	name := context.Args[0]
+	request, err := http.NewRequest("GET", cmd.GetUrl(fmt.Sprintf("/platforms/%s/apps", name)), nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintf(context.Stdout, "No apps use the platform %q.\n", name)
+		return nil
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var apps []string
+	if err = json.Unmarshal(result, &apps); err != nil {
+		return err
+	}
+	for _, app := range apps {
+		fmt.Fprintln(context.Stdout, app)
+	}
+	return nil
+}
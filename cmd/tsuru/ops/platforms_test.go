@@ -0,0 +1,131 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestPlatformAdd(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"java", "Java with Tomcat", "cs:precise/tomcat"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusCreated},
+		func(req *http.Request) bool {
+			defer req.Body.Close()
+			body, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, IsNil)
+			c.Assert(string(body), Equals, `{"Description":"Java with Tomcat","Name":"java","Template":"cs:precise/tomcat"}`)
+			return req.Method == "POST" && req.URL.Path == "/platforms"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := PlatformAdd{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Platform "java" successfully added!`+"\n")
+}
+
+func (s *S) TestPlatformRemove(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"java"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "DELETE" && req.URL.Path == "/platforms/java"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := PlatformRemove{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Platform "java" successfully removed!`+"\n")
+}
+
+func (s *S) TestPlatformDeprecate(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"java"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "PUT" && req.URL.Path == "/platforms/java/deprecate"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := PlatformDeprecate{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Platform "java" successfully deprecated!`+"\n")
+}
+
+func (s *S) TestPlatformEnable(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"java"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "PUT" && req.URL.Path == "/platforms/java/enable"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := PlatformEnable{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Platform "java" successfully enabled!`+"\n")
+}
+
+func (s *S) TestPlatformApps(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"java"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: `["coffee","bean"]`, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/platforms/java/apps"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := PlatformApps{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "coffee\nbean\n")
+}
+
+func (s *S) TestPlatformAppsWithoutApps(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"java"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: "", status: http.StatusNoContent}}, nil, manager)
+	command := PlatformApps{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `No apps use the platform "java".`+"\n")
+}
@@ -0,0 +1,110 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+type quota struct {
+	Owner    string
+	MaxApps  int
+	MaxUnits int
+	Apps     int
+	Units    int
+}
+
+func limit(n int) string {
+	if n < 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(n)
+}
+
+type QuotaGet struct{}
+
+func (c *QuotaGet) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "quota-get",
+		Usage:   "quota-get <team-name|user-email>",
+		Desc:    "displays the quota of a team or user, with the current usage.",
+		MinArgs: 1,
+	}
+}
+
+func (c *QuotaGet) Run(context *cmd.Context, client cmd.Doer) error {
+	request, err := http.NewRequest("GET", cmd.GetUrl("/quota/"+context.Args[0]), nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var q quota
+	if err = json.Unmarshal(result, &q); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Apps: %d of %s\n", q.Apps, limit(q.MaxApps))
+	fmt.Fprintf(context.Stdout, "Units: %d of %s\n", q.Units, limit(q.MaxUnits))
+	return nil
+}
+
+type QuotaSet struct{}
+
+func (c *QuotaSet) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "quota-set",
+		Usage: "quota-set <team-name|user-email> <max-apps> <max-units>",
+		Desc: `changes the quota of a team or user.
+
+Use "unlimited" (or -1) to remove a limit. Apps count towards the quotas of the
+user that created them and of the teams that have access to them.`,
+		MinArgs: 3,
+	}
+}
+
+func (c *QuotaSet) Run(context *cmd.Context, client cmd.Doer) error {
+	owner := context.Args[0]
+	limits := map[string]int{}
+	for i, field := range []string{"MaxApps", "MaxUnits"} {
+		arg := context.Args[i+1]
+		if arg == "unlimited" {
+			limits[field] = -1
+			continue
+		}
+		value, err := strconv.Atoi(arg)
+		if err != nil || value < -1 {
+			return fmt.Errorf("Invalid value for %s: %q.", field, arg)
+		}
+		limits[field] = value
+	}
+	b, err := json.Marshal(limits)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("PUT", cmd.GetUrl("/quota/"+owner), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Quota of %q successfully changed!\n", owner)
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PlanName is the plan of the app created by app-create, or of the service
+// instance created by service-add.
+var PlanName = gnuflag.String("plan", "", "The plan of the new app or service instance.")
+
+type plan struct {
+	Name     string
+	Memory   int64
+	CpuShare int
+	Disk     int64
+	Default  bool
+	Teams    []string
+}
+
+func (p *plan) String() string {
+	return fmt.Sprintf("%s (memory: %s, CPU share: %s, disk: %s)",
+		p.Name, megabytes(p.Memory), unlimited(int64(p.CpuShare), ""), megabytes(p.Disk))
+}
+
+func unlimited(n int64, suffix string) string {
+	if n == 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(n, 10) + suffix
+}
+
+func megabytes(n int64) string {
+	return unlimited(n, "MB")
+}
+
+type PlanList struct{}
+
+func (c *PlanList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "plan-list",
+		Usage: "plan-list",
+		Desc:  "list all plans available for your apps.",
+	}
+}
+
+func (c *PlanList) Run(context *cmd.Context, client cmd.Doer) error {
+	request, err := http.NewRequest("GET", cmd.GetUrl("/plans"), nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var plans []plan
+	err = json.Unmarshal(result, &plans)
+	if err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Plan", "Memory", "CPU share", "Disk", "Default", "Teams"})
+	for _, p := range plans {
+		var def string
+		if p.Default {
+			def = "yes"
+		}
+		table.AddRow(cmd.Row([]string{
+			p.Name, megabytes(p.Memory), unlimited(int64(p.CpuShare), ""),
+			megabytes(p.Disk), def, strings.Join(p.Teams, ", "),
+		}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type AppChangePlan struct {
+	GuessingCommand
+}
+
+func (c *AppChangePlan) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-change-plan",
+		Usage: "app-change-plan <planname> [--app appname]",
+		Desc: `changes the plan of an app.
+
+Units added after the change will be sized according to the new plan.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *AppChangePlan) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	planName := context.Args[0]
+	url := cmd.GetUrl(fmt.Sprintf("/apps/%s/plan", appName))
+	request, err := http.NewRequest("PUT", url, strings.NewReader(planName))
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, `Plan of the app "%s" changed to "%s".`+"\n", appName, planName)
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestPlanListInfo(c *C) {
+	expected := &cmd.Info{
+		Name:  "plan-list",
+		Usage: "plan-list",
+		Desc:  "list all plans available for your apps.",
+	}
+	c.Assert((&PlanList{}).Info(), DeepEquals, expected)
+}
+
+func (s *S) TestPlanList(c *C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Name":"small","Memory":512,"CpuShare":100,"Disk":0,"Default":true,"Teams":[]},
+{"Name":"huge","Memory":8192,"CpuShare":400,"Disk":10240,"Default":false,"Teams":["admin","ops"]}]`
+	expected := `+-------+--------+-----------+-----------+---------+------------+
+| Plan  | Memory | CPU share | Disk      | Default | Teams      |
++-------+--------+-----------+-----------+---------+------------+
+| small | 512MB  | 100       | unlimited | yes     |            |
+| huge  | 8192MB | 400       | 10240MB   |         | admin, ops |
++-------+--------+-----------+-----------+---------+------------+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/plans"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := PlanList{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestPlanListWithoutPlans(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: "", status: http.StatusNoContent}}, nil, manager)
+	command := PlanList{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "")
+}
+
+func (s *S) TestAppChangePlanInfo(c *C) {
+	info := (&AppChangePlan{}).Info()
+	c.Assert(info.Name, Equals, "app-change-plan")
+	c.Assert(info.Usage, Equals, "app-change-plan <planname> [--app appname]")
+	c.Assert(info.MinArgs, Equals, 1)
+}
+
+func (s *S) TestAppChangePlan(c *C) {
+	*AppName = "growing"
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"medium"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			defer req.Body.Close()
+			body, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, IsNil)
+			c.Assert(string(body), Equals, "medium")
+			return req.Method == "PUT" && req.URL.Path == "/apps/growing/plan"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := AppChangePlan{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, `Plan of the app "growing" changed to "medium".`+"\n")
+}
+
+func (s *S) TestAppInfoShowsPlan(c *C) {
+	*AppName = "app1"
+	var stdout, stderr bytes.Buffer
+	result := `{"Name":"app1","Framework":"php","Repository":"git@git.com:php.git","State":"dead","Units":[],"Teams":["tsuruteam"],"Plan":{"Name":"small","Memory":512,"CpuShare":100,"Disk":0}}`
+	expected := `Application: app1
+State: dead
+Repository: git@git.com:php.git
+Platform: php
+Teams: tsuruteam
+Plan: small (memory: 512MB, CPU share: 100, disk: unlimited)
+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	command := AppInfo{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
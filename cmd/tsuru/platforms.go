@@ -0,0 +1,64 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/cmd"
+	"io/ioutil"
+	"net/http"
+)
+
+type platform struct {
+	Name        string
+	Description string
+	Template    string
+	Enabled     bool
+}
+
+type PlatformList struct{}
+
+func (c *PlatformList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "platform-list",
+		Usage: "platform-list",
+		Desc:  "list the platforms (frameworks) available for new apps.",
+	}
+}
+
+func (c *PlatformList) Run(context *cmd.Context, client cmd.Doer) error {
+	request, err := http.NewRequest("GET", cmd.GetUrl("/platforms"), nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var platforms []platform
+	err = json.Unmarshal(result, &platforms)
+	if err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Platform", "Description", "State"})
+	for _, p := range platforms {
+		state := "enabled"
+		if !p.Enabled {
+			state = "deprecated"
+		}
+		table.AddRow(cmd.Row([]string{p.Name, p.Description, state}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
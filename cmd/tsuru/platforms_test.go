@@ -0,0 +1,62 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsuru
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	. "launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestPlatformListInfo(c *C) {
+	expected := &cmd.Info{
+		Name:  "platform-list",
+		Usage: "platform-list",
+		Desc:  "list the platforms (frameworks) available for new apps.",
+	}
+	c.Assert((&PlatformList{}).Info(), DeepEquals, expected)
+}
+
+func (s *S) TestPlatformList(c *C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Name":"python","Description":"Python 2.7","Template":"","Enabled":true},
+{"Name":"ruby18","Description":"Ruby 1.8","Template":"","Enabled":false}]`
+	expected := `+----------+-------------+------------+
+| Platform | Description | State      |
++----------+-------------+------------+
+| python   | Python 2.7  | enabled    |
+| ruby18   | Ruby 1.8    | deprecated |
++----------+-------------+------------+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: result, status: http.StatusOK},
+		func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/platforms"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := PlatformList{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestPlatformListWithoutPlatforms(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: "", status: http.StatusNoContent}}, nil, manager)
+	command := PlatformList{}
+	err := command.Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "")
+}
@@ -54,12 +54,14 @@ func (s *ServiceList) Run(ctx *cmd.Context, client cmd.Doer) error {
 type ServiceAdd struct{}
 
 func (sa *ServiceAdd) Info() *cmd.Info {
-	usage := `service-add <servicename> <serviceinstancename>
+	usage := `service-add <servicename> <serviceinstancename> [--plan planname]
 e.g.:
 
     $ tsuru service-add mongodb tsuru_mongodb
 
-Will add a new instance of the "mongodb" service, named "tsuru_mongodb".`
+Will add a new instance of the "mongodb" service, named "tsuru_mongodb".
+
+The plans of the service are listed by service-info.`
 	return &cmd.Info{
 		Name:    "service-add",
 		Usage:   usage,
@@ -70,18 +72,29 @@ Will add a new instance of the "mongodb" service, named "tsuru_mongodb".`
 
 func (sa *ServiceAdd) Run(ctx *cmd.Context, client cmd.Doer) error {
 	srvName, instName := ctx.Args[0], ctx.Args[1]
-	fmtBody := fmt.Sprintf(`{"name": "%s", "service_name": "%s"}`, instName, srvName)
-	b := bytes.NewBufferString(fmtBody)
+	body := map[string]string{"name": instName, "service_name": srvName}
+	if *PlanName != "" {
+		body["plan"] = *PlanName
+	}
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(body); err != nil {
+		return err
+	}
 	url := cmd.GetUrl("/services/instances")
-	request, err := http.NewRequest("POST", url, b)
+	request, err := http.NewRequest("POST", url, &b)
 	request.Header.Set("Content-Type", "application/json")
 	if err != nil {
 		return err
 	}
-	_, err = client.Do(request)
+	resp, err := client.Do(request)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusAccepted {
+		fmt.Fprintf(ctx.Stdout, "Service instance %q is being created. Run \"tsuru service-status %s\" to follow it.\n", instName, instName)
+		return nil
+	}
 	fmt.Fprint(ctx.Stdout, "Service successfully added.\n")
 	return nil
 }
@@ -235,7 +248,7 @@ e.g.:
 	return &cmd.Info{
 		Name:    "service-info",
 		Usage:   usg,
-		Desc:    "List all instances of a service",
+		Desc:    "List all instances and plans of a service",
 		MinArgs: 1,
 	}
 }
@@ -266,6 +279,10 @@ func (c *ServiceInfo) Run(ctx *cmd.Context, client cmd.Doer) error {
 	if err != nil {
 		return err
 	}
+	plans, err := c.plans(serviceName, client)
+	if err != nil {
+		fmt.Fprintf(ctx.Stderr, "Warning: could not get the plans of the service: %s\n", err)
+	}
 	ctx.Stdout.Write([]byte(fmt.Sprintf("Info for \"%s\"\n", serviceName)))
 	if len(instances) > 0 {
 		table := cmd.NewTable()
@@ -276,9 +293,42 @@ func (c *ServiceInfo) Run(ctx *cmd.Context, client cmd.Doer) error {
 		}
 		ctx.Stdout.Write(table.Bytes())
 	}
+	if len(plans) > 0 {
+		fmt.Fprint(ctx.Stdout, "\nPlans\n")
+		table := cmd.NewTable()
+		table.Headers = cmd.Row([]string{"Name", "Description"})
+		for _, p := range plans {
+			table.AddRow(cmd.Row([]string{p.Name, p.Description}))
+		}
+		ctx.Stdout.Write(table.Bytes())
+	}
 	return nil
 }
 
+type servicePlan struct {
+	Name        string
+	Description string
+}
+
+// plans returns the plans of the service that the user is allowed to use.
+func (c *ServiceInfo) plans(serviceName string, client cmd.Doer) ([]servicePlan, error) {
+	request, err := http.NewRequest("GET", cmd.GetUrl("/services/"+serviceName+"/plans"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var plans []servicePlan
+	if resp.StatusCode == http.StatusNoContent {
+		return plans, nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(&plans)
+	return plans, err
+}
+
 type ServiceDoc struct{}
 
 func (c *ServiceDoc) Info() *cmd.Info {
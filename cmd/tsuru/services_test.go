@@ -6,6 +6,7 @@ package tsuru
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/globocom/tsuru/cmd"
 	. "launchpad.net/gocheck"
 	"net/http"
@@ -290,12 +291,14 @@ func (s *S) TestServiceUnbindIsAComand(c *C) {
 }
 
 func (s *S) TestServiceAddInfo(c *C) {
-	usage := `service-add <servicename> <serviceinstancename>
+	usage := `service-add <servicename> <serviceinstancename> [--plan planname]
 e.g.:
 
     $ tsuru service-add mongodb tsuru_mongodb
 
-Will add a new instance of the "mongodb" service, named "tsuru_mongodb".`
+Will add a new instance of the "mongodb" service, named "tsuru_mongodb".
+
+The plans of the service are listed by service-info.`
 	expected := &cmd.Info{
 		Name:    "service-add",
 		Usage:   usage,
@@ -325,6 +328,43 @@ func (s *S) TestServiceAddRun(c *C) {
 	c.Assert(obtained, Equals, result)
 }
 
+func (s *S) TestServiceAddRunWithInstancesThatAreStillBeingCreated(c *C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"mysql", "my_app_db"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport{msg: "success", status: http.StatusAccepted}}, nil, manager)
+	err := (&ServiceAdd{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "Service instance \"my_app_db\" is being created. Run \"tsuru service-status my_app_db\" to follow it.\n")
+}
+
+func (s *S) TestServiceAddRunWithPlan(c *C) {
+	*PlanName = "small"
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"mysql", "my_app_db"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := conditionalTransport{
+		transport{msg: "", status: http.StatusOK},
+		func(req *http.Request) bool {
+			var body map[string]string
+			err := json.NewDecoder(req.Body).Decode(&body)
+			c.Assert(err, IsNil)
+			return req.URL.Path == "/services/instances" && body["plan"] == "small" &&
+				body["name"] == "my_app_db" && body["service_name"] == "mysql"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := (&ServiceAdd{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "Service successfully added.\n")
+}
+
 func (s *S) TestServiceInstanceStatusInfo(c *C) {
 	usg := `service-status <serviceinstancename>
 e.g.:
@@ -367,7 +407,7 @@ e.g.:
 	expected := &cmd.Info{
 		Name:    "service-info",
 		Usage:   usg,
-		Desc:    "List all instances of a service",
+		Desc:    "List all instances and plans of a service",
 		MinArgs: 1,
 	}
 	got := (&ServiceInfo{}).Info()
@@ -390,13 +430,71 @@ func (s *S) TestServiceInfoRun(c *C) {
 		Stdout: &stdout,
 		Stderr: &stderr,
 	}
-	client := cmd.NewClient(&http.Client{Transport: &transport{msg: result, status: http.StatusOK}}, nil, manager)
+	trans := sequentialTransport{msgs: []string{result, "null"}}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
 	err := (&ServiceInfo{}).Run(&context, client)
 	c.Assert(err, IsNil)
 	obtained := stdout.String()
 	c.Assert(obtained, Equals, expected)
 }
 
+func (s *S) TestServiceInfoRunShowsThePlans(c *C) {
+	var stdout, stderr bytes.Buffer
+	expected := `Info for "mongodb"
++-----------+-------+
+| Instances | Apps  |
++-----------+-------+
+| mymongo   | myapp |
++-----------+-------+
+
+Plans
++-------+----------------+
+| Name  | Description    |
++-------+----------------+
+| small | 1GB of storage |
++-------+----------------+
+`
+	context := cmd.Context{
+		Args:   []string{"mongodb"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := sequentialTransport{msgs: []string{
+		`[{"Name":"mymongo", "Apps":["myapp"]}]`,
+		`[{"Name":"small","Description":"1GB of storage"}]`,
+	}}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := (&ServiceInfo{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+	c.Assert(trans.requests[1].URL.Path, Equals, "/services/mongodb/plans")
+}
+
+func (s *S) TestServiceInfoRunShowsTheInstancesWhenThePlansFail(c *C) {
+	var stdout, stderr bytes.Buffer
+	expected := `Info for "mongodb"
++-----------+-------+
+| Instances | Apps  |
++-----------+-------+
+| mymongo   | myapp |
++-----------+-------+
+`
+	context := cmd.Context{
+		Args:   []string{"mongodb"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := sequentialTransport{msgs: []string{
+		`[{"Name":"mymongo", "Apps":["myapp"]}]`,
+		`not json`,
+	}}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	err := (&ServiceInfo{}).Run(&context, client)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, expected)
+	c.Assert(strings.HasPrefix(stderr.String(), "Warning: could not get the plans of the service: "), Equals, true)
+}
+
 func (s *S) TestServiceDocInfo(c *C) {
 	i := (&ServiceDoc{}).Info()
 	expected := &cmd.Info{
@@ -51,4 +51,8 @@ func (s *S) SetUpTest(c *C) {
 	var stdout, stderr bytes.Buffer
 	manager = cmd.NewManager("glb", "0.x", "Foo-Tsuru", &stdout, &stderr, os.Stdin)
 	AppName = new(string)
+	Force = new(bool)
+	*NamePattern, *Framework, *State, *TeamName, *Tag = "", "", "", "", ""
+	*Limit, *Page = 0, 1
+	*PlanName = ""
 }
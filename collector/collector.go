@@ -39,9 +39,21 @@ func (l *AppList) Add(a *app.App, index int) {
 	}
 }
 
+// unitIp returns the address of the unit of the app stored in the database,
+// or an empty string if the unit is not stored or has no address.
+func unitIp(a *app.App, name string) string {
+	for _, u := range a.Units {
+		if u.Name == name {
+			return u.Ip
+		}
+	}
+	return ""
+}
+
 func update(units []provision.Unit) {
 	log.Print("updating status from provisioner")
 	var l AppList
+	addressed := make(map[string][]app.Unit)
 	for _, unit := range units {
 		a, index := l.Search(unit.AppName)
 		if index > -1 {
@@ -57,14 +69,24 @@ func update(units []provision.Unit) {
 		u.Machine = unit.Machine
 		u.Ip = unit.Ip
 		u.State = string(unit.Status)
+		u.Process = unit.Process
 		a.State = string(unit.Status)
 		a.Ip = unit.Ip
+		if u.Ip != "" && unitIp(a, u.Name) == "" {
+			addressed[a.Name] = append(addressed[a.Name], u)
+		}
 		a.AddUnit(&u)
 		if index > -1 {
 			l.Add(a, index)
 		}
 	}
 	for _, a := range l {
+		if err := a.SyncRoutes(); err != nil {
+			log.Printf("collector: failed to sync the routes of the app %q: %s.", a.Name, err)
+		}
 		db.Session.Apps().Update(bson.M{"name": a.Name}, a)
+		if units := addressed[a.Name]; len(units) > 0 {
+			a.BindUnits(units)
+		}
 	}
 }
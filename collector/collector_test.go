@@ -5,11 +5,15 @@
 package main
 
 import (
+	"github.com/globocom/tsuru/api/service"
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/router/routertest"
 	"labix.org/v2/mgo/bson"
 	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
 )
 
 func getOutput() []provision.Unit {
@@ -46,6 +50,53 @@ func (s *S) TestUpdate(c *C) {
 	c.Assert(a.Units[0].State, Equals, string(provision.StatusStarted))
 }
 
+func (s *S) TestUpdateSyncsTheRoutesOfTheApp(c *C) {
+	r := routertest.NewFakeRouter()
+	app.Router = r
+	defer func() { app.Router = nil }()
+	a := getApp(c)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	r.AddBackend(a.Name)
+	r.AddRoute(a.Name, "192.168.0.10")
+	update(getOutput())
+	c.Assert(r.HasRoute(a.Name, "192.168.0.11"), Equals, true)
+	c.Assert(r.HasRoute(a.Name, "192.168.0.10"), Equals, false)
+	err := a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Ip, Equals, "umaappqq.fakerouter.com")
+}
+
+func (s *S) TestUpdateRemovesRoutesOfUnitsThatAreNotStarted(c *C) {
+	r := routertest.NewFakeRouter()
+	app.Router = r
+	defer func() { app.Router = nil }()
+	a := getApp(c)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	r.AddBackend(a.Name)
+	r.AddRoute(a.Name, "192.168.0.11")
+	out := getOutput()
+	out[0].Status = provision.StatusDown
+	update(out)
+	c.Assert(r.HasRoute(a.Name, "192.168.0.11"), Equals, false)
+}
+
+func (s *S) TestUpdateKeepsTheProcessOfUnits(c *C) {
+	a := &app.App{
+		Name:  "umaappqq",
+		State: "STOPPED",
+		Units: []app.Unit{{Name: "i-00000zz8", Process: "worker"}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	update(getOutput())
+	err = a.Get()
+	c.Assert(err, IsNil)
+	c.Assert(a.Units, HasLen, 1)
+	c.Assert(a.Units[0].Process, Equals, "worker")
+	c.Assert(a.Units[0].State, Equals, string(provision.StatusStarted))
+}
+
 func (s *S) TestUpdateWithMultipleUnits(c *C) {
 	a := getApp(c)
 	out := getOutput()
@@ -109,6 +160,30 @@ func (s *S) TestUpdateTwice(c *C) {
 	c.Assert(len(a.Units), Equals, 1)
 }
 
+func (s *S) TestUpdateBindsUnitsThatGetAnAddress(c *C) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		paths = append(paths, r.URL.Path+" "+r.Form.Get("unit-host"))
+	}))
+	defer ts.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}, ApiVersion: 2}
+	err := srvc.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Services().Remove(bson.M{"_id": srvc.Name})
+	instance := service.ServiceInstance{Name: "bound", ServiceName: srvc.Name, Apps: []string{"umaappqq"}}
+	err = instance.Create()
+	c.Assert(err, IsNil)
+	defer instance.Delete()
+	a := &app.App{Name: "umaappqq", Units: []app.Unit{{Name: "i-00000zz8"}}}
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	update(getOutput())
+	update(getOutput())
+	c.Assert(paths, DeepEquals, []string{"/resources/bound/units 192.168.0.11"})
+}
+
 func (s *S) TestUpdateWithMultipleApps(c *C) {
 	appDicts := []map[string]string{
 		{
@@ -0,0 +1,30 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/log"
+	"time"
+)
+
+// runCronJobs runs the cron jobs of the apps that are due at each tick. Jobs
+// run concurrently, so a slow job doesn't delay the others.
+func runCronJobs(ticker <-chan time.Time) {
+	for now := range ticker {
+		jobs, err := app.ClaimDueCronJobs(now)
+		if err != nil {
+			log.Printf("Failed to get the cron jobs to run: %s.", err)
+			continue
+		}
+		for _, job := range jobs {
+			go func(job app.CronJob) {
+				if err := job.Run(); err != nil {
+					log.Printf("Cron job %s of the app %s failed: %s.", job.Id.Hex(), job.App, err)
+				}
+			}(job)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestRunCronJobs(c *C) {
+	s.provisioner.PrepareOutput([]byte("ok"))
+	a := app.App{
+		Name:  "scheduled",
+		State: string(provision.StatusStarted),
+		Units: []app.Unit{{Name: "scheduled/0", State: string(provision.StatusStarted)}},
+	}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	job := app.CronJob{
+		Id:       bson.NewObjectId(),
+		App:      a.Name,
+		Schedule: "* * * * *",
+		Command:  "ls",
+		Next:     time.Now().Add(-time.Minute),
+	}
+	err = db.Session.CronJobs().Insert(job)
+	c.Assert(err, IsNil)
+	defer db.Session.CronJobs().RemoveId(job.Id)
+	ch := make(chan time.Time)
+	go runCronJobs(ch)
+	ch <- time.Now()
+	close(ch)
+	time.Sleep(1e9)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 1)
+	c.Assert(cmds[0].Cmd, Matches, ".*ls$")
+	err = db.Session.CronJobs().FindId(job.Id).One(&job)
+	c.Assert(err, IsNil)
+	c.Assert(job.History, HasLen, 1)
+	c.Assert(job.Next.After(time.Now()), Equals, true)
+}
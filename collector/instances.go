@@ -0,0 +1,22 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/api/service"
+	"github.com/globocom/tsuru/log"
+	"time"
+)
+
+// pollServiceInstances updates, at each tick, the state of the service
+// instances that are being created or removed by their services.
+func pollServiceInstances(ticker <-chan time.Time) {
+	for _ = range ticker {
+		n, err := service.PollInstances()
+		if err != nil {
+			log.Printf("Failed to check the state of %d service instances: %s.", n, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/api/service"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func (s *S) TestPollServiceInstances(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, IsNil)
+	defer db.Session.Services().Remove(bson.M{"_id": srvc.Name})
+	instance := service.ServiceInstance{Name: "slowsql", ServiceName: srvc.Name, State: service.StateCreating}
+	err = instance.Create()
+	c.Assert(err, IsNil)
+	defer instance.Delete()
+	ch := make(chan time.Time)
+	go pollServiceInstances(ch)
+	ch <- time.Now()
+	close(ch)
+	time.Sleep(1e8)
+	err = db.Session.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, IsNil)
+	c.Assert(instance.State, Equals, service.StateReady)
+}
@@ -8,11 +8,16 @@ import (
 	"flag"
 	"fmt"
 	"github.com/globocom/config"
+	_ "github.com/globocom/tsuru/api/service"
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/pipeline"
 	"github.com/globocom/tsuru/provision"
 	_ "github.com/globocom/tsuru/provision/juju"
+	_ "github.com/globocom/tsuru/provision/ssh"
+	"github.com/globocom/tsuru/router"
+	_ "github.com/globocom/tsuru/router/nginx"
 	stdlog "log"
 	"log/syslog"
 	"os"
@@ -79,6 +84,22 @@ func main() {
 		}
 		fmt.Printf("Using %q provisioner.\n\n", provisioner)
 
+		if name, err := config.GetString("router"); err == nil {
+			app.Router, err = router.Get(name)
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Printf("Using %q router.\n\n", name)
+		}
+
+		if name, err := config.GetString("storage"); err == nil {
+			app.Storage, err = app.GetStorage(name)
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Printf("Using %q object storage.\n\n", name)
+		}
+
 		handler := MessageHandler{}
 		err = handler.start()
 		if err != nil {
@@ -86,6 +107,9 @@ func main() {
 		}
 		fmt.Printf("Queue server listening at %s.\n", handler.server.Addr())
 		defer handler.stop()
+		go runCronJobs(time.Tick(10 * time.Second))
+		go recoverPipelines(time.Tick(pipeline.StaleAfter))
+		go pollServiceInstances(time.Tick(10 * time.Second))
 		ticker := time.Tick(time.Minute)
 		fmt.Println("tsuru collector agent started...")
 		jujuCollect(ticker)
@@ -0,0 +1,29 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/pipeline"
+	"time"
+)
+
+// recoverPipelines rolls back, at each tick, the pipelines that were
+// interrupted by a crash of the process running them, and removes the old
+// pipelines that finished.
+func recoverPipelines(ticker <-chan time.Time) {
+	for _ = range ticker {
+		n, err := pipeline.Recover()
+		if err != nil {
+			log.Printf("Failed to recover the interrupted pipelines: %s.", err)
+		}
+		if n > 0 {
+			log.Printf("Rolled back %d interrupted pipelines.", n)
+		}
+		if _, err = pipeline.Purge(); err != nil {
+			log.Printf("Failed to remove the finished pipelines: %s.", err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/pipeline"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestRecoverPipelines(c *C) {
+	a := app.App{Name: "interrupted", Framework: "python"}
+	err := db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	units, err := s.provisioner.AddUnits(&a, 2, provision.DefaultProcess)
+	c.Assert(err, IsNil)
+	names := []string{units[0].Name, units[1].Name}
+	doc := bson.M{
+		"_id":    "add-units-interrupted",
+		"kind":   "add-units",
+		"status": pipeline.Running,
+		"steps": []pipeline.Step{
+			{Name: "reserve quota", Status: pipeline.StepDone},
+			{Name: "provision units", Status: pipeline.StepDone},
+			{Name: "save the units in the database", Status: pipeline.StepRunning},
+			{Name: "start units", Status: pipeline.StepPending},
+		},
+		"context":   bson.M{"appname": a.Name, "units": 2, "process": provision.DefaultProcess, "unitnames": names},
+		"heartbeat": time.Now().Add(-2 * pipeline.StaleAfter),
+	}
+	err = db.Session.Pipelines().Insert(doc)
+	c.Assert(err, IsNil)
+	defer db.Session.Pipelines().RemoveId("add-units-interrupted")
+	ch := make(chan time.Time)
+	go recoverPipelines(ch)
+	ch <- time.Now()
+	close(ch)
+	time.Sleep(1e8)
+	c.Assert(s.provisioner.GetUnits(&a), HasLen, 1)
+	state, err := pipeline.Get("add-units-interrupted")
+	c.Assert(err, IsNil)
+	c.Assert(state.Status, Equals, pipeline.Failed)
+	c.Assert(state.Steps[1].Status, Equals, pipeline.StepRolledBack)
+}
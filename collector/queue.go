@@ -90,10 +90,27 @@ func (h *MessageHandler) handle(msg queue.Message) {
 			log.Print(err)
 			return
 		}
-		app.SerializeEnvVars()
+		results, err := app.WriteApprc(msg.Args[1:]...)
+		if err != nil {
+			log.Printf("Error handling %q: %s", msg.Action, err)
+			return
+		}
+		for _, r := range results {
+			if r.Error != nil {
+				log.Printf("Error handling %q: %s", msg.Action, r.Error)
+			}
+		}
 	case app.StartApp:
 		if len(msg.Args) < 1 {
 			log.Printf("Error handling %q: this action requires at least 1 argument.", msg.Action)
+			return
+		}
+		// Apps in maintenance mode are not started, but their apprc is
+		// still regenerated, so forced changes reach the units.
+		a := app.App{Name: msg.Args[0]}
+		if a.Get() == nil && a.Maintenance {
+			log.Printf("Error handling %q for the app %q: the app is in maintenance mode.", msg.Action, a.Name)
+			return
 		}
 		app, err := h.ensureAppIsStarted(msg)
 		if err != nil {
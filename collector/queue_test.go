@@ -53,8 +53,8 @@ func (s *S) TestHandleMessages(c *C) {
 	cmds := s.provisioner.GetCmds("", &a)
 	c.Assert(cmds, HasLen, 1)
 	output := strings.Replace(cmds[0].Cmd, "\n", " ", -1)
-	outputRegexp := `^cat > /home/application/apprc <<END # generated by tsuru.*`
-	outputRegexp += `export http_proxy="http://myproxy.com:3128/" END $`
+	outputRegexp := `^printf '%s' '# generated by tsuru.*`
+	outputRegexp += `export http_proxy='\\''http://myproxy.com:3128/'\\'' ' > .* && mv -f .* /home/application/apprc$`
 	c.Assert(output, Matches, outputRegexp)
 }
 
@@ -101,12 +101,37 @@ func (s *S) TestHandleMessageWithSpecificUnit(c *C) {
 	time.Sleep(1e9)
 	cmds := s.provisioner.GetCmds("", &a)
 	c.Assert(cmds, HasLen, 1)
+	c.Assert(cmds[0].App.ProvisionUnits()[0].GetName(), Equals, "nemesis/1")
 	output := strings.Replace(cmds[0].Cmd, "\n", " ", -1)
-	outputRegexp := `^cat > /home/application/apprc <<END # generated by tsuru.*`
-	outputRegexp += `export http_proxy="http://myproxy.com:3128/" END $`
+	outputRegexp := `^printf '%s' '# generated by tsuru.*`
+	outputRegexp += `export http_proxy='\\''http://myproxy.com:3128/'\\'' ' > .* && mv -f .* /home/application/apprc$`
 	c.Assert(output, Matches, outputRegexp)
 }
 
+func (s *S) TestHandleMessageRegeneratesApprcOfAppsInMaintenance(c *C) {
+	s.provisioner.PrepareOutput([]byte("exported"))
+	handler := MessageHandler{}
+	err := handler.start()
+	c.Assert(err, IsNil)
+	defer handler.stop()
+	a := app.App{
+		Name:        "tilt",
+		Units:       []app.Unit{{Name: "tilt/0", State: "started", Machine: 19}},
+		State:       string(provision.StatusStarted),
+		Maintenance: true,
+	}
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	messages, _, err := queue.Dial(handler.server.Addr())
+	c.Assert(err, IsNil)
+	messages <- queue.Message{Action: app.RegenerateApprc, Args: []string{a.Name}}
+	time.Sleep(1e9)
+	cmds := s.provisioner.GetCmds("", &a)
+	c.Assert(cmds, HasLen, 1)
+	c.Assert(cmds[0].Cmd, Matches, `(?s).* /home/application/apprc$`)
+}
+
 func (s *S) TestHandleMessageErrors(c *C) {
 	var data = []struct {
 		action      string
@@ -171,6 +196,12 @@ func (s *S) TestHandleMessageErrors(c *C) {
 			expectedLog: `Error handling "regenerate-apprc" for the app "territories":` +
 				` the app is down.`,
 		},
+		{
+			action: app.StartApp,
+			args:   []string{"tilt"},
+			expectedLog: `Error handling "start-app" for the app "tilt":` +
+				` the app is in maintenance mode.`,
+		},
 	}
 	var buf bytes.Buffer
 	a := app.App{Name: "nemesis", State: "pending"}
@@ -196,6 +227,10 @@ func (s *S) TestHandleMessageErrors(c *C) {
 	err = db.Session.Apps().Insert(a)
 	c.Assert(err, IsNil)
 	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
+	a = app.App{Name: "tilt", State: "pending", Maintenance: true}
+	err = db.Session.Apps().Insert(a)
+	c.Assert(err, IsNil)
+	defer db.Session.Apps().Remove(bson.M{"name": a.Name})
 	log.SetLogger(stdlog.New(&buf, "", 0))
 	handler := MessageHandler{}
 	handler.start()
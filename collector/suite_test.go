@@ -8,7 +8,7 @@ import (
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/db"
-	ttesting "github.com/globocom/tsuru/testing"
+	"github.com/globocom/tsuru/provision/provisiontest"
 	"labix.org/v2/mgo"
 	. "launchpad.net/gocheck"
 	"testing"
@@ -20,7 +20,7 @@ type S struct {
 	session     *mgo.Session
 	tmpdir      string
 	instances   []string
-	provisioner *ttesting.FakeProvisioner
+	provisioner *provisiontest.FakeProvisioner
 }
 
 var _ = Suite(&S{})
@@ -29,7 +29,7 @@ func (s *S) SetUpSuite(c *C) {
 	var err error
 	db.Session, err = db.Open("127.0.0.1:27017", "tsuru_collector_test")
 	c.Assert(err, IsNil)
-	s.provisioner = ttesting.NewFakeProvisioner()
+	s.provisioner = provisiontest.NewFakeProvisioner()
 	app.Provisioner = s.provisioner
 	err = config.ReadConfigFile("../etc/tsuru.conf")
 	c.Assert(err, IsNil)
@@ -104,3 +104,56 @@ func (s *Storage) Users() *mgo.Collection {
 func (s *Storage) Teams() *mgo.Collection {
 	return s.getCollection("teams")
 }
+
+// Plans returns the plans collection from MongoDB.
+func (s *Storage) Plans() *mgo.Collection {
+	return s.getCollection("plans")
+}
+
+// Operations returns the operations collection from MongoDB.
+func (s *Storage) Operations() *mgo.Collection {
+	return s.getCollection("operations")
+}
+
+// Hosts returns the hosts collection from MongoDB.
+func (s *Storage) Hosts() *mgo.Collection {
+	return s.getCollection("hosts")
+}
+
+// UnitCounters returns the unit_counters collection from MongoDB.
+func (s *Storage) UnitCounters() *mgo.Collection {
+	return s.getCollection("unit_counters")
+}
+
+// Routes returns the routes collection from MongoDB.
+func (s *Storage) Routes() *mgo.Collection {
+	return s.getCollection("routes")
+}
+
+// Platforms returns the platforms collection from MongoDB.
+func (s *Storage) Platforms() *mgo.Collection {
+	return s.getCollection("platforms")
+}
+
+// Quotas returns the quotas collection from MongoDB.
+func (s *Storage) Quotas() *mgo.Collection {
+	return s.getCollection("quotas")
+}
+
+// EnvRevisions returns the env_revisions collection from MongoDB.
+func (s *Storage) EnvRevisions() *mgo.Collection {
+	revisionIndex := mgo.Index{Key: []string{"app", "revision"}, Unique: true}
+	c := s.getCollection("env_revisions")
+	c.EnsureIndex(revisionIndex)
+	return c
+}
+
+// CronJobs returns the cron_jobs collection from MongoDB.
+func (s *Storage) CronJobs() *mgo.Collection {
+	return s.getCollection("cron_jobs")
+}
+
+// Pipelines returns the pipelines collection from MongoDB.
+func (s *Storage) Pipelines() *mgo.Collection {
+	return s.getCollection("pipelines")
+}
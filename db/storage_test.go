@@ -123,3 +123,63 @@ func (s *S) TestMethodTeamsShouldReturnTeamsCollection(c *C) {
 	teamsc := s.storage.getCollection("teams")
 	c.Assert(teams, DeepEquals, teamsc)
 }
+
+func (s *S) TestMethodPlansShouldReturnPlansCollection(c *C) {
+	plans := s.storage.Plans()
+	plansc := s.storage.getCollection("plans")
+	c.Assert(plans, DeepEquals, plansc)
+}
+
+func (s *S) TestMethodOperationsShouldReturnOperationsCollection(c *C) {
+	operations := s.storage.Operations()
+	operationsc := s.storage.getCollection("operations")
+	c.Assert(operations, DeepEquals, operationsc)
+}
+
+func (s *S) TestMethodHostsShouldReturnHostsCollection(c *C) {
+	hosts := s.storage.Hosts()
+	hostsc := s.storage.getCollection("hosts")
+	c.Assert(hosts, DeepEquals, hostsc)
+}
+
+func (s *S) TestMethodUnitCountersShouldReturnUnitCountersCollection(c *C) {
+	counters := s.storage.UnitCounters()
+	countersc := s.storage.getCollection("unit_counters")
+	c.Assert(counters, DeepEquals, countersc)
+}
+
+func (s *S) TestMethodRoutesShouldReturnRoutesCollection(c *C) {
+	routes := s.storage.Routes()
+	routesc := s.storage.getCollection("routes")
+	c.Assert(routes, DeepEquals, routesc)
+}
+
+func (s *S) TestMethodPlatformsShouldReturnPlatformsCollection(c *C) {
+	platforms := s.storage.Platforms()
+	platformsc := s.storage.getCollection("platforms")
+	c.Assert(platforms, DeepEquals, platformsc)
+}
+
+func (s *S) TestMethodQuotasShouldReturnQuotasCollection(c *C) {
+	quotas := s.storage.Quotas()
+	quotasc := s.storage.getCollection("quotas")
+	c.Assert(quotas, DeepEquals, quotasc)
+}
+
+func (s *S) TestMethodEnvRevisionsShouldReturnEnvRevisionsCollection(c *C) {
+	revisions := s.storage.EnvRevisions()
+	revisionsc := s.storage.getCollection("env_revisions")
+	c.Assert(revisions, DeepEquals, revisionsc)
+}
+
+func (s *S) TestMethodCronJobsShouldReturnCronJobsCollection(c *C) {
+	jobs := s.storage.CronJobs()
+	jobsc := s.storage.getCollection("cron_jobs")
+	c.Assert(jobs, DeepEquals, jobsc)
+}
+
+func (s *S) TestMethodPipelinesShouldReturnPipelinesCollection(c *C) {
+	pipelines := s.storage.Pipelines()
+	pipelinesc := s.storage.getCollection("pipelines")
+	c.Assert(pipelines, DeepEquals, pipelinesc)
+}
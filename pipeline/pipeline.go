@@ -0,0 +1,519 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pipeline runs sequences of actions that must succeed or fail as a
+// whole: when an action fails, the actions that ran before it are rolled
+// back, in reverse order.
+//
+// The progress of each pipeline is stored in the database, along with the
+// context shared by its actions, so the rollback of a pipeline interrupted by
+// a crash can be resumed by another process (see Recover).
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"sync"
+	"time"
+)
+
+const (
+	Running     = "running"
+	RollingBack = "rolling back"
+	Succeeded   = "succeeded"
+	Failed      = "failed"
+)
+
+const (
+	StepPending    = "pending"
+	StepRunning    = "running"
+	StepDone       = "done"
+	StepFailed     = "failed"
+	StepRolledBack = "rolled back"
+)
+
+// HeartbeatInterval is how often a running pipeline records that the process
+// running it is still alive.
+var HeartbeatInterval = 30 * time.Second
+
+// StaleAfter is how long a pipeline may go without a heartbeat before it's
+// considered interrupted, and rolled back by Recover.
+var StaleAfter = 3 * HeartbeatInterval
+
+// Retention is how long pipelines are kept in the database after they
+// finish, see Purge.
+var Retention = 7 * 24 * time.Hour
+
+var (
+	// ErrInterrupted is the error recorded in pipelines that were
+	// interrupted while running their actions.
+	ErrInterrupted = errors.New("The pipeline was interrupted before finishing.")
+
+	// ErrNotStuck is returned when resuming a pipeline that is running or
+	// that succeeded.
+	ErrNotStuck = errors.New("Only failed or interrupted pipelines can be resumed.")
+
+	// ErrRolledBack is returned when resuming a pipeline that was rolled
+	// back.
+	ErrRolledBack = errors.New("The pipeline was rolled back and can't be resumed.")
+)
+
+// Action is a step of a pipeline.
+type Action struct {
+	Name string
+
+	// Forward runs the step.
+	Forward func() error
+
+	// Backward undoes what Forward did. It may be nil, for steps that can't
+	// be undone or don't need to be. Pipelines whose actions have no
+	// Backward stop at the failing action, and can be resumed from it (see
+	// Resume).
+	Backward func()
+
+	// RollbackItself indicates whether Backward should be called when
+	// Forward fails. If false, only the previous actions are rolled back.
+	RollbackItself bool
+}
+
+// Loader is implemented by contexts that hold data that isn't stored, like
+// objects loaded from the database. When a pipeline is rebuilt, Load is
+// called after the stored context is loaded.
+type Loader interface {
+	Load() error
+}
+
+// Pipeline is a sequence of actions that share a context.
+//
+// Actions usually are closures bound to the context: the context is a
+// pointer to a value that the actions read and update, and that is saved in
+// the database after each step. When resuming a rollback, the context is
+// loaded from the database into the context of a pipeline rebuilt from its
+// kind, so it must hold only data that can be stored with bson, or implement
+// Loader to restore the rest.
+//
+// Target identifies what the pipeline acts on, like the name of an app. It's
+// stored to make it easier to find the pipelines of an object.
+//
+// Id is the id of the stored state of the pipeline, see Get. Execute
+// generates it when it's empty, so callers that need to follow the progress
+// of the pipeline may set it before running the pipeline.
+type Pipeline struct {
+	Id      string
+	Kind    string
+	Target  string
+	Context interface{}
+	Actions []*Action
+}
+
+// New returns a pipeline of the given kind, with the given context and
+// actions.
+func New(kind string, context interface{}, actions ...*Action) *Pipeline {
+	return &Pipeline{Kind: kind, Context: context, Actions: actions}
+}
+
+// Step is the stored progress of an action.
+type Step struct {
+	Name   string
+	Status string
+	Error  string
+}
+
+// State is the progress of a pipeline, as stored in the database.
+type State struct {
+	Id        string `bson:"_id"`
+	Kind      string
+	Target    string
+	Status    string
+	Error     string
+	Steps     []Step
+	Context   bson.Raw
+	Heartbeat time.Time
+	Started   time.Time
+	Finished  time.Time
+
+	// Final indicates that the pipeline can't be resumed: it succeeded,
+	// or it failed and was rolled back.
+	Final bool
+}
+
+// Get loads the state of a pipeline from the database, using its id.
+func Get(id string) (*State, error) {
+	var s State
+	if err := db.Session.Pipelines().FindId(id).One(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+var (
+	builders = make(map[string]func() *Pipeline)
+	bmut     sync.Mutex
+)
+
+// Register registers a function that builds pipelines of the given kind,
+// with a zeroed context. Recover uses it to rebuild the interrupted
+// pipelines, so packages that run pipelines should register them in their
+// init function.
+func Register(kind string, build func() *Pipeline) {
+	bmut.Lock()
+	defer bmut.Unlock()
+	builders[kind] = build
+}
+
+func builder(kind string) func() *Pipeline {
+	bmut.Lock()
+	defer bmut.Unlock()
+	return builders[kind]
+}
+
+// run stores and updates the progress of a pipeline.
+type run struct {
+	p     *Pipeline
+	state State
+	done  chan bool
+}
+
+func (r *run) set(fields bson.M) {
+	err := db.Session.Pipelines().UpdateId(r.state.Id, bson.M{"$set": fields})
+	if err != nil {
+		log.Printf("Failed to update the pipeline %s (%s): %s", r.state.Id, r.state.Kind, err)
+	}
+}
+
+func (r *run) setStep(index int, status string, err error) {
+	r.state.Steps[index].Status = status
+	fields := bson.M{fmt.Sprintf("steps.%d.status", index): status}
+	if status == StepRunning {
+		r.state.Steps[index].Error = ""
+		fields[fmt.Sprintf("steps.%d.error", index)] = ""
+	}
+	if err != nil {
+		r.state.Steps[index].Error = err.Error()
+		fields[fmt.Sprintf("steps.%d.error", index)] = err.Error()
+	}
+	if status == StepDone {
+		fields["context"] = r.p.Context
+	}
+	r.set(fields)
+}
+
+// keepAlive updates the heartbeat of the pipeline until finish is called.
+func (r *run) keepAlive() {
+	r.done = make(chan bool)
+	go func() {
+		ticker := time.NewTicker(HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.done:
+				return
+			case now := <-ticker.C:
+				r.set(bson.M{"heartbeat": now})
+			}
+		}
+	}()
+}
+
+func (r *run) finish(status string) {
+	close(r.done)
+	r.state.Status = status
+	r.state.Finished = time.Now()
+	r.state.Final = status == Succeeded || r.rollsBack()
+	fields := bson.M{"status": status, "finished": r.state.Finished, "final": r.state.Final}
+	if r.state.Error != "" {
+		fields["error"] = r.state.Error
+	}
+	r.set(fields)
+}
+
+// rollsBack indicates whether the pipeline is rolled back when it fails,
+// instead of stopping at the failing action to be resumed.
+func (r *run) rollsBack() bool {
+	for _, act := range r.p.Actions {
+		if act.Backward != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// rollBack runs Backward for the actions that completed, and for the ones
+// that failed or were interrupted if they roll back themselves, from the
+// last to the first. Steps already rolled back are skipped, so an interrupted
+// rollback can be resumed. Steps of actions without Backward keep their
+// status.
+func (r *run) rollBack() {
+	r.state.Status = RollingBack
+	r.set(bson.M{"status": RollingBack})
+	for i := len(r.p.Actions) - 1; i >= 0; i-- {
+		act := r.p.Actions[i]
+		switch r.state.Steps[i].Status {
+		case StepDone:
+		case StepFailed, StepRunning:
+			if !act.RollbackItself {
+				continue
+			}
+		default:
+			continue
+		}
+		if act.Backward == nil {
+			continue
+		}
+		act.Backward()
+		r.setStep(i, StepRolledBack, nil)
+	}
+	r.finish(Failed)
+}
+
+// Execute runs the actions of the pipeline, in order, storing the progress
+// of each step. If an action fails, Execute rolls back the previous actions
+// and returns the error of the action.
+func (p *Pipeline) Execute() error {
+	if p.Id == "" {
+		p.Id = bson.NewObjectId().Hex()
+	}
+	now := time.Now()
+	r := run{p: p, state: State{
+		Id:        p.Id,
+		Kind:      p.Kind,
+		Target:    p.Target,
+		Status:    Running,
+		Steps:     make([]Step, len(p.Actions)),
+		Heartbeat: now,
+		Started:   now,
+	}}
+	for i, act := range p.Actions {
+		r.state.Steps[i] = Step{Name: act.Name, Status: StepPending}
+	}
+	doc := bson.M{
+		"_id":       r.state.Id,
+		"kind":      r.state.Kind,
+		"target":    r.state.Target,
+		"status":    r.state.Status,
+		"steps":     r.state.Steps,
+		"context":   p.Context,
+		"heartbeat": r.state.Heartbeat,
+		"started":   r.state.Started,
+	}
+	if err := db.Session.Pipelines().Insert(doc); err != nil {
+		return err
+	}
+	r.keepAlive()
+	return r.forward(0)
+}
+
+// forward runs the actions of the pipeline, starting from the given index.
+func (r *run) forward(from int) error {
+	p := r.p
+	for i := from; i < len(p.Actions); i++ {
+		act := p.Actions[i]
+		r.setStep(i, StepRunning, nil)
+		err := act.Forward()
+		if err != nil {
+			r.setStep(i, StepFailed, err)
+			r.state.Error = err.Error()
+			r.rollBack()
+			return err
+		}
+		r.setStep(i, StepDone, nil)
+	}
+	r.finish(Succeeded)
+	return nil
+}
+
+// stuck returns the query for pipelines that failed, or that were
+// interrupted: the ones running or rolling back whose last heartbeat is
+// older than StaleAfter.
+func stuck() bson.M {
+	return bson.M{"$or": []bson.M{
+		{"status": Failed},
+		{
+			"status":    bson.M{"$in": []string{Running, RollingBack}},
+			"heartbeat": bson.M{"$lt": time.Now().Add(-StaleAfter)},
+		},
+	}}
+}
+
+// Stuck returns the pipelines of the given kinds that failed or were
+// interrupted, oldest first. If target is not empty, only the pipelines of
+// the target are returned.
+func Stuck(target string, kinds ...string) ([]State, error) {
+	query := stuck()
+	query["kind"] = bson.M{"$in": kinds}
+	if target != "" {
+		query["target"] = target
+	}
+	var states []State
+	err := db.Session.Pipelines().Find(query).Sort("started").All(&states)
+	return states, err
+}
+
+// claim marks the pipeline as being handled by the current process, with
+// the given status. It returns false if the pipeline was claimed by another
+// process first.
+func claim(state *State, status string) (bool, error) {
+	now := time.Now()
+	err := db.Session.Pipelines().Update(
+		bson.M{"_id": state.Id, "status": state.Status, "heartbeat": state.Heartbeat},
+		bson.M{"$set": bson.M{"status": status, "heartbeat": now}},
+	)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	state.Status = status
+	state.Heartbeat = now
+	return true, nil
+}
+
+// Resume runs again a pipeline that failed or was interrupted, starting from
+// the first step that is not done, with the stored context. It's meant for
+// pipelines whose actions can't be rolled back, like removals, that must be
+// finished instead. Pipelines that were rolled back can't be resumed.
+//
+// It returns the resulting state of the pipeline, and the error of the
+// failing action, if any.
+func Resume(id string) (*State, error) {
+	state, err := Get(id)
+	if err != nil {
+		return nil, err
+	}
+	stale := state.Heartbeat.Before(time.Now().Add(-StaleAfter))
+	if state.Status != Failed && !(stale && (state.Status == Running || state.Status == RollingBack)) {
+		return state, ErrNotStuck
+	}
+	from := len(state.Steps)
+	for i := len(state.Steps) - 1; i >= 0; i-- {
+		switch state.Steps[i].Status {
+		case StepRolledBack:
+			return state, ErrRolledBack
+		case StepDone:
+		default:
+			from = i
+		}
+	}
+	ok, err := claim(state, Running)
+	if err != nil {
+		return state, err
+	}
+	if !ok {
+		return state, ErrNotStuck
+	}
+	r := run{p: new(Pipeline), state: *state}
+	if err = r.rebuild(); err != nil {
+		r.state.Error = err.Error()
+		r.done = make(chan bool)
+		r.finish(Failed)
+		return &r.state, err
+	}
+	r.state.Error = ""
+	r.set(bson.M{"error": ""})
+	r.keepAlive()
+	err = r.forward(from)
+	return &r.state, err
+}
+
+// Recover resumes the rollback of the pipelines that were interrupted by a
+// crash: the pipelines that are running or rolling back, but whose last
+// heartbeat is older than StaleAfter. Each pipeline is claimed before the
+// rollback, so it's safe to call Recover from more than one process.
+//
+// It returns the number of pipelines rolled back.
+func Recover() (int, error) {
+	var states []State
+	query := bson.M{
+		"status":    bson.M{"$in": []string{Running, RollingBack}},
+		"heartbeat": bson.M{"$lt": time.Now().Add(-StaleAfter)},
+	}
+	if err := db.Session.Pipelines().Find(query).All(&states); err != nil {
+		return 0, err
+	}
+	var n int
+	for _, state := range states {
+		ok, err := claim(&state, RollingBack)
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			continue
+		}
+		if err = rollBackStored(state); err != nil {
+			log.Printf("Failed to roll back the pipeline %s (%s): %s", state.Id, state.Kind, err)
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Purge removes the pipelines that succeeded or failed more than Retention
+// ago. Failed pipelines that can be resumed are removed too, so the ones
+// nobody resumed, like failed deploys, don't pile up: they must be resumed
+// within Retention. Running pipelines are kept. It returns the number of
+// pipelines removed.
+func Purge() (int, error) {
+	query := bson.M{
+		"status":   bson.M{"$in": []string{Succeeded, Failed}},
+		"finished": bson.M{"$lt": time.Now().Add(-Retention)},
+	}
+	info, err := db.Session.Pipelines().RemoveAll(query)
+	if err != nil {
+		return 0, err
+	}
+	return info.Removed, nil
+}
+
+// rollBackStored rolls back a pipeline loaded from the database. Pipelines that
+// can't be rebuilt are marked as failed, without rolling back their steps.
+func rollBackStored(state State) error {
+	r := run{p: new(Pipeline), state: state}
+	err := r.rebuild()
+	if err != nil {
+		r.state.Error = err.Error()
+		r.done = make(chan bool)
+		r.finish(Failed)
+		return err
+	}
+	if r.state.Error == "" {
+		r.state.Error = ErrInterrupted.Error()
+	}
+	r.keepAlive()
+	r.rollBack()
+	return nil
+}
+
+// rebuild builds the pipeline of the stored kind, and loads the stored
+// context into it.
+func (r *run) rebuild() error {
+	build := builder(r.state.Kind)
+	if build == nil {
+		return fmt.Errorf("Unknown pipeline kind %q.", r.state.Kind)
+	}
+	p := build()
+	if len(p.Actions) != len(r.state.Steps) {
+		return fmt.Errorf("The pipeline has %d steps, but %d were stored.", len(p.Actions), len(r.state.Steps))
+	}
+	for i, act := range p.Actions {
+		if act.Name != r.state.Steps[i].Name {
+			return fmt.Errorf("Unexpected step %q, expected %q.", r.state.Steps[i].Name, act.Name)
+		}
+	}
+	if err := r.state.Context.Unmarshal(p.Context); err != nil {
+		return err
+	}
+	if l, ok := p.Context.(Loader); ok {
+		if err := l.Load(); err != nil {
+			return err
+		}
+	}
+	r.p = p
+	return nil
+}
@@ -0,0 +1,433 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+	"strconv"
+	"time"
+)
+
+type counter struct {
+	Values []string
+}
+
+// record returns an action that appends the given value to the context in
+// forward and records the rollback in the given slice.
+func record(name string, ctx *counter, rolledBack *[]string) *Action {
+	return &Action{
+		Name: name,
+		Forward: func() error {
+			ctx.Values = append(ctx.Values, name)
+			return nil
+		},
+		Backward: func() {
+			*rolledBack = append(*rolledBack, name+" "+strconv.Itoa(len(ctx.Values)))
+		},
+	}
+}
+
+func failing(name string, rollbackItself bool, rolledBack *[]string) *Action {
+	return &Action{
+		Name:    name,
+		Forward: func() error { return errors.New(name + " failed") },
+		Backward: func() {
+			*rolledBack = append(*rolledBack, name)
+		},
+		RollbackItself: rollbackItself,
+	}
+}
+
+func lastState(c *C) State {
+	var state State
+	err := db.Session.Pipelines().Find(nil).Sort("-started").One(&state)
+	c.Assert(err, IsNil)
+	return state
+}
+
+func (s *S) TestExecute(c *C) {
+	var ctx counter
+	var rolledBack []string
+	p := New("test", &ctx, record("first", &ctx, &rolledBack), record("second", &ctx, &rolledBack))
+	err := p.Execute()
+	c.Assert(err, IsNil)
+	c.Assert(ctx.Values, DeepEquals, []string{"first", "second"})
+	c.Assert(rolledBack, HasLen, 0)
+	state := lastState(c)
+	c.Assert(state.Kind, Equals, "test")
+	c.Assert(state.Status, Equals, Succeeded)
+	c.Assert(state.Steps, DeepEquals, []Step{{Name: "first", Status: StepDone}, {Name: "second", Status: StepDone}})
+	c.Assert(state.Finished.IsZero(), Equals, false)
+	var stored counter
+	err = state.Context.Unmarshal(&stored)
+	c.Assert(err, IsNil)
+	c.Assert(stored.Values, DeepEquals, []string{"first", "second"})
+}
+
+func (s *S) TestRollBackFailureOnSecondAction(c *C) {
+	var ctx counter
+	var rolledBack []string
+	p := New("test", &ctx, record("first", &ctx, &rolledBack), failing("second", false, &rolledBack))
+	err := p.Execute()
+	c.Assert(err, ErrorMatches, "^second failed$")
+	c.Assert(rolledBack, DeepEquals, []string{"first 1"})
+	state := lastState(c)
+	c.Assert(state.Status, Equals, Failed)
+	c.Assert(state.Error, Equals, "second failed")
+	c.Assert(state.Steps[0].Status, Equals, StepRolledBack)
+	c.Assert(state.Steps[1].Status, Equals, StepFailed)
+	c.Assert(state.Steps[1].Error, Equals, "second failed")
+}
+
+func (s *S) TestRollBackFailureOnFirstAction(c *C) {
+	var ctx counter
+	var rolledBack []string
+	p := New("test", &ctx, failing("first", false, &rolledBack), record("second", &ctx, &rolledBack))
+	err := p.Execute()
+	c.Assert(err, NotNil)
+	c.Assert(rolledBack, HasLen, 0)
+	c.Assert(ctx.Values, HasLen, 0)
+	state := lastState(c)
+	c.Assert(state.Steps[1].Status, Equals, StepPending)
+}
+
+func (s *S) TestRollBackFailureOnRollingBackItselfAction(c *C) {
+	var ctx counter
+	var rolledBack []string
+	p := New("test", &ctx, record("first", &ctx, &rolledBack), failing("second", true, &rolledBack))
+	err := p.Execute()
+	c.Assert(err, NotNil)
+	c.Assert(rolledBack, DeepEquals, []string{"second", "first 1"})
+}
+
+func (s *S) TestExecuteStoresTheStateWithTheGivenId(c *C) {
+	var ctx counter
+	var rolledBack []string
+	p := New("test", &ctx, record("first", &ctx, &rolledBack))
+	p.Id = bson.NewObjectId().Hex()
+	err := p.Execute()
+	c.Assert(err, IsNil)
+	state, err := Get(p.Id)
+	c.Assert(err, IsNil)
+	c.Assert(state.Status, Equals, Succeeded)
+}
+
+func (s *S) TestExecuteGeneratesTheId(c *C) {
+	var ctx counter
+	var rolledBack []string
+	p := New("test", &ctx, record("first", &ctx, &rolledBack))
+	err := p.Execute()
+	c.Assert(err, IsNil)
+	c.Assert(p.Id, Equals, lastState(c).Id)
+}
+
+func (s *S) TestExecuteWithoutBackward(c *C) {
+	var ctx counter
+	var rolledBack []string
+	first := &Action{Name: "first", Forward: func() error { return nil }}
+	p := New("test", &ctx, first, failing("second", false, &rolledBack))
+	err := p.Execute()
+	c.Assert(err, NotNil)
+	c.Assert(lastState(c).Steps[0].Status, Equals, StepDone)
+}
+
+var recovered []string
+
+func init() {
+	Register("test-recover", func() *Pipeline {
+		ctx := new(counter)
+		return New("test-recover", ctx,
+			record("first", ctx, &recovered),
+			record("second", ctx, &recovered),
+			&Action{Name: "third", Forward: func() error { return nil }, RollbackItself: true},
+		)
+	})
+}
+
+func insertState(c *C, state State, ctx counter) {
+	doc := bson.M{
+		"_id":       state.Id,
+		"kind":      state.Kind,
+		"status":    state.Status,
+		"error":     state.Error,
+		"steps":     state.Steps,
+		"context":   ctx,
+		"heartbeat": state.Heartbeat,
+		"started":   state.Started,
+	}
+	err := db.Session.Pipelines().Insert(doc)
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestRecover(c *C) {
+	recovered = nil
+	state := State{
+		Id:     "interrupted",
+		Kind:   "test-recover",
+		Status: Running,
+		Steps: []Step{
+			{Name: "first", Status: StepDone},
+			{Name: "second", Status: StepRunning},
+			{Name: "third", Status: StepPending},
+		},
+		Heartbeat: time.Now().Add(-2 * StaleAfter),
+	}
+	insertState(c, state, counter{Values: []string{"first"}})
+	n, err := Recover()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(recovered, DeepEquals, []string{"first 1"})
+	got, err := Get("interrupted")
+	c.Assert(err, IsNil)
+	c.Assert(got.Status, Equals, Failed)
+	c.Assert(got.Error, Equals, ErrInterrupted.Error())
+	c.Assert(got.Steps[0].Status, Equals, StepRolledBack)
+	c.Assert(got.Steps[1].Status, Equals, StepRunning)
+	n, err = Recover()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
+func (s *S) TestRecoverResumesAnInterruptedRollback(c *C) {
+	recovered = nil
+	state := State{
+		Id:     "rolling",
+		Kind:   "test-recover",
+		Status: RollingBack,
+		Error:  "third failed",
+		Steps: []Step{
+			{Name: "first", Status: StepDone},
+			{Name: "second", Status: StepRolledBack},
+			{Name: "third", Status: StepFailed, Error: "third failed"},
+		},
+		Heartbeat: time.Now().Add(-2 * StaleAfter),
+	}
+	insertState(c, state, counter{Values: []string{"first", "second"}})
+	n, err := Recover()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(recovered, DeepEquals, []string{"first 2"})
+	got, err := Get("rolling")
+	c.Assert(err, IsNil)
+	c.Assert(got.Status, Equals, Failed)
+	c.Assert(got.Error, Equals, "third failed")
+	c.Assert(got.Steps[2].Status, Equals, StepFailed)
+}
+
+func (s *S) TestRecoverIgnoresAlivePipelines(c *C) {
+	recovered = nil
+	state := State{
+		Id:        "alive",
+		Kind:      "test-recover",
+		Status:    Running,
+		Steps:     []Step{{Name: "first", Status: StepDone}, {Name: "second", Status: StepRunning}, {Name: "third"}},
+		Heartbeat: time.Now(),
+	}
+	insertState(c, state, counter{})
+	n, err := Recover()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+	c.Assert(recovered, HasLen, 0)
+	got, err := Get("alive")
+	c.Assert(err, IsNil)
+	c.Assert(got.Status, Equals, Running)
+}
+
+func (s *S) TestRecoverUnknownKind(c *C) {
+	state := State{
+		Id:        "unknown",
+		Kind:      "something-else",
+		Status:    Running,
+		Steps:     []Step{{Name: "first", Status: StepDone}},
+		Heartbeat: time.Now().Add(-2 * StaleAfter),
+	}
+	insertState(c, state, counter{})
+	n, err := Recover()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+	got, err := Get("unknown")
+	c.Assert(err, IsNil)
+	c.Assert(got.Status, Equals, Failed)
+	c.Assert(got.Error, Equals, `Unknown pipeline kind "something-else".`)
+}
+
+// resumed records the steps run by the test-resume pipeline, failing the
+// steps in failResume.
+var (
+	resumed    []string
+	failResume = map[string]bool{}
+)
+
+func resumable(name string) *Action {
+	return &Action{
+		Name: name,
+		Forward: func() error {
+			if failResume[name] {
+				return errors.New(name + " failed")
+			}
+			resumed = append(resumed, name)
+			return nil
+		},
+	}
+}
+
+func init() {
+	Register("test-resume", func() *Pipeline {
+		return New("test-resume", new(counter), resumable("first"), resumable("second"), resumable("third"))
+	})
+}
+
+func (s *S) TestResume(c *C) {
+	resumed = nil
+	failResume["second"] = true
+	build := builder("test-resume")
+	p := build()
+	p.Target = "something"
+	err := p.Execute()
+	c.Assert(err, ErrorMatches, "^second failed$")
+	state := lastState(c)
+	c.Assert(state.Target, Equals, "something")
+	c.Assert(state.Status, Equals, Failed)
+	c.Assert(state.Steps[0].Status, Equals, StepDone)
+	c.Assert(state.Steps[1].Status, Equals, StepFailed)
+	stuck, err := Stuck("something", "test-resume")
+	c.Assert(err, IsNil)
+	c.Assert(stuck, HasLen, 1)
+	c.Assert(stuck[0].Id, Equals, state.Id)
+	delete(failResume, "second")
+	got, err := Resume(state.Id)
+	c.Assert(err, IsNil)
+	c.Assert(got.Status, Equals, Succeeded)
+	c.Assert(resumed, DeepEquals, []string{"first", "second", "third"})
+	stored, err := Get(state.Id)
+	c.Assert(err, IsNil)
+	c.Assert(stored.Status, Equals, Succeeded)
+	c.Assert(stored.Error, Equals, "")
+	c.Assert(stored.Steps[1], DeepEquals, Step{Name: "second", Status: StepDone})
+	stuck, err = Stuck("something", "test-resume")
+	c.Assert(err, IsNil)
+	c.Assert(stuck, HasLen, 0)
+	_, err = Resume(state.Id)
+	c.Assert(err, Equals, ErrNotStuck)
+}
+
+func (s *S) TestResumeRolledBackPipeline(c *C) {
+	var ctx counter
+	var rolledBack []string
+	p := New("test", &ctx, record("first", &ctx, &rolledBack), failing("second", false, &rolledBack))
+	err := p.Execute()
+	c.Assert(err, NotNil)
+	_, err = Resume(lastState(c).Id)
+	c.Assert(err, Equals, ErrRolledBack)
+}
+
+func (s *S) TestStuckIncludesInterruptedPipelines(c *C) {
+	old := State{
+		Id:        "old",
+		Kind:      "test-resume",
+		Status:    Running,
+		Steps:     []Step{{Name: "first", Status: StepRunning}, {Name: "second"}, {Name: "third"}},
+		Heartbeat: time.Now().Add(-2 * StaleAfter),
+	}
+	insertState(c, old, counter{})
+	alive := old
+	alive.Id = "alive"
+	alive.Heartbeat = time.Now()
+	insertState(c, alive, counter{})
+	stuck, err := Stuck("", "test-resume")
+	c.Assert(err, IsNil)
+	c.Assert(stuck, HasLen, 1)
+	c.Assert(stuck[0].Id, Equals, "old")
+}
+
+func (s *S) TestFinishedPipelinesAreFinalUnlessTheyCanBeResumed(c *C) {
+	var ctx counter
+	var rolledBack []string
+	p := New("test", &ctx, &Action{Name: "first", Forward: func() error { return nil }})
+	err := p.Execute()
+	c.Assert(err, IsNil)
+	c.Assert(lastState(c).Final, Equals, true)
+	p = New("test", &ctx, record("first", &ctx, &rolledBack), failing("second", false, &rolledBack))
+	err = p.Execute()
+	c.Assert(err, NotNil)
+	c.Assert(lastState(c).Final, Equals, true)
+	second := &Action{Name: "second", Forward: func() error { return errors.New("second failed") }}
+	p = New("test", &ctx, &Action{Name: "first", Forward: func() error { return nil }}, second)
+	err = p.Execute()
+	c.Assert(err, NotNil)
+	c.Assert(lastState(c).Final, Equals, false)
+}
+
+func (s *S) TestPurge(c *C) {
+	old := time.Now().Add(-2 * Retention)
+	docs := []bson.M{
+		{"_id": "old-final", "status": Succeeded, "final": true, "finished": old},
+		{"_id": "old-resumable", "status": Failed, "final": false, "finished": old},
+		{"_id": "old-resumed", "status": Running, "final": false, "finished": old},
+		{"_id": "new-final", "status": Succeeded, "final": true, "finished": time.Now()},
+		{"_id": "new-resumable", "status": Failed, "final": false, "finished": time.Now()},
+	}
+	for _, doc := range docs {
+		err := db.Session.Pipelines().Insert(doc)
+		c.Assert(err, IsNil)
+		defer db.Session.Pipelines().RemoveId(doc["_id"])
+	}
+	n, err := Purge()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	count, err := db.Session.Pipelines().Find(bson.M{"_id": bson.M{"$in": []string{"old-final", "old-resumable"}}}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 0)
+	count, err = db.Session.Pipelines().Find(bson.M{"_id": bson.M{"$in": []string{"old-resumed", "new-final", "new-resumable"}}}).Count()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 3)
+}
+
+type loadingContext struct {
+	Name   string
+	loaded bool
+}
+
+func (ctx *loadingContext) Load() error {
+	ctx.loaded = true
+	return nil
+}
+
+var loaded []string
+
+func init() {
+	Register("test-load", func() *Pipeline {
+		ctx := new(loadingContext)
+		return New("test-load", ctx, &Action{
+			Name:    "first",
+			Forward: func() error { return nil },
+			Backward: func() {
+				loaded = append(loaded, ctx.Name+" "+strconv.FormatBool(ctx.loaded))
+			},
+		})
+	})
+}
+
+func (s *S) TestRecoverLoadsTheContext(c *C) {
+	loaded = nil
+	doc := bson.M{
+		"_id":       "loading",
+		"kind":      "test-load",
+		"status":    Running,
+		"steps":     []Step{{Name: "first", Status: StepDone}},
+		"context":   bson.M{"name": "stored"},
+		"heartbeat": time.Now().Add(-2 * StaleAfter),
+	}
+	err := db.Session.Pipelines().Insert(doc)
+	c.Assert(err, IsNil)
+	defer db.Session.Pipelines().RemoveId("loading")
+	n, err := Recover()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(loaded, DeepEquals, []string{"stored true"})
+}
@@ -0,0 +1,33 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"github.com/globocom/tsuru/db"
+	. "launchpad.net/gocheck"
+	"testing"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (s *S) SetUpSuite(c *C) {
+	var err error
+	db.Session, err = db.Open("127.0.0.1:27017", "tsuru_pipeline_test")
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TearDownSuite(c *C) {
+	db.Session.Pipelines().Database.DropDatabase()
+	db.Session.Close()
+}
+
+func (s *S) TearDownTest(c *C) {
+	_, err := db.Session.Pipelines().RemoveAll(nil)
+	c.Assert(err, IsNil)
+}
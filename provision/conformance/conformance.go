@@ -0,0 +1,339 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package conformance provides a gocheck suite that checks whether a
+// provisioner behaves as documented in the provision package.
+package conformance
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/provision"
+	. "launchpad.net/gocheck"
+	"sort"
+	"strings"
+)
+
+// Operation describes a call that ProvisionerSuite is about to make on the
+// provisioner under test.
+type Operation struct {
+	// Name of the method of the provision.Provisioner interface.
+	Method string
+
+	// App is the app given to the provisioner. Its units reflect the
+	// results of the previous operations.
+	App provision.App
+
+	// Number of units, used by AddUnits and RemoveUnits.
+	Units uint
+
+	// Process type of the new units, used by AddUnits.
+	Process string
+
+	// Name of the unit, used by RemoveUnit.
+	Unit string
+
+	// Output that the command must write to stdout, used by
+	// ExecuteCommand.
+	Output string
+}
+
+// ProvisionerSuite is a gocheck suite that checks whether a provisioner
+// behaves as documented in the provision package. It must be registered in
+// the package of the provisioner:
+//
+//	var _ = gocheck.Suite(&conformance.ProvisionerSuite{
+//	    Factory: func() provision.Provisioner { return &MyProvisioner{} },
+//	})
+//
+// Provisioners that depend on external tools can fake them in the Prepare
+// function, which is called before every call that the suite makes to the
+// provisioner.
+type ProvisionerSuite struct {
+	// Factory returns the provisioner under test. It's called before
+	// each test.
+	Factory func() provision.Provisioner
+
+	// Prepare is an optional function that prepares the provisioner for
+	// the given operation.
+	Prepare func(c *C, p provision.Provisioner, op Operation)
+
+	// TearDown is an optional function called after each test.
+	TearDown func(c *C)
+
+	p provision.Provisioner
+}
+
+// fakeApp is the app given to the provisioner under test. The suite records
+// in it the units returned by the provisioner.
+type fakeApp struct {
+	name      string
+	framework string
+	units     []provision.AppUnit
+}
+
+func newFakeApp(name, framework string) *fakeApp {
+	return &fakeApp{name: name, framework: framework}
+}
+
+func (a *fakeApp) Log(message, source string) error {
+	return nil
+}
+
+func (a *fakeApp) GetName() string {
+	return a.name
+}
+
+func (a *fakeApp) GetFramework() string {
+	return a.framework
+}
+
+func (a *fakeApp) ProvisionUnits() []provision.AppUnit {
+	return a.units
+}
+
+func (a *fakeApp) GetPlan() provision.Plan {
+	return provision.Plan{}
+}
+
+type fakeUnit struct {
+	name    string
+	machine int
+}
+
+func (u *fakeUnit) GetName() string {
+	return u.name
+}
+
+func (u *fakeUnit) GetMachine() int {
+	return u.machine
+}
+
+func (u *fakeUnit) GetStatus() provision.Status {
+	return provision.StatusStarted
+}
+
+func (s *ProvisionerSuite) SetUpTest(c *C) {
+	s.p = s.Factory()
+}
+
+func (s *ProvisionerSuite) TearDownTest(c *C) {
+	if s.TearDown != nil {
+		s.TearDown(c)
+	}
+}
+
+func (s *ProvisionerSuite) prepare(c *C, op Operation) {
+	if s.Prepare != nil {
+		s.Prepare(c, s.p, op)
+	}
+}
+
+// provision provisions the app, loading its first unit.
+func (s *ProvisionerSuite) provision(c *C, app *fakeApp) {
+	s.prepare(c, Operation{Method: "Provision", App: app})
+	err := s.p.Provision(app)
+	c.Assert(err, IsNil)
+	for _, u := range s.collect(c, app) {
+		app.units = append(app.units, &fakeUnit{name: u.Name, machine: u.Machine})
+	}
+}
+
+// collect returns the units of the app reported by CollectStatus.
+func (s *ProvisionerSuite) collect(c *C, app *fakeApp) []provision.Unit {
+	s.prepare(c, Operation{Method: "CollectStatus", App: app})
+	units, err := s.p.CollectStatus()
+	c.Assert(err, IsNil)
+	var result []provision.Unit
+	for _, u := range units {
+		if u.AppName == app.name {
+			result = append(result, u)
+		}
+	}
+	return result
+}
+
+func (s *ProvisionerSuite) addUnits(c *C, app *fakeApp, n uint) []provision.Unit {
+	s.prepare(c, Operation{Method: "AddUnits", App: app, Units: n, Process: provision.DefaultProcess})
+	units, err := s.p.AddUnits(app, n, provision.DefaultProcess)
+	c.Assert(err, IsNil)
+	for _, u := range units {
+		app.units = append(app.units, &fakeUnit{name: u.Name, machine: u.Machine})
+	}
+	return units
+}
+
+func unitNames(app *fakeApp) []string {
+	names := make([]string, len(app.units))
+	for i, u := range app.units {
+		names[i] = u.GetName()
+	}
+	return names
+}
+
+func collectedNames(units []provision.Unit) []string {
+	names := make([]string, len(units))
+	for i, u := range units {
+		names[i] = u.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *ProvisionerSuite) TestProvisionCreatesOneUnit(c *C) {
+	app := newFakeApp("starless", "python")
+	s.provision(c, app)
+	units := s.collect(c, app)
+	c.Assert(units, HasLen, 1)
+	c.Assert(units[0].Type, Equals, "python")
+}
+
+func (s *ProvisionerSuite) TestCollectStatusSeparatesApps(c *C) {
+	app1 := newFakeApp("starless", "python")
+	app2 := newFakeApp("red", "ruby")
+	s.provision(c, app1)
+	s.provision(c, app2)
+	units := s.collect(c, app1)
+	c.Assert(units, HasLen, 1)
+	c.Assert(units[0].Type, Equals, "python")
+	units = s.collect(c, app2)
+	c.Assert(units, HasLen, 1)
+	c.Assert(units[0].Type, Equals, "ruby")
+}
+
+func (s *ProvisionerSuite) TestAddUnits(c *C) {
+	app := newFakeApp("starless", "python")
+	s.provision(c, app)
+	units := s.addUnits(c, app, 2)
+	c.Assert(units, HasLen, 2)
+	names := unitNames(app)
+	sort.Strings(names)
+	c.Assert(collectedNames(s.collect(c, app)), DeepEquals, names)
+}
+
+func (s *ProvisionerSuite) TestAddUnitsOfAProcess(c *C) {
+	app := newFakeApp("starless", "python")
+	s.provision(c, app)
+	s.prepare(c, Operation{Method: "AddUnits", App: app, Units: 2, Process: "worker"})
+	units, err := s.p.AddUnits(app, 2, "worker")
+	c.Assert(err, IsNil)
+	c.Assert(units, HasLen, 2)
+	for _, u := range units {
+		c.Assert(u.Process, Equals, "worker")
+	}
+}
+
+func (s *ProvisionerSuite) TestAddUnitsReturnsUniqueNames(c *C) {
+	app := newFakeApp("starless", "python")
+	s.provision(c, app)
+	s.addUnits(c, app, 2)
+	name := unitNames(app)[1]
+	s.prepare(c, Operation{Method: "RemoveUnit", App: app, Unit: name})
+	err := s.p.RemoveUnit(app, name)
+	c.Assert(err, IsNil)
+	app.units = append(app.units[:1], app.units[2:]...)
+	s.addUnits(c, app, 2)
+	last := len(app.units) - 1
+	removed := unitNames(app)[last]
+	s.prepare(c, Operation{Method: "RemoveUnit", App: app, Unit: removed})
+	err = s.p.RemoveUnit(app, removed)
+	c.Assert(err, IsNil)
+	app.units = app.units[:last]
+	s.addUnits(c, app, 1)
+	names := make(map[string]bool)
+	for _, name := range unitNames(app) {
+		c.Assert(names[name], Equals, false)
+		names[name] = true
+	}
+	c.Assert(names[removed], Equals, false)
+	c.Assert(s.collect(c, app), HasLen, 4)
+}
+
+func (s *ProvisionerSuite) TestAddZeroUnits(c *C) {
+	app := newFakeApp("starless", "python")
+	s.provision(c, app)
+	s.prepare(c, Operation{Method: "AddUnits", App: app, Units: 0, Process: provision.DefaultProcess})
+	units, err := s.p.AddUnits(app, 0, provision.DefaultProcess)
+	c.Assert(err, NotNil)
+	c.Assert(units, HasLen, 0)
+}
+
+func (s *ProvisionerSuite) TestRemoveUnitsReturnsSortedIndices(c *C) {
+	app := newFakeApp("starless", "python")
+	s.provision(c, app)
+	s.addUnits(c, app, 3)
+	names := unitNames(app)
+	s.prepare(c, Operation{Method: "RemoveUnits", App: app, Units: 2})
+	indices, err := s.p.RemoveUnits(app, 2)
+	c.Assert(err, IsNil)
+	c.Assert(indices, HasLen, 2)
+	c.Assert(sort.IntsAreSorted(indices), Equals, true)
+	removed := make(map[string]bool)
+	for _, i := range indices {
+		c.Assert(i >= 0 && i < len(names), Equals, true)
+		removed[names[i]] = true
+	}
+	c.Assert(removed, HasLen, 2)
+	for i := len(indices) - 1; i >= 0; i-- {
+		index := indices[i]
+		app.units = append(app.units[:index], app.units[index+1:]...)
+	}
+	units := s.collect(c, app)
+	c.Assert(units, HasLen, 2)
+	for _, u := range units {
+		c.Assert(removed[u.Name], Equals, false)
+	}
+}
+
+func (s *ProvisionerSuite) TestRemoveUnitsCannotRemoveAllUnits(c *C) {
+	app := newFakeApp("starless", "python")
+	s.provision(c, app)
+	s.addUnits(c, app, 1)
+	s.prepare(c, Operation{Method: "RemoveUnits", App: app, Units: 2})
+	_, err := s.p.RemoveUnits(app, 2)
+	c.Assert(err, NotNil)
+	c.Assert(s.collect(c, app), HasLen, 2)
+}
+
+func (s *ProvisionerSuite) TestRemoveUnit(c *C) {
+	app := newFakeApp("starless", "python")
+	s.provision(c, app)
+	s.addUnits(c, app, 1)
+	name := unitNames(app)[1]
+	s.prepare(c, Operation{Method: "RemoveUnit", App: app, Unit: name})
+	err := s.p.RemoveUnit(app, name)
+	c.Assert(err, IsNil)
+	units := s.collect(c, app)
+	c.Assert(units, HasLen, 1)
+	c.Assert(units[0].Name, Not(Equals), name)
+}
+
+func (s *ProvisionerSuite) TestRemoveUnknownUnit(c *C) {
+	app := newFakeApp("starless", "python")
+	s.provision(c, app)
+	s.prepare(c, Operation{Method: "RemoveUnit", App: app, Unit: "starless/99"})
+	err := s.p.RemoveUnit(app, "starless/99")
+	c.Assert(err, NotNil)
+	c.Assert(s.collect(c, app), HasLen, 1)
+}
+
+func (s *ProvisionerSuite) TestExecuteCommand(c *C) {
+	var stdout, stderr bytes.Buffer
+	app := newFakeApp("starless", "python")
+	s.provision(c, app)
+	s.addUnits(c, app, 1)
+	s.prepare(c, Operation{Method: "ExecuteCommand", App: app, Output: "starless and bible black"})
+	err := s.p.ExecuteCommand(&stdout, &stderr, app, "ls", "-l")
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(stdout.String(), "starless and bible black"), Equals, true)
+}
+
+func (s *ProvisionerSuite) TestDestroy(c *C) {
+	app := newFakeApp("starless", "python")
+	s.provision(c, app)
+	s.addUnits(c, app, 1)
+	s.prepare(c, Operation{Method: "Destroy", App: app})
+	err := s.p.Destroy(app)
+	c.Assert(err, IsNil)
+	c.Assert(s.collect(c, app), HasLen, 0)
+}
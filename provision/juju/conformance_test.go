@@ -0,0 +1,183 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package juju
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/globocom/commandmocker"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/provision/conformance"
+	. "launchpad.net/gocheck"
+	"strconv"
+	"strings"
+)
+
+// fakeJuju keeps the state of the environment. Before each operation, the
+// juju binary is replaced with a script that prints what the real juju would
+// print, and the state is changed by the commands that the script received.
+type fakeJuju struct {
+	tmpdir     string
+	frameworks map[string]string
+	units      map[string][]string
+	machines   map[string]int
+	machine    int
+}
+
+var fakeJujuEnv fakeJuju
+
+// provisioner resets the environment and returns the provisioner that will
+// run against it.
+func (j *fakeJuju) provisioner() provision.Provisioner {
+	config.Set("git:host", "tsuruhost.com")
+	j.frameworks = make(map[string]string)
+	j.units = make(map[string][]string)
+	j.machines = make(map[string]int)
+	j.machine = 0
+	return &JujuProvisioner{}
+}
+
+func (j *fakeJuju) addUnit(app string) string {
+	j.machine++
+	name := fmt.Sprintf("%s/%d", app, j.machine)
+	j.units[app] = append(j.units[app], name)
+	j.machines[name] = j.machine
+	return name
+}
+
+func (j *fakeJuju) removeUnit(name string) {
+	app := name[:strings.Index(name, "/")]
+	units := j.units[app]
+	for i, unit := range units {
+		if unit == name {
+			j.units[app] = append(units[:i], units[i+1:]...)
+			break
+		}
+	}
+	delete(j.machines, name)
+}
+
+func (j *fakeJuju) status() string {
+	var machines, services bytes.Buffer
+	for app, units := range j.units {
+		fmt.Fprintf(&services, "  %s:\n    charm: local:precise/%s-1\n    units:\n", app, j.frameworks[app])
+		for _, unit := range units {
+			m := j.machines[unit]
+			fmt.Fprintf(&machines, "  %d:\n    agent-state: running\n    dns-name: 10.10.10.%d\n", m, m)
+			fmt.Fprintf(&machines, "    instance-id: i-%d\n    instance-state: running\n", m)
+			fmt.Fprintf(&services, "      %s:\n        agent-state: started\n        machine: %d\n", unit, m)
+		}
+	}
+	return "machines:\n" + machines.String() + "services:\n" + services.String()
+}
+
+// jujuArgs holds the arguments that the fake juju received, in order.
+type jujuArgs []string
+
+func (a jujuArgs) peek() string {
+	if len(a) == 0 {
+		return ""
+	}
+	return a[0]
+}
+
+func (a *jujuArgs) next() string {
+	arg := a.peek()
+	if arg != "" {
+		*a = (*a)[1:]
+	}
+	return arg
+}
+
+// run changes the state of the environment as the real juju would after
+// receiving the given commands.
+func (j *fakeJuju) run(c *C, args jujuArgs) {
+	for cmd := args.next(); cmd != ""; cmd = args.next() {
+		switch cmd {
+		case "deploy":
+			charm := args.next()
+			for charm != "" && !strings.HasPrefix(charm, "local:") {
+				charm = args.next()
+			}
+			app := args.next()
+			j.frameworks[app] = strings.TrimPrefix(charm, "local:")
+			j.addUnit(app)
+		case "destroy-service":
+			app := args.next()
+			for _, unit := range j.units[app] {
+				delete(j.machines, unit)
+			}
+			delete(j.units, app)
+		case "set":
+			args.next()
+			args.next()
+		case "set-constraints":
+			args.next()
+			args.next()
+			for strings.Contains(args.peek(), "=") {
+				args.next()
+			}
+		case "add-unit":
+			app := args.next()
+			args.next()
+			n, err := strconv.Atoi(args.next())
+			c.Assert(err, IsNil)
+			for i := 0; i < n; i++ {
+				j.addUnit(app)
+			}
+		case "remove-unit":
+			for strings.Contains(args.peek(), "/") {
+				j.removeUnit(args.next())
+			}
+		case "terminate-machine":
+			// Machines are listed only while they run units.
+			args.next()
+		case "ssh", "status":
+			// These commands don't change the environment, and the
+			// arguments of ssh are the command run in the unit.
+			return
+		default:
+			c.Fatalf("Unexpected juju command: %q.", cmd)
+		}
+	}
+}
+
+func (j *fakeJuju) prepare(c *C, p provision.Provisioner, op conformance.Operation) {
+	j.tearDown(c)
+	var output string
+	switch op.Method {
+	case "AddUnits":
+		var buf bytes.Buffer
+		app := op.App.GetName()
+		for i := 1; i <= int(op.Units); i++ {
+			fmt.Fprintf(&buf, "Unit '%s/%d' added to service '%s'\n", app, j.machine+i, app)
+		}
+		output = buf.String()
+	case "ExecuteCommand":
+		output = op.Output
+	case "CollectStatus":
+		output = j.status()
+	}
+	var err error
+	j.tmpdir, err = commandmocker.Add("juju", output)
+	c.Assert(err, IsNil)
+}
+
+// tearDown applies the commands received by the current fake juju and
+// removes it.
+func (j *fakeJuju) tearDown(c *C) {
+	if j.tmpdir != "" {
+		j.run(c, commandmocker.Parameters(j.tmpdir))
+		commandmocker.Remove(j.tmpdir)
+		j.tmpdir = ""
+	}
+}
+
+var _ = Suite(&conformance.ProvisionerSuite{
+	Factory:  fakeJujuEnv.provisioner,
+	Prepare:  fakeJujuEnv.prepare,
+	TearDown: fakeJujuEnv.tearDown,
+})
@@ -37,6 +37,7 @@ type FakeApp struct {
 	units     []provision.AppUnit
 	logs      []string
 	actions   []string
+	plan      provision.Plan
 }
 
 func NewFakeApp(name, framework string, units int) *FakeApp {
@@ -76,3 +77,8 @@ func (a *FakeApp) ProvisionUnits() []provision.AppUnit {
 	a.actions = append(a.actions, "getunits")
 	return a.units
 }
+
+func (a *FakeApp) GetPlan() provision.Plan {
+	a.actions = append(a.actions, "getplan")
+	return a.plan
+}
@@ -31,12 +31,27 @@ const destroyTries = 5
 // package.
 type JujuProvisioner struct{}
 
+// constraints translates the plan of the app to juju constraints. juju does
+// not support constraints on disk size, so it's ignored.
+func constraints(app provision.App) []string {
+	var cs []string
+	plan := app.GetPlan()
+	if plan.Memory > 0 {
+		cs = append(cs, fmt.Sprintf("mem=%dM", plan.Memory))
+	}
+	if plan.CpuShare > 0 {
+		cs = append(cs, fmt.Sprintf("cpu=%d", plan.CpuShare))
+	}
+	return cs
+}
+
 func (p *JujuProvisioner) Provision(app provision.App) error {
 	var buf bytes.Buffer
-	args := []string{
-		"deploy", "--repository", "/home/charms",
-		"local:" + app.GetFramework(), app.GetName(),
+	args := []string{"deploy", "--repository", "/home/charms"}
+	if cs := constraints(app); len(cs) > 0 {
+		args = append(args, "--constraints", strings.Join(cs, " "))
 	}
+	args = append(args, "local:"+app.GetFramework(), app.GetName())
 	err := runCmd(true, &buf, &buf, args...)
 	out := buf.String()
 	if err != nil {
@@ -58,7 +73,8 @@ func (p *JujuProvisioner) destroyService(app provision.App) error {
 	for i := 0; i < destroyTries; i++ {
 		buf.Reset()
 		err = runCmd(false, &buf, &buf, "destroy-service", app.GetName())
-		if err == nil {
+		if err == nil || notFound(buf.String()) {
+			err = nil
 			break
 		}
 		out = buf.String()
@@ -71,6 +87,12 @@ func (p *JujuProvisioner) destroyService(app provision.App) error {
 	return nil
 }
 
+// notFound indicates whether the output of a juju command reports that the
+// service or machine does not exist.
+func notFound(out string) bool {
+	return strings.Contains(out, "was not found")
+}
+
 func (p *JujuProvisioner) terminateMachines(app provision.App, units ...provision.AppUnit) error {
 	var buf bytes.Buffer
 	if len(units) < 1 {
@@ -80,7 +102,7 @@ func (p *JujuProvisioner) terminateMachines(app provision.App, units ...provisio
 		buf.Reset()
 		err := runCmd(false, &buf, &buf, "terminate-machine", strconv.Itoa(u.GetMachine()))
 		out := buf.String()
-		if err != nil {
+		if err != nil && !notFound(out) {
 			msg := fmt.Sprintf("Failed to destroy unit %s: %s", u.GetName(), out)
 			app.Log(msg, "tsuru")
 			return &provision.Error{Reason: out, Err: err}
@@ -89,15 +111,20 @@ func (p *JujuProvisioner) terminateMachines(app provision.App, units ...provisio
 	return nil
 }
 
+// Destroy destroys the juju service of the app and terminates its machines,
+// waiting for the machines to be terminated. Services and machines that
+// were already destroyed are ignored, so a failed destroy can be retried.
 func (p *JujuProvisioner) Destroy(app provision.App) error {
 	if err := p.destroyService(app); err != nil {
 		return err
 	}
-	go p.terminateMachines(app)
-	return nil
+	return p.terminateMachines(app)
 }
 
-func (p *JujuProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit, error) {
+// AddUnits adds n units to the juju service of the app. Juju runs the same
+// charm in all units of a service, so the process type of the units is only
+// recorded by tsuru, which tells the restart hook which process to run.
+func (p *JujuProvisioner) AddUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
 	if n < 1 {
 		return nil, errors.New("Cannot add zero units.")
 	}
@@ -109,6 +136,14 @@ func (p *JujuProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit,
 	if err != nil {
 		return nil, &provision.Error{Reason: buf.String(), Err: err}
 	}
+	// The plan of the app may have changed since the service was deployed.
+	if cs := constraints(app); len(cs) > 0 {
+		buf.Reset()
+		args := append([]string{"set-constraints", "--service", app.GetName()}, cs...)
+		if err = runCmd(true, &buf, &buf, args...); err != nil {
+			return nil, &provision.Error{Reason: buf.String(), Err: err}
+		}
+	}
 	buf.Reset()
 	err = runCmd(false, &buf, &buf, "add-unit", app.GetName(), "--num-units", strconv.FormatUint(uint64(n), 10))
 	if err != nil {
@@ -120,7 +155,7 @@ func (p *JujuProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit,
 	for err == nil {
 		matches := unitRe.FindStringSubmatch(line)
 		if len(matches) > 1 {
-			units = append(units, provision.Unit{Name: matches[1]})
+			units = append(units, provision.Unit{Name: matches[1], Process: process})
 		}
 		line, err = reader.ReadString('\n')
 	}
@@ -33,6 +33,22 @@ func (s *S) TestProvision(c *C) {
 	c.Assert(commandmocker.Output(tmpdir), Equals, "deploy --repository /home/charms local:python trace")
 }
 
+func (s *S) TestProvisionWithPlan(c *C) {
+	tmpdir, err := commandmocker.Add("juju", "$*")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := NewFakeApp("trace", "python", 0)
+	app.plan = provision.Plan{Name: "small", Memory: 512, CpuShare: 2, Disk: 1024}
+	p := JujuProvisioner{}
+	err = p.Provision(app)
+	c.Assert(err, IsNil)
+	expected := []string{
+		"deploy", "--repository", "/home/charms", "--constraints", "mem=512M cpu=2",
+		"local:python", "trace",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, expected)
+}
+
 func (s *S) TestProvisionFailure(c *C) {
 	tmpdir, err := commandmocker.Error("juju", "juju failed", 1)
 	c.Assert(err, IsNil)
@@ -92,13 +108,29 @@ func (s *S) TestDestroyFailure(c *C) {
 	c.Assert(pErr.Err.Error(), Equals, "exit status 25")
 }
 
+func (s *S) TestDestroyIgnoresDestroyedServicesAndMachines(c *C) {
+	tmpdir, err := commandmocker.Error("juju", "Service 'idioglossia' was not found", 1)
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := NewFakeApp("idioglossia", "static", 2)
+	p := JujuProvisioner{}
+	err = p.Destroy(app)
+	c.Assert(err, IsNil)
+	expected := []string{
+		"destroy-service", "idioglossia",
+		"terminate-machine", "1",
+		"terminate-machine", "2",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, expected)
+}
+
 func (s *S) TestAddUnits(c *C) {
 	tmpdir, err := commandmocker.Add("juju", addUnitsOutput)
 	c.Assert(err, IsNil)
 	defer commandmocker.Remove(tmpdir)
 	app := NewFakeApp("resist", "rush", 0)
 	p := JujuProvisioner{}
-	units, err := p.AddUnits(app, 4)
+	units, err := p.AddUnits(app, 4, "web")
 	c.Assert(err, IsNil)
 	c.Assert(units, HasLen, 4)
 	names := make([]string, len(units))
@@ -115,9 +147,27 @@ func (s *S) TestAddUnits(c *C) {
 	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, expectedParams)
 }
 
+func (s *S) TestAddUnitsWithPlan(c *C) {
+	tmpdir, err := commandmocker.Add("juju", addUnitsOutput)
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := NewFakeApp("resist", "rush", 0)
+	app.plan = provision.Plan{Name: "medium", Memory: 1024}
+	p := JujuProvisioner{}
+	units, err := p.AddUnits(app, 4, "web")
+	c.Assert(err, IsNil)
+	c.Assert(units, HasLen, 4)
+	expectedParams := []string{
+		"set", "resist", "app-repo=" + repository.GetReadOnlyUrl("resist"),
+		"set-constraints", "--service", "resist", "mem=1024M",
+		"add-unit", "resist", "--num-units", "4",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, expectedParams)
+}
+
 func (s *S) TestAddZeroUnits(c *C) {
 	p := JujuProvisioner{}
-	units, err := p.AddUnits(nil, 0)
+	units, err := p.AddUnits(nil, 0, "web")
 	c.Assert(units, IsNil)
 	c.Assert(err, NotNil)
 	c.Assert(err.Error(), Equals, "Cannot add zero units.")
@@ -129,7 +179,7 @@ func (s *S) TestAddUnitsFailure(c *C) {
 	defer commandmocker.Remove(tmpdir)
 	app := NewFakeApp("headlong", "rush", 1)
 	p := JujuProvisioner{}
-	units, err := p.AddUnits(app, 1)
+	units, err := p.AddUnits(app, 1, "web")
 	c.Assert(units, IsNil)
 	c.Assert(err, NotNil)
 	e, ok := err.(*provision.Error)
@@ -4,6 +4,10 @@
 
 // Package provision provides interfaces that need to be satisfied in order to
 // implement a new provisioner on tsuru.
+//
+// The semantics described in the Provisioner interface are checked by
+// conformance.ProvisionerSuite, which new provisioners should register in
+// their tests.
 package provision
 
 import (
@@ -26,6 +30,10 @@ const (
 	StatusCreating   = Status("creating")
 )
 
+// DefaultProcess is the process type of units of apps that don't declare
+// process types in a Procfile.
+const DefaultProcess = "web"
+
 // Unit represents a provision unit. Can be a machine, container or anything
 // IP-addressable.
 type Unit struct {
@@ -35,6 +43,29 @@ type Unit struct {
 	Machine int
 	Ip      string
 	Status  Status
+
+	// Process is the process type that the unit runs, as declared in the
+	// Procfile of the app.
+	Process string
+}
+
+// Plan represents the resources that a provisioner should allocate for each
+// unit of an app.
+//
+// A zero value in any of the fields means that the provisioner should use
+// its defaults for that resource.
+type Plan struct {
+	Name string
+
+	// Memory limit, in megabytes.
+	Memory int64
+
+	// Relative share of CPU, the meaning of the value is up to the
+	// provisioner.
+	CpuShare int
+
+	// Disk size, in megabytes.
+	Disk int64
 }
 
 // AppUnit represents a unit in an app.
@@ -65,6 +96,10 @@ type App interface {
 
 	// GetUnits returns all units of the app, in a slice.
 	ProvisionUnits() []AppUnit
+
+	// GetPlan returns the plan of the app, which describes the resources
+	// that should be allocated for each unit.
+	GetPlan() Plan
 }
 
 // Provisioner is the basic interface of this package.
@@ -75,20 +110,28 @@ type App interface {
 // Tsuru comes with a default provisioner: juju. One can add other provisioners
 // by satisfying this interface and registering it using the function Register.
 type Provisioner interface {
-	// Provision is called when tsuru is creating the app.
+	// Provision is called when tsuru is creating the app. The app must be
+	// created with exactly one unit of the DefaultProcess, sized according
+	// to the plan of the app.
 	Provision(App) error
 
 	// Destroy is called when tsuru is destroying the app.
 	Destroy(App) error
 
 	// AddUnits adds units to an app. The first parameter is the app, the
-	// second is the number of units to add.
+	// second is the number of units to add and the third is the process
+	// type that the new units run. New units must be sized according to the
+	// current plan of the app.
 	//
-	// It returns a slice containing all added units
-	AddUnits(App, uint) ([]Unit, error)
+	// It returns a slice containing all added units, with their Process
+	// field set. Names of new units must not clash with names of other
+	// units of the app, even if they were removed. Adding zero units is an
+	// error.
+	AddUnits(App, uint, string) ([]Unit, error)
 
 	// RemoveUnit removes a unit from the app. It receives the app and the name
-	// of the unit to be removed.
+	// of the unit to be removed. It returns an error if the app does not have
+	// the given unit.
 	RemoveUnit(App, string) error
 
 	// RemoveUnits removes multiple units from an app. The first parameter it
@@ -97,13 +140,21 @@ type Provisioner interface {
 	// It returns a slice containing indices of all removed units (the index
 	// must match the slice returned by App.ProvisionUnits). The list of
 	// indices must be returned sorted.
+	//
+	// Apps can't have zero units, so trying to remove all units of the app
+	// is an error, and no unit is removed in this case.
 	RemoveUnits(App, uint) ([]int, error)
 
-	// ExecuteCommand runs a command in all units of the app.
+	// ExecuteCommand runs a command in all units of the app, writing the
+	// output of the command to stdout.
 	ExecuteCommand(stdout, stderr io.Writer, app App, cmd string, args ...string) error
 
 	// CollectStatus returns information about all provisioned units. It's used
 	// by tsuru collector when updating the status of apps in the database.
+	//
+	// The returned units must reflect the previous calls to the provisioner:
+	// added units are included, removed units and units of destroyed apps
+	// are not.
 	CollectStatus() ([]Unit, error)
 }
 
@@ -0,0 +1,238 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provisiontest
+
+import (
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"math/rand"
+	"time"
+)
+
+// chaosMethods lists the methods of the FakeProvisioner that may have faults
+// injected.
+var chaosMethods = []string{
+	"Provision", "Destroy", "AddUnits", "RemoveUnit",
+	"RemoveUnits", "ExecuteCommand", "CollectStatus",
+}
+
+var flappingStatuses = []provision.Status{
+	provision.StatusStarted,
+	provision.StatusPending,
+	provision.StatusDown,
+	provision.StatusError,
+}
+
+// ChaosError is the error returned by methods of the FakeProvisioner when
+// chaos mode injects a failure.
+type ChaosError struct {
+	Method string
+	Reason string
+}
+
+func (e *ChaosError) Error() string {
+	return fmt.Sprintf("chaos: %s failed: %s.", e.Method, e.Reason)
+}
+
+// Chaos describes the faults that a FakeProvisioner injects, so the layers
+// that use the provisioner can be tested for rollback and retry behavior.
+//
+// Scripted results take precedence over probabilistic failures: each call to
+// a method consumes one entry of its script, and once the script is over the
+// failure rate of the method applies.
+type Chaos struct {
+	// FailureRate is the probability, from 0 to 1, of a call to the method
+	// failing. It's keyed by method name, like "AddUnits".
+	FailureRate map[string]float64
+
+	// Script contains the results of the next calls to the method, in
+	// order. Each result is either "ok" or "fail".
+	Script map[string][]string
+
+	// Latency is added to every call to the provisioner.
+	Latency time.Duration
+
+	// FlappingRate is the probability of CollectStatus reporting a unit
+	// with a status other than its own.
+	FlappingRate float64
+
+	// PartialAddUnits is the probability of AddUnits adding only part of
+	// the requested units. The added units are returned along with a
+	// ChaosError.
+	PartialAddUnits float64
+
+	// Seed is used to seed the random generator, making scenarios
+	// reproducible.
+	Seed int64
+}
+
+// ChaosFromConfig loads the chaos scenario from the "fake:chaos" section of
+// tsuru.conf. It returns nil if the section is not present. The api and the
+// collector use the fake provisioner when built with the fake tag. Example:
+//
+//	provisioner: fake
+//	fake:
+//	  chaos:
+//	    seed: 42
+//	    latency: 200ms
+//	    flapping-rate: 0.1
+//	    partial-add-units: 0.2
+//	    failure-rate:
+//	      AddUnits: 0.3
+//	    script:
+//	      Provision: [ok, fail]
+func ChaosFromConfig() (*Chaos, error) {
+	if _, err := config.Get("fake:chaos"); err != nil {
+		return nil, nil
+	}
+	chaos := Chaos{
+		FailureRate: make(map[string]float64),
+		Script:      make(map[string][]string),
+		Seed:        time.Now().UnixNano(),
+	}
+	if seed, err := configNumber("fake:chaos:seed"); err == nil {
+		chaos.Seed = int64(seed)
+	}
+	if latency, err := config.GetString("fake:chaos:latency"); err == nil {
+		d, err := time.ParseDuration(latency)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid chaos latency %q: %s", latency, err)
+		}
+		chaos.Latency = d
+	}
+	if rate, err := configNumber("fake:chaos:flapping-rate"); err == nil {
+		chaos.FlappingRate = rate
+	}
+	if rate, err := configNumber("fake:chaos:partial-add-units"); err == nil {
+		chaos.PartialAddUnits = rate
+	}
+	for _, method := range chaosMethods {
+		if rate, err := configNumber("fake:chaos:failure-rate:" + method); err == nil {
+			chaos.FailureRate[method] = rate
+		}
+		value, err := config.Get("fake:chaos:script:" + method)
+		if err != nil {
+			continue
+		}
+		results, _ := value.([]interface{})
+		script := make([]string, len(results))
+		for i, result := range results {
+			script[i] = fmt.Sprint(result)
+			if script[i] != "ok" && script[i] != "fail" {
+				return nil, fmt.Errorf("Invalid result in the chaos script of %s: %q.", method, script[i])
+			}
+		}
+		chaos.Script[method] = script
+	}
+	return &chaos, nil
+}
+
+// configNumber reads a number from the configuration, accepting both integer
+// and float values.
+func configNumber(key string) (float64, error) {
+	value, err := config.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	switch n := value.(type) {
+	case int:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	}
+	return 0, fmt.Errorf("%s must be a number.", key)
+}
+
+// SetChaos enables chaos mode in the provisioner, using the given scenario. A
+// nil scenario disables chaos mode.
+func (p *FakeProvisioner) SetChaos(chaos *Chaos) {
+	p.chaosMut.Lock()
+	defer p.chaosMut.Unlock()
+	p.chaos = chaos
+	p.scriptPos = make(map[string]int)
+	if chaos != nil {
+		p.random = rand.New(rand.NewSource(chaos.Seed))
+	}
+}
+
+// configure loads the chaos scenario from tsuru.conf, for the provisioner
+// registered as "fake". It runs only once, in the first call to the
+// provisioner, because the configuration file is read after the provisioner
+// is registered.
+func (p *FakeProvisioner) configure() {
+	if !p.fromConfig {
+		return
+	}
+	p.configOnce.Do(func() {
+		chaos, err := ChaosFromConfig()
+		if err != nil {
+			log.Printf("Not enabling chaos mode: %s", err)
+			return
+		}
+		if chaos != nil {
+			p.SetChaos(chaos)
+		}
+	})
+}
+
+// chaosError applies the latency of the scenario and decides whether the
+// call to the given method should fail.
+func (p *FakeProvisioner) chaosError(method string) error {
+	p.configure()
+	p.chaosMut.Lock()
+	chaos := p.chaos
+	if chaos == nil {
+		p.chaosMut.Unlock()
+		return nil
+	}
+	var fail bool
+	if pos := p.scriptPos[method]; pos < len(chaos.Script[method]) {
+		fail = chaos.Script[method][pos] == "fail"
+		p.scriptPos[method] = pos + 1
+	} else {
+		fail = p.random.Float64() < chaos.FailureRate[method]
+	}
+	p.chaosMut.Unlock()
+	if chaos.Latency > 0 {
+		time.Sleep(chaos.Latency)
+	}
+	if fail {
+		return &ChaosError{Method: method, Reason: "injected failure"}
+	}
+	return nil
+}
+
+// partialUnits returns how many of the n requested units AddUnits should add,
+// and whether the call is partial.
+func (p *FakeProvisioner) partialUnits(n uint) (uint, bool) {
+	p.chaosMut.Lock()
+	defer p.chaosMut.Unlock()
+	if p.chaos == nil || n < 2 || p.random.Float64() >= p.chaos.PartialAddUnits {
+		return n, false
+	}
+	return 1 + uint(p.random.Intn(int(n-1))), true
+}
+
+// flap changes the status of some of the given units, according to the
+// flapping rate of the scenario.
+func (p *FakeProvisioner) flap(units []provision.Unit) {
+	p.chaosMut.Lock()
+	defer p.chaosMut.Unlock()
+	if p.chaos == nil || p.chaos.FlappingRate == 0 {
+		return
+	}
+	for i := range units {
+		if p.random.Float64() >= p.chaos.FlappingRate {
+			continue
+		}
+		status := units[i].Status
+		for status == units[i].Status {
+			status = flappingStatuses[p.random.Intn(len(flappingStatuses))]
+		}
+		units[i].Status = status
+	}
+}
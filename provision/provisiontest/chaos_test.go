@@ -0,0 +1,173 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provisiontest
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/provision"
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestChaosErrorMessage(c *C) {
+	err := &ChaosError{Method: "AddUnits", Reason: "injected failure"}
+	c.Assert(err.Error(), Equals, "chaos: AddUnits failed: injected failure.")
+}
+
+func (s *S) TestChaosScript(c *C) {
+	p := NewFakeProvisioner()
+	p.SetChaos(&Chaos{Script: map[string][]string{"Provision": {"fail", "ok"}}})
+	app := NewFakeApp("kid-a", "python", 0)
+	err := p.Provision(app)
+	c.Assert(err, FitsTypeOf, &ChaosError{})
+	c.Assert(p.FindApp(app), Equals, -1)
+	err = p.Provision(app)
+	c.Assert(err, IsNil)
+	c.Assert(p.FindApp(app), Equals, 0)
+}
+
+func (s *S) TestChaosScriptIsPerMethod(c *C) {
+	p := NewFakeProvisioner()
+	p.SetChaos(&Chaos{Script: map[string][]string{"Destroy": {"fail"}}})
+	app := NewFakeApp("kid-a", "python", 0)
+	err := p.Provision(app)
+	c.Assert(err, IsNil)
+	err = p.Destroy(app)
+	c.Assert(err, ErrorMatches, "^chaos: Destroy failed: injected failure.$")
+	err = p.Destroy(app)
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestChaosFailureRate(c *C) {
+	p := NewFakeProvisioner()
+	p.SetChaos(&Chaos{FailureRate: map[string]float64{"CollectStatus": 1}})
+	_, err := p.CollectStatus()
+	c.Assert(err, FitsTypeOf, &ChaosError{})
+	p.SetChaos(&Chaos{FailureRate: map[string]float64{"CollectStatus": 0}})
+	_, err = p.CollectStatus()
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestChaosFailureRateIsReproducible(c *C) {
+	results := func() []bool {
+		p := NewFakeProvisioner()
+		p.SetChaos(&Chaos{FailureRate: map[string]float64{"CollectStatus": 0.5}, Seed: 42})
+		var r []bool
+		for i := 0; i < 20; i++ {
+			_, err := p.CollectStatus()
+			r = append(r, err != nil)
+		}
+		return r
+	}
+	c.Assert(results(), DeepEquals, results())
+}
+
+func (s *S) TestChaosExecuteCommand(c *C) {
+	p := NewFakeProvisioner()
+	p.SetChaos(&Chaos{Script: map[string][]string{"ExecuteCommand": {"fail"}}})
+	app := NewFakeApp("kid-a", "python", 1)
+	err := p.ExecuteCommand(nil, nil, app, "ls")
+	c.Assert(err, FitsTypeOf, &ChaosError{})
+	c.Assert(p.GetCmds("ls", app), HasLen, 1)
+}
+
+func (s *S) TestChaosLatency(c *C) {
+	p := NewFakeProvisioner()
+	p.SetChaos(&Chaos{Latency: 50 * time.Millisecond})
+	start := time.Now()
+	p.CollectStatus()
+	c.Assert(time.Since(start) >= 50*time.Millisecond, Equals, true)
+}
+
+func (s *S) TestChaosPartialAddUnits(c *C) {
+	p := NewFakeProvisioner()
+	app := NewFakeApp("kid-a", "python", 0)
+	p.Provision(app)
+	p.SetChaos(&Chaos{PartialAddUnits: 1})
+	units, err := p.AddUnits(app, 5, "web")
+	c.Assert(err, FitsTypeOf, &ChaosError{})
+	c.Assert(len(units) > 0, Equals, true)
+	c.Assert(len(units) < 5, Equals, true)
+	c.Assert(p.GetUnits(app), HasLen, len(units)+1)
+}
+
+func (s *S) TestChaosPartialAddUnitsNeverAffectsOneUnit(c *C) {
+	p := NewFakeProvisioner()
+	app := NewFakeApp("kid-a", "python", 0)
+	p.Provision(app)
+	p.SetChaos(&Chaos{PartialAddUnits: 1})
+	units, err := p.AddUnits(app, 1, "web")
+	c.Assert(err, IsNil)
+	c.Assert(units, HasLen, 1)
+}
+
+func (s *S) TestChaosFlapping(c *C) {
+	p := NewFakeProvisioner()
+	app := NewFakeApp("kid-a", "python", 0)
+	p.Provision(app)
+	p.AddUnits(app, 9, "web")
+	p.SetChaos(&Chaos{FlappingRate: 1})
+	units, err := p.CollectStatus()
+	c.Assert(err, IsNil)
+	c.Assert(units, HasLen, 10)
+	for _, unit := range units {
+		c.Assert(unit.Status, Not(Equals), provision.StatusStarted)
+	}
+	for _, unit := range p.GetUnits(app) {
+		c.Assert(unit.Status, Equals, provision.StatusStarted)
+	}
+}
+
+func (s *S) TestResetDisablesChaos(c *C) {
+	p := NewFakeProvisioner()
+	p.SetChaos(&Chaos{FailureRate: map[string]float64{"CollectStatus": 1}})
+	p.Reset()
+	_, err := p.CollectStatus()
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestChaosFromConfig(c *C) {
+	config.Set("fake:chaos:seed", 42)
+	config.Set("fake:chaos:latency", "200ms")
+	config.Set("fake:chaos:flapping-rate", 0.1)
+	config.Set("fake:chaos:partial-add-units", 0.2)
+	config.Set("fake:chaos:failure-rate:AddUnits", 0.3)
+	config.Set("fake:chaos:script:Provision", []interface{}{"ok", "fail"})
+	defer config.Unset("fake")
+	chaos, err := ChaosFromConfig()
+	c.Assert(err, IsNil)
+	c.Assert(chaos.Seed, Equals, int64(42))
+	c.Assert(chaos.Latency, Equals, 200*time.Millisecond)
+	c.Assert(chaos.FlappingRate, Equals, 0.1)
+	c.Assert(chaos.PartialAddUnits, Equals, 0.2)
+	c.Assert(chaos.FailureRate, DeepEquals, map[string]float64{"AddUnits": 0.3})
+	c.Assert(chaos.Script, DeepEquals, map[string][]string{"Provision": {"ok", "fail"}})
+}
+
+func (s *S) TestChaosFromConfigWithoutChaosSection(c *C) {
+	config.Unset("fake")
+	chaos, err := ChaosFromConfig()
+	c.Assert(err, IsNil)
+	c.Assert(chaos, IsNil)
+}
+
+func (s *S) TestChaosFromConfigInvalidScript(c *C) {
+	config.Set("fake:chaos:script:Provision", []interface{}{"ok", "explode"})
+	defer config.Unset("fake")
+	chaos, err := ChaosFromConfig()
+	c.Assert(chaos, IsNil)
+	c.Assert(err, ErrorMatches, `^Invalid result in the chaos script of Provision: "explode".$`)
+}
+
+func (s *S) TestRegisteredProvisionerIsUsable(c *C) {
+	p, err := provision.Get("fake")
+	c.Assert(err, IsNil)
+	fake, ok := p.(*FakeProvisioner)
+	c.Assert(ok, Equals, true)
+	c.Assert(fake.fromConfig, Equals, true)
+	app := NewFakeApp("kid-a", "python", 0)
+	defer fake.Destroy(app)
+	c.Assert(fake.Provision(app), IsNil)
+}
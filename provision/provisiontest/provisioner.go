@@ -2,20 +2,25 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package testing
+// Package provisiontest provides a fake provisioner, registered as "fake", for
+// tests and for the binaries built with the fake tag.
+package provisiontest
 
 import (
 	"errors"
 	"fmt"
 	"github.com/globocom/tsuru/provision"
 	"io"
+	"math/rand"
 	"strconv"
 	"sync"
 	"time"
 )
 
 func init() {
-	provision.Register("fake", &FakeProvisioner{})
+	p := NewFakeProvisioner()
+	p.fromConfig = true
+	provision.Register("fake", p)
 }
 
 // Fake implementation for provision.Unit.
@@ -47,6 +52,7 @@ type FakeApp struct {
 	units     []provision.AppUnit
 	logs      []string
 	actions   []string
+	plan      provision.Plan
 }
 
 func NewFakeApp(name, framework string, units int) *FakeApp {
@@ -56,7 +62,7 @@ func NewFakeApp(name, framework string, units int) *FakeApp {
 		units:     make([]provision.AppUnit, units),
 	}
 	for i := 0; i < units; i++ {
-		app.units[i] = &FakeUnit{name: name, machine: i + 1}
+		app.units[i] = &FakeUnit{name: fmt.Sprintf("%s/%d", name, i), machine: i + 1}
 	}
 	return &app
 }
@@ -82,6 +88,16 @@ func (a *FakeApp) ProvisionUnits() []provision.AppUnit {
 	return a.units
 }
 
+// SetPlan changes the plan of the app.
+func (a *FakeApp) SetPlan(plan provision.Plan) {
+	a.plan = plan
+}
+
+func (a *FakeApp) GetPlan() provision.Plan {
+	a.actions = append(a.actions, "getplan")
+	return a.plan
+}
+
 type Cmd struct {
 	Cmd  string
 	Args []string
@@ -97,11 +113,19 @@ type failure struct {
 type FakeProvisioner struct {
 	apps     []provision.App
 	units    map[string][]provision.Unit
+	counters map[string]uint
 	cmds     []Cmd
 	outputs  chan []byte
 	failures chan failure
 	cmdMut   sync.Mutex
 	unitMut  sync.Mutex
+
+	chaos      *Chaos
+	chaosMut   sync.Mutex
+	scriptPos  map[string]int
+	random     *rand.Rand
+	fromConfig bool
+	configOnce sync.Once
 }
 
 func NewFakeProvisioner() *FakeProvisioner {
@@ -109,10 +133,14 @@ func NewFakeProvisioner() *FakeProvisioner {
 	p.outputs = make(chan []byte, 8)
 	p.failures = make(chan failure, 8)
 	p.units = make(map[string][]provision.Unit)
+	p.counters = make(map[string]uint)
 	return &p
 }
 
 func (p *FakeProvisioner) getError(method string) error {
+	if err := p.chaosError(method); err != nil {
+		return err
+	}
 	select {
 	case fail := <-p.failures:
 		if fail.method == method {
@@ -161,9 +189,14 @@ func (p *FakeProvisioner) PrepareFailure(method string, err error) {
 	p.failures <- failure{method, err}
 }
 
+// Reset removes all units, commands, prepared outputs and failures from the
+// provisioner, and disables chaos mode.
 func (p *FakeProvisioner) Reset() {
+	p.SetChaos(nil)
+
 	p.unitMut.Lock()
 	p.units = make(map[string][]provision.Unit)
+	p.counters = make(map[string]uint)
 	p.unitMut.Unlock()
 
 	p.cmdMut.Lock()
@@ -196,10 +229,12 @@ func (p *FakeProvisioner) Provision(app provision.App) error {
 			AppName: app.GetName(),
 			Type:    app.GetFramework(),
 			Status:  provision.StatusStarted,
-			Ip:      "10.10.10.1",
-			Machine: 1,
+			Ip:      "10.10.10." + strconv.Itoa(len(p.apps)),
+			Machine: len(p.apps),
+			Process: provision.DefaultProcess,
 		},
 	}
+	p.counters[app.GetName()] = 1
 	p.unitMut.Unlock()
 	return nil
 }
@@ -216,11 +251,12 @@ func (p *FakeProvisioner) Destroy(app provision.App) error {
 	p.apps = p.apps[:len(p.apps)-1]
 	p.unitMut.Lock()
 	delete(p.units, app.GetName())
+	delete(p.counters, app.GetName())
 	p.unitMut.Unlock()
 	return nil
 }
 
-func (p *FakeProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit, error) {
+func (p *FakeProvisioner) AddUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
 	if err := p.getError("AddUnits"); err != nil {
 		return nil, err
 	}
@@ -233,19 +269,30 @@ func (p *FakeProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit,
 	}
 	name := app.GetName()
 	framework := app.GetFramework()
+	requested := n
+	n, partial := p.partialUnits(n)
 	p.unitMut.Lock()
 	defer p.unitMut.Unlock()
 	length := uint(len(p.units[name]))
+	// Unit numbers are never reused, even after the units are removed.
+	next := p.counters[name]
 	for i := uint(0); i < n; i++ {
 		unit := provision.Unit{
-			Name:    fmt.Sprintf("%s/%d", name, length+i),
+			Name:    fmt.Sprintf("%s/%d", name, next),
 			AppName: name,
 			Type:    framework,
 			Status:  provision.StatusStarted,
-			Ip:      fmt.Sprintf("10.10.10.%d", length+i),
-			Machine: int(length + i),
+			Ip:      fmt.Sprintf("10.10.10.%d", next),
+			Machine: int(next),
+			Process: process,
 		}
 		p.units[name] = append(p.units[name], unit)
+		next++
+	}
+	p.counters[name] = next
+	if partial {
+		reason := fmt.Sprintf("added only %d of %d units", n, requested)
+		return p.units[name][length:], &ChaosError{Method: "AddUnits", Reason: reason}
 	}
 	return p.units[name][length:], nil
 }
@@ -310,6 +357,9 @@ func (p *FakeProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision
 	p.cmdMut.Lock()
 	p.cmds = append(p.cmds, command)
 	p.cmdMut.Unlock()
+	if err := p.chaosError("ExecuteCommand"); err != nil {
+		return err
+	}
 	select {
 	case output = <-p.outputs:
 		select {
@@ -344,8 +394,14 @@ func (p *FakeProvisioner) CollectStatus() ([]provision.Unit, error) {
 	if err := p.getError("CollectStatus"); err != nil {
 		return nil, err
 	}
-	units := make([]provision.Unit, len(p.apps))
+	units := make([]provision.Unit, 0, len(p.apps))
+	p.unitMut.Lock()
+	defer p.unitMut.Unlock()
 	for i, app := range p.apps {
+		if appUnits, ok := p.units[app.GetName()]; ok {
+			units = append(units, appUnits...)
+			continue
+		}
 		unit := provision.Unit{
 			Name:    app.GetName() + "/0",
 			AppName: app.GetName(),
@@ -353,8 +409,10 @@ func (p *FakeProvisioner) CollectStatus() ([]provision.Unit, error) {
 			Status:  "started",
 			Ip:      "10.10.10." + strconv.Itoa(i+1),
 			Machine: i + 1,
+			Process: provision.DefaultProcess,
 		}
-		units[i] = unit
+		units = append(units, unit)
 	}
+	p.flap(units)
 	return units, nil
 }
@@ -2,12 +2,13 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package testing
+package provisiontest
 
 import (
 	"bytes"
 	"errors"
 	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/provision/conformance"
 	. "launchpad.net/gocheck"
 	"testing"
 )
@@ -20,6 +21,17 @@ type S struct{}
 
 var _ = Suite(&S{})
 
+var _ = Suite(&conformance.ProvisionerSuite{
+	Factory: func() provision.Provisioner {
+		return NewFakeProvisioner()
+	},
+	Prepare: func(c *C, p provision.Provisioner, op conformance.Operation) {
+		if op.Method == "ExecuteCommand" {
+			p.(*FakeProvisioner).PrepareOutput([]byte(op.Output))
+		}
+	},
+})
+
 func (s *S) TestFindApp(c *C) {
 	app := NewFakeApp("red-sector", "rush", 1)
 	p := NewFakeProvisioner()
@@ -48,8 +60,8 @@ func (s *S) TestGetCmds(c *C) {
 
 func (s *S) TestGetUnits(c *C) {
 	list := []provision.Unit{
-		{"chain-lighting/0", "chain-lighting", "django", 1, "10.10.10.10", provision.StatusStarted},
-		{"chain-lighting/1", "chain-lighting", "django", 2, "10.10.10.15", provision.StatusStarted},
+		{"chain-lighting/0", "chain-lighting", "django", 1, "10.10.10.10", provision.StatusStarted, "web"},
+		{"chain-lighting/1", "chain-lighting", "django", 2, "10.10.10.15", provision.StatusStarted, "web"},
 	}
 	app := NewFakeApp("chain-lighting", "rush", 1)
 	p := NewFakeProvisioner()
@@ -89,6 +101,7 @@ func (s *S) TestProvision(c *C) {
 		Status:  provision.StatusStarted,
 		Ip:      "10.10.10.1",
 		Machine: 1,
+		Process: provision.DefaultProcess,
 	}
 	unit := p.units["kid-gloves"][0]
 	c.Assert(unit, DeepEquals, expected)
@@ -144,15 +157,51 @@ func (s *S) TestAddUnits(c *C) {
 	app := NewFakeApp("mystic-rhythms", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	units, err := p.AddUnits(app, 2)
+	units, err := p.AddUnits(app, 2, "web")
 	c.Assert(err, IsNil)
 	c.Assert(p.units["mystic-rhythms"], HasLen, 3)
 	c.Assert(units, HasLen, 2)
 }
 
+func (s *S) TestAddUnitsOfAProcess(c *C) {
+	app := NewFakeApp("mystic-rhythms", "rush", 0)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	units, err := p.AddUnits(app, 2, "worker")
+	c.Assert(err, IsNil)
+	c.Assert(units, HasLen, 2)
+	c.Assert(units[0].Process, Equals, "worker")
+	c.Assert(units[1].Process, Equals, "worker")
+	c.Assert(p.units["mystic-rhythms"][0].Process, Equals, "web")
+}
+
+func (s *S) TestAddUnitsDoesNotReuseNames(c *C) {
+	app := NewFakeApp("mystic-rhythms", "rush", 0)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	p.AddUnits(app, 2, "web")
+	err := p.RemoveUnit(app, "mystic-rhythms/1")
+	c.Assert(err, IsNil)
+	units, err := p.AddUnits(app, 1, "web")
+	c.Assert(err, IsNil)
+	c.Assert(units[0].Name, Equals, "mystic-rhythms/3")
+}
+
+func (s *S) TestAddUnitsDoesNotReuseNameOfTheLastUnit(c *C) {
+	app := NewFakeApp("mystic-rhythms", "rush", 0)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	p.AddUnits(app, 2, "web")
+	err := p.RemoveUnit(app, "mystic-rhythms/2")
+	c.Assert(err, IsNil)
+	units, err := p.AddUnits(app, 1, "web")
+	c.Assert(err, IsNil)
+	c.Assert(units[0].Name, Equals, "mystic-rhythms/3")
+}
+
 func (s *S) TestAddZeroUnits(c *C) {
 	p := NewFakeProvisioner()
-	units, err := p.AddUnits(nil, 0)
+	units, err := p.AddUnits(nil, 0, "web")
 	c.Assert(units, IsNil)
 	c.Assert(err, NotNil)
 	c.Assert(err.Error(), Equals, "Cannot add 0 units.")
@@ -161,7 +210,7 @@ func (s *S) TestAddZeroUnits(c *C) {
 func (s *S) TestAddUnitsUnprovisionedApp(c *C) {
 	app := NewFakeApp("mystic-rhythms", "rush", 0)
 	p := NewFakeProvisioner()
-	units, err := p.AddUnits(app, 1)
+	units, err := p.AddUnits(app, 1, "web")
 	c.Assert(units, IsNil)
 	c.Assert(err, NotNil)
 	c.Assert(err.Error(), Equals, "App is not provisioned.")
@@ -170,7 +219,7 @@ func (s *S) TestAddUnitsUnprovisionedApp(c *C) {
 func (s *S) TestAddUnitsFailure(c *C) {
 	p := NewFakeProvisioner()
 	p.PrepareFailure("AddUnits", errors.New("Cannot add more units."))
-	units, err := p.AddUnits(nil, 10)
+	units, err := p.AddUnits(nil, 10, "web")
 	c.Assert(units, IsNil)
 	c.Assert(err, NotNil)
 	c.Assert(err.Error(), Equals, "Cannot add more units.")
@@ -180,7 +229,7 @@ func (s *S) TestRemoveUnit(c *C) {
 	app := NewFakeApp("hemispheres", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	_, err := p.AddUnits(app, 2)
+	_, err := p.AddUnits(app, 2, "web")
 	c.Assert(err, IsNil)
 	err = p.RemoveUnit(app, "hemispheres/1")
 	c.Assert(err, IsNil)
@@ -200,7 +249,7 @@ func (s *S) TestRemoveUnknownUnit(c *C) {
 	app := NewFakeApp("hemispheres", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	_, err := p.AddUnits(app, 2)
+	_, err := p.AddUnits(app, 2, "web")
 	c.Assert(err, IsNil)
 	err = p.RemoveUnit(app, "hemispheres/3")
 	c.Assert(err, NotNil)
@@ -219,7 +268,7 @@ func (s *S) TestRemoveUnits(c *C) {
 	app := NewFakeApp("trees", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	_, err := p.AddUnits(app, 9)
+	_, err := p.AddUnits(app, 9, "web")
 	c.Assert(err, IsNil)
 	units, err := p.RemoveUnits(app, 3)
 	c.Assert(err, IsNil)
@@ -241,7 +290,7 @@ func (s *S) TestRemoveTooManyUnits(c *C) {
 	app := NewFakeApp("strangiato", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	_, err := p.AddUnits(app, 9)
+	_, err := p.AddUnits(app, 9, "web")
 	c.Assert(err, IsNil)
 	numbers := []uint{10, 11, 30}
 	for _, n := range numbers {
@@ -311,16 +360,26 @@ func (s *S) TestCollectStatus(c *C) {
 		NewFakeApp("grand-designs", "rush", 1),
 	}
 	expected := []provision.Unit{
-		{"red-lenses/0", "red-lenses", "rush", 1, "10.10.10.1", "started"},
-		{"between-the-wheels/0", "between-the-wheels", "rush", 2, "10.10.10.2", "started"},
-		{"the-big-money/0", "the-big-money", "rush", 3, "10.10.10.3", "started"},
-		{"grand-designs/0", "grand-designs", "rush", 4, "10.10.10.4", "started"},
+		{"red-lenses/0", "red-lenses", "rush", 1, "10.10.10.1", "started", "web"},
+		{"between-the-wheels/0", "between-the-wheels", "rush", 2, "10.10.10.2", "started", "web"},
+		{"the-big-money/0", "the-big-money", "rush", 3, "10.10.10.3", "started", "web"},
+		{"grand-designs/0", "grand-designs", "rush", 4, "10.10.10.4", "started", "web"},
 	}
 	units, err := p.CollectStatus()
 	c.Assert(err, IsNil)
 	c.Assert(units, DeepEquals, expected)
 }
 
+func (s *S) TestCollectStatusReportsAddedUnits(c *C) {
+	app := NewFakeApp("red-lenses", "rush", 0)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	p.AddUnits(app, 2, "web")
+	units, err := p.CollectStatus()
+	c.Assert(err, IsNil)
+	c.Assert(units, DeepEquals, p.GetUnits(app))
+}
+
 func (s *S) TestCollectStatusPreparedFailure(c *C) {
 	p := NewFakeProvisioner()
 	p.PrepareFailure("CollectStatus", errors.New("Failed to collect status."))
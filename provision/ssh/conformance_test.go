@@ -0,0 +1,48 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"github.com/globocom/commandmocker"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/provision/conformance"
+	. "launchpad.net/gocheck"
+)
+
+// conformanceEnv runs the provisioner against a pool of two hosts, replacing
+// the ssh binary with a script that prints the output of the command.
+type conformanceEnv struct {
+	tmpdir string
+}
+
+var sshEnv conformanceEnv
+
+func (e *conformanceEnv) provisioner() provision.Provisioner {
+	db.Session.Hosts().RemoveAll(nil)
+	AddHost("10.10.10.1", 10)
+	AddHost("10.10.10.2", 10)
+	return &SSHProvisioner{}
+}
+
+func (e *conformanceEnv) prepare(c *C, p provision.Provisioner, op conformance.Operation) {
+	e.tearDown(c)
+	var err error
+	e.tmpdir, err = commandmocker.Add("ssh", op.Output)
+	c.Assert(err, IsNil)
+}
+
+func (e *conformanceEnv) tearDown(c *C) {
+	if e.tmpdir != "" {
+		commandmocker.Remove(e.tmpdir)
+		e.tmpdir = ""
+	}
+}
+
+var _ = Suite(&conformance.ProvisionerSuite{
+	Factory:  sshEnv.provisioner,
+	Prepare:  sshEnv.prepare,
+	TearDown: sshEnv.tearDown,
+})
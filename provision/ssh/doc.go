@@ -0,0 +1,36 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ssh provides a provisioner that places units in a static pool of
+// pre-existing hosts, for environments where juju is not an option.
+//
+// Hosts are registered by admins, with a capacity that limits how many units
+// each host runs. New units go to the hosts with more free slots. The
+// provisioner runs commands in the hosts over SSH, using the user and the key
+// defined in tsuru.conf:
+//
+//	provisioner: ssh
+//	ssh:
+//	  user: tsuru
+//	  key: /home/tsuru/.ssh/id_rsa
+//	  unit-script: /usr/local/bin/tsuru-unit
+//
+// Every host must have the unit script installed. The provisioner calls it
+// with the following arguments:
+//
+//	tsuru-unit create <unit> <framework> <repository> [--process=<process>] [--memory=<MB>] [--cpu-share=<share>]
+//	tsuru-unit destroy <unit>
+//	tsuru-unit exec <unit> <command>
+//	tsuru-unit status
+//
+// The exec command runs the given shell command inside the unit, as the
+// user of the app, so the files of the unit, like the apprc and the hooks,
+// are not shared with the units of other apps placed in the same host.
+//
+// The status command prints one line for each unit in the host, containing
+// the name and the status of the unit (started, installing, down or error).
+//
+// The process option tells which process type, declared in the Procfile of
+// the app, the unit runs. It's omitted for units of the web process.
+package ssh
@@ -0,0 +1,261 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrHostAlreadyExists = errors.New("There is already a host with this address.")
+	ErrHostNotFound      = errors.New("Host not found.")
+	ErrHostNotEmpty      = errors.New("Cannot remove a host that has units.")
+)
+
+// placeMut serializes changes in the placement of units made by this
+// process. The api and the collector run in different processes, so the
+// database updates are also conditional on the room left in the host, see
+// placeIn.
+var placeMut sync.Mutex
+
+// hostUnit is a unit placed in a host.
+type hostUnit struct {
+	Name    string
+	App     string
+	Type    string
+	Process string
+}
+
+// index returns the number of the unit, which comes after the slash in its
+// name.
+func (u *hostUnit) index() int {
+	i, _ := strconv.Atoi(u.Name[strings.LastIndex(u.Name, "/")+1:])
+	return i
+}
+
+// Host is a pre-existing machine in the pool managed by the SSH provisioner.
+// Each host runs at most Capacity units.
+type Host struct {
+	Address  string `bson:"_id"`
+	Machine  int
+	Capacity int
+	Units    []hostUnit
+}
+
+// Free returns how many units can still be placed in the host.
+func (h *Host) Free() int {
+	return h.Capacity - len(h.Units)
+}
+
+// AddHost registers a new host in the pool, with capacity for the given
+// number of units.
+func AddHost(address string, capacity int) (*Host, error) {
+	if address == "" {
+		return nil, errors.New("The address of the host is required.")
+	}
+	if capacity < 1 {
+		return nil, errors.New("The capacity of the host must be at least 1.")
+	}
+	placeMut.Lock()
+	defer placeMut.Unlock()
+	var last Host
+	err := db.Session.Hosts().Find(nil).Sort("-machine").One(&last)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	n, err := db.Session.Hosts().FindId(address).Count()
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, ErrHostAlreadyExists
+	}
+	host := Host{Address: address, Machine: last.Machine + 1, Capacity: capacity}
+	if err = db.Session.Hosts().Insert(host); err != nil {
+		return nil, err
+	}
+	return &host, nil
+}
+
+// RemoveHost removes a host from the pool. Hosts that still run units can't
+// be removed.
+func RemoveHost(address string) error {
+	placeMut.Lock()
+	defer placeMut.Unlock()
+	var host Host
+	err := db.Session.Hosts().FindId(address).One(&host)
+	if err == mgo.ErrNotFound {
+		return ErrHostNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if len(host.Units) > 0 {
+		return ErrHostNotEmpty
+	}
+	err = db.Session.Hosts().Remove(bson.M{"_id": address, "units": bson.M{"$size": 0}})
+	if err == mgo.ErrNotFound {
+		return ErrHostNotEmpty
+	}
+	return err
+}
+
+// ListHosts returns all hosts in the pool, ordered by machine number.
+func ListHosts() ([]Host, error) {
+	var hosts []Host
+	err := db.Session.Hosts().Find(nil).Sort("machine").All(&hosts)
+	return hosts, err
+}
+
+// placement is a unit along with the host where it was placed.
+type placement struct {
+	host *Host
+	unit hostUnit
+}
+
+// place reserves room for n new units of the app, running the given process,
+// choosing the hosts with more free slots. Either all units are placed or
+// none is.
+func place(app provision.App, n int, process string) ([]placement, error) {
+	placeMut.Lock()
+	defer placeMut.Unlock()
+	hosts, err := ListHosts()
+	if err != nil {
+		return nil, err
+	}
+	var free int
+	used := 0
+	for i := range hosts {
+		free += hosts[i].Free()
+		for _, u := range hosts[i].Units {
+			if u.App == app.GetName() && u.index() >= used {
+				used = u.index() + 1
+			}
+		}
+	}
+	if free < n {
+		return nil, fmt.Errorf("There is no room for %d units in the host pool, only %d slots are free.", n, free)
+	}
+	next, err := reserveIndexes(app.GetName(), n, used)
+	if err != nil {
+		return nil, err
+	}
+	placements := make([]placement, n)
+	for i := 0; i < n; i++ {
+		unit := hostUnit{
+			Name:    fmt.Sprintf("%s/%d", app.GetName(), next+i),
+			App:     app.GetName(),
+			Type:    app.GetFramework(),
+			Process: process,
+		}
+		host, err := placeIn(hosts, unit)
+		if err != nil {
+			for _, p := range placements[:i] {
+				unplace(p.host.Address, p.unit.Name)
+			}
+			return nil, err
+		}
+		placements[i] = placement{host: host, unit: unit}
+	}
+	return placements, nil
+}
+
+// placeIn adds the unit to the host with more free slots. The update only
+// matches while the host has room for the unit, so concurrent placements made
+// by other processes don't over-commit it: when the host is taken, it's
+// reloaded and the unit goes to the next best host.
+func placeIn(hosts []Host, unit hostUnit) (*Host, error) {
+	for {
+		host := &hosts[0]
+		for j := range hosts {
+			if hosts[j].Free() > host.Free() {
+				host = &hosts[j]
+			}
+		}
+		if host.Free() < 1 {
+			return nil, errors.New("There is no room for the unit in the host pool, all slots were taken.")
+		}
+		last := fmt.Sprintf("units.%d", host.Capacity-1)
+		query := bson.M{"_id": host.Address, last: bson.M{"$exists": false}}
+		err := db.Session.Hosts().Update(query, bson.M{"$push": bson.M{"units": unit}})
+		if err == nil {
+			host.Units = append(host.Units, unit)
+			return host, nil
+		}
+		if err != mgo.ErrNotFound {
+			return nil, err
+		}
+		if err = db.Session.Hosts().FindId(host.Address).One(host); err == mgo.ErrNotFound {
+			host.Capacity, host.Units = 0, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// unitCounter holds the number of the next unit of an app. Numbers are never
+// reused, even after the units are removed.
+type unitCounter struct {
+	App  string `bson:"_id"`
+	Next int
+}
+
+// reserveIndexes atomically reserves n unit numbers for the app, returning the
+// first one. Apps without a counter start after used, the number that follows
+// the units already placed.
+func reserveIndexes(appName string, n, used int) (int, error) {
+	err := db.Session.UnitCounters().Insert(unitCounter{App: appName, Next: used})
+	if err != nil && !mgo.IsDup(err) {
+		return 0, err
+	}
+	var counter unitCounter
+	change := mgo.Change{Update: bson.M{"$inc": bson.M{"next": n}}, ReturnNew: true}
+	if _, err = db.Session.UnitCounters().FindId(appName).Apply(change, &counter); err != nil {
+		return 0, err
+	}
+	return counter.Next - n, nil
+}
+
+// removeCounter removes the unit counter of a destroyed app.
+func removeCounter(appName string) error {
+	return db.Session.UnitCounters().RemoveId(appName)
+}
+
+// unplace frees the slot used by the given unit.
+func unplace(address, unitName string) error {
+	return db.Session.Hosts().UpdateId(address, bson.M{"$pull": bson.M{"units": bson.M{"name": unitName}}})
+}
+
+// appPlacements returns the units of the app and the hosts where they're
+// placed, ordered by unit number.
+func appPlacements(appName string) ([]placement, error) {
+	var hosts []Host
+	err := db.Session.Hosts().Find(bson.M{"units.app": appName}).All(&hosts)
+	if err != nil {
+		return nil, err
+	}
+	var placements []placement
+	for i := range hosts {
+		for _, u := range hosts[i].Units {
+			if u.App == appName {
+				placements = append(placements, placement{host: &hosts[i], unit: u})
+			}
+		}
+	}
+	for i := 1; i < len(placements); i++ {
+		for j := i; j > 0 && placements[j].unit.index() < placements[j-1].unit.index(); j-- {
+			placements[j], placements[j-1] = placements[j-1], placements[j]
+		}
+	}
+	return placements, nil
+}
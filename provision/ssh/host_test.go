@@ -0,0 +1,164 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision/provisiontest"
+	"labix.org/v2/mgo/bson"
+	. "launchpad.net/gocheck"
+)
+
+func (s *S) TestAddHost(c *C) {
+	host, err := AddHost("10.10.10.1", 4)
+	c.Assert(err, IsNil)
+	c.Assert(host.Machine, Equals, 1)
+	var stored Host
+	err = db.Session.Hosts().FindId("10.10.10.1").One(&stored)
+	c.Assert(err, IsNil)
+	c.Assert(stored.Capacity, Equals, 4)
+	c.Assert(stored.Machine, Equals, 1)
+}
+
+func (s *S) TestAddHostIncrementsTheMachineNumber(c *C) {
+	_, err := AddHost("10.10.10.1", 4)
+	c.Assert(err, IsNil)
+	host, err := AddHost("10.10.10.2", 4)
+	c.Assert(err, IsNil)
+	c.Assert(host.Machine, Equals, 2)
+}
+
+func (s *S) TestAddHostDuplicated(c *C) {
+	_, err := AddHost("10.10.10.1", 4)
+	c.Assert(err, IsNil)
+	_, err = AddHost("10.10.10.1", 2)
+	c.Assert(err, Equals, ErrHostAlreadyExists)
+}
+
+func (s *S) TestAddHostValidation(c *C) {
+	_, err := AddHost("", 4)
+	c.Assert(err, ErrorMatches, "^The address of the host is required.$")
+	_, err = AddHost("10.10.10.1", 0)
+	c.Assert(err, ErrorMatches, "^The capacity of the host must be at least 1.$")
+}
+
+func (s *S) TestRemoveHost(c *C) {
+	_, err := AddHost("10.10.10.1", 4)
+	c.Assert(err, IsNil)
+	err = RemoveHost("10.10.10.1")
+	c.Assert(err, IsNil)
+	n, err := db.Session.Hosts().FindId("10.10.10.1").Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
+func (s *S) TestRemoveHostNotFound(c *C) {
+	err := RemoveHost("10.10.10.1")
+	c.Assert(err, Equals, ErrHostNotFound)
+}
+
+func (s *S) TestRemoveHostWithUnits(c *C) {
+	host := Host{Address: "10.10.10.1", Capacity: 2, Units: []hostUnit{{Name: "myapp/0", App: "myapp"}}}
+	err := db.Session.Hosts().Insert(host)
+	c.Assert(err, IsNil)
+	err = RemoveHost("10.10.10.1")
+	c.Assert(err, Equals, ErrHostNotEmpty)
+}
+
+func (s *S) TestListHosts(c *C) {
+	AddHost("10.10.10.2", 4)
+	AddHost("10.10.10.1", 2)
+	hosts, err := ListHosts()
+	c.Assert(err, IsNil)
+	c.Assert(hosts, HasLen, 2)
+	c.Assert(hosts[0].Address, Equals, "10.10.10.2")
+	c.Assert(hosts[1].Address, Equals, "10.10.10.1")
+}
+
+func (s *S) TestPlaceChoosesHostsWithMoreFreeSlots(c *C) {
+	AddHost("10.10.10.1", 2)
+	AddHost("10.10.10.2", 3)
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	placements, err := place(app, 3, "web")
+	c.Assert(err, IsNil)
+	c.Assert(placements, HasLen, 3)
+	c.Assert(placements[0].host.Address, Equals, "10.10.10.2")
+	c.Assert(placements[0].unit.Name, Equals, "myapp/0")
+	c.Assert(placements[1].host.Address, Equals, "10.10.10.1")
+	c.Assert(placements[1].unit.Name, Equals, "myapp/1")
+	c.Assert(placements[2].host.Address, Equals, "10.10.10.2")
+	hosts, err := ListHosts()
+	c.Assert(err, IsNil)
+	c.Assert(hosts[0].Units, HasLen, 1)
+	c.Assert(hosts[1].Units, HasLen, 2)
+}
+
+func (s *S) TestPlaceDoesNotReuseUnitNumbers(c *C) {
+	host := Host{Address: "10.10.10.1", Machine: 1, Capacity: 4, Units: []hostUnit{{Name: "myapp/3", App: "myapp"}}}
+	db.Session.Hosts().Insert(host)
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	placements, err := place(app, 1, "web")
+	c.Assert(err, IsNil)
+	c.Assert(placements[0].unit.Name, Equals, "myapp/4")
+}
+
+func (s *S) TestPlaceDoesNotReuseNumbersOfRemovedUnits(c *C) {
+	AddHost("10.10.10.1", 4)
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	placements, err := place(app, 2, "web")
+	c.Assert(err, IsNil)
+	err = unplace(placements[1].host.Address, placements[1].unit.Name)
+	c.Assert(err, IsNil)
+	placements, err = place(app, 1, "web")
+	c.Assert(err, IsNil)
+	c.Assert(placements[0].unit.Name, Equals, "myapp/2")
+}
+
+func (s *S) TestPlaceInDoesNotOvercommitHostsTakenByOtherProcesses(c *C) {
+	AddHost("10.10.10.1", 2)
+	AddHost("10.10.10.2", 1)
+	hosts, err := ListHosts()
+	c.Assert(err, IsNil)
+	// Another process fills the first host after the hosts were listed.
+	taken := []hostUnit{{Name: "other/0", App: "other"}, {Name: "other/1", App: "other"}}
+	err = db.Session.Hosts().UpdateId("10.10.10.1", bson.M{"$set": bson.M{"units": taken}})
+	c.Assert(err, IsNil)
+	host, err := placeIn(hosts, hostUnit{Name: "myapp/0", App: "myapp"})
+	c.Assert(err, IsNil)
+	c.Assert(host.Address, Equals, "10.10.10.2")
+	host, err = placeIn(hosts, hostUnit{Name: "myapp/1", App: "myapp"})
+	c.Assert(host, IsNil)
+	c.Assert(err, ErrorMatches, "^There is no room for the unit in the host pool, all slots were taken.$")
+	hosts, err = ListHosts()
+	c.Assert(err, IsNil)
+	c.Assert(hosts[0].Units, HasLen, 2)
+	c.Assert(hosts[1].Units, HasLen, 1)
+}
+
+func (s *S) TestPlaceWithoutRoom(c *C) {
+	AddHost("10.10.10.1", 1)
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	placements, err := place(app, 2, "web")
+	c.Assert(placements, IsNil)
+	c.Assert(err, ErrorMatches, "^There is no room for 2 units in the host pool, only 1 slots are free.$")
+	hosts, _ := ListHosts()
+	c.Assert(hosts[0].Units, HasLen, 0)
+}
+
+func (s *S) TestAppPlacementsAreSortedByUnitNumber(c *C) {
+	db.Session.Hosts().Insert(Host{Address: "10.10.10.1", Machine: 1, Capacity: 4, Units: []hostUnit{
+		{Name: "myapp/2", App: "myapp"}, {Name: "other/0", App: "other"},
+	}})
+	db.Session.Hosts().Insert(Host{Address: "10.10.10.2", Machine: 2, Capacity: 4, Units: []hostUnit{
+		{Name: "myapp/10", App: "myapp"}, {Name: "myapp/0", App: "myapp"},
+	}})
+	placements, err := appPlacements("myapp")
+	c.Assert(err, IsNil)
+	var names []string
+	for _, p := range placements {
+		names = append(names, p.unit.Name)
+	}
+	c.Assert(names, DeepEquals, []string{"myapp/0", "myapp/2", "myapp/10"})
+}
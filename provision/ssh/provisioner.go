@@ -0,0 +1,345 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/repository"
+	"io"
+	"labix.org/v2/mgo"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// probeTimeout is how long CollectStatus waits for a host to report the
+// status of its units before considering the host down.
+var probeTimeout time.Duration = 10e9
+
+const defaultUnitScript = "/usr/local/bin/tsuru-unit"
+
+// SSHProvisioner is an implementation for the Provisioner interface that
+// places units in a static pool of hosts, managing them over SSH. For more
+// details on how a provisioner work, check the documentation of the provision
+// package.
+type SSHProvisioner struct{}
+
+func init() {
+	provision.Register("ssh", &SSHProvisioner{})
+}
+
+// sshArgs returns the arguments for running the given command in the host,
+// using the user and key defined in the configuration.
+func sshArgs(host *Host, cmd ...string) []string {
+	args := []string{"-o", "StrictHostKeyChecking no", "-q"}
+	if key, err := config.GetString("ssh:key"); err == nil {
+		args = append(args, "-i", key)
+	}
+	target := host.Address
+	if user, err := config.GetString("ssh:user"); err == nil {
+		target = user + "@" + target
+	}
+	args = append(args, target)
+	return append(args, cmd...)
+}
+
+func sshCommand(stdout, stderr io.Writer, host *Host, cmd ...string) *exec.Cmd {
+	command := exec.Command("ssh", sshArgs(host, cmd...)...)
+	command.Stdout = stdout
+	command.Stderr = stderr
+	return command
+}
+
+// unitCommand returns the command that runs the unit script in the host. The
+// unit script is the program, installed in every host of the pool, that
+// creates, destroys and reports the status of units.
+func unitCommand(stdout, stderr io.Writer, host *Host, args ...string) *exec.Cmd {
+	script, err := config.GetString("ssh:unit-script")
+	if err != nil {
+		script = defaultUnitScript
+	}
+	return sshCommand(stdout, stderr, host, append([]string{script}, args...)...)
+}
+
+// unitScript runs the unit script in the host, see unitCommand.
+func unitScript(stdout, stderr io.Writer, host *Host, args ...string) error {
+	return unitCommand(stdout, stderr, host, args...).Run()
+}
+
+// shellQuote quotes the value for the shell in the host, so the command is
+// given to the unit script as a single argument.
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+func createUnit(app provision.App, p placement) error {
+	var buf bytes.Buffer
+	args := []string{"create", p.unit.Name, app.GetFramework(), repository.GetReadOnlyUrl(app.GetName())}
+	if p.unit.Process != "" && p.unit.Process != provision.DefaultProcess {
+		args = append(args, "--process="+p.unit.Process)
+	}
+	plan := app.GetPlan()
+	if plan.Memory > 0 {
+		args = append(args, fmt.Sprintf("--memory=%d", plan.Memory))
+	}
+	if plan.CpuShare > 0 {
+		args = append(args, fmt.Sprintf("--cpu-share=%d", plan.CpuShare))
+	}
+	if err := unitScript(&buf, &buf, p.host, args...); err != nil {
+		msg := fmt.Sprintf("Failed to create unit %s in %s: %s", p.unit.Name, p.host.Address, buf.String())
+		app.Log(msg, "tsuru")
+		return &provision.Error{Reason: buf.String(), Err: err}
+	}
+	return nil
+}
+
+func destroyUnit(app provision.App, p placement) error {
+	var buf bytes.Buffer
+	if err := unitScript(&buf, &buf, p.host, "destroy", p.unit.Name); err != nil {
+		msg := fmt.Sprintf("Failed to destroy unit %s in %s: %s", p.unit.Name, p.host.Address, buf.String())
+		app.Log(msg, "tsuru")
+		return &provision.Error{Reason: buf.String(), Err: err}
+	}
+	return unplace(p.host.Address, p.unit.Name)
+}
+
+// addUnits places and creates n units of the app, running the given process.
+// If the creation of any unit fails, the units created in the call are
+// destroyed.
+func (p *SSHProvisioner) addUnits(app provision.App, n int, process string) ([]provision.Unit, error) {
+	placements, err := place(app, n, process)
+	if err != nil {
+		return nil, err
+	}
+	units := make([]provision.Unit, len(placements))
+	for i, pl := range placements {
+		if err = createUnit(app, pl); err != nil {
+			for _, created := range placements[:i] {
+				destroyUnit(app, created)
+			}
+			for _, pending := range placements[i:] {
+				unplace(pending.host.Address, pending.unit.Name)
+			}
+			return nil, err
+		}
+		units[i] = provision.Unit{
+			Name:    pl.unit.Name,
+			AppName: app.GetName(),
+			Type:    app.GetFramework(),
+			Machine: pl.host.Machine,
+			Ip:      pl.host.Address,
+			Status:  provision.StatusInstalling,
+			Process: pl.unit.Process,
+		}
+	}
+	return units, nil
+}
+
+func (p *SSHProvisioner) Provision(app provision.App) error {
+	placements, err := appPlacements(app.GetName())
+	if err != nil {
+		return err
+	}
+	if len(placements) > 0 {
+		return &provision.Error{Reason: "App already provisioned."}
+	}
+	_, err = p.addUnits(app, 1, provision.DefaultProcess)
+	return err
+}
+
+func (p *SSHProvisioner) Destroy(app provision.App) error {
+	placements, err := appPlacements(app.GetName())
+	if err != nil {
+		return err
+	}
+	for _, pl := range placements {
+		if err = destroyUnit(app, pl); err != nil {
+			return err
+		}
+	}
+	if err = removeCounter(app.GetName()); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+func (p *SSHProvisioner) AddUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
+	if n < 1 {
+		return nil, errors.New("Cannot add zero units.")
+	}
+	placements, err := appPlacements(app.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if len(placements) == 0 {
+		return nil, errors.New("App is not provisioned.")
+	}
+	return p.addUnits(app, int(n), process)
+}
+
+func (p *SSHProvisioner) RemoveUnit(app provision.App, name string) error {
+	placements, err := appPlacements(app.GetName())
+	if err != nil {
+		return err
+	}
+	for _, pl := range placements {
+		if pl.unit.Name == name {
+			return destroyUnit(app, pl)
+		}
+	}
+	return fmt.Errorf("App %q does not have a unit named %q.", app.GetName(), name)
+}
+
+func (p *SSHProvisioner) RemoveUnits(app provision.App, n uint) ([]int, error) {
+	units := app.ProvisionUnits()
+	length := uint(len(units))
+	if length == n {
+		return nil, errors.New("You can't remove all units from an app.")
+	} else if length < n {
+		return nil, fmt.Errorf("You can't remove %d units from this app because it has only %d units.", n, length)
+	}
+	result := make([]int, n)
+	for i, unit := range units[:n] {
+		if err := p.RemoveUnit(app, unit.GetName()); err != nil {
+			return nil, err
+		}
+		result[i] = i
+	}
+	return result, nil
+}
+
+// ExecuteCommand runs the command in the units of the app, through the exec
+// command of the unit script, so it runs inside the unit instead of the host
+// shared by the units of several apps.
+func (p *SSHProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
+	command := strings.Join(append([]string{cmd}, args...), " ")
+	all, err := appPlacements(app.GetName())
+	if err != nil {
+		return err
+	}
+	units := make(map[string]bool)
+	for _, u := range app.ProvisionUnits() {
+		units[u.GetName()] = true
+	}
+	var placements []placement
+	for _, pl := range all {
+		if units[pl.unit.Name] {
+			placements = append(placements, pl)
+		}
+	}
+	for i, pl := range placements {
+		if len(placements) > 1 {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "Output from unit %q:\n\n", pl.unit.Name)
+		}
+		err = unitScript(stdout, stderr, pl.host, "exec", pl.unit.Name, shellQuote(command))
+		fmt.Fprintln(stdout)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probe asks the host for the status of its units. The unit script prints
+// one unit per line, followed by its status:
+//
+//	myapp/0 started
+//	myapp/1 installing
+//
+// If the host doesn't answer in time, the ssh process is killed and all its
+// units are considered down.
+func probe(host *Host) map[string]provision.Status {
+	var buf bytes.Buffer
+	cmd := unitCommand(&buf, &buf, host, "status")
+	// ssh runs in its own process group, so its children are killed with it
+	// and the output isn't written after probe returns.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil
+		}
+	case <-time.After(probeTimeout):
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return nil
+	}
+	statuses := make(map[string]provision.Status)
+	scanner := bufio.NewReader(&buf)
+	for {
+		line, err := scanner.ReadString('\n')
+		if fields := strings.Fields(line); len(fields) == 2 {
+			statuses[fields[0]] = unitStatus(fields[1])
+		}
+		if err != nil {
+			break
+		}
+	}
+	return statuses
+}
+
+func unitStatus(status string) provision.Status {
+	switch status {
+	case "started":
+		return provision.StatusStarted
+	case "installing":
+		return provision.StatusInstalling
+	case "down":
+		return provision.StatusDown
+	case "error":
+		return provision.StatusError
+	}
+	return provision.StatusPending
+}
+
+func (p *SSHProvisioner) CollectStatus() ([]provision.Unit, error) {
+	hosts, err := ListHosts()
+	if err != nil {
+		return nil, err
+	}
+	var units []provision.Unit
+	for i := range hosts {
+		if len(hosts[i].Units) == 0 {
+			continue
+		}
+		statuses := probe(&hosts[i])
+		for _, u := range hosts[i].Units {
+			status := provision.StatusDown
+			if statuses != nil {
+				status = provision.StatusPending
+				if s, ok := statuses[u.Name]; ok {
+					status = s
+				}
+			}
+			unit := provision.Unit{
+				Name:    u.Name,
+				AppName: u.App,
+				Type:    u.Type,
+				Machine: hosts[i].Machine,
+				Ip:      hosts[i].Address,
+				Status:  status,
+				Process: u.Process,
+			}
+			units = append(units, unit)
+		}
+	}
+	return units, nil
+}
@@ -0,0 +1,337 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"github.com/globocom/commandmocker"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/provision/provisiontest"
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+var sshPrefix = []string{"-o", "StrictHostKeyChecking no", "-q", "-i", "/home/tsuru/.ssh/id_rsa"}
+
+func sshParams(target string, cmd ...string) []string {
+	params := append([]string{}, sshPrefix...)
+	params = append(params, target)
+	return append(params, cmd...)
+}
+
+func (s *S) TestShouldBeRegistered(c *C) {
+	p, err := provision.Get("ssh")
+	c.Assert(err, IsNil)
+	c.Assert(p, FitsTypeOf, &SSHProvisioner{})
+}
+
+func (s *S) TestSSHArgsWithoutUserAndKey(c *C) {
+	config.Unset("ssh:user")
+	config.Unset("ssh:key")
+	defer config.Set("ssh:user", "tsuru")
+	defer config.Set("ssh:key", "/home/tsuru/.ssh/id_rsa")
+	args := sshArgs(&Host{Address: "10.10.10.1"}, "uptime")
+	c.Assert(args, DeepEquals, []string{"-o", "StrictHostKeyChecking no", "-q", "10.10.10.1", "uptime"})
+}
+
+func (s *S) TestProvision(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	AddHost("10.10.10.1", 2)
+	app := provisiontest.NewFakeApp("trace", "python", 0)
+	p := SSHProvisioner{}
+	err = p.Provision(app)
+	c.Assert(err, IsNil)
+	expected := sshParams("tsuru@10.10.10.1", defaultUnitScript, "create", "trace/0", "python", "git://tsuruhost.com/trace.git")
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, expected)
+	placements, err := appPlacements("trace")
+	c.Assert(err, IsNil)
+	c.Assert(placements, HasLen, 1)
+}
+
+func (s *S) TestProvisionWithPlanAndUnitScript(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	config.Set("ssh:unit-script", "/opt/unit")
+	defer config.Unset("ssh:unit-script")
+	AddHost("10.10.10.1", 2)
+	app := provisiontest.NewFakeApp("trace", "python", 0)
+	app.SetPlan(provision.Plan{Name: "small", Memory: 512, CpuShare: 2})
+	p := SSHProvisioner{}
+	err = p.Provision(app)
+	c.Assert(err, IsNil)
+	expected := sshParams("tsuru@10.10.10.1", "/opt/unit", "create", "trace/0", "python",
+		"git://tsuruhost.com/trace.git", "--memory=512", "--cpu-share=2")
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, expected)
+}
+
+func (s *S) TestProvisionFailureFreesTheSlot(c *C) {
+	tmpdir, err := commandmocker.Error("ssh", "no space left", 1)
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	AddHost("10.10.10.1", 2)
+	app := provisiontest.NewFakeApp("trace", "python", 0)
+	p := SSHProvisioner{}
+	err = p.Provision(app)
+	pErr, ok := err.(*provision.Error)
+	c.Assert(ok, Equals, true)
+	c.Assert(pErr.Reason, Equals, "no space left")
+	hosts, err := ListHosts()
+	c.Assert(err, IsNil)
+	c.Assert(hosts[0].Units, HasLen, 0)
+}
+
+func (s *S) TestProvisionWithoutHosts(c *C) {
+	app := provisiontest.NewFakeApp("trace", "python", 0)
+	p := SSHProvisioner{}
+	err := p.Provision(app)
+	c.Assert(err, ErrorMatches, "^There is no room for 1 units in the host pool, only 0 slots are free.$")
+}
+
+func (s *S) TestAddUnitsSpreadsUnitsInTheHosts(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	AddHost("10.10.10.1", 2)
+	AddHost("10.10.10.2", 2)
+	app := provisiontest.NewFakeApp("trace", "python", 0)
+	p := SSHProvisioner{}
+	err = p.Provision(app)
+	c.Assert(err, IsNil)
+	units, err := p.AddUnits(app, 2, "web")
+	c.Assert(err, IsNil)
+	c.Assert(units, HasLen, 2)
+	c.Assert(units[0].Name, Equals, "trace/1")
+	c.Assert(units[0].Ip, Equals, "10.10.10.2")
+	c.Assert(units[0].Machine, Equals, 2)
+	c.Assert(units[1].Name, Equals, "trace/2")
+}
+
+func (s *S) TestAddUnitsOfAProcess(c *C) {
+	AddHost("10.10.10.1", 2)
+	app := provisiontest.NewFakeApp("trace", "python", 0)
+	p := SSHProvisioner{}
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, IsNil)
+	err = p.Provision(app)
+	commandmocker.Remove(tmpdir)
+	c.Assert(err, IsNil)
+	tmpdir, err = commandmocker.Add("ssh", "$*")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	units, err := p.AddUnits(app, 1, "worker")
+	c.Assert(err, IsNil)
+	c.Assert(units, HasLen, 1)
+	c.Assert(units[0].Process, Equals, "worker")
+	expected := sshParams("tsuru@10.10.10.1", defaultUnitScript, "create", "trace/1", "python",
+		"git://tsuruhost.com/trace.git", "--process=worker")
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, expected)
+	placements, err := appPlacements("trace")
+	c.Assert(err, IsNil)
+	c.Assert(placements, HasLen, 2)
+	c.Assert(placements[0].unit.Process, Equals, "web")
+	c.Assert(placements[1].unit.Process, Equals, "worker")
+}
+
+func (s *S) TestAddUnitsWithoutRoomDoesNotAddAnyUnit(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	AddHost("10.10.10.1", 2)
+	app := provisiontest.NewFakeApp("trace", "python", 0)
+	p := SSHProvisioner{}
+	p.Provision(app)
+	units, err := p.AddUnits(app, 2, "web")
+	c.Assert(units, IsNil)
+	c.Assert(err, NotNil)
+	placements, _ := appPlacements("trace")
+	c.Assert(placements, HasLen, 1)
+}
+
+func (s *S) TestAddUnitsToUnprovisionedApp(c *C) {
+	AddHost("10.10.10.1", 2)
+	app := provisiontest.NewFakeApp("trace", "python", 0)
+	p := SSHProvisioner{}
+	_, err := p.AddUnits(app, 1, "web")
+	c.Assert(err, ErrorMatches, "^App is not provisioned.$")
+}
+
+func (s *S) TestDestroy(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	hosts := []Host{
+		{Address: "10.10.10.1", Machine: 1, Capacity: 2, Units: []hostUnit{{Name: "trace/0", App: "trace"}}},
+		{Address: "10.10.10.2", Machine: 2, Capacity: 2, Units: []hostUnit{{Name: "trace/1", App: "trace"}, {Name: "other/0", App: "other"}}},
+	}
+	insertHosts(c, hosts)
+	app := provisiontest.NewFakeApp("trace", "python", 0)
+	p := SSHProvisioner{}
+	err = p.Destroy(app)
+	c.Assert(err, IsNil)
+	expected := sshParams("tsuru@10.10.10.1", defaultUnitScript, "destroy", "trace/0")
+	expected = append(expected, sshParams("tsuru@10.10.10.2", defaultUnitScript, "destroy", "trace/1")...)
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, expected)
+	hosts, err = ListHosts()
+	c.Assert(err, IsNil)
+	c.Assert(hosts[0].Units, HasLen, 0)
+	c.Assert(hosts[1].Units, DeepEquals, []hostUnit{{Name: "other/0", App: "other"}})
+}
+
+func (s *S) TestRemoveUnit(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	insertHosts(c, []Host{
+		{Address: "10.10.10.1", Machine: 1, Capacity: 2, Units: []hostUnit{{Name: "trace/0", App: "trace"}, {Name: "trace/1", App: "trace"}}},
+	})
+	app := provisiontest.NewFakeApp("trace", "python", 0)
+	p := SSHProvisioner{}
+	err = p.RemoveUnit(app, "trace/1")
+	c.Assert(err, IsNil)
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, sshParams("tsuru@10.10.10.1", defaultUnitScript, "destroy", "trace/1"))
+	placements, _ := appPlacements("trace")
+	c.Assert(placements, HasLen, 1)
+	c.Assert(placements[0].unit.Name, Equals, "trace/0")
+}
+
+func (s *S) TestRemoveUnknownUnit(c *C) {
+	app := provisiontest.NewFakeApp("trace", "python", 0)
+	p := SSHProvisioner{}
+	err := p.RemoveUnit(app, "trace/9")
+	c.Assert(err, ErrorMatches, `^App "trace" does not have a unit named "trace/9".$`)
+}
+
+func (s *S) TestRemoveAllUnits(c *C) {
+	app := provisiontest.NewFakeApp("trace", "python", 2)
+	p := SSHProvisioner{}
+	_, err := p.RemoveUnits(app, 2)
+	c.Assert(err, ErrorMatches, "^You can't remove all units from an app.$")
+}
+
+func (s *S) TestExecuteCommand(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	insertHosts(c, []Host{
+		{Address: "10.10.10.1", Machine: 1, Capacity: 2, Units: []hostUnit{{Name: "trace/0", App: "trace"}}},
+	})
+	var stdout, stderr bytes.Buffer
+	app := provisiontest.NewFakeApp("trace", "python", 1)
+	p := SSHProvisioner{}
+	err = p.ExecuteCommand(&stdout, &stderr, app, "ls", "-lh")
+	c.Assert(err, IsNil)
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, sshParams("tsuru@10.10.10.1", defaultUnitScript, "exec", "trace/0", "'ls -lh'"))
+}
+
+func (s *S) TestExecuteCommandQuotesTheCommand(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	insertHosts(c, []Host{
+		{Address: "10.10.10.1", Machine: 1, Capacity: 2, Units: []hostUnit{{Name: "trace/0", App: "trace"}}},
+	})
+	var stdout, stderr bytes.Buffer
+	app := provisiontest.NewFakeApp("trace", "python", 1)
+	p := SSHProvisioner{}
+	err = p.ExecuteCommand(&stdout, &stderr, app, "printf '%s' 'x' > /home/application/apprc")
+	c.Assert(err, IsNil)
+	expected := sshParams("tsuru@10.10.10.1", defaultUnitScript, "exec", "trace/0", `'printf '\''%s'\'' '\''x'\'' > /home/application/apprc'`)
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, expected)
+}
+
+func (s *S) TestExecuteCommandMultipleUnits(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "done")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	insertHosts(c, []Host{
+		{Address: "10.10.10.1", Machine: 1, Capacity: 2, Units: []hostUnit{{Name: "trace/0", App: "trace"}}},
+		{Address: "10.10.10.2", Machine: 2, Capacity: 2, Units: []hostUnit{{Name: "trace/1", App: "trace"}}},
+	})
+	var stdout, stderr bytes.Buffer
+	app := provisiontest.NewFakeApp("trace", "python", 2)
+	p := SSHProvisioner{}
+	err = p.ExecuteCommand(&stdout, &stderr, app, "ls")
+	c.Assert(err, IsNil)
+	expected := "Output from unit \"trace/0\":\n\ndone\n\nOutput from unit \"trace/1\":\n\ndone\n"
+	c.Assert(stdout.String(), Equals, expected)
+}
+
+func (s *S) TestExecuteCommandOnlyInTheGivenUnits(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	insertHosts(c, []Host{
+		{Address: "10.10.10.1", Machine: 1, Capacity: 2, Units: []hostUnit{{Name: "trace/0", App: "trace"}}},
+		{Address: "10.10.10.2", Machine: 2, Capacity: 2, Units: []hostUnit{{Name: "trace/1", App: "trace"}}},
+	})
+	var stdout, stderr bytes.Buffer
+	app := provisiontest.NewFakeApp("trace", "python", 1)
+	p := SSHProvisioner{}
+	err = p.ExecuteCommand(&stdout, &stderr, app, "ls")
+	c.Assert(err, IsNil)
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, sshParams("tsuru@10.10.10.1", defaultUnitScript, "exec", "trace/0", "'ls'"))
+}
+
+func (s *S) TestCollectStatus(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "trace/0 started\ntrace/1 installing\n")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	insertHosts(c, []Host{
+		{Address: "10.10.10.1", Machine: 1, Capacity: 4, Units: []hostUnit{
+			{Name: "trace/0", App: "trace", Type: "python"},
+			{Name: "trace/1", App: "trace", Type: "python"},
+			{Name: "trace/2", App: "trace", Type: "python"},
+		}},
+		{Address: "10.10.10.2", Machine: 2, Capacity: 4},
+	})
+	p := SSHProvisioner{}
+	units, err := p.CollectStatus()
+	c.Assert(err, IsNil)
+	expected := []provision.Unit{
+		{Name: "trace/0", AppName: "trace", Type: "python", Machine: 1, Ip: "10.10.10.1", Status: provision.StatusStarted},
+		{Name: "trace/1", AppName: "trace", Type: "python", Machine: 1, Ip: "10.10.10.1", Status: provision.StatusInstalling},
+		{Name: "trace/2", AppName: "trace", Type: "python", Machine: 1, Ip: "10.10.10.1", Status: provision.StatusPending},
+	}
+	c.Assert(units, DeepEquals, expected)
+	c.Assert(commandmocker.Parameters(tmpdir), DeepEquals, sshParams("tsuru@10.10.10.1", defaultUnitScript, "status"))
+}
+
+func (s *S) TestCollectStatusUnreachableHost(c *C) {
+	tmpdir, err := commandmocker.Error("ssh", "connection refused", 255)
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	insertHosts(c, []Host{
+		{Address: "10.10.10.1", Machine: 1, Capacity: 4, Units: []hostUnit{{Name: "trace/0", App: "trace", Type: "python"}}},
+	})
+	p := SSHProvisioner{}
+	units, err := p.CollectStatus()
+	c.Assert(err, IsNil)
+	c.Assert(units, HasLen, 1)
+	c.Assert(units[0].Status, Equals, provision.StatusDown)
+}
+
+func (s *S) TestProbeKillsHostsThatDontAnswerInTime(c *C) {
+	tmpdir, err := commandmocker.Add("ssh", "$(sleep 5)trace/0 started")
+	c.Assert(err, IsNil)
+	defer commandmocker.Remove(tmpdir)
+	probeTimeout = 1e8
+	defer func() { probeTimeout = 10e9 }()
+	start := time.Now()
+	statuses := probe(&Host{Address: "10.10.10.1"})
+	c.Assert(statuses, IsNil)
+	c.Assert(time.Since(start) < 2*time.Second, Equals, true)
+}
+
+func insertHosts(c *C, hosts []Host) {
+	for _, h := range hosts {
+		err := db.Session.Hosts().Insert(h)
+		c.Assert(err, IsNil)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	. "launchpad.net/gocheck"
+	"testing"
+)
+
+// Test opens the database before running the suites, because both S and the
+// conformance suite use it.
+func Test(t *testing.T) {
+	var err error
+	db.Session, err = db.Open("127.0.0.1:27017", "tsuru_ssh_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Session.Close()
+	defer db.Session.Hosts().Database.DropDatabase()
+	config.Set("git:host", "tsuruhost.com")
+	config.Set("ssh:user", "tsuru")
+	config.Set("ssh:key", "/home/tsuru/.ssh/id_rsa")
+	TestingT(t)
+}
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (s *S) TearDownTest(c *C) {
+	db.Session.Hosts().RemoveAll(nil)
+	db.Session.UnitCounters().RemoveAll(nil)
+}
@@ -0,0 +1,253 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package nginx implements a router that writes the routes of all apps to an
+// nginx configuration file, reloading nginx after each change.
+//
+// The router is configured in the "nginx" section of tsuru.conf:
+//
+//	router: nginx
+//	nginx:
+//	  domain: cloud.company.com
+//	  config-file: /etc/nginx/sites-enabled/tsuru
+//	  reload-command: sudo service nginx reload
+//	  maintenance-page: /etc/nginx/maintenance.html
+//
+// Each app is reachable at <app-name>.<domain>, and through its CNames. The
+// routes are stored in MongoDB, so the file can be rebuilt from any tsuru
+// server.
+//
+// Apps in maintenance mode are answered with the status 503, and the content of
+// the maintenance page, when one is configured.
+package nginx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/router"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"text/template"
+)
+
+const defaultConfigFile = "/etc/nginx/sites-enabled/tsuru"
+
+var configTemplate = template.Must(template.New("nginx").Parse(`# This file is generated by tsuru. Do not edit.
+{{range .}}{{if .Maintenance}}
+server {
+    listen 80;
+    server_name {{.Host}}{{range .CNames}} {{.}}{{end}};
+{{with .Page}}    error_page 503 /{{.File}};
+    location = /{{.File}} {
+        root {{.Dir}};
+        internal;
+    }
+{{end}}    location / {
+        return 503;
+    }
+}
+{{else}}
+upstream {{.Name}} {
+{{range .Addresses}}    server {{.}};
+{{end}}}
+
+server {
+    listen 80;
+    server_name {{.Host}}{{range .CNames}} {{.}}{{end}};
+    location / {
+        proxy_pass http://{{.Name}};
+        proxy_set_header Host $host;
+    }
+}
+{{end}}{{end}}`))
+
+// maintenancePage is the static page served by nginx for the apps in
+// maintenance mode.
+type maintenancePage struct {
+	Dir  string
+	File string
+}
+
+// backend is an app registered in the router.
+type backend struct {
+	Name        string `bson:"_id"`
+	Addresses   []string
+	CNames      []string
+	Maintenance bool
+	Host        string           `bson:"-"`
+	Page        *maintenancePage `bson:"-"`
+}
+
+// NginxRouter is an implementation for the Router interface that manages an
+// nginx configuration file.
+type NginxRouter struct {
+	// mut serializes the writes to the configuration file.
+	mut sync.Mutex
+}
+
+func init() {
+	router.Register("nginx", &NginxRouter{})
+}
+
+func domain() (string, error) {
+	d, err := config.GetString("nginx:domain")
+	if err != nil {
+		return "", errors.New("nginx:domain is not defined in the configuration file.")
+	}
+	return d, nil
+}
+
+// update applies the given change to the backend and rewrites the
+// configuration file.
+func (r *NginxRouter) update(name string, change bson.M) error {
+	err := db.Session.Routes().UpdateId(name, change)
+	if err == mgo.ErrNotFound {
+		return router.ErrBackendNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return r.write()
+}
+
+// write renders the configuration of all backends with routes to a temporary
+// file, moves it over the configuration file and reloads nginx. Moving the
+// file ensures nginx never reads a partially written configuration.
+func (r *NginxRouter) write() error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	d, err := domain()
+	if err != nil {
+		return err
+	}
+	var backends []backend
+	query := bson.M{"$or": []bson.M{
+		{"addresses.0": bson.M{"$exists": true}},
+		{"maintenance": true},
+	}}
+	err = db.Session.Routes().Find(query).Sort("_id").All(&backends)
+	if err != nil {
+		return err
+	}
+	var page *maintenancePage
+	if p, err := config.GetString("nginx:maintenance-page"); err == nil {
+		page = &maintenancePage{Dir: filepath.Dir(p), File: filepath.Base(p)}
+	}
+	for i := range backends {
+		backends[i].Host = backends[i].Name + "." + d
+		backends[i].Page = page
+	}
+	var buf bytes.Buffer
+	if err = configTemplate.Execute(&buf, backends); err != nil {
+		return err
+	}
+	path, err := config.GetString("nginx:config-file")
+	if err != nil {
+		path = defaultConfigFile
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	f.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return reload()
+}
+
+func reload() error {
+	command, err := config.GetString("nginx:reload-command")
+	if err != nil {
+		return nil
+	}
+	out, err := exec.Command("sh", "-c", command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Failed to reload nginx: %s. Output: %s", err, out)
+	}
+	return nil
+}
+
+func (r *NginxRouter) AddBackend(name string) error {
+	n, err := db.Session.Routes().FindId(name).Count()
+	if err != nil || n > 0 {
+		return err
+	}
+	return db.Session.Routes().Insert(backend{Name: name})
+}
+
+func (r *NginxRouter) RemoveBackend(name string) error {
+	err := db.Session.Routes().RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return router.ErrBackendNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return r.write()
+}
+
+func (r *NginxRouter) AddRoute(name, address string) error {
+	return r.update(name, bson.M{"$addToSet": bson.M{"addresses": address}})
+}
+
+func (r *NginxRouter) RemoveRoute(name, address string) error {
+	return r.update(name, bson.M{"$pull": bson.M{"addresses": address}})
+}
+
+func (r *NginxRouter) Routes(name string) ([]string, error) {
+	var b backend
+	err := db.Session.Routes().FindId(name).One(&b)
+	if err == mgo.ErrNotFound {
+		return nil, router.ErrBackendNotFound
+	}
+	return b.Addresses, err
+}
+
+func (r *NginxRouter) SetCName(cname, name string) error {
+	n, err := db.Session.Routes().Find(bson.M{"cnames": cname}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return router.ErrCNameExists
+	}
+	return r.update(name, bson.M{"$addToSet": bson.M{"cnames": cname}})
+}
+
+func (r *NginxRouter) UnsetCName(cname, name string) error {
+	n, err := db.Session.Routes().Find(bson.M{"_id": name, "cnames": cname}).Count()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return router.ErrCNameNotFound
+	}
+	return r.update(name, bson.M{"$pull": bson.M{"cnames": cname}})
+}
+
+func (r *NginxRouter) Addr(name string) (string, error) {
+	d, err := domain()
+	if err != nil {
+		return "", err
+	}
+	return name + "." + d, nil
+}
+
+func (r *NginxRouter) SetMaintenance(name string, on bool) error {
+	return r.update(name, bson.M{"$set": bson.M{"maintenance": on}})
+}
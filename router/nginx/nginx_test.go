@@ -0,0 +1,239 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nginx
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/router"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"path"
+)
+
+func (s *S) TestNginxRouterIsRegistered(c *C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, IsNil)
+	c.Assert(r, FitsTypeOf, &NginxRouter{})
+}
+
+func (s *S) TestAddBackend(c *C) {
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	routes, err := r.Routes("myapp")
+	c.Assert(err, IsNil)
+	c.Assert(routes, HasLen, 0)
+}
+
+func (s *S) TestAddBackendTwice(c *C) {
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	n, err := db.Session.Routes().FindId("myapp").Count()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+}
+
+func (s *S) TestAddRouteWritesTheConfigFile(c *C) {
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.AddRoute("myapp", "10.10.10.10")
+	c.Assert(err, IsNil)
+	err = r.AddRoute("myapp", "10.10.10.11")
+	c.Assert(err, IsNil)
+	err = r.SetCName("myapp.com", "myapp")
+	c.Assert(err, IsNil)
+	err = r.AddBackend("empty")
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(s.configFile)
+	c.Assert(err, IsNil)
+	expected := `# This file is generated by tsuru. Do not edit.
+
+upstream myapp {
+    server 10.10.10.10;
+    server 10.10.10.11;
+}
+
+server {
+    listen 80;
+    server_name myapp.cloud.tsuru.io myapp.com;
+    location / {
+        proxy_pass http://myapp;
+        proxy_set_header Host $host;
+    }
+}
+`
+	c.Assert(string(content), Equals, expected)
+}
+
+func (s *S) TestAddRouteIsIdempotent(c *C) {
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.AddRoute("myapp", "10.10.10.10")
+	c.Assert(err, IsNil)
+	err = r.AddRoute("myapp", "10.10.10.10")
+	c.Assert(err, IsNil)
+	routes, err := r.Routes("myapp")
+	c.Assert(err, IsNil)
+	c.Assert(routes, DeepEquals, []string{"10.10.10.10"})
+}
+
+func (s *S) TestAddRouteToUnknownBackend(c *C) {
+	r := NginxRouter{}
+	err := r.AddRoute("unknown", "10.10.10.10")
+	c.Assert(err, Equals, router.ErrBackendNotFound)
+}
+
+func (s *S) TestRemoveRoute(c *C) {
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.AddRoute("myapp", "10.10.10.10")
+	c.Assert(err, IsNil)
+	err = r.RemoveRoute("myapp", "10.10.10.10")
+	c.Assert(err, IsNil)
+	routes, err := r.Routes("myapp")
+	c.Assert(err, IsNil)
+	c.Assert(routes, HasLen, 0)
+	content, err := ioutil.ReadFile(s.configFile)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "# This file is generated by tsuru. Do not edit.\n")
+}
+
+func (s *S) TestRemoveBackend(c *C) {
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.RemoveBackend("myapp")
+	c.Assert(err, IsNil)
+	_, err = r.Routes("myapp")
+	c.Assert(err, Equals, router.ErrBackendNotFound)
+	err = r.RemoveBackend("myapp")
+	c.Assert(err, Equals, router.ErrBackendNotFound)
+}
+
+func (s *S) TestSetCNameUsedByAnotherApp(c *C) {
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.AddBackend("otherapp")
+	c.Assert(err, IsNil)
+	err = r.SetCName("myapp.com", "myapp")
+	c.Assert(err, IsNil)
+	err = r.SetCName("myapp.com", "otherapp")
+	c.Assert(err, Equals, router.ErrCNameExists)
+}
+
+func (s *S) TestUnsetCName(c *C) {
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.SetCName("myapp.com", "myapp")
+	c.Assert(err, IsNil)
+	err = r.UnsetCName("myapp.com", "myapp")
+	c.Assert(err, IsNil)
+	err = r.UnsetCName("myapp.com", "myapp")
+	c.Assert(err, Equals, router.ErrCNameNotFound)
+}
+
+func (s *S) TestReloadCommandIsRunAfterWriting(c *C) {
+	out := path.Join(s.tmpdir, "reloaded")
+	config.Set("nginx:reload-command", "cp "+s.configFile+" "+out)
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.AddRoute("myapp", "10.10.10.10")
+	c.Assert(err, IsNil)
+	expected, err := ioutil.ReadFile(s.configFile)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(out)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, string(expected))
+}
+
+func (s *S) TestReloadCommandFailure(c *C) {
+	config.Set("nginx:reload-command", "exit 1")
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.AddRoute("myapp", "10.10.10.10")
+	c.Assert(err, NotNil)
+}
+
+func (s *S) TestAddr(c *C) {
+	r := NginxRouter{}
+	addr, err := r.Addr("myapp")
+	c.Assert(err, IsNil)
+	c.Assert(addr, Equals, "myapp.cloud.tsuru.io")
+}
+
+func (s *S) TestSetMaintenance(c *C) {
+	config.Set("nginx:maintenance-page", "/etc/nginx/maintenance.html")
+	defer config.Unset("nginx:maintenance-page")
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.AddRoute("myapp", "10.10.10.10")
+	c.Assert(err, IsNil)
+	err = r.SetCName("myapp.com", "myapp")
+	c.Assert(err, IsNil)
+	err = r.SetMaintenance("myapp", true)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(s.configFile)
+	c.Assert(err, IsNil)
+	expected := `# This file is generated by tsuru. Do not edit.
+
+server {
+    listen 80;
+    server_name myapp.cloud.tsuru.io myapp.com;
+    error_page 503 /maintenance.html;
+    location = /maintenance.html {
+        root /etc/nginx;
+        internal;
+    }
+    location / {
+        return 503;
+    }
+}
+`
+	c.Assert(string(content), Equals, expected)
+	err = r.SetMaintenance("myapp", false)
+	c.Assert(err, IsNil)
+	content, err = ioutil.ReadFile(s.configFile)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Matches, `(?s).*proxy_pass http://myapp;.*`)
+}
+
+func (s *S) TestSetMaintenanceWithoutPage(c *C) {
+	r := NginxRouter{}
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.SetMaintenance("myapp", true)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(s.configFile)
+	c.Assert(err, IsNil)
+	expected := `# This file is generated by tsuru. Do not edit.
+
+server {
+    listen 80;
+    server_name myapp.cloud.tsuru.io;
+    location / {
+        return 503;
+    }
+}
+`
+	c.Assert(string(content), Equals, expected)
+}
+
+func (s *S) TestSetMaintenanceOfUnknownBackend(c *C) {
+	r := NginxRouter{}
+	err := r.SetMaintenance("unknown", true)
+	c.Assert(err, Equals, router.ErrBackendNotFound)
+}
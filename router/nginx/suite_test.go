@@ -0,0 +1,48 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nginx
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"os"
+	"path"
+	"testing"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type S struct {
+	tmpdir     string
+	configFile string
+}
+
+var _ = Suite(&S{})
+
+func (s *S) SetUpSuite(c *C) {
+	var err error
+	db.Session, err = db.Open("127.0.0.1:27017", "tsuru_router_nginx_test")
+	c.Assert(err, IsNil)
+	s.tmpdir, err = ioutil.TempDir("", "tsuru-nginx")
+	c.Assert(err, IsNil)
+	s.configFile = path.Join(s.tmpdir, "tsuru")
+	config.Set("nginx:domain", "cloud.tsuru.io")
+	config.Set("nginx:config-file", s.configFile)
+}
+
+func (s *S) TearDownSuite(c *C) {
+	db.Session.Routes().Database.DropDatabase()
+	db.Session.Close()
+	os.RemoveAll(s.tmpdir)
+	config.Unset("nginx")
+}
+
+func (s *S) TearDownTest(c *C) {
+	_, err := db.Session.Routes().RemoveAll(nil)
+	c.Assert(err, IsNil)
+	config.Unset("nginx:reload-command")
+}
@@ -0,0 +1,83 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package router provides interfaces that need to be satisfied in order to
+// implement a new router on tsuru.
+//
+// A router receives the requests sent to an app and forwards them to its
+// units. Each app is registered in the router as a backend, reachable through
+// a stable address, and may have custom domains (CNAMEs) pointing to it.
+package router
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrBackendNotFound = errors.New("Backend not found.")
+	ErrCNameExists     = errors.New("CName already exists.")
+	ErrCNameNotFound   = errors.New("CName not found.")
+)
+
+// Router is the basic interface of this package. It manages the backends
+// (apps), their routes (units) and their CNames.
+type Router interface {
+	// AddBackend registers an app in the router. The app becomes
+	// reachable through the address returned by Addr, once it has
+	// routes.
+	AddBackend(name string) error
+
+	// RemoveBackend removes an app from the router, along with its routes
+	// and CNames.
+	RemoveBackend(name string) error
+
+	// AddRoute adds a new route to the app, which is the address of one of
+	// its units. Adding an existing route is not an error.
+	AddRoute(name, address string) error
+
+	// RemoveRoute removes a route from the app. Removing an unknown route
+	// is not an error.
+	RemoveRoute(name, address string) error
+
+	// Routes returns the routes of the app.
+	Routes(name string) ([]string, error)
+
+	// SetCName makes the app reachable through the given domain. A CName
+	// belongs to a single app.
+	SetCName(cname, name string) error
+
+	// UnsetCName removes a CName from the app.
+	UnsetCName(cname, name string) error
+
+	// Addr returns the stable address of the app in the router.
+	Addr(name string) (string, error)
+}
+
+// MaintenanceRouter is a router that can serve a maintenance page for the apps
+// in maintenance mode, instead of forwarding their requests to the units.
+//
+// Implementing this interface is optional.
+type MaintenanceRouter interface {
+	Router
+
+	// SetMaintenance turns the maintenance page of the app on or off.
+	SetMaintenance(name string, on bool) error
+}
+
+var routers = make(map[string]Router)
+
+// Register registers a new router in the Router registry.
+func Register(name string, r Router) {
+	routers[name] = r
+}
+
+// Get gets the named router from the registry.
+func Get(name string) (Router, error) {
+	r, ok := routers[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown router: %q.", name)
+	}
+	return r, nil
+}
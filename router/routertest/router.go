@@ -0,0 +1,178 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package routertest provides a fake router, registered as "fake", for tests
+// and for the binaries built with the fake tag.
+package routertest
+
+import (
+	"github.com/globocom/tsuru/router"
+	"sort"
+	"sync"
+)
+
+func init() {
+	router.Register("fake", NewFakeRouter())
+}
+
+type fakeBackend struct {
+	routes      map[string]bool
+	cnames      map[string]bool
+	maintenance bool
+}
+
+// FakeRouter is a fake implementation for router.MaintenanceRouter, that keeps
+// the routes in memory.
+type FakeRouter struct {
+	backends map[string]*fakeBackend
+	mut      sync.Mutex
+}
+
+func NewFakeRouter() *FakeRouter {
+	return &FakeRouter{backends: make(map[string]*fakeBackend)}
+}
+
+// HasBackend checks whether the given app is registered in the router.
+func (r *FakeRouter) HasBackend(name string) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	_, ok := r.backends[name]
+	return ok
+}
+
+// HasRoute checks whether the app has a route to the given address.
+func (r *FakeRouter) HasRoute(name, address string) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	b, ok := r.backends[name]
+	return ok && b.routes[address]
+}
+
+// HasCName checks whether the given CName points to the app.
+func (r *FakeRouter) HasCName(cname, name string) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	b, ok := r.backends[name]
+	return ok && b.cnames[cname]
+}
+
+// InMaintenance checks whether the router serves the maintenance page of the
+// app.
+func (r *FakeRouter) InMaintenance(name string) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	b, ok := r.backends[name]
+	return ok && b.maintenance
+}
+
+// Reset removes all backends from the router.
+func (r *FakeRouter) Reset() {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.backends = make(map[string]*fakeBackend)
+}
+
+func (r *FakeRouter) AddBackend(name string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if _, ok := r.backends[name]; !ok {
+		r.backends[name] = &fakeBackend{routes: make(map[string]bool), cnames: make(map[string]bool)}
+	}
+	return nil
+}
+
+func (r *FakeRouter) RemoveBackend(name string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if _, ok := r.backends[name]; !ok {
+		return router.ErrBackendNotFound
+	}
+	delete(r.backends, name)
+	return nil
+}
+
+func (r *FakeRouter) AddRoute(name, address string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	b, ok := r.backends[name]
+	if !ok {
+		return router.ErrBackendNotFound
+	}
+	b.routes[address] = true
+	return nil
+}
+
+func (r *FakeRouter) RemoveRoute(name, address string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	b, ok := r.backends[name]
+	if !ok {
+		return router.ErrBackendNotFound
+	}
+	delete(b.routes, address)
+	return nil
+}
+
+func (r *FakeRouter) Routes(name string) ([]string, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	b, ok := r.backends[name]
+	if !ok {
+		return nil, router.ErrBackendNotFound
+	}
+	var routes []string
+	for address := range b.routes {
+		routes = append(routes, address)
+	}
+	sort.Strings(routes)
+	return routes, nil
+}
+
+func (r *FakeRouter) SetCName(cname, name string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	b, ok := r.backends[name]
+	if !ok {
+		return router.ErrBackendNotFound
+	}
+	for _, other := range r.backends {
+		if other.cnames[cname] {
+			return router.ErrCNameExists
+		}
+	}
+	b.cnames[cname] = true
+	return nil
+}
+
+func (r *FakeRouter) UnsetCName(cname, name string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	b, ok := r.backends[name]
+	if !ok {
+		return router.ErrBackendNotFound
+	}
+	if !b.cnames[cname] {
+		return router.ErrCNameNotFound
+	}
+	delete(b.cnames, cname)
+	return nil
+}
+
+func (r *FakeRouter) Addr(name string) (string, error) {
+	if !r.HasBackend(name) {
+		return "", router.ErrBackendNotFound
+	}
+	return name + ".fakerouter.com", nil
+}
+
+func (r *FakeRouter) SetMaintenance(name string, on bool) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	b, ok := r.backends[name]
+	if !ok {
+		return router.ErrBackendNotFound
+	}
+	b.maintenance = on
+	return nil
+}
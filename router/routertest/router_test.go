@@ -0,0 +1,86 @@
+// Copyright 2012 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package routertest
+
+import (
+	"github.com/globocom/tsuru/router"
+	. "launchpad.net/gocheck"
+)
+
+func (s *S) TestFakeRouterIsRegistered(c *C) {
+	r, err := router.Get("fake")
+	c.Assert(err, IsNil)
+	c.Assert(r, FitsTypeOf, &FakeRouter{})
+}
+
+func (s *S) TestFakeRouterAddBackend(c *C) {
+	r := NewFakeRouter()
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	c.Assert(r.HasBackend("myapp"), Equals, true)
+	addr, err := r.Addr("myapp")
+	c.Assert(err, IsNil)
+	c.Assert(addr, Equals, "myapp.fakerouter.com")
+}
+
+func (s *S) TestFakeRouterRemoveBackend(c *C) {
+	r := NewFakeRouter()
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.RemoveBackend("myapp")
+	c.Assert(err, IsNil)
+	c.Assert(r.HasBackend("myapp"), Equals, false)
+	err = r.RemoveBackend("myapp")
+	c.Assert(err, Equals, router.ErrBackendNotFound)
+}
+
+func (s *S) TestFakeRouterRoutes(c *C) {
+	r := NewFakeRouter()
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.AddRoute("myapp", "10.10.10.11")
+	c.Assert(err, IsNil)
+	err = r.AddRoute("myapp", "10.10.10.10")
+	c.Assert(err, IsNil)
+	c.Assert(r.HasRoute("myapp", "10.10.10.10"), Equals, true)
+	routes, err := r.Routes("myapp")
+	c.Assert(err, IsNil)
+	c.Assert(routes, DeepEquals, []string{"10.10.10.10", "10.10.10.11"})
+	err = r.RemoveRoute("myapp", "10.10.10.10")
+	c.Assert(err, IsNil)
+	c.Assert(r.HasRoute("myapp", "10.10.10.10"), Equals, false)
+	err = r.AddRoute("unknown", "10.10.10.10")
+	c.Assert(err, Equals, router.ErrBackendNotFound)
+}
+
+func (s *S) TestFakeRouterCNames(c *C) {
+	r := NewFakeRouter()
+	r.AddBackend("myapp")
+	r.AddBackend("otherapp")
+	err := r.SetCName("myapp.com", "myapp")
+	c.Assert(err, IsNil)
+	c.Assert(r.HasCName("myapp.com", "myapp"), Equals, true)
+	err = r.SetCName("myapp.com", "otherapp")
+	c.Assert(err, Equals, router.ErrCNameExists)
+	err = r.UnsetCName("myapp.com", "myapp")
+	c.Assert(err, IsNil)
+	c.Assert(r.HasCName("myapp.com", "myapp"), Equals, false)
+	err = r.UnsetCName("myapp.com", "myapp")
+	c.Assert(err, Equals, router.ErrCNameNotFound)
+}
+
+func (s *S) TestFakeRouterMaintenance(c *C) {
+	var r router.MaintenanceRouter = NewFakeRouter()
+	err := r.AddBackend("myapp")
+	c.Assert(err, IsNil)
+	err = r.SetMaintenance("myapp", true)
+	c.Assert(err, IsNil)
+	c.Assert(r.(*FakeRouter).InMaintenance("myapp"), Equals, true)
+	err = r.SetMaintenance("myapp", false)
+	c.Assert(err, IsNil)
+	c.Assert(r.(*FakeRouter).InMaintenance("myapp"), Equals, false)
+	err = r.SetMaintenance("unknown", true)
+	c.Assert(err, Equals, router.ErrBackendNotFound)
+}